@@ -0,0 +1,118 @@
+import { readFileSync } from "fs";
+import type { Config } from "./config.js";
+
+export const SERVICE_NAME = "zoom-oauth-server";
+
+// package.json sits next to src/ when run from source and two levels up when built into dist/src/
+function readVersion(): string {
+  for (const path of ["../package.json", "../../package.json"]) {
+    try {
+      const manifest = JSON.parse(readFileSync(new URL(path, import.meta.url), "utf8")) as { name?: string; version?: string };
+      if (manifest.name === SERVICE_NAME && manifest.version) return manifest.version;
+    } catch {
+      // not there, try the next one
+    }
+  }
+  return "unknown";
+}
+
+export const SERVICE_VERSION = readVersion();
+
+/** The User-Agent outbound requests carry unless USER_AGENT replaces it, e.g. zoom-oauth-server/1.2.0 (instance web-1). */
+export function defaultUserAgent(instanceId: string): string {
+  return `${SERVICE_NAME}/${SERVICE_VERSION} (instance ${instanceId})`;
+}
+
+// the region in a Recall API host such as us-east-1.recall.ai, or the host itself
+function recallRegion(apiBaseUrl: string): string {
+  const host = new URL(apiBaseUrl).hostname;
+  return /^([a-z]+-[a-z]+-\d+)\.recall\.ai$/.exec(host)?.[1] ?? host;
+}
+
+/**
+ * What GET /about says about this instance: which service and version it
+ * is, what is enabled and served, and how each part expects callers to
+ * authenticate. Secrets, keys, user IDs and store locations are never part
+ * of it.
+ */
+export function aboutJSON(config: Config): Record<string, unknown> {
+  const providers = ["zoom", ...(config.teamsClientId ? ["teams"] : []), ...(config.googleClientId ? ["google"] : [])];
+  const refused = config.defaultSecretPolicy === "refuse" && config.recallCallbackSecretSource === "default";
+
+  const endpoints = ["/about", "/me", "/launch", "/readyz", "/metrics"];
+  if (!config.zoomAccountId) endpoints.push("/zoom/oauth", "/zoom/oauth-callback");
+  endpoints.push("/recall/oauth-callback", "/recall/obf-callback", "/recall/zak-callback", "/recall/meeting");
+  if (config.proxyTokens) endpoints.push("/recall/token-exchange");
+  for (const provider of providers.filter((name) => name !== "zoom")) {
+    endpoints.push(`/${provider}/oauth`, `/${provider}/oauth-callback`, `/recall/${provider}/oauth-callback`);
+  }
+  if (config.brandingConfig) endpoints.push("/connect");
+  if (config.zoomWebhookSecretToken) endpoints.push("/zoom/webhooks");
+  if (config.recallWebhookSecret) endpoints.push("/recall/webhooks");
+  if (config.slackSigningSecret) endpoints.push("/slack/commands");
+  if (config.brokerConfig) endpoints.push("/broker/token", "/broker/obf", "/broker/zak");
+  if (config.tenants.length > 0) endpoints.push("/t/*/zoom/oauth", "/t/*/zoom/oauth-callback", "/t/*/recall/*");
+  if (config.adminApiKey) endpoints.push("/admin/*");
+  if (config.faultInjectionEnabled) endpoints.push("/debug/faults");
+
+  const auth: Record<string, string> = {
+    recall_callbacks: refused ? "refused until RECALL_CALLBACK_SECRET is set" : "auth_token query parameter",
+    consent: config.zoomAccountId ? "none, server-to-server oauth" : "zoom oauth",
+  };
+  if (config.adminApiKey) auth.admin = "bearer token";
+  if (config.brokerConfig) auth.broker = "per-client bearer token";
+  if (config.zoomWebhookSecretToken) auth.zoom_webhooks = "zoom webhook signature";
+  if (config.recallWebhookSecret) auth.recall_webhooks = "svix webhook signature";
+  if (config.slackSigningSecret) auth.slack = "slack request signature";
+  if (config.grpcPort !== null) auth.grpc = "mutual tls";
+
+  return {
+    service: SERVICE_NAME,
+    version: SERVICE_VERSION,
+    instance_id: config.instanceId,
+    base_url: config.baseUrl,
+    providers,
+    features: {
+      zoom_app_type: config.zoomAccountId ? "server-to-server" : "user",
+      // selected with ?app= on /zoom/oauth and the Recall callbacks
+      zoom_apps: config.zoomApps.map((zoomApp) => zoomApp.name),
+      // how many, the names can be customers'
+      tenants: config.tenants.length,
+      token_store: config.tokenStore,
+      token_encryption: config.tokenEncryptionProvider !== null,
+      token_encryption_provider: config.tokenEncryptionProvider,
+      proxy_tokens: config.proxyTokens,
+      resolve_meeting_hosts: config.resolveMeetingHosts,
+      resolve_meeting_occurrences: config.resolveMeetingOccurrences,
+      resolve_personal_meetings: config.resolvePersonalMeetings,
+      // users can always be given callback secrets of their own; "required" refuses the shared one
+      user_callback_secrets: config.requireUserCallbackSecrets ? "required" : "optional",
+      // tokens for hosts who never connected, minted with an account admin's
+      account_admin_minting: Boolean(config.zoomAccountAdminUserId),
+      // where the admin API's mappings of bots and hosts to users are kept
+      user_mappings: config.userMappingsFile ? "file" : "memory",
+      recall_response_format: config.recallResponseFormat,
+      zak_meeting_passcodes: config.zakMeetingPasscodes,
+      stale_token_policy: config.staleTokenPolicy,
+      auto_admit: config.autoAdmitBotNames.length > 0,
+      branding: Boolean(config.brandingConfig),
+      consent_return_to: config.consentReturnHosts.length > 0,
+      consent_sessions: config.consentSessionTtlMs > 0,
+      token_broker: Boolean(config.brokerConfig),
+      notifiers: [
+        ...(config.webhookUrls.length > 0 ? ["webhook"] : []),
+        ...(config.slackAlertWebhookUrl ? ["slack"] : []),
+        ...(config.smtpUrl ? ["email"] : []),
+        ...(config.pagerdutyRoutingKey ? ["pagerduty"] : []),
+      ],
+      grpc: config.grpcPort !== null,
+      fault_injection: config.faultInjectionEnabled,
+    },
+    regions: {
+      recall: recallRegion(config.recallApiBaseUrl),
+      zoom_api: new URL(config.zoomApiBaseUrl).hostname,
+    },
+    endpoints,
+    auth,
+  };
+}
@@ -0,0 +1,666 @@
+import { timingSafeEqual } from "crypto";
+import express from "express";
+import type { AuditLog } from "./audit.js";
+import type { Canaries } from "./canaries.js";
+import type { CallerLog } from "./callers.js";
+import type { DeadLetters } from "./deadletters.js";
+import type { BotIdentityLog } from "./identities.js";
+import { normalizeMappingMatch, USER_MAPPING_KINDS } from "./mappings.js";
+import type { UserMappingKind, UserMappings } from "./mappings.js";
+import { parseInviteesCsv, validateInvitees } from "./onboarding.js";
+import type { Invitations } from "./onboarding.js";
+import type { RemovedUsers } from "./removals.js";
+import type { Retention } from "./retention.js";
+import { latencySloJSON } from "./slo.js";
+import type { LatencySlos } from "./slo.js";
+import type { SupportBundle } from "./support.js";
+import { HttpError, ISSUANCE_WINDOW_MS, meetingIdFromUrl, meetingJSON, parseMeetingId, parseScopes } from "./zoomrecall/index.js";
+import type { IssuancePolicy, TokenManager, TokenStatus, ZoomProfile } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+export interface AdminRouterOptions {
+  tokens: TokenManager;
+  audit: AuditLog;
+  policy: IssuancePolicy;
+  identities: BotIdentityLog;
+  callers: CallerLog;
+  canaries: Canaries;
+  retention: Retention;
+  removedUsers: RemovedUsers;
+  userMappings: UserMappings;
+  deadLetters: DeadLetters;
+  invitations: Invitations;
+  supportBundle: SupportBundle;
+  slos: LatencySlos;
+}
+
+function safeEqual(a: string, b: string): boolean {
+  const left = Buffer.from(a);
+  const right = Buffer.from(b);
+  return left.length === right.length && timingSafeEqual(left, right);
+}
+
+/** Rejects requests that don't carry `Authorization: Bearer <adminApiKey>`. */
+export function requireAdminKey(adminApiKey: string): express.RequestHandler {
+  return (req, res, next) => {
+    const provided = req.headers.authorization?.replace(/^Bearer /, "") ?? "";
+    if (!adminApiKey || !safeEqual(provided, adminApiKey)) {
+      writeError(req, res, new HttpError(401, "admin API key is missing or incorrect"));
+      return;
+    }
+    next();
+  };
+}
+
+// profile is who the user is connected as at Zoom, as far as it is known
+export function tokenStatusJSON(status: TokenStatus, profile: ZoomProfile = {}): Record<string, unknown> {
+  return {
+    user_id: status.userId,
+    expires_at: status.expiresAt.toISOString(),
+    next_refresh_at: status.nextRefreshAt?.toISOString() ?? null,
+    last_refreshed_at: status.lastRefreshedAt?.toISOString() ?? null,
+    needs_reauthorization: status.needsReauthorization,
+    deactivated: status.deactivated,
+    scopes: status.scopes,
+    missing_scopes: status.missingScopes,
+    consented_at: status.consentedAt?.toISOString() ?? null,
+    refresh_token_issued_at: status.refreshTokenIssuedAt?.toISOString() ?? null,
+    reauthorization_due_at: status.reauthorizationDueAt?.toISOString() ?? null,
+    token_type: status.tokenType,
+    api_url: status.apiUrl,
+    refresh_failures: status.refreshFailures,
+    zoom_user_id: profile.zoomUserId ?? null,
+    email: profile.email ?? null,
+    account_id: profile.accountId ?? null,
+    time_zone: profile.timeZone ?? null,
+    name: profile.name ?? null,
+  };
+}
+
+// one connected user at a glance: who they are at Zoom, what they granted, since when, and whether their token works
+function connectedUserJSON(status: TokenStatus, profile: ZoomProfile): Record<string, unknown> {
+  const state = status.deactivated
+    ? "deactivated"
+    : status.needsReauthorization
+      ? "needs_reauthorization"
+      : status.expiresAt.getTime() <= Date.now()
+        ? "expired"
+        : "ok";
+  return {
+    user_id: status.userId,
+    email: profile.email ?? null,
+    zoom_user_id: profile.zoomUserId ?? null,
+    scopes: status.scopes,
+    connected_at: status.consentedAt?.toISOString() ?? null,
+    expires_at: status.expiresAt.toISOString(),
+    state,
+  };
+}
+
+// the columns of an export, in order; the CSV and JSON exports hold the same fields
+const EXPORT_COLUMNS = [
+  "user_id",
+  "email",
+  "name",
+  "zoom_user_id",
+  "account_id",
+  "scopes",
+  "connected_at",
+  "last_refreshed_at",
+  "last_refresh_status",
+  "refresh_failures",
+  "state",
+] as const;
+
+// one connected user for reconciling against a CRM: connectedUserJSON with how their last refresh went, never a token
+function exportedUserJSON(status: TokenStatus, profile: ZoomProfile): Record<(typeof EXPORT_COLUMNS)[number], unknown> {
+  const { user_id, email, zoom_user_id, scopes, connected_at, state } = connectedUserJSON(status, profile);
+  return {
+    user_id,
+    email,
+    name: profile.name ?? null,
+    zoom_user_id,
+    account_id: profile.accountId ?? null,
+    scopes,
+    connected_at,
+    last_refreshed_at: status.lastRefreshedAt?.toISOString() ?? null,
+    // failures are counted since the last refresh that worked
+    last_refresh_status: status.refreshFailures > 0 ? "failed" : status.lastRefreshedAt ? "succeeded" : "none",
+    refresh_failures: status.refreshFailures,
+    state,
+  };
+}
+
+function csvField(value: unknown): string {
+  let text = value === null || value === undefined ? "" : Array.isArray(value) ? value.join(" ") : String(value);
+  // spreadsheets run cells starting with these as formulas, and names come from Zoom profiles
+  if (/^[=+\-@\t\r]/.test(text)) text = `'${text}`;
+  return /[",\r\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
+
+/** Operator endpoints; mount behind requireAdminKey. */
+export function createAdminRouter(options: AdminRouterOptions): express.Router {
+  const { tokens, audit, policy, identities, callers, canaries, retention, removedUsers, userMappings, deadLetters, invitations, supportBundle, slos } = options;
+  const router = express.Router();
+
+  router.get("/audit", (req, res) => {
+    const limit = req.query.limit === undefined ? undefined : Number(req.query.limit);
+    if (limit !== undefined && !(Number.isInteger(limit) && limit > 0)) {
+      writeError(req, res, new HttpError(400, "limit must be a positive integer"));
+      return;
+    }
+    const source = typeof req.query.source === "string" ? req.query.source : undefined;
+    writeJSON(res, 200, { entries: audit.list(limit, source) });
+  });
+
+  router.get("/slo", (_req, res) => {
+    writeJSON(res, 200, latencySloJSON(slos));
+  });
+
+  router.get("/support-bundle", (_req, res) => {
+    const now = new Date();
+    console.log("admin API generated a support bundle");
+    res
+      .type("application/gzip")
+      .set("Content-Disposition", `attachment; filename="${supportBundle.name(now)}.tar.gz"`)
+      .send(supportBundle.archive(now));
+  });
+
+  router.get("/callers", (_req, res) => {
+    writeJSON(res, 200, { callers: callers.list() });
+  });
+
+  router.get("/canaries", (_req, res) => {
+    writeJSON(res, 200, { canaries: canaries.list() });
+  });
+
+  router.get("/bots", (req, res) => {
+    const limit = req.query.limit === undefined ? undefined : Number(req.query.limit);
+    if (limit !== undefined && !(Number.isInteger(limit) && limit > 0)) {
+      writeError(req, res, new HttpError(400, "limit must be a positive integer"));
+      return;
+    }
+    const userId = typeof req.query.user_id === "string" ? req.query.user_id : undefined;
+    const meetingId = typeof req.query.meeting_id === "string" ? parseMeetingId(req.query.meeting_id) : undefined;
+    if (req.query.meeting_id !== undefined && !meetingId) {
+      writeError(req, res, new HttpError(400, `invalid meeting ID: ${String(req.query.meeting_id)}`));
+      return;
+    }
+    writeJSON(res, 200, { records: identities.find({ userId, meetingId }, limit) });
+  });
+
+  // for bots launched elsewhere, e.g. by the launch-bot command, so their tokens can be traced back to them
+  router.post("/bots", express.json(), (req, res) => {
+    const body = (req.body ?? {}) as { bot_id?: unknown; user_id?: unknown; meeting_url?: unknown; meeting_id?: unknown; source?: unknown };
+    if (typeof body.bot_id !== "string" || !body.bot_id || typeof body.user_id !== "string" || !body.user_id) {
+      writeError(req, res, new HttpError(400, "bot_id and user_id are required"));
+      return;
+    }
+    if (!tokens.has(body.user_id)) {
+      writeError(req, res, new HttpError(404, `no tokens stored for user ${body.user_id}`));
+      return;
+    }
+    const meetingId =
+      typeof body.meeting_id === "string"
+        ? parseMeetingId(body.meeting_id)
+        : typeof body.meeting_url === "string"
+          ? meetingIdFromUrl(body.meeting_url)
+          : undefined;
+    const record = identities.launched({
+      botId: body.bot_id,
+      userId: body.user_id,
+      zoomUserId: tokens.zoomUserId(body.user_id),
+      meetingId,
+      source: typeof body.source === "string" && body.source ? body.source : "admin",
+    });
+    writeJSON(res, 201, record);
+  });
+
+  router.get("/bots/:botId", (req, res) => {
+    const records = identities.find({ botId: req.params.botId });
+    const launch = records.find((record) => record.event === "bot.launched") ?? records.at(-1);
+    if (!launch) {
+      writeError(req, res, new HttpError(404, `no identity recorded for bot ${req.params.botId}`));
+      return;
+    }
+    writeJSON(res, 200, {
+      bot_id: req.params.botId,
+      user_id: launch.user_id,
+      zoom_user_id: records.find((record) => record.zoom_user_id)?.zoom_user_id ?? null,
+      meeting_id: records.find((record) => record.meeting_id)?.meeting_id ?? null,
+      records,
+    });
+  });
+
+  router.get("/mappings", (req, res) => {
+    writeJSON(res, 200, { mappings: userMappings.list(typeof req.query.user_id === "string" ? req.query.user_id : undefined) });
+  });
+
+  // so the Recall callbacks serve a bot, the bots created with some metadata, or a host's meetings as user_id
+  router.post("/mappings", express.json(), (req, res) => {
+    const body = (req.body ?? {}) as { kind?: unknown; match?: unknown; user_id?: unknown };
+    if (typeof body.kind !== "string" || !(USER_MAPPING_KINDS as readonly string[]).includes(body.kind)) {
+      writeError(req, res, new HttpError(400, `kind must be one of ${USER_MAPPING_KINDS.join(", ")}`));
+      return;
+    }
+    if (typeof body.match !== "string" || typeof body.user_id !== "string" || !body.user_id) {
+      writeError(req, res, new HttpError(400, "match and user_id are required"));
+      return;
+    }
+    const kind = body.kind as UserMappingKind;
+    const match = normalizeMappingMatch(kind, body.match);
+    if (typeof match !== "string") {
+      writeError(req, res, new HttpError(400, match.error));
+      return;
+    }
+    if (!tokens.has(body.user_id)) {
+      writeError(req, res, new HttpError(404, `no tokens stored for user ${body.user_id}`));
+      return;
+    }
+    const replaced = userMappings.get(kind, match);
+    const mapping = userMappings.set(kind, match, body.user_id);
+    console.log(`admin API mapped ${kind} ${match} to user ${body.user_id}${replaced ? `, was ${replaced.user_id}` : ""}`);
+    writeJSON(res, replaced ? 200 : 201, mapping);
+  });
+
+  router.delete("/mappings/:kind/:match", (req, res) => {
+    const kind = req.params.kind as UserMappingKind;
+    const match = (USER_MAPPING_KINDS as readonly string[]).includes(kind) ? normalizeMappingMatch(kind, req.params.match) : undefined;
+    if (typeof match !== "string" || !userMappings.remove(kind, match)) {
+      writeError(req, res, new HttpError(404, `no ${req.params.kind} mapping of ${req.params.match}`));
+      return;
+    }
+    console.warn(`admin API removed the mapping of ${kind} ${match}`);
+    writeJSON(res, 200, { kind, match, removed: true });
+  });
+
+  router.get("/issuance", (_req, res) => {
+    writeJSON(res, 200, {
+      window_ms: ISSUANCE_WINDOW_MS,
+      usage: policy.usage().map((usage) => ({
+        scope: usage.scope,
+        id: usage.id,
+        count: usage.count,
+        window_started_at: usage.windowStartedAt.toISOString(),
+      })),
+    });
+  });
+
+  router.get("/retention", (_req, res) => {
+    writeJSON(res, 200, { last_run: retention.lastReport });
+  });
+
+  router.post("/retention/run", async (req, res) => {
+    try {
+      writeJSON(res, 200, await retention.run());
+    } catch (error) {
+      writeError(req, res, error, "error running retention");
+    }
+  });
+
+  router.get("/tokens", (_req, res) => {
+    writeJSON(res, 200, { tokens: tokens.list().map((status) => tokenStatusJSON(status, tokens.zoomProfile(status.userId))) });
+  });
+
+  router.get("/users", (_req, res) => {
+    writeJSON(res, 200, { users: tokens.list().map((status) => connectedUserJSON(status, tokens.zoomProfile(status.userId))) });
+  });
+
+  // ?format=csv for a spreadsheet or CRM import, JSON otherwise; scopes are space-separated in CSV
+  router.get("/users/export", (req, res) => {
+    const format = req.query.format ?? "json";
+    if (format !== "json" && format !== "csv") {
+      writeError(req, res, new HttpError(400, `format must be json or csv, not ${String(format)}`));
+      return;
+    }
+    const users = tokens.list().map((status) => exportedUserJSON(status, tokens.zoomProfile(status.userId)));
+    const filename = `connected-users-${new Date().toISOString().replace(/[-:]|\.\d+/g, "")}.${format}`;
+    console.log(`admin API exported ${users.length} connected user(s) as ${format}`);
+    res.set("Content-Disposition", `attachment; filename="${filename}"`);
+    if (format === "json") {
+      writeJSON(res, 200, { exported_at: new Date().toISOString(), users });
+      return;
+    }
+    const rows = [EXPORT_COLUMNS.join(","), ...users.map((user) => EXPORT_COLUMNS.map((column) => csvField(user[column])).join(","))];
+    res.set("Cache-Control", "no-store").type("text/csv").send(`${rows.join("\r\n")}\r\n`);
+  });
+
+  router.post("/tokens/sync", async (req, res) => {
+    try {
+      const result = await tokens.syncUsers();
+      writeJSON(res, 200, { checked: result.checked, deactivated: result.deactivated });
+    } catch (error) {
+      writeError(req, res, error, "error syncing zoom users");
+    }
+  });
+
+  router.put("/tokens/:userId", express.json(), (req, res) => {
+    const body = (req.body ?? {}) as { access_token?: unknown; refresh_token?: unknown; expires_in?: unknown; scope?: unknown };
+    const expiresIn = Number(body.expires_in);
+    if (typeof body.access_token !== "string" || typeof body.refresh_token !== "string" || !(expiresIn > 0)) {
+      writeError(req, res, new HttpError(400, "access_token, refresh_token and a positive expires_in are required"));
+      return;
+    }
+
+    tokens.set(req.params.userId, {
+      accessToken: body.access_token,
+      refreshToken: body.refresh_token,
+      expiresIn,
+      scopes: parseScopes(typeof body.scope === "string" ? body.scope : undefined),
+    });
+    console.log(`admin API stored tokens for user ${req.params.userId}`);
+    removedUsers.restored(req.params.userId);
+    writeJSON(res, 200, tokenStatusJSON(tokens.status(req.params.userId), tokens.zoomProfile(req.params.userId)));
+  });
+
+  router.get("/tokens/:userId", (req, res) => {
+    try {
+      const body = tokenStatusJSON(tokens.status(req.params.userId), tokens.zoomProfile(req.params.userId));
+      body.own_callback_secret = tokens.callbackSecret(req.params.userId) !== undefined;
+      if (req.query.include_token === "true") {
+        console.warn(`admin API revealed the access token for user ${req.params.userId}`);
+        body.access_token = tokens.get(req.params.userId).accessToken;
+      }
+      writeJSON(res, 200, body);
+    } catch (error) {
+      writeError(req, res, error, "error fetching token status");
+    }
+  });
+
+  // a confidence check that never shows the token: what Zoom says about whoever it belongs to, and the token's status
+  router.post("/tokens/:userId/verify", async (req, res) => {
+    try {
+      const check = await tokens.verifyToken(req.params.userId);
+      const status = tokens.status(req.params.userId);
+      console.log(`admin API verified the access token of user ${req.params.userId}: ${check.detail}`);
+      audit.record({ action: "token.verify", outcome: check.works ? "allowed" : "denied", user_id: req.params.userId, source: "admin", reason: check.detail });
+      writeJSON(res, 200, {
+        user_id: req.params.userId,
+        works: check.works,
+        detail: check.detail,
+        checked_at: new Date().toISOString(),
+        zoom_user_id: check.zoomUser?.id ?? null,
+        email: check.zoomUser?.email || null,
+        account_id: check.zoomUser?.accountId ?? null,
+        name: check.zoomUser?.name ?? null,
+        scopes: status.scopes,
+        expires_at: status.expiresAt.toISOString(),
+        token_type: status.tokenType,
+      });
+    } catch (error) {
+      writeError(req, res, error, "error verifying token");
+    }
+  });
+
+  // the secret is only ever in this response; the Recall callbacks then refuse the shared one for the user
+  router.post("/tokens/:userId/callback-secret", (req, res) => {
+    try {
+      const replaced = tokens.callbackSecret(req.params.userId) !== undefined;
+      const secret = tokens.issueCallbackSecret(req.params.userId);
+      console.warn(`admin API ${replaced ? "replaced the" : "issued a"} callback secret of user ${req.params.userId}`);
+      audit.record({ action: "callback_secret.issue", outcome: "allowed", user_id: req.params.userId, source: "admin" });
+      writeJSON(res, 201, { user_id: req.params.userId, callback_secret: secret, replaced });
+    } catch (error) {
+      writeError(req, res, error, "error issuing callback secret");
+    }
+  });
+
+  router.delete("/tokens/:userId/callback-secret", (req, res) => {
+    if (!tokens.revokeCallbackSecret(req.params.userId)) {
+      writeError(req, res, new HttpError(404, `user ${req.params.userId} has no callback secret of their own`));
+      return;
+    }
+    console.warn(`admin API revoked the callback secret of user ${req.params.userId}`);
+    audit.record({ action: "callback_secret.revoke", outcome: "allowed", user_id: req.params.userId, source: "admin" });
+    writeJSON(res, 200, { user_id: req.params.userId, revoked: true });
+  });
+
+  // ?hard=true also forgets the soft-deleted record, and works on a user whose tokens are already gone
+  router.delete("/tokens/:userId", (req, res) => {
+    const userId = req.params.userId;
+    const hard = req.query.hard === "true";
+    if (!tokens.has(userId) && !(hard && removedUsers.get(userId))) {
+      writeError(req, res, new HttpError(404, `no tokens stored for user ${userId}`));
+      return;
+    }
+    if (tokens.has(userId)) {
+      const removed = { status: tokens.status(userId), zoomUserId: tokens.zoomUserId(userId) };
+      tokens.delete(userId);
+      audit.record({ action: "tokens.purge", outcome: "allowed", user_id: userId, source: "admin" });
+      if (!hard) removedUsers.removed({ ...removed, removal: "purged", source: "admin" });
+    }
+    if (hard) removedUsers.purge(userId);
+    console.warn(`admin API ${hard ? "hard deleted" : "purged"} tokens for user ${userId}`);
+    writeJSON(res, 200, { user_id: userId, purged: true, hard });
+  });
+
+  router.post("/tokens/:userId/revoke", async (req, res) => {
+    const userId = req.params.userId;
+    try {
+      const removed = { status: tokens.status(userId), zoomUserId: tokens.zoomUserId(userId) };
+      await tokens.revoke(userId);
+      audit.record({ action: "tokens.revoke", outcome: "allowed", user_id: userId, source: "admin" });
+      removedUsers.removed({ ...removed, removal: "revoked", source: "admin" });
+      console.warn(`admin API revoked tokens for user ${userId} at zoom`);
+      writeJSON(res, 200, { user_id: userId, revoked: true });
+    } catch (error) {
+      writeError(req, res, error, "error revoking token");
+    }
+  });
+
+  // offboarding: whatever Zoom says of the token, the user is gone from here afterwards
+  router.delete("/users/:userId", async (req, res) => {
+    const userId = req.params.userId;
+    if (!tokens.has(userId)) {
+      writeError(req, res, new HttpError(404, `no user ${userId} is connected`));
+      return;
+    }
+    try {
+      const removed = { status: tokens.status(userId), zoomUserId: tokens.zoomUserId(userId) };
+      const revoked = await tokens.disconnect(userId);
+      audit.record({ action: "tokens.disconnect", outcome: "allowed", user_id: userId, source: "admin" });
+      removedUsers.removed({ ...removed, removal: revoked ? "revoked" : "purged", source: "admin" });
+      console.warn(`admin API disconnected user ${userId}${revoked ? ", revoked at zoom" : ", zoom had already dropped the token"}`);
+      writeJSON(res, 200, { user_id: userId, disconnected: true, revoked });
+    } catch (error) {
+      writeError(req, res, error, "error disconnecting user");
+    }
+  });
+
+  router.get("/removed-users", (_req, res) => {
+    writeJSON(res, 200, { users: removedUsers.list() });
+  });
+
+  router.get("/removed-users/:userId", (req, res) => {
+    const removed = removedUsers.get(req.params.userId);
+    if (!removed) {
+      writeError(req, res, new HttpError(404, `no removed user ${req.params.userId}`));
+      return;
+    }
+    writeJSON(res, 200, removed);
+  });
+
+  router.post("/removed-users/:userId/notes", express.json(), (req, res) => {
+    const note = (req.body as { note?: unknown } | undefined)?.note;
+    if (typeof note !== "string" || !note.trim()) {
+      writeError(req, res, new HttpError(400, "a non-empty note is required"));
+      return;
+    }
+    const removed = removedUsers.annotate(req.params.userId, note.trim());
+    if (!removed) {
+      writeError(req, res, new HttpError(404, `no removed user ${req.params.userId}`));
+      return;
+    }
+    console.log(`admin API annotated removed user ${req.params.userId}`);
+    writeJSON(res, 200, removed);
+  });
+
+  router.get("/dead-letters", (_req, res) => {
+    writeJSON(res, 200, { letters: deadLetters.list() });
+  });
+
+  router.get("/dead-letters/:id", (req, res) => {
+    const letter = deadLetters.get(req.params.id);
+    if (!letter) {
+      writeError(req, res, new HttpError(404, `no dead letter ${req.params.id}`));
+      return;
+    }
+    writeJSON(res, 200, letter);
+  });
+
+  // a letter that fails again is kept, with the new error, and answered with 502
+  router.post("/dead-letters/:id/replay", async (req, res) => {
+    const replay = await deadLetters.replay(req.params.id);
+    if (!replay) {
+      writeError(req, res, new HttpError(404, `no dead letter ${req.params.id}`));
+      return;
+    }
+    if (!replay.replayed) {
+      writeError(req, res, new HttpError(502, `dead letter ${req.params.id} failed again: ${replay.letter.last_error}`));
+      return;
+    }
+    console.log(`admin API replayed dead letter ${req.params.id}`);
+    writeJSON(res, 200, { ...replay.letter, replayed: true });
+  });
+
+  router.delete("/dead-letters/:id", (req, res) => {
+    if (!deadLetters.discard(req.params.id)) {
+      writeError(req, res, new HttpError(404, `no dead letter ${req.params.id}`));
+      return;
+    }
+    console.warn(`admin API discarded dead letter ${req.params.id}`);
+    writeJSON(res, 200, { id: req.params.id, discarded: true });
+  });
+
+  router.get("/invitations", (req, res) => {
+    const status = req.query.status;
+    if (status !== undefined && status !== "pending" && status !== "completed") {
+      writeError(req, res, new HttpError(400, "status must be pending or completed"));
+      return;
+    }
+    const all = invitations.list();
+    writeJSON(res, 200, {
+      pending: all.filter((invitation) => invitation.status === "pending").length,
+      completed: all.filter((invitation) => invitation.status === "completed").length,
+      invitations: status ? all.filter((invitation) => invitation.status === status) : all,
+    });
+  });
+
+  // a JSON {"users": [...], "email": true} body, or CSV with ?email=true; emailing goes to every listed user not yet connected
+  router.post("/invitations", express.json(), express.text({ type: "text/csv" }), async (req, res) => {
+    const csv = typeof req.body === "string";
+    const body = (csv ? {} : (req.body ?? {})) as { users?: unknown; email?: unknown };
+    const invitees = validateInvitees(csv ? parseInviteesCsv(req.body as string) : body.users);
+    if (typeof invitees === "string") {
+      writeError(req, res, new HttpError(400, invitees));
+      return;
+    }
+    const email = csv ? req.query.email === "true" : body.email === true;
+    if (email && !invitations.canEmail) {
+      writeError(req, res, new HttpError(400, "invitations can't be emailed without SMTP_URL and ONBOARDING_EMAIL_FROM"));
+      return;
+    }
+    const results = invitations.invite(invitees);
+    const created = results.filter((result) => result.created).length;
+    console.log(`admin API invited ${created} new user(s) of ${results.length} to connect zoom`);
+    const toEmail = email ? results.map((result) => result.invitation).filter((invitation) => invitation.status === "pending") : [];
+    if (toEmail.length > 0) await invitations.email(toEmail);
+    writeJSON(res, 200, {
+      created,
+      emailed: toEmail.filter((invitation) => !invitation.email_error).length,
+      invitations: results.map(({ invitation, created }) => ({ ...invitation, created })),
+    });
+  });
+
+  // nudges the listed emails, or everyone, that haven't connected yet
+  router.post("/invitations/remind", express.json(), async (req, res) => {
+    const body = (req.body ?? {}) as { emails?: unknown };
+    if (body.emails !== undefined && !(Array.isArray(body.emails) && body.emails.every((email) => typeof email === "string"))) {
+      writeError(req, res, new HttpError(400, "emails must be a list of email addresses"));
+      return;
+    }
+    if (!invitations.canEmail) {
+      writeError(req, res, new HttpError(400, "invitations can't be emailed without SMTP_URL and ONBOARDING_EMAIL_FROM"));
+      return;
+    }
+    const selected = (body.emails as string[] | undefined)?.map((email) => ({ email, invitation: invitations.findByEmail(email.trim()) }));
+    const unknown = selected?.filter(({ invitation }) => !invitation).map(({ email }) => email) ?? [];
+    if (unknown.length > 0) {
+      writeError(req, res, new HttpError(404, `no invitation for ${unknown.join(", ")}`));
+      return;
+    }
+    const reminded = await invitations.remind(selected?.map(({ invitation }) => invitation!));
+    console.log(`admin API reminded ${reminded.length} pending onboarding invitation(s)`);
+    writeJSON(res, 200, { reminded: reminded.length, invitations: reminded });
+  });
+
+  router.get("/invitations/:id", (req, res) => {
+    const invitation = invitations.get(req.params.id);
+    if (!invitation) {
+      writeError(req, res, new HttpError(404, `no invitation ${req.params.id}`));
+      return;
+    }
+    writeJSON(res, 200, invitation);
+  });
+
+  // its link stops working; tokens stored by an earlier consent through it are kept
+  router.delete("/invitations/:id", (req, res) => {
+    if (!invitations.remove(req.params.id)) {
+      writeError(req, res, new HttpError(404, `no invitation ${req.params.id}`));
+      return;
+    }
+    console.warn(`admin API withdrew invitation ${req.params.id}`);
+    writeJSON(res, 200, { id: req.params.id, withdrawn: true });
+  });
+
+  router.get("/tokens/:userId/obf", async (req, res) => {
+    try {
+      const raw = req.query.meeting_id as string | undefined;
+      const meetingId = raw === undefined ? undefined : parseMeetingId(raw);
+      if (!meetingId) {
+        throw new HttpError(400, "a valid meeting_id is required");
+      }
+      console.warn(`admin API generated an OBF token for user ${req.params.userId} and meeting ${meetingId}`);
+      writeJSON(res, 200, { token: await tokens.generateObfToken(req.params.userId, meetingId) });
+    } catch (error) {
+      writeError(req, res, error, "error generating OBF token");
+    }
+  });
+
+  router.get("/tokens/:userId/meetings/:meetingId", async (req, res) => {
+    try {
+      const meetingId = parseMeetingId(req.params.meetingId);
+      if (!meetingId) {
+        throw new HttpError(400, `invalid meeting ID: ${req.params.meetingId}`);
+      }
+      writeJSON(res, 200, meetingJSON(await tokens.getMeeting(req.params.userId, meetingId)));
+    } catch (error) {
+      writeError(req, res, error, "error fetching meeting");
+    }
+  });
+
+  router.get("/tokens/:userId/entitlements", async (req, res) => {
+    try {
+      const raw = req.query.meeting_id;
+      const meetingId = typeof raw === "string" && raw !== "" ? parseMeetingId(raw) : undefined;
+      if (raw !== undefined && raw !== "" && !meetingId) {
+        throw new HttpError(400, `invalid meeting ID: ${String(raw)}`);
+      }
+      const obf = await tokens.probeObfEntitlement(req.params.userId, meetingId);
+      writeJSON(res, 200, { user_id: req.params.userId, obf });
+    } catch (error) {
+      writeError(req, res, error, "error probing entitlements");
+    }
+  });
+
+  router.get("/tokens/:userId/zak", async (req, res) => {
+    try {
+      console.warn(`admin API generated a ZAK token for user ${req.params.userId}`);
+      writeJSON(res, 200, { token: await tokens.generateZakToken(req.params.userId) });
+    } catch (error) {
+      writeError(req, res, error, "error generating ZAK token");
+    }
+  });
+
+  return router;
+}
@@ -0,0 +1,1143 @@
+import { randomUUID } from "crypto";
+import express from "express";
+import { aboutJSON } from "./about.js";
+import { createAdminRouter, requireAdminKey } from "./admin.js";
+import { AuditLog } from "./audit.js";
+import { createBrokerAdminRouter, createBrokerRouter, loadBrokerClients, TokenBroker } from "./broker.js";
+import type { AuditSink } from "./audit.js";
+import { CallerLog, recordCallers } from "./callers.js";
+import { Canaries, catchCanaries } from "./canaries.js";
+import { clockSkewMetrics, HealthMonitor, healthBanner, healthJSON, healthMetrics, reauthorizationMetrics } from "./health.js";
+import {
+  awsSecretsManagerStoreOptions,
+  azureKeyVaultStoreOptions,
+  ConfigError,
+  dynamoDbStoreOptions,
+  gcpSecretManagerStoreOptions,
+  kubernetesSecretStoreOptions,
+  tokenEncryptionOptions,
+  vaultStoreOptions,
+} from "./config.js";
+import type { Config } from "./config.js";
+import { allowedReturnUrl, CONSENT_SESSION_COOKIE, CONSENT_STATE_TTL_MS, ConsentSessions, ConsentStates } from "./consent.js";
+import type { ConsentSession } from "./consent.js";
+import { DeadLetters } from "./deadletters.js";
+import { createFaultRouter, FaultInjector } from "./faults.js";
+import { localeFor, translate } from "./i18n.js";
+import { BotIdentityLog } from "./identities.js";
+import { JobJournal } from "./jobs.js";
+import { UserMappings } from "./mappings.js";
+import { RemovedUsers } from "./removals.js";
+import { EmailNotifier, Notifications, PagerDutyNotifier, SlackNotifier } from "./notify.js";
+import type { Notifier } from "./notify.js";
+import type { Locale } from "./i18n.js";
+import { invitationMetrics, Invitations } from "./onboarding.js";
+import { ConsentPages, escapeHTML, loadBranding } from "./pages.js";
+import type { PageDetail } from "./pages.js";
+import { createRealtimeRouter, createRealtimeStreamRouter, RealtimeRelay, realtimeRecordingConfig } from "./realtime.js";
+import { createRecallWebhookRouter } from "./recallwebhooks.js";
+import { RecordingIngest } from "./recordings.js";
+import { Retention } from "./retention.js";
+import type { RetentionSweep } from "./retention.js";
+import { createSlackRouter, SlackLinks } from "./slack.js";
+import { LatencySlos, latencySloMetrics, trackLatency } from "./slo.js";
+import { captureConsole, SupportBundle, ZoomErrorLog } from "./support.js";
+import { formatTime } from "./timezone.js";
+import { WebhookDispatcher } from "./webhooks.js";
+import { createZoomWebhookRouter } from "./zoomwebhooks.js";
+import {
+  AccountTokenManager,
+  AuthorizationCodeExpiredError,
+  CodeVerifierMismatchError,
+  AwsSecretsManagerTokenStore,
+  AzureKeyVaultTokenStore,
+  ClockSkew,
+  DynamoDbTokenStore,
+  GcpSecretManagerTokenStore,
+  KubernetesSecretTokenStore,
+  createHttpClient,
+  createRecallRouter,
+  createOAuthRecallRouter,
+  EncryptedTokenStore,
+  FileTokenStore,
+  GoogleClient,
+  HttpError,
+  IssuancePolicy,
+  meetingIdFromUrl,
+  MemoryTokenStore,
+  MicrosoftClient,
+  OAuthTokenManager,
+  ProxyTokens,
+  RecallClient,
+  recallCallbackUrl,
+  RedisTokenStore,
+  SqliteTokenStore,
+  statusForError,
+  TokenManager,
+  VaultTokenStore,
+  WaitingRoomAdmitter,
+  withUserAgent,
+  ZoomClient,
+} from "./zoomrecall/index.js";
+import type { HttpClient, OAuthProvider, TokenManagerHooks, TokenStore } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+export interface AppOptions {
+  httpClient?: HttpClient;
+}
+
+export interface App {
+  app: express.Express;
+  tokens: TokenManager;
+  // the users of each further Zoom app in ZOOM_APPS, by app name
+  zoomApps: Map<string, TokenManager>;
+  // the users of each tenant in TENANTS, by tenant name
+  tenants: Map<string, TokenManager>;
+  // null unless the provider is configured
+  teamsTokens: OAuthTokenManager | null;
+  googleTokens: OAuthTokenManager | null;
+  notifications: Notifications;
+  policy: IssuancePolicy;
+  audit: AuditLog;
+  identities: BotIdentityLog;
+  // records a token served for a bot and announces it to ISSUANCE_WEBHOOK_URL, for callers outside the Recall router, e.g. gRPC
+  served(entry: ServedEntry, origin?: ServedOrigin): void;
+  removedUsers: RemovedUsers;
+  userMappings: UserMappings;
+  deadLetters: DeadLetters;
+  invitations: Invitations;
+  callers: CallerLog;
+  canaries: Canaries;
+  health: HealthMonitor;
+  retention: Retention;
+}
+
+type ServedEntry = Parameters<BotIdentityLog["served"]>[0];
+
+// which further Zoom app or tenant served a token, neither for ZOOM_CLIENT_ID's users
+interface ServedOrigin {
+  zoomApp?: string;
+  tenant?: string;
+}
+
+interface OAuthProviderMount {
+  name: string;
+  // consent lives under `${path}/oauth`, the Recall callback under `/recall${path}/oauth-callback`
+  path: string;
+  client: OAuthProvider & { authorizeUrl(state?: string): string };
+  hooks: TokenManagerHooks;
+  // the provider's own, 0 if its refresh tokens don't expire by age
+  refreshTokenLifetimeMs: number;
+}
+
+// the consent session cookie helpers of createApp, which tie a consent callback to the browser that started it
+interface ConsentCookie {
+  remember(res: express.Response, path: string, session: ConsentSession): void;
+  forget(req: express.Request, res: express.Response, path: string): void;
+  startedHere(req: express.Request, state: string): boolean;
+}
+
+function tokenEventHooks(notifications: Notifications, provider: string): TokenManagerHooks {
+  return {
+    onRefresh: (status) =>
+      notifications.emit("token.refreshed", { provider, user_id: status.userId, expires_at: status.expiresAt.toISOString() }),
+    onReauthorizationRequired: (userId, error) =>
+      notifications.emit("token.reauthorization_required", { provider, user_id: userId, reason: error.message }),
+    onDeactivated: (userId, reason) => notifications.emit("token.deactivated", { provider, user_id: userId, reason }),
+    onScopesNarrowed: (userId, missingScopes, scopes) =>
+      notifications.emit("token.scopes_narrowed", { provider, user_id: userId, missing_scopes: missingScopes, scopes }),
+    onReauthorizationDue: (status) =>
+      notifications.emit("token.reauthorization_due", { provider, user_id: status.userId, due_at: status.reauthorizationDueAt?.toISOString() ?? null }),
+  };
+}
+
+// consent pages are read by whoever is authorizing, so failures are described in their language
+function writeConsentError(req: express.Request, res: express.Response, pages: ConsentPages, locale: Locale, error: unknown): void {
+  const status = statusForError(error);
+  const internal = status === 500 && !(error instanceof HttpError);
+  if (internal) {
+    console.error(`${req.method} ${req.path}: consent failed`, error);
+  }
+  const reason = internal ? translate(locale, "consent.internal") : error instanceof Error ? error.message : String(error);
+  pages.failure(req, res, locale, new HttpError(status, translate(locale, "consent.failed", { reason })));
+}
+
+// which Zoom account consent connected and what it granted, so whoever connects several accounts can tell it was the right one
+function connectedDetails(locale: Locale, tokens: TokenManager, userId: string): PageDetail[] {
+  const profile = tokens.zoomProfile(userId);
+  const scopes = tokens.status(userId).scopes;
+  return [
+    { label: translate(locale, "consent.account"), value: profile.name ?? "-" },
+    { label: translate(locale, "consent.email"), value: profile.email ?? "-" },
+    { label: translate(locale, "consent.scopes"), value: scopes?.length ? scopes.join(", ") : "-" },
+    { label: translate(locale, "consent.user_id"), value: userId },
+  ];
+}
+
+// serves consent and the Recall token callback for a non-Zoom provider; users are tracked in a `<path>_user_id` cookie
+function mountOAuthProvider(
+  app: express.Express,
+  config: Config,
+  pages: ConsentPages,
+  consents: ConsentStates,
+  consentCookie: ConsentCookie,
+  store: TokenStore,
+  mount: OAuthProviderMount,
+): OAuthTokenManager {
+  const { name, path, client, hooks, refreshTokenLifetimeMs } = mount;
+  const tokens = new OAuthTokenManager({
+    store,
+    storeKey: name,
+    provider: client,
+    refreshIntervalMs: config.tokenRefreshIntervalMs,
+    refreshMarginMs: config.tokenRefreshMarginMs,
+    staleTokenPolicy: config.staleTokenPolicy,
+    staleTokenGraceMs: config.staleTokenGraceMs,
+    refreshTokenLifetimeMs,
+    consentLifetimeMs: config.consentLifetimeMs,
+    reauthorizationWarningMs: config.reauthorizationWarningMs,
+    consentPath: `${path}/oauth`,
+    hooks,
+  });
+
+  app.get(`${path}/oauth`, (_req, res) => {
+    const state = consents.start(name);
+    consentCookie.remember(res, path, { provider: name, state });
+    res.redirect(client.authorizeUrl(state));
+  });
+
+  app.get(`${path}/oauth-callback`, async (req, res) => {
+    const locale = localeFor(req, res, config.defaultLocale);
+    const authCode = req.query.code as string | undefined;
+    if (!authCode) {
+      const reason = (req.query.error_description ?? req.query.error) as string | undefined;
+      const message = reason ? translate(locale, "consent.denied", { provider: name, reason }) : translate(locale, "consent.missing_code");
+      pages.failure(req, res, locale, new HttpError(400, message));
+      return;
+    }
+    const displayName = `${name[0].toUpperCase()}${name.slice(1)}`;
+    // unlike Zoom's, these consents are only ever started here, so a callback without a state wasn't
+    const state = req.query.state as string | undefined;
+    if (state === undefined || !consentCookie.startedHere(req, state) || !consents.claim(state, name)) {
+      pages.expired(req, res, locale, displayName, `${path}/oauth`);
+      return;
+    }
+
+    try {
+      const userId = randomUUID();
+      await tokens.authorize(userId, authCode);
+      consentCookie.forget(req, res, path);
+
+      res.cookie(`${path.slice(1)}_user_id`, userId, { httpOnly: true, maxAge: 30 * 24 * 60 * 60 * 1000 });
+      pages.success(req, res, locale, translate(locale, "consent.stored_provider", { provider: name, user_id: userId }));
+    } catch (error) {
+      if (error instanceof AuthorizationCodeExpiredError) {
+        pages.expired(req, res, locale, displayName, error.consentPath);
+        return;
+      }
+      writeConsentError(req, res, pages, locale, error);
+    }
+  });
+
+  app.use(
+    `/recall${path}`,
+    createOAuthRecallRouter({ tokens, callbackSecret: config.recallCallbackSecret, provider: name, responseFormat: config.recallResponseFormat }),
+  );
+  return tokens;
+}
+
+// the audit log is kept in the store too when it is a SQLite database
+export function openTokenStore(config: Config, httpClient: HttpClient): { store: TokenStore; auditSink?: AuditSink } {
+  if (config.tokenStore === "memory") return { store: new MemoryTokenStore() };
+  const store = openPersistentTokenStore(config, httpClient);
+  const encryption = tokenEncryptionOptions(config, httpClient);
+  return {
+    store: encryption ? new EncryptedTokenStore({ store, ...encryption }) : store,
+    auditSink: store instanceof SqliteTokenStore ? store : undefined,
+  };
+}
+
+function openPersistentTokenStore(config: Config, httpClient: HttpClient): TokenStore {
+  if (config.tokenStore === "redis") {
+    // connects on first use; unreachable at startup surfaces through the token managers' ready
+    return new RedisTokenStore({ url: config.redisUrl, keyPrefix: config.redisKeyPrefix });
+  }
+  if (config.tokenStore === "vault") {
+    return new VaultTokenStore({ ...vaultStoreOptions(config), httpClient });
+  }
+  if (config.tokenStore === "aws-secrets-manager") {
+    return new AwsSecretsManagerTokenStore(awsSecretsManagerStoreOptions(config, httpClient));
+  }
+  if (config.tokenStore === "dynamodb") {
+    return new DynamoDbTokenStore(dynamoDbStoreOptions(config, httpClient));
+  }
+  if (config.tokenStore === "gcp-secret-manager") {
+    return new GcpSecretManagerTokenStore(gcpSecretManagerStoreOptions(config, httpClient));
+  }
+  if (config.tokenStore === "azure-key-vault") {
+    return new AzureKeyVaultTokenStore(azureKeyVaultStoreOptions(config, httpClient));
+  }
+  if (config.tokenStore === "kubernetes-secret") {
+    return new KubernetesSecretTokenStore(kubernetesSecretStoreOptions(config, httpClient));
+  }
+  try {
+    return config.tokenStore === "sqlite" ? new SqliteTokenStore(config.tokenStorePath) : new FileTokenStore(config.tokenStorePath);
+  } catch (error) {
+    throw new ConfigError(`could not read TOKEN_STORE_PATH ${config.tokenStorePath}: ${error instanceof Error ? error.message : String(error)}`);
+  }
+}
+
+function getCookie(req: express.Request, name: string): string | undefined {
+  const cookies = req.headers.cookie?.split("; ") ?? [];
+  for (const cookie of cookies) {
+    const [key, value] = cookie.split("=");
+    if (key === name) return value;
+  }
+  return undefined;
+}
+
+export function createApp(config: Config, options: AppOptions = {}): App {
+  // recent logs go into support bundles
+  captureConsole();
+  let httpClient = withUserAgent(config.userAgent, options.httpClient ?? createHttpClient(config.httpTimeoutMs));
+  const faults = config.faultInjectionEnabled ? new FaultInjector([config.zoomOauthBaseUrl, config.zoomApiBaseUrl]) : null;
+  if (faults) {
+    httpClient = faults.wrap(httpClient);
+  }
+  // Zoom's clock is the one its tokens expire on
+  const clock = new ClockSkew({ baseUrls: [config.zoomOauthBaseUrl, config.zoomApiBaseUrl], warningMs: config.clockSkewWarningMs });
+  httpClient = clock.wrap(httpClient);
+  const zoomErrors = new ZoomErrorLog([config.zoomOauthBaseUrl, config.zoomApiBaseUrl]);
+  httpClient = zoomErrors.wrap(httpClient);
+  const zoom = new ZoomClient({
+    clientId: config.zoomClientId,
+    clientSecret: config.zoomClientSecret,
+    redirectUri: config.zoomRedirectUri,
+    oauthBaseUrl: config.zoomOauthBaseUrl,
+    apiBaseUrl: config.zoomApiBaseUrl,
+    httpClient,
+  });
+  const recall = new RecallClient({ apiKey: config.recallApiKey, apiBaseUrl: config.recallApiBaseUrl, httpClient });
+  // the journal's webhook deliveries are resumed by the WEBHOOK_URLS dispatcher, which drops those for other URLs, so
+  // the issuance and recording forwarders below aren't journaled
+  const journal = new JobJournal(config.jobJournal);
+  const webhooks = new WebhookDispatcher({ urls: config.webhookUrls, secret: config.webhookSecret, httpClient, journal });
+  webhooks.resume();
+  const notifiers: Notifier[] = [webhooks];
+  if (config.slackAlertWebhookUrl) {
+    notifiers.push(new SlackNotifier(config.slackAlertWebhookUrl, httpClient, config.displayTimeZone));
+  }
+  if (config.smtpUrl) {
+    notifiers.push(new EmailNotifier({ smtpUrl: config.smtpUrl, from: config.alertEmailFrom, to: config.alertEmailTo, timeZone: config.displayTimeZone }));
+  }
+  if (config.pagerdutyRoutingKey) {
+    notifiers.push(
+      new PagerDutyNotifier({ routingKey: config.pagerdutyRoutingKey, source: config.baseUrl, httpClient, eventsUrl: config.pagerdutyEventsUrl }),
+    );
+  }
+  const notifications = new Notifications({ notifiers, routes: config.notifyRoutes });
+  const { store, auditSink } = openTokenStore(config, httpClient);
+  const health = new HealthMonitor({
+    users: () => tokens.list(),
+    onChange: (from, to, reasons) => notifications.emit("health.changed", { from, to, reasons }),
+  });
+  const tokenOptions = {
+    store,
+    zoom,
+    hooks: health.observe(tokenEventHooks(notifications, "zoom")),
+    refreshIntervalMs: config.tokenRefreshIntervalMs,
+    refreshMarginMs: config.tokenRefreshMarginMs,
+    staleTokenPolicy: config.staleTokenPolicy,
+    staleTokenGraceMs: config.staleTokenGraceMs,
+    refreshTokenLifetimeMs: config.refreshTokenLifetimeMs,
+    consentLifetimeMs: config.consentLifetimeMs,
+    reauthorizationWarningMs: config.reauthorizationWarningMs,
+    clock,
+    zakCacheTtlMs: config.zakCacheTtlMs,
+    obfCacheTtlMs: config.obfCacheTtlMs,
+  };
+  const tokens: TokenManager = config.zoomAccountId
+    ? new AccountTokenManager({ ...tokenOptions, accountId: config.zoomAccountId })
+    : new TokenManager({ ...tokenOptions, userSyncIntervalMs: config.zoomUserSyncIntervalMs, accountAdmin: config.zoomAccountAdminUserId });
+  if (config.zoomAccountAdminUserId) {
+    tokens.ready.then(
+      () => {
+        if (!tokens.has(config.zoomAccountAdminUserId)) {
+          console.warn(`account admin ${config.zoomAccountAdminUserId} is not connected, hosts who never connected get no tokens until they do`);
+        }
+      },
+      () => {},
+    );
+  }
+  // each further Zoom app's users are stored apart, a user ID only means something within its app
+  const zoomApps = new Map<string, { zoom: ZoomClient; tokens: TokenManager }>();
+  for (const { name, clientId, clientSecret, redirectUri } of config.zoomApps) {
+    const client = new ZoomClient({ clientId, clientSecret, redirectUri, oauthBaseUrl: config.zoomOauthBaseUrl, apiBaseUrl: config.zoomApiBaseUrl, httpClient });
+    const appTokens = new TokenManager({
+      ...tokenOptions,
+      zoom: client,
+      storeKey: `zoom:${name}`,
+      consentPath: `/zoom/oauth?app=${name}`,
+      hooks: tokenEventHooks(notifications, `zoom:${name}`),
+      userSyncIntervalMs: config.zoomUserSyncIntervalMs,
+    });
+    zoomApps.set(name, { zoom: client, tokens: appTokens });
+  }
+  // and each tenant's under its own store key too, found by its own callback secret
+  const tenants = new Map<string, { zoom: ZoomClient; tokens: TokenManager; callbackSecret: string }>();
+  for (const tenant of config.tenants) {
+    const client = new ZoomClient({
+      clientId: tenant.zoomClientId,
+      clientSecret: tenant.zoomClientSecret,
+      redirectUri: tenant.zoomRedirectUri,
+      oauthBaseUrl: config.zoomOauthBaseUrl,
+      apiBaseUrl: config.zoomApiBaseUrl,
+      httpClient,
+    });
+    const tenantTokens = new TokenManager({
+      ...tokenOptions,
+      zoom: client,
+      storeKey: `tenant:${tenant.name}`,
+      consentPath: `/t/${tenant.name}/zoom/oauth`,
+      hooks: tokenEventHooks(notifications, `tenant:${tenant.name}`),
+      userSyncIntervalMs: config.zoomUserSyncIntervalMs,
+    });
+    tenants.set(tenant.name, { zoom: client, tokens: tenantTokens, callbackSecret: tenant.recallCallbackSecret });
+  }
+  const audit = new AuditLog(undefined, auditSink);
+  const identities = new BotIdentityLog(config.botIdentityLog);
+  const issuanceWebhook = config.issuanceWebhookUrl
+    ? new WebhookDispatcher({ urls: [config.issuanceWebhookUrl], secret: config.webhookSecret, httpClient })
+    : undefined;
+  function served(entry: ServedEntry, origin: ServedOrigin = {}): void {
+    const record = identities.served(entry);
+    // reconciliation only needs to know a token went out, never the token itself
+    void issuanceWebhook?.send({
+      id: randomUUID(),
+      type: "token.served",
+      created_at: record.at,
+      data: {
+        token_kind: record.token_kind,
+        user_id: record.user_id,
+        zoom_user_id: record.zoom_user_id,
+        meeting_id: record.meeting_id,
+        bot_id: record.bot_id,
+        zoom_app: origin.zoomApp ?? null,
+        tenant: origin.tenant ?? null,
+        source: record.source,
+      },
+    });
+  }
+  const removedUsers = new RemovedUsers({ path: config.removedUsersFile, retentionMs: config.removedUserRetentionMs });
+  const userMappings = new UserMappings({ path: config.userMappingsFile });
+  const deadLetters = new DeadLetters({ path: config.deadLetterFile });
+  const invitations = new Invitations({
+    baseUrl: config.baseUrl,
+    path: config.onboardingFile,
+    smtpUrl: config.smtpUrl,
+    from: config.onboardingEmailFrom,
+    reminderIntervalMs: config.onboardingReminderIntervalMs,
+    maxReminders: config.onboardingMaxReminders,
+  });
+  const policy = new IssuancePolicy(config.issuanceRules, {
+    onDenied: (request, reason) =>
+      audit.record({
+        action: `${request.kind}.issue`,
+        outcome: "denied",
+        user_id: request.userId,
+        meeting_id: request.meetingId,
+        source: request.source,
+        reason,
+      }),
+    onAnomaly: ({ request, count, windowStartedAt }) => {
+      const subject = request.meetingId ? `meeting ${request.meetingId}` : `user ${request.userId}`;
+      console.warn(`anomalous token issuance: ${count} ${request.kind} token requests for ${subject} within an hour`);
+      audit.record({
+        action: `${request.kind}.issue`,
+        outcome: "allowed",
+        user_id: request.userId,
+        meeting_id: request.meetingId,
+        source: request.source,
+        reason: `anomaly: ${count} ${request.kind} token requests for ${subject} within an hour`,
+      });
+      notifications.emit("issuance.anomaly", {
+        kind: request.kind,
+        user_id: request.userId,
+        meeting_id: request.meetingId ?? null,
+        count,
+        window_started_at: windowStartedAt.toISOString(),
+      });
+    },
+  });
+
+  const callers = new CallerLog();
+  const canaries = new Canaries(config.canaryTokens);
+  const slos = new LatencySlos(config.latencySlos, config.latencySloObjective);
+  const app = express();
+  app.use(recordCallers(audit, callers));
+  if (slos.size > 0) {
+    app.use(trackLatency(slos));
+  }
+  if (canaries.size > 0) {
+    app.use("/recall", catchCanaries({ canaries, audit, notifications }));
+  }
+  if (config.defaultSecretPolicy === "refuse" && config.recallCallbackSecretSource === "default") {
+    // Recall webhooks are signed with a secret of their own, so only the token callbacks are refused;
+    // tenants' callbacks under /t/<tenant>/recall keep working, their secrets are never the default (see tenants in config.ts)
+    app.use("/recall", (req, res, next) => {
+      if (/^\/webhooks(\/|$)/.test(req.path)) return next();
+      writeError(req, res, new HttpError(503, "RECALL_CALLBACK_SECRET is the default, set it before tokens are served"));
+    });
+  }
+  const recordingConfig = realtimeRecordingConfig(config.baseUrl, config.recallCallbackSecret, config.realtimeEvents);
+  const slackLinks = config.slackSigningSecret ? new SlackLinks() : null;
+  if (slackLinks) {
+    // mounted before the global body parser, which would otherwise consume the body Slack signs
+    app.use(
+      "/slack",
+      createSlackRouter({
+        signingSecret: config.slackSigningSecret,
+        zoom,
+        tokens,
+        recall,
+        links: slackLinks,
+        baseUrl: config.baseUrl,
+        callbackSecret: config.recallCallbackSecret,
+        httpClient,
+        notifications,
+        identities,
+        recordingConfig,
+      }),
+    );
+  }
+  const realtime = recordingConfig
+    ? new RealtimeRelay({ url: config.realtimeRelayUrl, secret: config.webhookSecret, httpClient, identities })
+    : null;
+  if (realtime) {
+    app.use("/recall/realtime", createRealtimeRouter({ callbackSecret: config.recallCallbackSecret, relay: realtime }));
+  }
+  if (config.recallWebhookSecret) {
+    app.use("/recall/webhooks", createRecallWebhookRouter({ secret: config.recallWebhookSecret, notifications, deadLetters }));
+  }
+  if (config.zoomWebhookSecretToken) {
+    const admitter =
+      config.autoAdmitBotNames.length > 0
+        ? new WaitingRoomAdmitter({
+            tokens,
+            botNames: config.autoAdmitBotNames,
+            onAdmitted: ({ meetingId, userId, botName }) =>
+              audit.record({
+                action: "waiting_room.admit",
+                outcome: "allowed",
+                user_id: userId,
+                meeting_id: meetingId,
+                source: "zoom webhook",
+                reason: `admitted ${botName} from the waiting room`,
+              }),
+            journal,
+          })
+        : undefined;
+    if (admitter) {
+      // the hosts' tokens have to be loaded before their waiting rooms can be turned back on
+      tokens.ready.then(
+        () => void admitter.resume(),
+        () => {},
+      );
+    }
+    const recordings = new RecordingIngest({
+      tokens,
+      notifications,
+      forwarder: config.recordingForwardUrl
+        ? new WebhookDispatcher({ urls: [config.recordingForwardUrl], secret: config.webhookSecret, httpClient })
+        : undefined,
+    });
+    app.use("/zoom/webhooks", createZoomWebhookRouter({ secretToken: config.zoomWebhookSecretToken, tokens, admitter, recordings, deadLetters }));
+  }
+  app.use(express.urlencoded({ extended: true }));
+
+  const pages = new ConsentPages(config.brandingConfig ? loadBranding(config.brandingConfig, config.brandingAssetsDir) : null);
+  if (config.brandingConfig) {
+    if (config.brandingAssetsDir) {
+      app.use("/branding", express.static(config.brandingAssetsDir, { index: false }));
+    }
+    // somewhere to send people before consent, since Zoom's consent screen can't be branded
+    app.get("/connect", (req, res) => {
+      const providers = [
+        { name: "Zoom", href: "/zoom/oauth" },
+        ...(config.teamsClientId ? [{ name: "Microsoft Teams", href: "/teams/oauth" }] : []),
+        ...(config.googleClientId ? [{ name: "Google", href: "/google/oauth" }] : []),
+      ];
+      pages.connect(req, res, localeFor(req, res, config.defaultLocale), providers);
+    });
+  }
+
+  const consents = new ConsentStates();
+  // ?return_to=, once checked against CONSENT_RETURN_HOSTS; null once the request was refused for any other
+  function returnToFrom(req: express.Request, res: express.Response): string | undefined | null {
+    const returnTo = req.query.return_to;
+    if (returnTo === undefined) return undefined;
+    const allowed = typeof returnTo === "string" ? allowedReturnUrl(returnTo, config.consentReturnHosts) : undefined;
+    if (!allowed) {
+      pages.failure(req, res, localeFor(req, res, config.defaultLocale), new HttpError(400, `return_to is not an allowed url: ${String(returnTo)}`));
+      return null;
+    }
+    return allowed;
+  }
+
+  // without resuming, the cookie only has to outlive the flow's state
+  const consentSessions = new ConsentSessions({ secret: config.consentSessionSecret, ttlMs: config.consentSessionTtlMs || CONSENT_STATE_TTL_MS });
+  // remembers how consent under path, "/zoom" or a tenant's "/t/<name>/zoom", was started, until it completes
+  function rememberConsent(res: express.Response, path: string, session: ConsentSession): void {
+    res.cookie(CONSENT_SESSION_COOKIE, consentSessions.seal(session), { httpOnly: true, maxAge: consentSessions.ttlMs, path });
+  }
+  function forgetConsent(req: express.Request, res: express.Response, path: string): void {
+    if (getCookie(req, CONSENT_SESSION_COOKIE) !== undefined) res.clearCookie(CONSENT_SESSION_COOKIE, { path });
+  }
+  // whether state's callback came back to the browser that started it, so no one can log others in as themselves with
+  // a callback URL of their own consent; the state still has to be claimed
+  function startedHere(req: express.Request, state: string): boolean {
+    if (consentSessions.open(getCookie(req, CONSENT_SESSION_COOKIE))?.state === state) return true;
+    console.warn("refused a consent callback that didn't come back to the browser that started it");
+    return false;
+  }
+  const consentCookie: ConsentCookie = { remember: rememberConsent, forget: forgetConsent, startedHere };
+  // the flow this browser left unfinished, if it was for provider; its invitation and return URL only while they still hold
+  function resumedConsent(req: express.Request, provider: (provider: string) => boolean): ConsentSession | undefined {
+    if (config.consentSessionTtlMs === 0) return undefined;
+    const session = consentSessions.open(getCookie(req, CONSENT_SESSION_COOKIE));
+    if (!session || !provider(session.provider)) return undefined;
+    return {
+      provider: session.provider,
+      invitationId: session.invitationId !== undefined && invitations.get(session.invitationId) ? session.invitationId : undefined,
+      returnTo: session.returnTo !== undefined ? allowedReturnUrl(session.returnTo, config.consentReturnHosts) : undefined,
+    };
+  }
+
+  app.get("/zoom/oauth", (req, res) => {
+    // where to send the user once they consented, e.g. back into a larger onboarding journey
+    const requestedReturnTo = returnToFrom(req, res);
+    if (requestedReturnTo === null) return;
+    // coming back without a link picks up the flow left unfinished in this browser, e.g. from the "start over" button days later
+    const resumed =
+      req.query.app === undefined && req.query.invitation === undefined && requestedReturnTo === undefined
+        ? resumedConsent(req, (provider) => provider === "zoom" || (provider.startsWith("zoom:") && zoomApps.has(provider.slice("zoom:".length))))
+        : undefined;
+    if (resumed) console.log(`resumed an unfinished ${resumed.provider} consent${resumed.invitationId ? ` for invitation ${resumed.invitationId}` : ""}`);
+    const returnTo = requestedReturnTo ?? resumed?.returnTo;
+    const appName = req.query.app !== undefined ? String(req.query.app) : resumed?.provider.startsWith("zoom:") ? resumed.provider.slice("zoom:".length) : undefined;
+    if (appName !== undefined) {
+      const zoomApp = zoomApps.get(appName);
+      if (!zoomApp) {
+        pages.failure(req, res, localeFor(req, res, config.defaultLocale), new HttpError(404, `unknown zoom app: ${appName}`));
+        return;
+      }
+      const state = consents.start(`zoom:${appName}`, returnTo);
+      rememberConsent(res, "/zoom", { provider: `zoom:${appName}`, returnTo, state });
+      res.redirect(zoomApp.zoom.authorizeUrl(state, consents.codeChallengeOf(state)));
+      return;
+    }
+    if (config.zoomAccountId) {
+      writeError(req, res, new HttpError(404, "this server uses server-to-server oauth, users don't consent"));
+      return;
+    }
+    // onboarding links carry their invitation, so the consent that follows completes it
+    const invitationId = req.query.invitation ?? resumed?.invitationId;
+    const invitation = typeof invitationId === "string" ? invitations.get(invitationId) : undefined;
+    if (invitationId !== undefined && !invitation) {
+      const locale = localeFor(req, res, config.defaultLocale);
+      pages.failure(req, res, locale, new HttpError(404, translate(locale, "consent.unknown_invitation")));
+      return;
+    }
+    const state = consents.start("zoom", returnTo);
+    if (invitation) invitations.started(invitation.id, state);
+    rememberConsent(res, "/zoom", { provider: "zoom", invitationId: invitation?.id, returnTo, state });
+    res.redirect(zoom.authorizeUrl(state, consents.codeChallengeOf(state)));
+  });
+
+  app.get("/zoom/oauth-callback", async (req, res) => {
+    const locale = localeFor(req, res, config.defaultLocale);
+    const authCode = req.query.code as string | undefined;
+    if (!authCode) {
+      pages.failure(req, res, locale, new HttpError(400, translate(locale, "consent.missing_code")));
+      return;
+    }
+
+    const state = req.query.state as string | undefined;
+    // a further app's redirect URI names it, failing that the consent it started does
+    const provider = req.query.app !== undefined ? `zoom:${String(req.query.app)}` : state !== undefined ? consents.providerOf(state) : undefined;
+    if (provider?.startsWith("zoom:")) {
+      const name = provider.slice("zoom:".length);
+      const zoomApp = zoomApps.get(name);
+      if (!zoomApp) {
+        pages.failure(req, res, locale, new HttpError(404, `unknown zoom app: ${name}`));
+        return;
+      }
+      const flow = { provider, tokens: zoomApp.tokens, consentPath: `/zoom/oauth?app=${name}`, cookie: `zoom_${name}_user_id` };
+      await completeSeparateConsent(req, res, locale, flow, authCode, state);
+      return;
+    }
+    const returnTo = state !== undefined ? consents.returnToOf(state) : undefined;
+    const codeVerifier = state !== undefined ? (consents.codeVerifierOf(state) ?? slackLinks?.codeVerifierOf(state)) : undefined;
+    // Marketplace installs arrive without a state, and Slack links from Slack rather than this browser; any other consent
+    // must be one started here, in this browser, and completes once
+    if (state !== undefined && !slackLinks?.isPending(state) && (!startedHere(req, state) || !consents.claim(state, "zoom"))) {
+      pages.expired(req, res, locale, "Zoom", "/zoom/oauth");
+      return;
+    }
+    try {
+      const { userId, reconnected } = await tokens.connect(authCode, codeVerifier);
+      if (reconnected) {
+        console.log(`zoom user ${tokens.zoomUserId(userId)} consented again, replaced the tokens of user ${userId}`);
+      }
+      removedUsers.restored(userId, tokens.zoomUserId(userId));
+      const invitation = state ? invitations.completed(state, userId, tokens.zoomUserId(userId)) : null;
+      if (invitation) {
+        console.log(`onboarding invitation for ${invitation.email} completed by user ${userId}`);
+        audit.record({ action: "onboarding.complete", outcome: "allowed", user_id: userId, source: "onboarding link", reason: `invited as ${invitation.email}` });
+      }
+
+      res.cookie("zoom_user_id", userId, { httpOnly: true, maxAge: 30 * 24 * 60 * 60 * 1000 });
+      forgetConsent(req, res, "/zoom");
+      if (state && slackLinks?.complete(state, userId)) {
+        pages.success(req, res, locale, translate(locale, "consent.slack_linked", { user_id: userId }));
+        return;
+      }
+      if (returnTo) {
+        res.redirect(returnTo);
+        return;
+      }
+      pages.success(req, res, locale, translate(locale, "consent.connected"), connectedDetails(locale, tokens, userId));
+    } catch (error) {
+      if (error instanceof AuthorizationCodeExpiredError) {
+        // a pending Slack link moves to a fresh state, so starting over still links the account
+        const renewed = state ? slackLinks?.renew(state) : undefined;
+        // and starting over from an onboarding link still completes its invitation
+        const invitation = state ? invitations.startedFrom(state) : undefined;
+        pages.expired(req, res, locale, "Zoom", renewed ? zoom.authorizeUrl(renewed, slackLinks?.codeChallengeOf(renewed)) : (invitation?.link ?? error.consentPath));
+        return;
+      }
+      if (error instanceof CodeVerifierMismatchError) refusedVerifier(req, "zoom");
+      writeConsentError(req, res, pages, locale, error);
+    }
+  });
+
+  // a code that came back with the state of a flow started here, but was issued for another one's challenge
+  function refusedVerifier(req: express.Request, provider: string): void {
+    console.warn(`${req.method} ${req.baseUrl}${req.path}: zoom refused the code verifier of a ${provider} consent`);
+    audit.record({ action: "consent.complete", outcome: "denied", user_id: "", source: req.ip ?? "", reason: `${provider} consent refused: code verifier mismatch` });
+  }
+
+  // completes consent to a Zoom app whose users are stored apart from the default app's
+  async function completeSeparateConsent(
+    req: express.Request,
+    res: express.Response,
+    locale: Locale,
+    flow: { provider: string; tokens: TokenManager; consentPath: string; cookie: string; cookiePath?: string },
+    authCode: string,
+    state: string | undefined,
+  ): Promise<void> {
+    const returnTo = state !== undefined ? consents.returnToOf(state) : undefined;
+    const codeVerifier = state !== undefined ? consents.codeVerifierOf(state) : undefined;
+    if (state !== undefined && (!startedHere(req, state) || !consents.claim(state, flow.provider))) {
+      pages.expired(req, res, locale, "Zoom", flow.consentPath);
+      return;
+    }
+    try {
+      const { userId, reconnected } = await flow.tokens.connect(authCode, codeVerifier);
+      if (reconnected) {
+        console.log(`zoom user ${flow.tokens.zoomUserId(userId)} consented again to ${flow.provider}, replaced the tokens of user ${userId}`);
+      }
+      res.cookie(flow.cookie, userId, { httpOnly: true, maxAge: 30 * 24 * 60 * 60 * 1000, path: flow.cookiePath ?? "/" });
+      forgetConsent(req, res, `${flow.cookiePath ?? ""}/zoom`);
+      if (returnTo) {
+        res.redirect(returnTo);
+        return;
+      }
+      pages.success(req, res, locale, translate(locale, "consent.connected"), connectedDetails(locale, flow.tokens, userId));
+    } catch (error) {
+      if (error instanceof AuthorizationCodeExpiredError) {
+        pages.expired(req, res, locale, "Zoom", error.consentPath);
+        return;
+      }
+      if (error instanceof CodeVerifierMismatchError) refusedVerifier(req, flow.provider);
+      writeConsentError(req, res, pages, locale, error);
+    }
+  }
+
+  const microsoft = config.teamsClientId
+    ? new MicrosoftClient({
+        clientId: config.teamsClientId,
+        clientSecret: config.teamsClientSecret,
+        redirectUri: `${config.baseUrl}/teams/oauth-callback`,
+        tenant: config.teamsTenant,
+        scopes: config.teamsScopes,
+        loginBaseUrl: config.microsoftLoginBaseUrl,
+        httpClient,
+      })
+    : null;
+  const teamsTokens = microsoft ? mountOAuthProvider(app, config, pages, consents, consentCookie, store, {
+        name: "microsoft",
+        path: "/teams",
+        client: microsoft,
+        hooks: tokenEventHooks(notifications, "microsoft"),
+        // left unused that long, Microsoft's refresh tokens expire
+        refreshTokenLifetimeMs: 90 * 24 * 60 * 60 * 1000,
+      }) : null;
+
+  const google = config.googleClientId
+    ? new GoogleClient({
+        clientId: config.googleClientId,
+        clientSecret: config.googleClientSecret,
+        redirectUri: `${config.baseUrl}/google/oauth-callback`,
+        scopes: config.googleScopes,
+        authBaseUrl: config.googleAuthBaseUrl,
+        tokenBaseUrl: config.googleTokenBaseUrl,
+        httpClient,
+      })
+    : null;
+  const googleTokens = google ? mountOAuthProvider(app, config, pages, consents, consentCookie, store, {
+        name: "google",
+        path: "/google",
+        client: google,
+        hooks: tokenEventHooks(notifications, "google"),
+        refreshTokenLifetimeMs: 0,
+      }) : null;
+
+  app.get("/me", (req, res) => {
+    const userId = getCookie(req, "zoom_user_id");
+    if (!userId) {
+      writeError(req, res, new HttpError(401, "not authenticated. please visit /zoom/oauth"));
+      return;
+    }
+
+    if (!tokens.has(userId)) {
+      writeError(req, res, new HttpError(404, `no tokens found for user: ${userId}. please visit /zoom/oauth`));
+      return;
+    }
+
+    try {
+      writeJSON(res, 200, {
+        user_id: userId,
+        has_oauth_token: !!tokens.get(userId).accessToken,
+      });
+    } catch (error) {
+      // expired or deactivated, like any other token lookup
+      writeError(req, res, error);
+    }
+  });
+
+  const about = aboutJSON(config);
+  app.get("/about", (_req, res) => {
+    writeJSON(res, 200, about);
+  });
+
+  app.get("/readyz", (_req, res) => {
+    const report = health.report();
+    writeJSON(res, report.ready ? 200 : 503, healthJSON(report));
+  });
+
+  app.get("/metrics", (_req, res) => {
+    res
+      .type("text/plain; version=0.0.4")
+      .send(
+        healthMetrics(health.report()) +
+          reauthorizationMetrics(tokens.list(), config.reauthorizationWarningMs) +
+          clockSkewMetrics(clock.measuredMs()) +
+          latencySloMetrics(slos) +
+          invitationMetrics(invitations.list()),
+      );
+  });
+
+  app.get("/launch", (req, res) => {
+    const userId = getCookie(req, "zoom_user_id");
+    if (!userId || !tokens.has(userId)) {
+      writeError(req, res, new HttpError(401, "not authenticated. please visit /zoom/oauth first"));
+      return;
+    }
+    // reconnecting before the forecast date keeps the bot's tokens from dying unannounced
+    const dueAt = tokens.status(userId).reauthorizationDueAt;
+    const reconnect =
+      dueAt && dueAt.getTime() - Date.now() <= config.reauthorizationWarningMs
+        ? `<p>Your Zoom connection has to be renewed by ${escapeHTML(formatTime(dueAt, tokens.zoomProfile(userId).timeZone ?? config.displayTimeZone))}: <a href="/zoom/oauth">reconnect Zoom</a></p>`
+        : "";
+
+    res.send(`
+      <!DOCTYPE html>
+      <html>
+      <head><title>Launch Bot</title></head>
+      <body>
+        ${healthBanner(health.report())}
+        <h1>Launch Recording Bot</h1>
+        <p>Logged in as: ${userId}</p>
+        ${reconnect}
+        <form method="POST" action="/launch">
+          <label>Zoom Meeting URL:</label><br>
+          <input type="text" name="meeting_url" style="width: 400px" placeholder="https://zoom.us/j/123456789" required><br><br>
+          <button type="submit">Launch Bot</button>
+        </form>
+      </body>
+      </html>
+    `);
+  });
+
+  app.post("/launch", async (req, res) => {
+    const userId = getCookie(req, "zoom_user_id");
+    if (!userId || !tokens.has(userId)) {
+      writeError(req, res, new HttpError(401, "not authenticated. please visit /zoom/oauth first"));
+      return;
+    }
+
+    if (!config.recallApiKey) {
+      writeError(req, res, new HttpError(500, "RECALL_API_KEY is not configured"));
+      return;
+    }
+
+    const meetingUrl = req.body.meeting_url as string | undefined;
+    if (!meetingUrl) {
+      writeError(req, res, new HttpError(400, "meeting_url is required"));
+      return;
+    }
+
+    const obfTokenUrl = recallCallbackUrl(config.baseUrl, "obf-callback", tokens.callbackSecret(userId) ?? config.recallCallbackSecret, userId);
+
+    // runs the checks the bot's OBF callback will, without creating a bot
+    if (req.query.dry_run === "true" || req.body.dry_run === "true") {
+      try {
+        const meetingId = meetingIdFromUrl(meetingUrl);
+        if (!meetingId) {
+          throw new HttpError(400, `no zoom meeting ID in meeting_url: ${meetingUrl}`);
+        }
+        policy.verify({ kind: "obf", userId, meetingId, source: req.ip });
+        await tokens.checkIssuance(userId, "obf");
+        res.set("Dry-Run", "true").send(`
+          <!DOCTYPE html>
+          <html>
+          <head><title>Dry Run Passed</title></head>
+          <body>
+            <h1>Dry Run Passed</h1>
+            <p>A bot would be launched for meeting ${meetingId} and get its OBF tokens as ${userId}. No bot was created.</p>
+            <p><a href="/launch">Back</a></p>
+          </body>
+          </html>
+        `);
+      } catch (error) {
+        writeError(req, res, error, "error checking bot launch");
+      }
+      return;
+    }
+
+    try {
+      const bot = await recall.createBot({
+        meeting_url: meetingUrl,
+        bot_name: "Recall Bot",
+        zoom: {
+          obf_token_url: obfTokenUrl,
+        },
+        automatic_leave: {
+          // you can set the waiting room timeout to determine how long the bot will wait for the OBF user to join the meeting
+          waiting_room_timeout: 1200,
+        },
+        ...(recordingConfig ? { recording_config: recordingConfig } : {}),
+      });
+      notifications.emit("bot.launched", { bot_id: bot.id, meeting_url: meetingUrl, user_id: userId, source: "web" });
+      identities.launched({
+        botId: bot.id,
+        userId,
+        zoomUserId: tokens.zoomUserId(userId),
+        meetingId: meetingIdFromUrl(meetingUrl),
+        source: "web",
+      });
+
+      res.send(`
+        <!DOCTYPE html>
+        <html>
+        <head><title>Bot Launched</title></head>
+        <body>
+          <h1>Bot Launched Successfully</h1>
+          <p>Bot ID: ${bot.id}</p>
+          <p><a href="/launch">Launch another</a></p>
+        </body>
+        </html>
+      `);
+    } catch (error) {
+      writeError(req, res, error, "error launching bot");
+    }
+  });
+
+  const proxyTokens = config.proxyTokens ? new ProxyTokens({ ttlMs: config.proxyTokenTtlMs }) : undefined;
+  const sweeps: RetentionSweep[] = [
+    {
+      name: "expired_cache_entries",
+      sweep: () =>
+        tokens.purgeExpired() +
+        [...zoomApps.values(), ...tenants.values()].reduce((total, separate) => total + separate.tokens.purgeExpired(), 0) +
+        consents.purgeExpired() + (proxyTokens?.purgeExpired() ?? 0) + (slackLinks?.purgeExpired() ?? 0) + invitations.purgeExpired(),
+    },
+    { name: "completed_jobs", sweep: () => journal.compact() },
+    { name: "orphaned_slack_links", sweep: () => slackLinks?.forgetUnless((userId) => tokens.has(userId)) ?? 0 },
+    { name: "removed_users", sweep: (now) => removedUsers.prune(now) },
+  ];
+  if (config.auditRetentionMs > 0) {
+    sweeps.push({ name: "audit_entries", sweep: (now) => audit.prune(now - config.auditRetentionMs) });
+  }
+  if (config.botIdentityRetentionMs > 0) {
+    sweeps.push({ name: "bot_identities", sweep: (now) => identities.prune(now - config.botIdentityRetentionMs) });
+  }
+  if (config.deadLetterRetentionMs > 0) {
+    sweeps.push({ name: "dead_letters", sweep: (now) => deadLetters.prune(now - config.deadLetterRetentionMs) });
+  }
+  if (config.tokenHistoryRetentionMs > 0 && store.pruneHistory) {
+    sweeps.push({ name: "token_history_entries", sweep: (now) => store.pruneHistory!(new Date(now - config.tokenHistoryRetentionMs)) });
+  }
+  const retention = new Retention({ sweeps, intervalMs: config.retentionIntervalMs });
+
+  app.use(
+    "/admin",
+    requireAdminKey(config.adminApiKey),
+    createAdminRouter({
+      tokens,
+      audit,
+      policy,
+      identities,
+      callers,
+      canaries,
+      retention,
+      removedUsers,
+      userMappings,
+      deadLetters,
+      invitations,
+      supportBundle: new SupportBundle({ config, health, zoomErrors }),
+      slos,
+    }),
+  );
+  if (faults) {
+    app.use("/debug/faults", requireAdminKey(config.adminApiKey), createFaultRouter(faults));
+  }
+  if (config.brokerConfig) {
+    const broker = new TokenBroker({ clients: loadBrokerClients(config.brokerConfig), tokens, audit, policy });
+    app.use("/broker", createBrokerRouter(broker));
+    app.use("/admin/broker", requireAdminKey(config.adminApiKey), createBrokerAdminRouter(broker));
+  }
+  if (realtime) {
+    app.use("/admin/realtime", requireAdminKey(config.adminApiKey), createRealtimeStreamRouter(realtime));
+  }
+
+  // each tenant's consent and Recall callbacks live under /t/<name>/, like the default ones at the root
+  for (const [name, tenant] of tenants) {
+    const router = express.Router();
+    const consentPath = `/t/${name}/zoom/oauth`;
+    router.get("/zoom/oauth", (req, res) => {
+      const requestedReturnTo = returnToFrom(req, res);
+      if (requestedReturnTo === null) return;
+      const returnTo = requestedReturnTo ?? resumedConsent(req, (provider) => provider === `tenant:${name}`)?.returnTo;
+      const state = consents.start(`tenant:${name}`, returnTo);
+      rememberConsent(res, `/t/${name}/zoom`, { provider: `tenant:${name}`, returnTo, state });
+      res.redirect(tenant.zoom.authorizeUrl(state, consents.codeChallengeOf(state)));
+    });
+    router.get("/zoom/oauth-callback", async (req, res) => {
+      const locale = localeFor(req, res, config.defaultLocale);
+      const authCode = req.query.code as string | undefined;
+      if (!authCode) {
+        pages.failure(req, res, locale, new HttpError(400, translate(locale, "consent.missing_code")));
+        return;
+      }
+      // the cookie is the tenant's alone, so one browser can be connected to several tenants
+      const flow = { provider: `tenant:${name}`, tokens: tenant.tokens, consentPath, cookie: "zoom_user_id", cookiePath: `/t/${name}` };
+      await completeSeparateConsent(req, res, locale, flow, authCode, req.query.state as string | undefined);
+    });
+    if (canaries.size > 0) {
+      router.use("/recall", catchCanaries({ canaries, audit, notifications }));
+    }
+    router.use(
+      "/recall",
+      createRecallRouter({
+        tokens: tenant.tokens,
+        callbackSecret: tenant.callbackSecret,
+        policy,
+        resolveHosts: config.resolveMeetingHosts,
+        meetingPasscodes: config.zakMeetingPasscodes,
+        resolveOccurrences: config.resolveMeetingOccurrences,
+        resolvePersonalMeetings: config.resolvePersonalMeetings,
+        requireUserSecrets: config.requireUserCallbackSecrets,
+        responseFormat: config.recallResponseFormat,
+        onServed: ({ kind, userId, meetingId, source }) =>
+          served({ kind, userId, zoomUserId: tenant.tokens.zoomUserId(userId), meetingId, source: `${source} (tenant ${name})` }, { tenant: name }),
+      }),
+    );
+    app.use(`/t/${name}`, router);
+  }
+
+  // `?app=<name>` serves a further Zoom app's users, without it the callbacks serve ZOOM_CLIENT_ID's
+  const zoomAppRecallRouters = new Map(
+    [...zoomApps].map(([name, { tokens: appTokens }]) => [
+      name,
+      createRecallRouter({
+        tokens: appTokens,
+        callbackSecret: config.recallCallbackSecret,
+        policy,
+        resolveHosts: config.resolveMeetingHosts,
+        meetingPasscodes: config.zakMeetingPasscodes,
+        resolveOccurrences: config.resolveMeetingOccurrences,
+        resolvePersonalMeetings: config.resolvePersonalMeetings,
+        requireUserSecrets: config.requireUserCallbackSecrets,
+        responseFormat: config.recallResponseFormat,
+        onServed: ({ kind, userId, meetingId, source }) =>
+          served({ kind, userId, zoomUserId: appTokens.zoomUserId(userId), meetingId, source: `${source} (zoom app ${name})` }, { zoomApp: name }),
+      }),
+    ]),
+  );
+  app.use("/recall", (req, res, next) => {
+    if (req.query.app === undefined) {
+      next();
+      return;
+    }
+    const router = zoomAppRecallRouters.get(String(req.query.app));
+    if (!router) {
+      writeError(req, res, new HttpError(404, `unknown zoom app: ${String(req.query.app)}`));
+      return;
+    }
+    // the app's users are never served by the default router
+    router(req, res, (error?: unknown) => (error ? next(error) : writeError(req, res, new HttpError(404, `zoom app ${String(req.query.app)} has no ${req.path}`))));
+  });
+  app.use(
+    "/recall",
+    createRecallRouter({
+      tokens,
+      callbackSecret: config.recallCallbackSecret,
+      policy,
+      resolveHosts: config.resolveMeetingHosts,
+      meetingPasscodes: config.zakMeetingPasscodes,
+      resolveOccurrences: config.resolveMeetingOccurrences,
+      resolvePersonalMeetings: config.resolvePersonalMeetings,
+      requireUserSecrets: config.requireUserCallbackSecrets,
+      proxyTokens,
+      exchangeAccessTokens: config.proxyTokenExchangeAccess,
+      userMappings,
+      responseFormat: config.recallResponseFormat,
+      onServed: ({ kind, userId, meetingId, source }) =>
+        served({ kind, userId, zoomUserId: tokens.zoomUserId(userId), meetingId, source }),
+    }),
+  );
+
+  return {
+    app,
+    tokens,
+    zoomApps: new Map([...zoomApps].map(([name, zoomApp]) => [name, zoomApp.tokens])),
+    tenants: new Map([...tenants].map(([name, tenant]) => [name, tenant.tokens])),
+    teamsTokens,
+    googleTokens,
+    notifications,
+    policy,
+    audit,
+    identities,
+    served,
+    removedUsers,
+    userMappings,
+    deadLetters,
+    invitations,
+    callers,
+    canaries,
+    health,
+    retention,
+  };
+}
@@ -0,0 +1,73 @@
+const DEFAULT_MAX_ENTRIES = 1000;
+
+export interface AuditEntry {
+  at: string;
+  // e.g. "obf.issue"
+  action: string;
+  outcome: "allowed" | "denied";
+  user_id: string;
+  meeting_id?: string;
+  source?: string;
+  reason?: string;
+  // on Recall callback hits, to tell Recall from scanners
+  user_agent?: string;
+  recall_headers?: Record<string, string>;
+}
+
+/** Where audit entries are also written so they survive a restart, e.g. the SQLite token store. */
+export interface AuditSink {
+  appendAuditEntry(at: string, entry: object): void;
+  // oldest first
+  recentAuditEntries(limit: number): object[];
+  pruneAuditEntries(before: Date): number;
+}
+
+/**
+ * Records security-relevant decisions as one JSON line each on stdout, so log
+ * shipping picks them up, and keeps the most recent ones in memory for the
+ * admin API. With a sink, entries are written to it too, and the most
+ * recent ones are read back from it at startup.
+ */
+export class AuditLog {
+  private readonly maxEntries: number;
+  private readonly sink: AuditSink | undefined;
+  private readonly entries: AuditEntry[] = [];
+
+  constructor(maxEntries: number = DEFAULT_MAX_ENTRIES, sink?: AuditSink) {
+    this.maxEntries = maxEntries;
+    this.sink = sink;
+    if (sink) {
+      this.entries.push(...(sink.recentAuditEntries(maxEntries) as AuditEntry[]));
+    }
+  }
+
+  record(entry: Omit<AuditEntry, "at">): AuditEntry {
+    const recorded: AuditEntry = { at: new Date().toISOString(), ...entry };
+    console.log(`audit ${JSON.stringify(recorded)}`);
+    try {
+      this.sink?.appendAuditEntry(recorded.at, recorded);
+    } catch (error) {
+      // the entry still went to stdout
+      console.error("could not write an audit entry to the store", error);
+    }
+    this.entries.push(recorded);
+    if (this.entries.length > this.maxEntries) {
+      this.entries.shift();
+    }
+    return recorded;
+  }
+
+  /** Forgets entries recorded before before, in ms since the epoch; returns how many. */
+  prune(before: number): number {
+    const kept = this.entries.findIndex((entry) => Date.parse(entry.at) >= before);
+    const forgotten = this.entries.splice(0, kept === -1 ? this.entries.length : kept).length;
+    // the sink holds more than the entries kept in memory
+    return this.sink ? this.sink.pruneAuditEntries(new Date(before)) : forgotten;
+  }
+
+  /** Returns recorded entries, newest first, only those of source when given. */
+  list(limit: number = this.maxEntries, source?: string): AuditEntry[] {
+    const entries = source === undefined ? this.entries : this.entries.filter((entry) => entry.source === source);
+    return entries.slice(-limit).reverse();
+  }
+}
@@ -0,0 +1,383 @@
+import { timingSafeEqual } from "crypto";
+import { readFileSync } from "fs";
+import express from "express";
+import type { AuditLog } from "./audit.js";
+import { ConfigError } from "./config.js";
+import { HourlyCounter, HttpError, ISSUANCE_WINDOW_MS, IssuanceDeniedError, IssuanceQuotaExceededError, parseMeetingId } from "./zoomrecall/index.js";
+import type { IssuancePolicy, TokenManager } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+export const DEFAULT_BROKER_QUOTA_PER_HOUR = 60;
+// what a client may ask the broker for: an access token, or an OBF or ZAK token minted with one
+export const BROKER_ENDPOINTS = ["token", "obf", "zak"] as const;
+export type BrokerEndpoint = (typeof BROKER_ENDPOINTS)[number];
+
+/** An internal service allowed to get Zoom credentials from the broker. */
+export interface BrokerClient {
+  name: string;
+  key: string;
+  // user IDs or emails the client may get tokens of; empty means every connected user
+  users: string[];
+  // Zoom scopes the client may ask access tokens for
+  scopes: string[];
+  endpoints: BrokerEndpoint[];
+  // tokens of any kind the client may get in an hour; 0 means unlimited
+  quotaPerHour: number;
+}
+
+interface BrokerFile {
+  clients?: {
+    name?: unknown;
+    key?: unknown;
+    users?: unknown;
+    scopes?: unknown;
+    endpoints?: unknown;
+    max_per_hour?: unknown;
+  }[];
+}
+
+/**
+ * Reads a broker file, e.g. {"clients": [{"name": "billing", "key": "...",
+ * "scopes": ["meeting:read:meeting"], "endpoints": ["token", "zak"],
+ * "users": ["ops@example.com"], "max_per_hour": 120}]}. Throws ConfigError
+ * on anything invalid.
+ */
+export function loadBrokerClients(path: string): BrokerClient[] {
+  let file: BrokerFile;
+  try {
+    file = JSON.parse(readFileSync(path, "utf8")) as BrokerFile;
+  } catch (error) {
+    throw new ConfigError(`could not read BROKER_CONFIG ${path}: ${error instanceof Error ? error.message : String(error)}`);
+  }
+  if (!Array.isArray(file.clients) || file.clients.length === 0) {
+    throw new ConfigError(`BROKER_CONFIG ${path} has no clients`);
+  }
+
+  const strings = (value: unknown, name: string): string[] => {
+    if (value === undefined) return [];
+    if (!Array.isArray(value) || value.some((item) => typeof item !== "string" || !item.trim())) {
+      throw new ConfigError(`broker client ${name} must be an array of non-empty strings`);
+    }
+    return value.map((item: string) => item.trim());
+  };
+
+  const clients: BrokerClient[] = [];
+  for (const entry of file.clients) {
+    const name = typeof entry.name === "string" ? entry.name.trim() : "";
+    if (!/^[\w.-]+$/.test(name)) {
+      throw new ConfigError("broker client names must be letters, digits, '.', '_' or '-'");
+    }
+    if (typeof entry.key !== "string" || entry.key.length < 32) {
+      throw new ConfigError(`broker client ${name} needs a key of at least 32 characters, generate one with generate-secret`);
+    }
+    const endpoints = entry.endpoints === undefined ? ["token"] : strings(entry.endpoints, `${name} endpoints`);
+    const unknown = endpoints.find((endpoint) => !(BROKER_ENDPOINTS as readonly string[]).includes(endpoint));
+    if (unknown !== undefined || endpoints.length === 0) {
+      throw new ConfigError(`broker client ${name} endpoints must be some of ${BROKER_ENDPOINTS.join(", ")}`);
+    }
+    const scopes = strings(entry.scopes, `${name} scopes`);
+    if (scopes.length === 0 && endpoints.includes("token")) {
+      throw new ConfigError(`broker client ${name} needs the scopes it may ask access tokens for`);
+    }
+    const quota = entry.max_per_hour ?? DEFAULT_BROKER_QUOTA_PER_HOUR;
+    if (typeof quota !== "number" || !Number.isInteger(quota) || quota < 0) {
+      throw new ConfigError(`broker client ${name} max_per_hour must be a whole number, 0 for unlimited`);
+    }
+    if (clients.some((client) => client.name === name || client.key === entry.key)) {
+      throw new ConfigError(`BROKER_CONFIG has ${name} or its key twice`);
+    }
+    clients.push({
+      name,
+      key: entry.key,
+      users: strings(entry.users, `${name} users`),
+      scopes,
+      endpoints: endpoints as BrokerEndpoint[],
+      quotaPerHour: quota,
+    });
+  }
+  return clients;
+}
+
+function safeEqual(a: string, b: string): boolean {
+  const left = Buffer.from(a);
+  const right = Buffer.from(b);
+  return left.length === right.length && timingSafeEqual(left, right);
+}
+
+// the quota window a request took its slot in
+interface Reservation {
+  count: number;
+}
+
+// a window that has ended since is dropped by the counter, so giving its slot back changes nothing
+function release(reserved: Reservation): void {
+  if (reserved.count > 0) reserved.count--;
+}
+
+export interface BrokeredToken {
+  userId: string;
+  accessToken: string;
+  expiresAt: Date;
+  scopes: string[];
+}
+
+/** What one client got from the broker, for the admin API; never its key. */
+export interface BrokerClientUsage {
+  name: string;
+  endpoints: BrokerEndpoint[];
+  scopes: string[];
+  users: string[];
+  quotaPerHour: number;
+  // in the current one-hour window
+  issued: number;
+  windowStartedAt: Date | null;
+  lastIssuedAt: Date | null;
+}
+
+export interface TokenBrokerOptions {
+  clients: BrokerClient[];
+  tokens: TokenManager;
+  audit: AuditLog;
+  // checked before every OBF and ZAK token, like for Recall
+  policy?: IssuancePolicy;
+}
+
+/**
+ * Hands Zoom credentials of connected users to internal services, so they
+ * call the Zoom API or join meetings without keeping credentials of their
+ * own. A client only gets what its endpoints allow, of the users and with
+ * the scopes it is configured for, at most its quota an hour; every request
+ * is audited with the client as broker:<name>.
+ */
+export class TokenBroker {
+  private readonly clients: BrokerClient[];
+  private readonly tokens: TokenManager;
+  private readonly audit: AuditLog;
+  private readonly policy: IssuancePolicy | undefined;
+  private readonly issued = new HourlyCounter();
+  private readonly lastIssued = new Map<string, number>();
+
+  constructor(options: TokenBrokerOptions) {
+    this.clients = options.clients;
+    this.tokens = options.tokens;
+    this.audit = options.audit;
+    this.policy = options.policy;
+  }
+
+  /** The client whose key this is, if any. */
+  authenticate(key: string): BrokerClient | undefined {
+    return this.clients.find((client) => safeEqual(key, client.key));
+  }
+
+  /**
+   * Returns the user's current access token for client, throwing
+   * IssuanceDeniedError when the client may not have it and
+   * IssuanceQuotaExceededError once its quota is used up. Zoom can't narrow
+   * a token, so the scopes asked for are checked against what the user
+   * granted and the token carries all of them.
+   */
+  async issue(client: BrokerClient, user: { userId?: string; email?: string }, scopes: string[] = client.scopes): Promise<BrokeredToken> {
+    const userId = await this.resolve(client, "token", "broker.issue", user);
+    const reserved = this.admit(client, "token", "broker.issue", userId, user.email);
+    try {
+      const unallowed = scopes.filter((scope) => !client.scopes.includes(scope));
+      if (unallowed.length > 0) {
+        throw this.deny(client, "broker.issue", userId, `client ${client.name} may not ask for ${unallowed.join(", ")}`);
+      }
+      // throws TokenNotSetError for users that never connected
+      const status = this.tokens.status(userId);
+      // the scopes of tokens stored without them aren't known, so they can't be checked
+      const granted = status.scopes;
+      const ungranted = granted ? scopes.filter((scope) => !granted.includes(scope)) : [];
+      if (ungranted.length > 0) {
+        throw this.deny(client, "broker.issue", userId, `user ${userId} hasn't granted ${ungranted.join(", ")}`);
+      }
+      const { accessToken } = this.tokens.get(userId);
+      this.lastIssued.set(client.name, Date.now());
+      this.audit.record({ action: "broker.issue", outcome: "allowed", user_id: userId, source: `broker:${client.name}`, reason: `scopes ${scopes.join(" ")}` });
+      return { userId, accessToken, expiresAt: this.tokens.status(userId).expiresAt, scopes };
+    } catch (error) {
+      release(reserved);
+      throw error;
+    }
+  }
+
+  /** Mints an OBF or ZAK token of the user for client, checked like issue and by the issuance policy. */
+  async mint(client: BrokerClient, kind: "obf" | "zak", user: { userId?: string; email?: string }, meetingId?: string): Promise<{ userId: string; token: string }> {
+    const action = `${kind}.issue`;
+    const userId = await this.resolve(client, kind, action, user);
+    const reserved = this.admit(client, kind, action, userId, user.email);
+    try {
+      // the policy audits what it refuses
+      this.policy?.enforce({ kind, userId, meetingId, source: `broker:${client.name}` });
+      const token = kind === "obf" ? await this.tokens.generateObfToken(userId, meetingId) : await this.tokens.generateZakToken(userId);
+      this.lastIssued.set(client.name, Date.now());
+      this.audit.record({ action, outcome: "allowed", user_id: userId, meeting_id: meetingId, source: `broker:${client.name}` });
+      return { userId, token };
+    } catch (error) {
+      release(reserved);
+      throw error;
+    }
+  }
+
+  /** Every client with what it got in the current hour. */
+  usage(): BrokerClientUsage[] {
+    const now = Date.now();
+    return this.clients.map((client) => {
+      const window = this.issued.peek(client.name, now);
+      const lastIssued = this.lastIssued.get(client.name);
+      return {
+        name: client.name,
+        endpoints: client.endpoints,
+        scopes: client.scopes,
+        users: client.users,
+        quotaPerHour: client.quotaPerHour,
+        issued: window?.count ?? 0,
+        windowStartedAt: window ? new Date(window.startedAt) : null,
+        lastIssuedAt: lastIssued === undefined ? null : new Date(lastIssued),
+      };
+    });
+  }
+
+  // the user asked for; an email that isn't connected is refused like an unlisted one, so unlisted users can't be told apart by it
+  private async resolve(client: BrokerClient, endpoint: BrokerEndpoint, action: string, user: { userId?: string; email?: string }): Promise<string> {
+    if (user.userId !== undefined) return user.userId;
+    const email = user.email!;
+    if (!client.endpoints.includes(endpoint)) {
+      throw this.deny(client, action, email, `client ${client.name} may not use the ${endpoint} endpoint`);
+    }
+    try {
+      return await this.tokens.userForEmail(email);
+    } catch (error) {
+      if (client.users.length > 0 && !client.users.some((allowed) => allowed.toLowerCase() === email.toLowerCase())) {
+        throw this.deny(client, action, email, `client ${client.name} may not get tokens of user ${email}`);
+      }
+      throw error;
+    }
+  }
+
+  // throws unless client may use endpoint for userId, named by email when asked by it, and has quota left;
+  // the slot is taken right away so concurrent requests can't go past the quota, and given back with release if they fail
+  private admit(client: BrokerClient, endpoint: BrokerEndpoint, action: string, userId: string, requestedEmail?: string): Reservation {
+    if (!client.endpoints.includes(endpoint)) {
+      throw this.deny(client, action, userId, `client ${client.name} may not use the ${endpoint} endpoint`);
+    }
+    const emails = [this.tokens.zoomProfile(userId).email, requestedEmail]
+      .filter((email): email is string => email !== undefined)
+      .map((email) => email.toLowerCase());
+    if (client.users.length > 0 && !client.users.some((allowed) => allowed === userId || emails.includes(allowed.toLowerCase()))) {
+      throw this.deny(client, action, userId, `client ${client.name} may not get tokens of user ${userId}`);
+    }
+    const now = Date.now();
+    const window = this.issued.peek(client.name, now);
+    if (client.quotaPerHour > 0 && window && window.count >= client.quotaPerHour) {
+      const reason = `client ${client.name} was issued ${window.count} tokens in the last hour`;
+      const retryAfterSeconds = Math.ceil((window.startedAt + ISSUANCE_WINDOW_MS - now) / 1000);
+      throw this.deny(client, action, userId, reason, new IssuanceQuotaExceededError(reason, retryAfterSeconds));
+    }
+    return this.issued.increment(client.name, now);
+  }
+
+  private deny(client: BrokerClient, action: string, userId: string, reason: string, error: Error = new IssuanceDeniedError("broker", reason)): Error {
+    this.audit.record({ action, outcome: "denied", user_id: userId, source: `broker:${client.name}`, reason });
+    return error;
+  }
+}
+
+interface BrokerRequestBody {
+  user_id?: unknown;
+  email?: unknown;
+  scopes?: unknown;
+  meeting_id?: unknown;
+}
+
+/**
+ * Serves `POST /token`, `/obf` and `/zak` to internal services
+ * authenticating with `Authorization: Bearer <client key>`; mount at
+ * `/broker`.
+ */
+export function createBrokerRouter(broker: TokenBroker): express.Router {
+  const router = express.Router();
+
+  // the client and the user its request names, or undefined once an error is written
+  function parse(req: express.Request, res: express.Response): { client: BrokerClient; user: { userId?: string; email?: string }; body: BrokerRequestBody } | undefined {
+    const client = broker.authenticate(req.headers.authorization?.replace(/^Bearer /, "") ?? "");
+    if (!client) {
+      writeError(req, res, new HttpError(401, "broker client key is missing or incorrect"));
+      return undefined;
+    }
+    const body = (req.body ?? {}) as BrokerRequestBody;
+    if (typeof body.user_id === "string" && body.user_id) return { client, user: { userId: body.user_id }, body };
+    if (typeof body.email === "string" && body.email) return { client, user: { email: body.email }, body };
+    writeError(req, res, new HttpError(400, "no user_id or email provided"));
+    return undefined;
+  }
+
+  router.post("/token", express.json(), async (req, res) => {
+    const parsed = parse(req, res);
+    if (!parsed) return;
+    const { scopes } = parsed.body;
+    if (scopes !== undefined && (!Array.isArray(scopes) || scopes.some((scope) => typeof scope !== "string"))) {
+      writeError(req, res, new HttpError(400, "scopes must be an array of strings"));
+      return;
+    }
+
+    try {
+      const token = await broker.issue(parsed.client, parsed.user, scopes === undefined ? undefined : (scopes as string[]));
+      writeJSON(res, 200, {
+        user_id: token.userId,
+        access_token: token.accessToken,
+        token_type: "bearer",
+        expires_at: token.expiresAt.toISOString(),
+        expires_in: Math.max(0, Math.floor((token.expiresAt.getTime() - Date.now()) / 1000)),
+        scopes: token.scopes,
+      });
+    } catch (error) {
+      writeError(req, res, error);
+    }
+  });
+
+  for (const kind of ["obf", "zak"] as const) {
+    router.post(`/${kind}`, express.json(), async (req, res) => {
+      const parsed = parse(req, res);
+      if (!parsed) return;
+      const raw = parsed.body.meeting_id;
+      const meetingId = raw === undefined ? undefined : parseMeetingId(String(raw));
+      if (raw !== undefined && !meetingId) {
+        writeError(req, res, new HttpError(400, `invalid meeting_id: ${String(raw)}`));
+        return;
+      }
+
+      try {
+        const { userId, token } = await broker.mint(parsed.client, kind, parsed.user, meetingId);
+        writeJSON(res, 200, { user_id: userId, token, meeting_id: meetingId ?? null });
+      } catch (error) {
+        writeError(req, res, error);
+      }
+    });
+  }
+
+  return router;
+}
+
+/** Serves `GET /clients`, each broker client with what it got this hour; mount behind requireAdminKey. */
+export function createBrokerAdminRouter(broker: TokenBroker): express.Router {
+  const router = express.Router();
+
+  router.get("/clients", (_req, res) => {
+    writeJSON(res, 200, {
+      clients: broker.usage().map((usage) => ({
+        name: usage.name,
+        endpoints: usage.endpoints,
+        scopes: usage.scopes,
+        users: usage.users,
+        max_per_hour: usage.quotaPerHour,
+        issued_this_hour: usage.issued,
+        window_started_at: usage.windowStartedAt?.toISOString() ?? null,
+        last_issued_at: usage.lastIssuedAt?.toISOString() ?? null,
+      })),
+    });
+  });
+
+  return router;
+}
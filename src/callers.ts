@@ -0,0 +1,102 @@
+import type express from "express";
+import type { AuditLog } from "./audit.js";
+
+const MAX_CALLERS = 1000;
+// headers Recall may identify itself or the bot with
+const RECALL_HEADER_PREFIX = "x-recall-";
+
+export interface CallerMetadata {
+  ip: string;
+  user_agent: string | null;
+  // as sent, unverified; only meaningful behind a proxy you trust
+  forwarded_for: string | null;
+  recall_headers: Record<string, string>;
+}
+
+export interface CallerSummary extends CallerMetadata {
+  hits: number;
+  // responses below 400, and the rest
+  answered: number;
+  rejected: number;
+  paths: string[];
+  first_seen: string;
+  last_seen: string;
+}
+
+export function callerMetadata(req: express.Request): CallerMetadata {
+  const recallHeaders: Record<string, string> = {};
+  for (const [name, value] of Object.entries(req.headers)) {
+    if (name.startsWith(RECALL_HEADER_PREFIX) && value !== undefined) {
+      recallHeaders[name] = Array.isArray(value) ? value.join(", ") : value;
+    }
+  }
+  return {
+    ip: req.ip ?? req.socket.remoteAddress ?? "",
+    user_agent: req.headers["user-agent"] ?? null,
+    forwarded_for: (req.headers["x-forwarded-for"] as string | undefined) ?? null,
+    recall_headers: recallHeaders,
+  };
+}
+
+/**
+ * Tallies who calls the Recall callbacks, by IP and User-Agent, so genuine
+ * Recall traffic can be told apart from scanners. Kept in memory; the least
+ * recently seen callers are dropped past MAX_CALLERS.
+ */
+export class CallerLog {
+  private readonly callers = new Map<string, CallerSummary>();
+
+  record(caller: CallerMetadata, path: string, status: number): void {
+    const key = `${caller.ip} ${caller.user_agent ?? ""}`;
+    const now = new Date().toISOString();
+    const summary = this.callers.get(key) ?? { ...caller, hits: 0, answered: 0, rejected: 0, paths: [], first_seen: now, last_seen: now };
+    summary.hits++;
+    if (status < 400) summary.answered++;
+    else summary.rejected++;
+    if (!summary.paths.includes(path)) summary.paths.push(path);
+    summary.recall_headers = caller.recall_headers;
+    summary.forwarded_for = caller.forwarded_for;
+    summary.last_seen = now;
+    // re-inserting keeps the map ordered by last hit, oldest first
+    this.callers.delete(key);
+    this.callers.set(key, summary);
+    if (this.callers.size > MAX_CALLERS) {
+      this.callers.delete(this.callers.keys().next().value as string);
+    }
+  }
+
+  /** Returns callers, most recently seen first. */
+  list(): CallerSummary[] {
+    return [...this.callers.values()].reverse();
+  }
+}
+
+/**
+ * Records every response from the Recall callbacks under `/recall`, except
+ * the signed webhooks, in the audit log and callers. Mount ahead of the
+ * routers it watches.
+ */
+export function recordCallers(audit: AuditLog, callers: CallerLog): express.RequestHandler {
+  return (req, res, next) => {
+    if (!req.path.startsWith("/recall/") || req.path.startsWith("/recall/webhooks")) {
+      next();
+      return;
+    }
+    const caller = callerMetadata(req);
+    res.on("finish", () => {
+      callers.record(caller, req.path, res.statusCode);
+      const meetingId = req.query.meeting_id;
+      audit.record({
+        action: "recall.callback",
+        outcome: res.statusCode < 400 ? "allowed" : "denied",
+        user_id: typeof req.query.user_id === "string" ? req.query.user_id : "",
+        meeting_id: typeof meetingId === "string" ? meetingId : undefined,
+        source: caller.ip,
+        reason: `${req.method} ${req.path} answered ${res.statusCode}`,
+        user_agent: caller.user_agent ?? undefined,
+        recall_headers: Object.keys(caller.recall_headers).length > 0 ? caller.recall_headers : undefined,
+      });
+    });
+    next();
+  };
+}
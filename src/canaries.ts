@@ -0,0 +1,115 @@
+import { createHash, timingSafeEqual } from "crypto";
+import type express from "express";
+import type { AuditLog } from "./audit.js";
+import { callerMetadata } from "./callers.js";
+import type { CallerMetadata } from "./callers.js";
+import type { Notifications } from "./notify.js";
+import { HttpError } from "./zoomrecall/index.js";
+import { writeError } from "./zoomrecall/httpx.js";
+
+// a callback secret planted somewhere it should never be used from, named for where it was planted
+export interface CanaryToken {
+  label: string;
+  token: string;
+}
+
+export interface CanaryStatus {
+  label: string;
+  triggered: number;
+  last_triggered_at: string | null;
+  last_caller: (CallerMetadata & { path: string }) | null;
+}
+
+function digest(value: string): Buffer {
+  return createHash("sha256").update(value).digest();
+}
+
+/**
+ * The canary tokens from CANARY_TOKENS and how often each was used. A
+ * canary looks like a callback secret but never authenticates anything, so
+ * a request carrying one means the configuration it was planted in was
+ * copied somewhere else. Counts are in memory and start over on restart.
+ */
+export class Canaries {
+  private readonly canaries: { label: string; digest: Buffer; status: CanaryStatus }[];
+
+  constructor(canaries: CanaryToken[]) {
+    this.canaries = canaries.map(({ label, token }) => ({
+      label,
+      digest: digest(token),
+      status: { label, triggered: 0, last_triggered_at: null, last_caller: null },
+    }));
+  }
+
+  get size(): number {
+    return this.canaries.length;
+  }
+
+  /** The label of the canary that token is, or null if it is none. Compares digests so the time taken gives nothing away. */
+  match(token: string): string | null {
+    const candidate = digest(token);
+    let label: string | null = null;
+    for (const canary of this.canaries) {
+      if (timingSafeEqual(candidate, canary.digest)) label = canary.label;
+    }
+    return label;
+  }
+
+  triggered(label: string, caller: CallerMetadata, path: string): CanaryStatus {
+    const { status } = this.canaries.find((canary) => canary.label === label)!;
+    status.triggered++;
+    status.last_triggered_at = new Date().toISOString();
+    status.last_caller = { ...caller, path };
+    return status;
+  }
+
+  list(): CanaryStatus[] {
+    return this.canaries.map(({ status }) => status);
+  }
+}
+
+export interface CatchCanariesOptions {
+  canaries: Canaries;
+  audit: AuditLog;
+  notifications: Notifications;
+}
+
+/**
+ * Answers Recall callbacks whose auth_token is a canary the way a wrong
+ * secret is answered, so whoever holds it can't tell, and raises a
+ * canary.triggered alert. Mount under `/recall` ahead of the routers.
+ */
+export function catchCanaries(options: CatchCanariesOptions): express.RequestHandler {
+  const { canaries, audit, notifications } = options;
+  return (req, res, next) => {
+    const token = req.query.auth_token;
+    const label = typeof token === "string" ? canaries.match(token) : null;
+    if (!label) {
+      next();
+      return;
+    }
+    const caller = callerMetadata(req);
+    const path = `${req.baseUrl}${req.path}`;
+    const userId = typeof req.query.user_id === "string" ? req.query.user_id : "";
+    canaries.triggered(label, caller, path);
+    console.warn(`canary token ${label} was used on ${req.method} ${path} from ${caller.ip}, the place it was planted has leaked`);
+    audit.record({
+      action: "canary.triggered",
+      outcome: "denied",
+      user_id: userId,
+      source: caller.ip,
+      reason: `canary token ${label} used on ${req.method} ${path}`,
+      user_agent: caller.user_agent ?? undefined,
+      recall_headers: Object.keys(caller.recall_headers).length > 0 ? caller.recall_headers : undefined,
+    });
+    notifications.emit("canary.triggered", {
+      label,
+      path,
+      user_id: userId || null,
+      ip: caller.ip,
+      user_agent: caller.user_agent,
+      forwarded_for: caller.forwarded_for,
+    });
+    writeError(req, res, new HttpError(401, "recall auth secret provided is incorrect"));
+  };
+}
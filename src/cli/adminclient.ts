@@ -0,0 +1,57 @@
+import { DEFAULT_PORT } from "../config.js";
+import { CommandError } from "./command.js";
+import { stringFlag } from "./flags.js";
+import type { ParsedArgs } from "./flags.js";
+
+/** Talks to the admin API of a running instance, configured by --url/--admin-key or ADMIN_URL/ADMIN_API_KEY. */
+export class AdminClient {
+  readonly url: string;
+  private readonly adminKey: string;
+
+  constructor(parsed: ParsedArgs, env: NodeJS.ProcessEnv = process.env) {
+    this.url = (stringFlag(parsed, "url") ?? env.ADMIN_URL ?? `http://localhost:${DEFAULT_PORT}`).replace(/\/$/, "");
+    this.adminKey = stringFlag(parsed, "admin-key") ?? env.ADMIN_API_KEY ?? "";
+    if (!this.adminKey) {
+      throw new CommandError("no admin API key: pass --admin-key or set ADMIN_API_KEY");
+    }
+  }
+
+  async request<T>(method: string, path: string, body?: unknown): Promise<T> {
+    return JSON.parse((await this.send(method, path, "application/json", body)).toString("utf8")) as T;
+  }
+
+  /** Fetches a file the admin API serves, e.g. a support bundle. */
+  async download(path: string): Promise<Buffer> {
+    return this.send("GET", path, "*/*");
+  }
+
+  private async send(method: string, path: string, accept: string, body?: unknown): Promise<Buffer> {
+    let response: Response;
+    try {
+      response = await fetch(`${this.url}${path}`, {
+        method,
+        headers: {
+          Authorization: `Bearer ${this.adminKey}`,
+          Accept: accept,
+          ...(body === undefined ? {} : { "Content-Type": "application/json" }),
+        },
+        body: body === undefined ? undefined : JSON.stringify(body),
+      });
+    } catch (error) {
+      throw new CommandError(`could not reach ${this.url}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+
+    const contents = Buffer.from(await response.arrayBuffer());
+    if (!response.ok) {
+      const text = contents.toString("utf8");
+      let message = text;
+      try {
+        message = (JSON.parse(text) as { error?: string }).error ?? text;
+      } catch {
+        // not JSON, use the body as is
+      }
+      throw new CommandError(`${method} ${path} failed with ${response.status}: ${message}`);
+    }
+    return contents;
+  }
+}
@@ -0,0 +1,119 @@
+import { spawn } from "child_process";
+import { randomBytes, randomUUID } from "crypto";
+import http from "http";
+import { requireEnv, userAgent, withSsmParameters } from "../config.js";
+import { codeChallenge } from "../consent.js";
+import { DEFAULT_ZOOM_API_BASE_URL, DEFAULT_ZOOM_OAUTH_BASE_URL, withUserAgent, ZoomClient } from "../zoomrecall/index.js";
+import type { OAuthTokens } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+
+const DEFAULT_LISTENER_PORT = 8765;
+const CONSENT_TIMEOUT_MS = 5 * 60 * 1000;
+
+function openBrowser(url: string): void {
+  const [command, args]: [string, string[]] =
+    process.platform === "darwin"
+      ? ["open", [url]]
+      : process.platform === "win32"
+        ? ["cmd", ["/c", "start", "", url]]
+        : ["xdg-open", [url]];
+  const child = spawn(command, args, { stdio: "ignore", detached: true });
+  child.on("error", () => console.error("could not open a browser, open the URL above manually"));
+  child.unref();
+}
+
+function waitForCode(port: number, state: string): Promise<string> {
+  return new Promise((resolve, reject) => {
+    const timeout = setTimeout(() => {
+      server.close();
+      reject(new CommandError(`no consent received within ${CONSENT_TIMEOUT_MS / 1000}s`));
+    }, CONSENT_TIMEOUT_MS);
+    const server = http.createServer((req, res) => {
+      const url = new URL(req.url ?? "/", `http://localhost:${port}`);
+      if (url.pathname !== "/zoom/oauth-callback") {
+        res.writeHead(404).end();
+        return;
+      }
+
+      const code = url.searchParams.get("code");
+      if (url.searchParams.get("state") !== state || !code) {
+        res.writeHead(400, { "Content-Type": "text/plain; charset=utf-8" }).end("invalid or missing state/code, restart the authorize command");
+        return;
+      }
+
+      res.writeHead(200, { "Content-Type": "text/plain; charset=utf-8" }).end("authorization received, you can close this tab");
+      clearTimeout(timeout);
+      server.close();
+      resolve(code);
+    });
+
+    server.on("error", (error) => {
+      clearTimeout(timeout);
+      reject(new CommandError(`could not listen on port ${port}: ${error.message}`));
+    });
+    server.listen(port, "127.0.0.1");
+  });
+}
+
+/**
+ * Runs the Zoom consent flow against a temporary listener on this machine and
+ * pushes the resulting tokens to a running instance via its admin API.
+ */
+export async function authorizeCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const port = Number(stringFlag(parsed, "port") ?? DEFAULT_LISTENER_PORT);
+  if (!Number.isInteger(port) || port <= 0 || port > 65535) {
+    throw new CommandError("--port must be a valid TCP port");
+  }
+  const userId = stringFlag(parsed, "user-id") ?? randomUUID();
+  const admin = booleanFlag(parsed, "print-only") ? null : new AdminClient(parsed);
+
+  const redirectUri = `http://localhost:${port}/zoom/oauth-callback`;
+  const env = await withSsmParameters();
+  const zoom = new ZoomClient({
+    clientId: requireEnv(env, "ZOOM_CLIENT_ID"),
+    clientSecret: requireEnv(env, "ZOOM_CLIENT_SECRET"),
+    redirectUri,
+    oauthBaseUrl: process.env.ZOOM_OAUTH_BASE_URL ?? DEFAULT_ZOOM_OAUTH_BASE_URL,
+    apiBaseUrl: process.env.ZOOM_API_BASE_URL ?? DEFAULT_ZOOM_API_BASE_URL,
+    httpClient: withUserAgent(userAgent(process.env)),
+  });
+
+  const state = randomBytes(16).toString("hex");
+  const codeVerifier = randomBytes(32).toString("base64url");
+  const authorizeUrl = zoom.authorizeUrl(state, codeChallenge(codeVerifier));
+  console.log(`make sure ${redirectUri} is an allowed redirect URL of your Zoom app, then authorize at:\n\n  ${authorizeUrl}\n`);
+  const codePromise = waitForCode(port, state);
+  if (!booleanFlag(parsed, "no-browser")) {
+    openBrowser(authorizeUrl);
+  }
+
+  let tokens: OAuthTokens;
+  try {
+    tokens = await zoom.exchangeCode(await codePromise, codeVerifier);
+  } catch (error) {
+    if (error instanceof CommandError) throw error;
+    throw new CommandError(`token exchange failed: ${error instanceof Error ? error.message : String(error)}`);
+  }
+
+  if (!admin) {
+    const output = {
+      user_id: userId,
+      access_token: tokens.accessToken,
+      refresh_token: tokens.refreshToken,
+      expires_in: tokens.expiresIn,
+    };
+    console.log(JSON.stringify(output, null, 2));
+    return 0;
+  }
+
+  await admin.request("PUT", `/admin/tokens/${encodeURIComponent(userId)}`, {
+    access_token: tokens.accessToken,
+    refresh_token: tokens.refreshToken,
+    expires_in: tokens.expiresIn,
+  });
+  console.log(`stored tokens for user ${userId} on ${admin.url}`);
+  return 0;
+}
@@ -0,0 +1,60 @@
+import type { BotIdentity } from "../identities.js";
+import { AdminClient } from "./adminclient.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+
+interface BotJSON {
+  bot_id: string;
+  user_id: string;
+  zoom_user_id: string | null;
+  meeting_id: string | null;
+  records: BotIdentity[];
+}
+
+function printRecords(records: BotIdentity[]): void {
+  if (records.length === 0) {
+    console.log("no records");
+    return;
+  }
+  for (const record of records) {
+    const what = record.event === "bot.launched" ? "launched" : `served ${record.token_kind ?? "token"}`;
+    console.log(
+      [record.at, what.padEnd(12), record.bot_id ?? "-", record.user_id, record.zoom_user_id ?? "-", record.meeting_id ?? "-", record.source].join("  "),
+    );
+  }
+}
+
+/** Shows whose credentials a bot used, or the bots that used a user's credentials or joined a meeting. */
+export async function botsCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const botId = parsed.positionals[0];
+  const json = booleanFlag(parsed, "json");
+
+  if (botId) {
+    const bot = await admin.request<BotJSON>("GET", `/admin/bots/${encodeURIComponent(botId)}`);
+    if (json) {
+      console.log(JSON.stringify(bot, null, 2));
+      return 0;
+    }
+    console.log(`bot           ${bot.bot_id}`);
+    console.log(`user          ${bot.user_id}`);
+    console.log(`zoom user     ${bot.zoom_user_id ?? "-"}`);
+    console.log(`meeting       ${bot.meeting_id ?? "-"}`);
+    console.log("");
+    printRecords(bot.records);
+    return 0;
+  }
+
+  const query = new URLSearchParams();
+  const userId = stringFlag(parsed, "user-id");
+  const meetingId = stringFlag(parsed, "meeting-id");
+  if (userId) query.set("user_id", userId);
+  if (meetingId) query.set("meeting_id", meetingId);
+  const { records } = await admin.request<{ records: BotIdentity[] }>("GET", `/admin/bots?${query}`);
+  if (json) {
+    console.log(JSON.stringify(records, null, 2));
+    return 0;
+  }
+  printRecords(records);
+  return 0;
+}
@@ -0,0 +1,32 @@
+import type { CallerSummary } from "../callers.js";
+import { AdminClient } from "./adminclient.js";
+import { booleanFlag, parseArgs } from "./flags.js";
+
+/** Shows who has called a running instance's Recall callbacks, most recent first. */
+export async function callersCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const { callers } = await admin.request<{ callers: CallerSummary[] }>("GET", "/admin/callers");
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(callers, null, 2));
+    return 0;
+  }
+  if (callers.length === 0) {
+    console.log("no callers");
+    return 0;
+  }
+  for (const caller of callers) {
+    const recall = Object.entries(caller.recall_headers).map(([name, value]) => `${name}=${value}`);
+    console.log(
+      [
+        caller.last_seen,
+        caller.ip.padEnd(15),
+        `${caller.answered} ok / ${caller.rejected} rejected`.padEnd(20),
+        caller.user_agent ?? "(no user-agent)",
+        recall.length > 0 ? recall.join(" ") : "-",
+        caller.paths.join(","),
+      ].join("  "),
+    );
+  }
+  return 0;
+}
@@ -0,0 +1,14 @@
+export interface Command {
+  name: string;
+  usage: string;
+  description: string;
+  run(args: string[]): Promise<number>;
+}
+
+/** A user-facing failure: printed without a stack trace and exits with status 1. */
+export class CommandError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "CommandError";
+  }
+}
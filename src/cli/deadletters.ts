@@ -0,0 +1,44 @@
+import type { DeadLetter } from "../deadletters.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs } from "./flags.js";
+
+/** Lists the inbound webhooks a running instance couldn't process, most recently received first. */
+export async function deadLettersCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const { letters } = await admin.request<{ letters: DeadLetter[] }>("GET", "/admin/dead-letters");
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(letters, null, 2));
+    return 0;
+  }
+  if (letters.length === 0) {
+    console.log("no dead letters");
+    return 0;
+  }
+  for (const letter of letters) {
+    console.log(
+      [letter.received_at, letter.id, letter.source.padEnd(6), letter.event ?? "-", `${letter.attempts} attempt(s)`, letter.last_error].join("  "),
+    );
+  }
+  return 0;
+}
+
+/** Processes a dead letter again, or with --discard drops it unprocessed. */
+export async function replayCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const id = parsed.positionals[0];
+  if (!id) {
+    throw new CommandError("usage: replay <dead-letter-id> [--discard]");
+  }
+
+  const admin = new AdminClient(parsed);
+  if (booleanFlag(parsed, "discard")) {
+    await admin.request("DELETE", `/admin/dead-letters/${encodeURIComponent(id)}`);
+    console.log(`discarded dead letter ${id} without processing it`);
+    return 0;
+  }
+  const letter = await admin.request<DeadLetter>("POST", `/admin/dead-letters/${encodeURIComponent(id)}/replay`);
+  console.log(`processed ${letter.source} webhook ${letter.event ?? "without an event"} from ${letter.received_at}`);
+  return 0;
+}
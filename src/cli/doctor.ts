@@ -0,0 +1,371 @@
+import { lookup } from "dns/promises";
+import { constants } from "fs";
+import { access, stat } from "fs/promises";
+import { dirname } from "path";
+import {
+  awsSecretsManagerStoreOptions,
+  azureKeyVaultStoreOptions,
+  ConfigError,
+  DEFAULT_RECALL_CALLBACK_SECRET,
+  dynamoDbStoreOptions,
+  gcpSecretManagerStoreOptions,
+  kubernetesSecretStoreOptions,
+  loadConfig,
+  tokenEncryptionOptions,
+  vaultStoreOptions,
+  withSsmParameters,
+} from "../config.js";
+import type { Config } from "../config.js";
+import { migrationStatus, schemaBackendFor } from "../migrate.js";
+import type { SchemaBackend } from "../migrate.js";
+import {
+  AwsSecretsManagerTokenStore,
+  AzureKeyVaultTokenStore,
+  createHttpClient,
+  DynamoDbTokenStore,
+  GcpSecretManagerTokenStore,
+  KubernetesSecretTokenStore,
+  RedisClient,
+  VaultTokenStore,
+} from "../zoomrecall/index.js";
+import type { TokenStore } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { parseArgs } from "./flags.js";
+import type { ParsedArgs } from "./flags.js";
+import { printReport } from "./report.js";
+import type { CheckResult } from "./report.js";
+
+interface DoctorContext {
+  parsed: ParsedArgs;
+  config: Config | null;
+  // Date headers seen on responses from Zoom and Recall, used for the clock skew check
+  remoteDates: { source: string; date: Date; receivedAt: number }[];
+}
+
+type Check = (context: DoctorContext) => Promise<CheckResult[]>;
+
+const CLOCK_SKEW_FAIL_MS = 5 * 60 * 1000;
+const REACHABILITY_TIMEOUT_MS = 5 * 1000;
+
+function message(error: unknown): string {
+  return error instanceof Error ? error.message : String(error);
+}
+
+const checkEnvironment: Check = async (context) => {
+  try {
+    context.config = loadConfig(await withSsmParameters());
+  } catch (error) {
+    if (!(error instanceof ConfigError)) throw error;
+    return [{ status: "fail", name: "environment", detail: error.message }];
+  }
+
+  const config = context.config;
+  const results: CheckResult[] = [{ status: "ok", name: "environment", detail: "required variables are set" }];
+  if (config.recallCallbackSecretSource === "default") {
+    results.push({
+      status: config.defaultSecretPolicy === "refuse" ? "fail" : "warn",
+      name: "callback secret",
+      detail:
+        config.defaultSecretPolicy === "refuse"
+          ? `RECALL_CALLBACK_SECRET is the default '${DEFAULT_RECALL_CALLBACK_SECRET}', /recall requests are refused until it is set`
+          : `RECALL_CALLBACK_SECRET is the default '${DEFAULT_RECALL_CALLBACK_SECRET}', anyone can fetch tokens`,
+    });
+  }
+  if (config.recallCallbackSecretSource === "generated") {
+    results.push({
+      status: "warn",
+      name: "callback secret",
+      detail: "RECALL_CALLBACK_SECRET is generated at startup, callback URLs given to Recall stop working on every restart",
+    });
+  }
+  if (!config.recallApiKey) {
+    results.push({ status: "warn", name: "recall api key", detail: "RECALL_API_KEY is not set, /launch will not work" });
+  }
+  if (!config.adminApiKey) {
+    results.push({ status: "warn", name: "admin api key", detail: "ADMIN_API_KEY is not set, admin endpoints and token checks are disabled" });
+  }
+  if (config.faultInjectionEnabled) {
+    results.push({ status: "warn", name: "fault injection", detail: "FAULT_INJECTION_ENABLED is set, do not use in production" });
+  }
+  return results;
+};
+
+async function checkReachability(context: DoctorContext, name: string, baseUrl: string): Promise<CheckResult[]> {
+  const url = new URL(baseUrl);
+  try {
+    const { address } = await lookup(url.hostname);
+    const response = await fetch(url.origin, { method: "HEAD", redirect: "manual", signal: AbortSignal.timeout(REACHABILITY_TIMEOUT_MS) });
+    const date = response.headers.get("date");
+    if (date) {
+      context.remoteDates.push({ source: url.hostname, date: new Date(date), receivedAt: Date.now() });
+    }
+    const tls = url.protocol === "https:" ? "TLS ok, " : "";
+    return [{ status: "ok", name, detail: `${url.hostname} resolves to ${address}, ${tls}HTTP ${response.status}` }];
+  } catch (error) {
+    return [{ status: "fail", name, detail: `${url.origin} is not reachable: ${message((error as { cause?: unknown }).cause ?? error)}` }];
+  }
+}
+
+const checkZoomReachability: Check = async (context) => {
+  if (!context.config) return [];
+  const results = await checkReachability(context, "zoom oauth", context.config.zoomOauthBaseUrl);
+  if (new URL(context.config.zoomApiBaseUrl).origin !== new URL(context.config.zoomOauthBaseUrl).origin) {
+    results.push(...(await checkReachability(context, "zoom api", context.config.zoomApiBaseUrl)));
+  }
+  return results;
+};
+
+const checkRecallReachability: Check = async (context) => {
+  if (!context.config) return [];
+  return checkReachability(context, "recall api", context.config.recallApiBaseUrl);
+};
+
+const checkMicrosoftReachability: Check = async (context) => {
+  if (!context.config?.teamsClientId) return [];
+  return checkReachability(context, "microsoft login", context.config.microsoftLoginBaseUrl);
+};
+
+const checkGoogleReachability: Check = async (context) => {
+  if (!context.config?.googleClientId) return [];
+  return [
+    ...(await checkReachability(context, "google consent", context.config.googleAuthBaseUrl)),
+    ...(await checkReachability(context, "google token", context.config.googleTokenBaseUrl)),
+  ];
+};
+
+const checkRedirectUri: Check = async (context) => {
+  if (!context.config) return [];
+  const { baseUrl, zoomClientId } = context.config;
+  const results: CheckResult[] = [];
+  const redirectUri = `${baseUrl}/zoom/oauth-callback`;
+
+  let parsed: URL;
+  try {
+    parsed = new URL(baseUrl);
+  } catch {
+    return [{ status: "fail", name: "redirect uri", detail: `BASE_URL is not a valid URL: ${baseUrl}` }];
+  }
+  if (baseUrl.endsWith("/")) {
+    results.push({ status: "fail", name: "redirect uri", detail: `BASE_URL ends with '/', the redirect URI becomes ${redirectUri}` });
+  }
+  if (parsed.protocol !== "https:" && !["localhost", "127.0.0.1", "[::1]"].includes(parsed.hostname)) {
+    results.push({ status: "warn", name: "redirect uri", detail: "BASE_URL is not https, Zoom requires https redirect URLs for published apps" });
+  }
+
+  try {
+    const response = await fetch(`${baseUrl}/zoom/oauth`, { redirect: "manual", signal: AbortSignal.timeout(REACHABILITY_TIMEOUT_MS) });
+    const location = response.headers.get("location");
+    if (response.status !== 302 || !location) {
+      results.push({ status: "fail", name: "redirect uri", detail: `${baseUrl}/zoom/oauth returned ${response.status} instead of redirecting to Zoom` });
+    } else {
+      const served = new URL(location);
+      if (served.searchParams.get("redirect_uri") !== redirectUri || served.searchParams.get("client_id") !== zoomClientId) {
+        results.push({
+          status: "fail",
+          name: "redirect uri",
+          detail: `the instance at BASE_URL redirects with redirect_uri=${served.searchParams.get("redirect_uri")}, expected ${redirectUri}; is it running with the same config?`,
+        });
+      }
+    }
+  } catch (error) {
+    results.push({ status: "warn", name: "redirect uri", detail: `${baseUrl} is not reachable from here (${message(error)}), Zoom must be able to redirect browsers to it` });
+  }
+
+  if (results.length === 0) {
+    results.push({ status: "ok", name: "redirect uri", detail: `${redirectUri} is served; make sure it is on the Zoom app's redirect allow list` });
+  }
+  return results;
+};
+
+const checkStore: Check = async (context) => {
+  if (!context.config || context.config.tokenStore === "memory") {
+    return [{ status: "warn", name: "token store", detail: "tokens are kept in memory only and are lost on restart, set TOKEN_STORE=sqlite and TOKEN_STORE_PATH to keep them in one file" }];
+  }
+  if (context.config.tokenStore === "redis") {
+    const redis = new RedisClient({ url: context.config.redisUrl });
+    try {
+      await redis.command("PING");
+      return [{ status: "ok", name: "token store", detail: `tokens are shared through ${redis.address}` }];
+    } catch (error) {
+      return [{ status: "fail", name: "token store", detail: `cannot reach ${redis.address}: ${message(error)}` }];
+    } finally {
+      redis.close();
+    }
+  }
+  if (["vault", "aws-secrets-manager", "dynamodb", "gcp-secret-manager", "azure-key-vault", "kubernetes-secret"].includes(context.config.tokenStore)) {
+    const httpClient = createHttpClient(REACHABILITY_TIMEOUT_MS);
+    const stores: Partial<Record<Config["tokenStore"], () => TokenStore>> = {
+      vault: () => new VaultTokenStore({ ...vaultStoreOptions(context.config), httpClient }),
+      "aws-secrets-manager": () => new AwsSecretsManagerTokenStore(awsSecretsManagerStoreOptions(context.config, httpClient)),
+      dynamodb: () => new DynamoDbTokenStore(dynamoDbStoreOptions(context.config, httpClient)),
+      "gcp-secret-manager": () => new GcpSecretManagerTokenStore(gcpSecretManagerStoreOptions(context.config, httpClient)),
+      "azure-key-vault": () => new AzureKeyVaultTokenStore(azureKeyVaultStoreOptions(context.config, httpClient)),
+      "kubernetes-secret": () => new KubernetesSecretTokenStore(kubernetesSecretStoreOptions(context.config, httpClient)),
+    };
+    const store = stores[context.config.tokenStore]!();
+    try {
+      const users = await store.list("zoom");
+      return [{ status: "ok", name: "token store", detail: `tokens are kept in ${store.path}, ${users.length} zoom user(s) so far` }];
+    } catch (error) {
+      return [{ status: "fail", name: "token store", detail: `cannot read ${store.path}: ${message(error)}` }];
+    }
+  }
+  const path = context.config.tokenStorePath;
+  try {
+    await access(dirname(path), constants.W_OK);
+  } catch (error) {
+    return [{ status: "fail", name: "token store", detail: `cannot write to the directory of ${path}: ${message(error)}` }];
+  }
+  const info = await stat(path).catch(() => null);
+  if (info && (info.mode & 0o077) !== 0) {
+    return [{ status: "warn", name: "token store", detail: `${path} is readable by other users, run chmod 600 on it` }];
+  }
+  if (context.config.tokenStore === "sqlite" && !info) {
+    return [{ status: "fail", name: "token store", detail: `${path} does not exist yet, create it with \`migrate up\`` }];
+  }
+  if (context.config.tokenStore === "sqlite") {
+    let backend: SchemaBackend | null = null;
+    try {
+      backend = schemaBackendFor(context.config);
+      const { current, latest } = await migrationStatus(backend!);
+      if (current !== latest) {
+        return [{ status: "fail", name: "token store", detail: `${path} is at schema version ${current} of ${latest}, run \`migrate up\`` }];
+      }
+    } catch (error) {
+      return [{ status: "fail", name: "token store", detail: `cannot read ${path}: ${message(error)}` }];
+    } finally {
+      await backend?.close();
+    }
+  }
+  return [{ status: "ok", name: "token store", detail: info ? `tokens are saved to ${path}` : `tokens will be saved to ${path}` }];
+};
+
+const checkEncryption: Check = async (context) => {
+  if (!context.config || context.config.tokenStore === "memory") return [];
+  const encryption = tokenEncryptionOptions(context.config, createHttpClient(REACHABILITY_TIMEOUT_MS));
+  if (!encryption) {
+    return [
+      { status: "warn", name: "token encryption", detail: `tokens are kept in the ${context.config.tokenStore} store in plaintext, set TOKEN_ENCRYPTION_KEY to seal them` },
+    ];
+  }
+  const { provider } = encryption;
+  try {
+    // a data key that doesn't come back unwrapped would seal tokens nothing can open
+    const { key, ref } = await provider.dataKey();
+    if (!key.equals(await provider.unwrap(ref))) throw new Error("the data key came back different");
+  } catch (error) {
+    return [{ status: "fail", name: "token encryption", detail: `cannot seal tokens with ${provider.description}: ${message(error)}` }];
+  }
+  return [{ status: "ok", name: "token encryption", detail: `tokens are sealed with ${provider.description} before they are stored` }];
+};
+
+const checkTokens: Check = async (context) => {
+  if (!context.config?.adminApiKey) return [];
+  try {
+    // without --url/ADMIN_URL, check the instance Zoom redirects to
+    const admin = new AdminClient(context.parsed, { ...process.env, ADMIN_URL: process.env.ADMIN_URL ?? context.config.baseUrl });
+    const { tokens } = await admin.request<{
+      tokens: {
+        user_id: string;
+        expires_at: string;
+        needs_reauthorization: boolean;
+        deactivated: boolean;
+        missing_scopes?: string[];
+        reauthorization_due_at?: string | null;
+      }[];
+    }>("GET", "/admin/tokens");
+    if (tokens.length === 0) {
+      return [{ status: "warn", name: "tokens", detail: `no users connected on ${admin.url}, visit /zoom/oauth` }];
+    }
+    const warningMs = context.config.reauthorizationWarningMs;
+    return tokens.map((token): CheckResult => {
+      if (token.deactivated) {
+        return { status: "warn", name: "tokens", detail: `${token.user_id} was deactivated at zoom, purge it with \`purge\`` };
+      }
+      if (token.needs_reauthorization) {
+        return { status: "fail", name: "tokens", detail: `${token.user_id} needs to re-authorize via /zoom/oauth` };
+      }
+      if (new Date(token.expires_at) <= new Date()) {
+        return { status: "fail", name: "tokens", detail: `${token.user_id}'s access token expired at ${token.expires_at}` };
+      }
+      if (token.missing_scopes?.length) {
+        return {
+          status: "warn",
+          name: "tokens",
+          detail: `${token.user_id}'s token lost scopes ${token.missing_scopes.join(", ")} on refresh, check the Zoom app's scopes and re-authorize`,
+        };
+      }
+      const dueAt = token.reauthorization_due_at ? new Date(token.reauthorization_due_at) : null;
+      if (dueAt && dueAt.getTime() - Date.now() <= warningMs) {
+        return { status: "warn", name: "tokens", detail: `${token.user_id} will have to re-authorize via /zoom/oauth by ${token.reauthorization_due_at}` };
+      }
+      return { status: "ok", name: "tokens", detail: `${token.user_id} valid until ${token.expires_at}` };
+    });
+  } catch (error) {
+    return [{ status: "warn", name: "tokens", detail: `could not query the admin API: ${message(error)}` }];
+  }
+};
+
+const checkObfEntitlement: Check = async (context) => {
+  if (!context.config?.adminApiKey) return [];
+  try {
+    const admin = new AdminClient(context.parsed, { ...process.env, ADMIN_URL: process.env.ADMIN_URL ?? context.config.baseUrl });
+    const { tokens } = await admin.request<{
+      tokens: { user_id: string; needs_reauthorization: boolean; deactivated: boolean }[];
+    }>("GET", "/admin/tokens");
+    const results: CheckResult[] = [];
+    for (const token of tokens.filter((token) => !token.needs_reauthorization && !token.deactivated)) {
+      const { obf } = await admin.request<{ obf: { entitled: boolean | null; detail: string } }>(
+        "GET",
+        `/admin/tokens/${encodeURIComponent(token.user_id)}/entitlements`,
+      );
+      const status = obf.entitled === true ? "ok" : obf.entitled === false ? "fail" : "warn";
+      results.push({ status, name: "obf entitlement", detail: `${token.user_id}: ${obf.detail}` });
+    }
+    return results;
+  } catch (error) {
+    return [{ status: "warn", name: "obf entitlement", detail: `could not probe via the admin API: ${message(error)}` }];
+  }
+};
+
+const checkClockSkew: Check = async (context) => {
+  if (!context.config) return [];
+  const warnMs = context.config.clockSkewWarningMs;
+  if (context.remoteDates.length === 0) {
+    return [{ status: "warn", name: "clock skew", detail: "no Date headers received, skew unknown" }];
+  }
+  return context.remoteDates.map(({ source, date, receivedAt }): CheckResult => {
+    // Date headers have one-second resolution
+    const skew = receivedAt - date.getTime() - 500;
+    const detail = `local clock is ${Math.abs(Math.round(skew / 1000))}s ${skew >= 0 ? "ahead of" : "behind"} ${source}`;
+    const abs = Math.abs(skew);
+    return { status: abs >= CLOCK_SKEW_FAIL_MS ? "fail" : abs >= warnMs ? "warn" : "ok", name: "clock skew", detail };
+  });
+};
+
+// checks run in order; later checks rely on the config loaded by checkEnvironment
+// and the Date headers collected by the reachability checks
+const checks: Check[] = [
+  checkEnvironment,
+  checkZoomReachability,
+  checkRecallReachability,
+  checkMicrosoftReachability,
+  checkGoogleReachability,
+  checkRedirectUri,
+  checkStore,
+  checkEncryption,
+  checkTokens,
+  checkObfEntitlement,
+  checkClockSkew,
+];
+
+/** Checks configuration, connectivity and token health, printing one line per finding. Exits 1 if anything failed. */
+export async function doctorCommand(args: string[]): Promise<number> {
+  const context: DoctorContext = { parsed: parseArgs(args), config: null, remoteDates: [] };
+  const results: CheckResult[] = [];
+  for (const check of checks) {
+    results.push(...(await check(context)));
+  }
+
+  return printReport(results);
+}
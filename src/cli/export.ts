@@ -0,0 +1,23 @@
+import { writeFileSync } from "fs";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { parseArgs, stringFlag } from "./flags.js";
+
+/** Exports a running instance's connected users, without tokens, as CSV or JSON for reconciliation, e.g. against a CRM. */
+export async function exportUsersCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const format = stringFlag(parsed, "format") ?? "csv";
+  if (format !== "csv" && format !== "json") {
+    throw new CommandError(`--format must be csv or json, not ${format}`);
+  }
+  const admin = new AdminClient(parsed);
+  const output = stringFlag(parsed, "output");
+  const exported = await admin.download(`/admin/users/export?format=${format}`);
+  if (!output) {
+    process.stdout.write(exported);
+    return 0;
+  }
+  writeFileSync(output, exported, { mode: 0o600 });
+  console.log(`saved the connected users of ${admin.url} to ${output}`);
+  return 0;
+}
@@ -0,0 +1,52 @@
+import { DEFAULT_TIME_ZONE, isTimeZone } from "../timezone.js";
+import { CommandError } from "./command.js";
+
+export interface ParsedArgs {
+  flags: Map<string, string | true>;
+  positionals: string[];
+}
+
+/** Parses `--name value`, `--name=value` and bare `--name` flags; everything else is positional. */
+export function parseArgs(args: string[]): ParsedArgs {
+  const flags = new Map<string, string | true>();
+  const positionals: string[] = [];
+  for (let i = 0; i < args.length; i++) {
+    const arg = args[i];
+    if (arg === "--") {
+      positionals.push(...args.slice(i + 1));
+      break;
+    }
+    if (!arg.startsWith("--")) {
+      positionals.push(arg);
+      continue;
+    }
+    const [name, inline] = arg.slice(2).split(/=(.*)/s, 2);
+    if (inline !== undefined) {
+      flags.set(name, inline);
+    } else if (i + 1 < args.length && !args[i + 1].startsWith("--")) {
+      flags.set(name, args[++i]);
+    } else {
+      flags.set(name, true);
+    }
+  }
+  return { flags, positionals };
+}
+
+export function stringFlag(parsed: ParsedArgs, name: string): string | undefined {
+  const value = parsed.flags.get(name);
+  return typeof value === "string" ? value : undefined;
+}
+
+export function booleanFlag(parsed: ParsedArgs, name: string): boolean {
+  const value = parsed.flags.get(name);
+  return value === true || value === "true";
+}
+
+/** The time zone to show times in: --time-zone, else DISPLAY_TIME_ZONE, else UTC. */
+export function timeZoneFlag(parsed: ParsedArgs, env: NodeJS.ProcessEnv = process.env): string {
+  const timeZone = stringFlag(parsed, "time-zone") ?? env.DISPLAY_TIME_ZONE ?? DEFAULT_TIME_ZONE;
+  if (!isTimeZone(timeZone)) {
+    throw new CommandError(`unknown time zone ${timeZone}, use an IANA name such as Europe/Berlin`);
+  }
+  return timeZone;
+}
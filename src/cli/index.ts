@@ -0,0 +1,220 @@
+import { ConfigError } from "../config.js";
+import { runE2E } from "../e2e.js";
+import { authorizeCommand } from "./authorize.js";
+import { botsCommand } from "./bots.js";
+import { callersCommand } from "./callers.js";
+import { CommandError } from "./command.js";
+import type { Command } from "./command.js";
+import { deadLettersCommand, replayCommand } from "./deadletters.js";
+import { doctorCommand } from "./doctor.js";
+import { exportUsersCommand } from "./export.js";
+import { obfCommand, zakCommand } from "./jointoken.js";
+import { launchBotCommand } from "./launchbot.js";
+import { meetingCommand } from "./meeting.js";
+import { migrateCommand, migrateStoreCommand } from "./migrate.js";
+import { invitationsCommand, inviteCommand, remindCommand } from "./onboard.js";
+import { annotateCommand, purgeCommand, removedUsersCommand, revokeCommand } from "./offboard.js";
+import { generateCanaryCommand, generateSecretCommand } from "./secret.js";
+import { serve } from "./serve.js";
+import { simulateRecallCommand } from "./simulate.js";
+import { supportBundleCommand } from "./support.js";
+import { tokenCommand } from "./token.js";
+
+const commands: Command[] = [
+  {
+    name: "serve",
+    usage: "serve",
+    description: "run the OAuth callback server (default)",
+    run: () => serve(),
+  },
+  {
+    name: "e2e",
+    usage: "e2e",
+    description: "run the end-to-end check against the bundled mock Zoom",
+    run: () => runE2E(),
+  },
+  {
+    name: "authorize",
+    usage: "authorize [--user-id ID] [--port 8765] [--no-browser] [--print-only]",
+    description: "run Zoom consent from this machine and push the tokens to a running instance",
+    run: authorizeCommand,
+  },
+  {
+    name: "token",
+    usage: "token status [user-id] [--time-zone ZONE] | token get <user-id> | token verify <user-id> | token sync",
+    description: "show token holders and expiries, print a raw access token, check a token works without printing it, or check users for deactivation at Zoom, on a running instance",
+    run: tokenCommand,
+  },
+  {
+    name: "obf",
+    usage: "obf <meeting-id> [--user-id ID]",
+    description: "generate an OBF token for a meeting from a running instance's stored credentials",
+    run: obfCommand,
+  },
+  {
+    name: "zak",
+    usage: "zak [--user-id ID]",
+    description: "generate a ZAK token from a running instance's stored credentials",
+    run: zakCommand,
+  },
+  {
+    name: "meeting",
+    usage: "meeting <meeting-id> [--user-id ID] [--json] [--time-zone ZONE]",
+    description: "show a meeting's topic, host, start time and join settings as a connected user sees them",
+    run: meetingCommand,
+  },
+  {
+    name: "launch-bot",
+    usage: "launch-bot <meeting-url> [--user-id ID] [--bot-name NAME] [--zak] [--no-follow]",
+    description: "launch a Recall bot with a connected user's credentials and follow its status",
+    run: launchBotCommand,
+  },
+  {
+    name: "bots",
+    usage: "bots [bot-id] [--user-id ID] [--meeting-id ID] [--json]",
+    description: "show whose credentials a bot used, or the bots launched with a user's credentials or for a meeting",
+    run: botsCommand,
+  },
+  {
+    name: "callers",
+    usage: "callers [--json]",
+    description: "show the IPs, user agents and Recall headers that called the Recall callbacks, and how they were answered",
+    run: callersCommand,
+  },
+  {
+    name: "export-users",
+    usage: "export-users [--format csv|json] [--output FILE]",
+    description: "export every connected user's email, scopes, connection time and last refresh, without tokens, e.g. for a CRM",
+    run: exportUsersCommand,
+  },
+  {
+    name: "invite",
+    usage: "invite [EMAIL...] [--file users.csv|users.json] [--send] [--json]",
+    description: "give users consent links of their own to connect Zoom, emailing them with --send",
+    run: inviteCommand,
+  },
+  {
+    name: "invitations",
+    usage: "invitations [--pending] [--json]",
+    description: "list onboarding invitations and who has connected through them",
+    run: invitationsCommand,
+  },
+  {
+    name: "remind",
+    usage: "remind [EMAIL...]",
+    description: "email a reminder to invited users, all of them by default, who haven't connected yet",
+    run: remindCommand,
+  },
+  {
+    name: "revoke",
+    usage: "revoke <user-id>",
+    description: "revoke a user's authorization at Zoom and remove their tokens from a running instance",
+    run: revokeCommand,
+  },
+  {
+    name: "purge",
+    usage: "purge <user-id> [--hard]",
+    description: "remove a user's tokens from a running instance without contacting Zoom; --hard also deletes their removed-user record",
+    run: purgeCommand,
+  },
+  {
+    name: "removed-users",
+    usage: "removed-users [--json]",
+    description: "list purged and revoked users still remembered, without tokens, and whether they consented again",
+    run: removedUsersCommand,
+  },
+  {
+    name: "annotate",
+    usage: "annotate <user-id> <note>",
+    description: "add a note to a removed user's record, e.g. why they were revoked",
+    run: annotateCommand,
+  },
+  {
+    name: "dead-letters",
+    usage: "dead-letters [--json]",
+    description: "list the Zoom and Recall webhooks a running instance received but couldn't process",
+    run: deadLettersCommand,
+  },
+  {
+    name: "replay",
+    usage: "replay <dead-letter-id> [--discard]",
+    description: "process a dead-lettered webhook again, or drop it with --discard",
+    run: replayCommand,
+  },
+  {
+    name: "doctor",
+    usage: "doctor [--url URL] [--admin-key KEY]",
+    description: "check configuration, Zoom/Recall reachability, redirect URL, tokens and clock skew",
+    run: doctorCommand,
+  },
+  {
+    name: "support-bundle",
+    usage: "support-bundle [--output FILE]",
+    description: "save a running instance's redacted logs, config, health and recent Zoom errors as one .tar.gz for support",
+    run: supportBundleCommand,
+  },
+  {
+    name: "migrate",
+    usage: "migrate status | up [--to VERSION] | down [--to VERSION]",
+    description: "show or change the schema version of the configured token store",
+    run: migrateCommand,
+  },
+  {
+    name: "migrate-store",
+    usage: "migrate-store --from STORE --to STORE [--from-path PATH] [--to-path PATH] [--overwrite] [--dry-run]",
+    description: "copy every user's tokens from one token store to another, e.g. from file to redis, without new consents",
+    run: migrateStoreCommand,
+  },
+  {
+    name: "generate-secret",
+    usage: "generate-secret [NAME...] [--env-file FILE] [--force] [--bytes 32]",
+    description: "generate random secrets (RECALL_CALLBACK_SECRET by default), optionally writing them to an env file",
+    run: generateSecretCommand,
+  },
+  {
+    name: "generate-canary",
+    usage: "generate-canary <label> [--url URL] [--user-id ID] [--env-file FILE]",
+    description: "generate a canary callback secret for CANARY_TOKENS and print callback URLs that raise an alert when used",
+    run: generateCanaryCommand,
+  },
+  {
+    name: "simulate-recall",
+    usage: "simulate-recall [--user-id ID] [--meeting-id ID] [--url URL] [--secret SECRET]",
+    description: "call a running instance's /recall/* endpoints like Recall does and check the responses",
+    run: simulateRecallCommand,
+  },
+];
+
+function printHelp(): void {
+  console.log("usage: index.js <command> [options]\n\ncommands:");
+  const width = Math.max(...commands.map((command) => command.usage.length));
+  for (const command of commands) {
+    console.log(`  ${command.usage.padEnd(width)}  ${command.description}`);
+  }
+}
+
+export async function main(argv: string[]): Promise<number> {
+  // "--e2e" predates subcommands and is kept as an alias
+  const [name = "serve", ...args] = argv[0] === "--e2e" ? ["e2e", ...argv.slice(1)] : argv;
+  if (name === "help" || name === "--help" || name === "-h") {
+    printHelp();
+    return 0;
+  }
+
+  const command = commands.find((candidate) => candidate.name === name);
+  if (!command) {
+    console.error(`unknown command: ${name}`);
+    printHelp();
+    return 2;
+  }
+
+  try {
+    return await command.run(args);
+  } catch (error) {
+    if (error instanceof ConfigError || error instanceof CommandError) {
+      console.error(error.message);
+      return 1;
+    }
+    throw error;
+  }
+}
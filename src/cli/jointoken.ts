@@ -0,0 +1,49 @@
+import { parseMeetingId } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { parseArgs, stringFlag } from "./flags.js";
+import type { ParsedArgs } from "./flags.js";
+
+export async function resolveUserId(admin: AdminClient, parsed: ParsedArgs): Promise<string> {
+  const userId = stringFlag(parsed, "user-id");
+  if (userId) return userId;
+
+  const { tokens } = await admin.request<{ tokens: { user_id: string }[] }>("GET", "/admin/tokens");
+  if (tokens.length !== 1) {
+    throw new CommandError(
+      tokens.length === 0
+        ? `no tokens stored on ${admin.url}, run authorize first`
+        : `${tokens.length} users are connected, pick one with --user-id (see token status)`,
+    );
+  }
+  return tokens[0].user_id;
+}
+
+export async function obfCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const raw = stringFlag(parsed, "meeting-id") ?? parsed.positionals[0];
+  const meetingId = raw === undefined ? undefined : parseMeetingId(raw);
+  if (!meetingId) {
+    throw new CommandError("usage: obf <meeting-id> [--user-id ID]");
+  }
+
+  const admin = new AdminClient(parsed);
+  const userId = await resolveUserId(admin, parsed);
+  const { token } = await admin.request<{ token: string }>(
+    "GET",
+    `/admin/tokens/${encodeURIComponent(userId)}/obf?meeting_id=${meetingId}`,
+  );
+  console.error(`OBF token for user ${userId} and meeting ${meetingId}:`);
+  console.log(token);
+  return 0;
+}
+
+export async function zakCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const userId = await resolveUserId(admin, parsed);
+  const { token } = await admin.request<{ token: string }>("GET", `/admin/tokens/${encodeURIComponent(userId)}/zak`);
+  console.error(`ZAK token for user ${userId}:`);
+  console.log(token);
+  return 0;
+}
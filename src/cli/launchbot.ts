@@ -0,0 +1,107 @@
+import { DEFAULT_RECALL_CALLBACK_SECRET, realtimeEvents, requireEnv, userAgent } from "../config.js";
+import { realtimeRecordingConfig } from "../realtime.js";
+import { DEFAULT_RECALL_API_BASE_URL, RecallApiError, RecallClient, recallCallbackUrl, withUserAgent } from "../zoomrecall/index.js";
+import type { Bot, CreateBotRequest } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+import { resolveUserId } from "./jointoken.js";
+
+const STATUS_POLL_INTERVAL_MS = 2 * 1000;
+// statuses after which a bot never changes again
+const FINAL_BOT_STATUSES = new Set(["done", "fatal", "analysis_done", "analysis_failed"]);
+
+async function sleep(ms: number): Promise<void> {
+  await new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+async function tailStatus(recall: RecallClient, botId: string): Promise<number> {
+  let seen = 0;
+  for (;;) {
+    let bot: Bot;
+    try {
+      bot = await recall.getBot(botId);
+    } catch (error) {
+      console.error(`could not fetch bot status: ${error instanceof Error ? error.message : String(error)}`);
+      await sleep(STATUS_POLL_INTERVAL_MS);
+      continue;
+    }
+
+    const changes = bot.status_changes ?? [];
+    for (const change of changes.slice(seen)) {
+      const detail = [change.sub_code, change.message].filter(Boolean).join(": ");
+      console.log(`${change.created_at}  ${change.code}${detail ? `  ${detail}` : ""}`);
+    }
+    seen = changes.length;
+
+    const latest = changes.at(-1)?.code;
+    if (latest && FINAL_BOT_STATUSES.has(latest)) {
+      return latest === "fatal" || latest === "analysis_failed" ? 1 : 0;
+    }
+    await sleep(STATUS_POLL_INTERVAL_MS);
+  }
+}
+
+/**
+ * Launches a Recall bot that joins with a connected user's Zoom credentials
+ * from a running instance, then follows the bot's status until it finishes.
+ */
+export async function launchBotCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const meetingUrl = parsed.positionals[0];
+  if (!meetingUrl) {
+    throw new CommandError("usage: launch-bot <meeting-url> [--user-id ID] [--callback-secret SECRET] [--bot-name NAME] [--zak] [--no-follow]");
+  }
+
+  const recall = new RecallClient({
+    apiKey: requireEnv(process.env, "RECALL_API_KEY"),
+    apiBaseUrl: process.env.RECALL_API_BASE_URL ?? DEFAULT_RECALL_API_BASE_URL,
+    httpClient: withUserAgent(userAgent(process.env)),
+  });
+  // Recall fetches credentials from the public URL, not from the admin URL this command may use
+  const baseUrl = requireEnv(process.env, "BASE_URL").replace(/\/$/, "");
+  const sharedSecret = process.env.RECALL_CALLBACK_SECRET ?? DEFAULT_RECALL_CALLBACK_SECRET;
+  // the user's own, for users given one with POST /admin/tokens/:userId/callback-secret
+  const callbackSecret = stringFlag(parsed, "callback-secret") ?? sharedSecret;
+  const admin = process.env.ADMIN_API_KEY || stringFlag(parsed, "admin-key") ? new AdminClient(parsed) : undefined;
+  const userId = stringFlag(parsed, "user-id") ?? (await resolveUserId(admin ?? new AdminClient(parsed), parsed));
+
+  // so the running instance relays this bot's real-time events like those of bots it launches itself
+  const recordingConfig = realtimeRecordingConfig(baseUrl, sharedSecret, realtimeEvents(process.env));
+  const request: CreateBotRequest = {
+    meeting_url: meetingUrl,
+    bot_name: stringFlag(parsed, "bot-name") ?? "Recall Bot",
+    zoom: {
+      obf_token_url: recallCallbackUrl(baseUrl, "obf-callback", callbackSecret, userId),
+      ...(booleanFlag(parsed, "zak") ? { zak_url: recallCallbackUrl(baseUrl, "zak-callback", callbackSecret, userId) } : {}),
+    },
+    automatic_leave: {
+      waiting_room_timeout: 1200,
+    },
+    ...(recordingConfig ? { recording_config: recordingConfig } : {}),
+  };
+
+  let bot: Bot;
+  try {
+    bot = await recall.createBot(request);
+  } catch (error) {
+    if (error instanceof RecallApiError) {
+      throw new CommandError(`recall rejected the bot: ${error.message}`);
+    }
+    throw error;
+  }
+
+  if (admin) {
+    // so the running instance can tell whose credentials the bot used
+    await admin
+      .request("POST", "/admin/bots", { bot_id: bot.id, user_id: userId, meeting_url: meetingUrl, source: "cli" })
+      .catch((error: unknown) => console.error(`could not record the bot's identity: ${error instanceof Error ? error.message : String(error)}`));
+  }
+  console.error(`launched bot for user ${userId}:`);
+  console.log(bot.id);
+  if (booleanFlag(parsed, "no-follow")) {
+    return 0;
+  }
+  console.error("following bot status, press Ctrl-C to stop");
+  return tailStatus(recall, bot.id);
+}
@@ -0,0 +1,64 @@
+import { formatTime, isTimeZone } from "../timezone.js";
+import { parseMeetingId } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag, timeZoneFlag } from "./flags.js";
+import { resolveUserId } from "./jointoken.js";
+
+interface MeetingJSON {
+  meeting_id: string;
+  topic: string;
+  host_id: string;
+  host_email: string | null;
+  start_time: string | null;
+  timezone: string | null;
+  duration_minutes: number | null;
+  status: string | null;
+  registration_required: boolean;
+  waiting_room: boolean;
+  join_before_host: boolean;
+}
+
+// in the meeting's own time zone, and in the display one too when they differ
+function startTime(start: Date, meetingTimeZone: string | null, timeZone: string): string {
+  const own = meetingTimeZone && isTimeZone(meetingTimeZone) ? meetingTimeZone : null;
+  if (!own || own === timeZone) return formatTime(start, timeZone);
+  return `${formatTime(start, own)} (${own}), ${formatTime(start, timeZone)}`;
+}
+
+export async function meetingCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const raw = stringFlag(parsed, "meeting-id") ?? parsed.positionals[0];
+  const meetingId = raw === undefined ? undefined : parseMeetingId(raw);
+  if (!meetingId) {
+    throw new CommandError("usage: meeting <meeting-id> [--user-id ID] [--json] [--time-zone ZONE]");
+  }
+  const timeZone = timeZoneFlag(parsed);
+
+  const admin = new AdminClient(parsed);
+  const userId = await resolveUserId(admin, parsed);
+  const meeting = await admin.request<MeetingJSON>(
+    "GET",
+    `/admin/tokens/${encodeURIComponent(userId)}/meetings/${meetingId}`,
+  );
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(meeting, null, 2));
+    return 0;
+  }
+
+  const yesNo = (value: boolean) => (value ? "yes" : "no");
+  console.log(`meeting           ${meeting.meeting_id}`);
+  console.log(`topic             ${meeting.topic}`);
+  console.log(`host              ${meeting.host_email ?? meeting.host_id}`);
+  console.log(`start time        ${meeting.start_time ? startTime(new Date(meeting.start_time), meeting.timezone, timeZone) : "-"}`);
+  console.log(`duration          ${meeting.duration_minutes === null ? "-" : `${meeting.duration_minutes} min`}`);
+  console.log(`status            ${meeting.status ?? "-"}`);
+  console.log(`registration      ${yesNo(meeting.registration_required)}`);
+  console.log(`waiting room      ${yesNo(meeting.waiting_room)}`);
+  console.log(`join before host  ${yesNo(meeting.join_before_host)}`);
+  // the two settings that most often keep a bot from getting in on its own
+  if (meeting.registration_required || meeting.waiting_room) {
+    console.error("warning: a bot may need to be admitted or registered before it can join this meeting");
+  }
+  return 0;
+}
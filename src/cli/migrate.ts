@@ -0,0 +1,103 @@
+import { openTokenStore } from "../app.js";
+import { loadConfig, TOKEN_STORES, withSsmParameters } from "../config.js";
+import type { Config } from "../config.js";
+import { copyTokenStore, migrateDown, migrateUp, migrationStatus, MigrationError, schemaBackendFor } from "../migrate.js";
+import { createHttpClient, withUserAgent } from "../zoomrecall/index.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+
+const USAGE = "usage: migrate status | migrate up [--to VERSION] | migrate down [--to VERSION]";
+
+/** Shows or changes the schema version of the configured token store. */
+export async function migrateCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const [subcommand] = parsed.positionals;
+  if (subcommand !== "status" && subcommand !== "up" && subcommand !== "down") {
+    throw new CommandError(USAGE);
+  }
+  const rawTarget = stringFlag(parsed, "to");
+  const target = rawTarget === undefined ? undefined : Number(rawTarget);
+  if (target !== undefined && (!Number.isInteger(target) || target < 0)) {
+    throw new CommandError("--to must be a non-negative schema version");
+  }
+
+  const backend = schemaBackendFor(loadConfig(await withSsmParameters()));
+  if (!backend) {
+    console.log("the configured token store has no schema to migrate");
+    return subcommand === "status" ? 0 : 1;
+  }
+
+  try {
+    if (subcommand === "status") {
+      const { current, latest, pending } = await migrationStatus(backend);
+      console.log(`${backend.name}: schema version ${current}, latest ${latest}`);
+      for (const migration of pending) {
+        console.log(`  pending ${migration.version}: ${migration.description}`);
+      }
+      return 0;
+    }
+
+    const changed = subcommand === "up" ? await migrateUp(backend, target) : await migrateDown(backend, target);
+    for (const migration of changed) {
+      console.log(`${subcommand === "up" ? "applied" : "reverted"} ${migration.version}: ${migration.description}`);
+    }
+    console.log(`${backend.name} is at schema version ${await backend.currentVersion()}`);
+    return 0;
+  } catch (error) {
+    if (error instanceof MigrationError) throw new CommandError(error.message);
+    throw error;
+  } finally {
+    await backend.close();
+  }
+}
+
+const STORE_USAGE = "usage: migrate-store --from STORE --to STORE [--from-path PATH] [--to-path PATH] [--overwrite] [--dry-run]";
+
+// the environment's configuration with another TOKEN_STORE and TOKEN_STORE_PATH, validated as if the server were started with them
+function storeConfig(env: NodeJS.ProcessEnv, store: string | undefined, path: string | undefined): Config {
+  if (!store || !(TOKEN_STORES as readonly string[]).includes(store) || store === "memory") {
+    throw new CommandError(`${STORE_USAGE}\nSTORE is one of ${TOKEN_STORES.filter((name) => name !== "memory").join(", ")}`);
+  }
+  return loadConfig({ ...env, TOKEN_STORE: store, ...(path ? { TOKEN_STORE_PATH: path } : {}) });
+}
+
+/**
+ * Copies every user from one token store to another, e.g. from the file
+ * store to Redis. Both are configured by the environment, as for the server,
+ * with --from/--to picking TOKEN_STORE and --from-path/--to-path overriding
+ * TOKEN_STORE_PATH.
+ */
+export async function migrateStoreCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const env = await withSsmParameters();
+  const fromConfig = storeConfig(env, stringFlag(parsed, "from"), stringFlag(parsed, "from-path"));
+  const toConfig = storeConfig(env, stringFlag(parsed, "to"), stringFlag(parsed, "to-path"));
+  if (fromConfig.tokenStore === toConfig.tokenStore && fromConfig.tokenStorePath === toConfig.tokenStorePath) {
+    throw new CommandError("--from and --to are the same store");
+  }
+
+  const httpClient = withUserAgent(fromConfig.userAgent, createHttpClient(fromConfig.httpTimeoutMs));
+  const { store: from } = openTokenStore(fromConfig, httpClient);
+  const { store: to } = openTokenStore(toConfig, httpClient);
+  try {
+    const dryRun = booleanFlag(parsed, "dry-run");
+    const { copied, skipped } = await copyTokenStore(from, to, { overwrite: booleanFlag(parsed, "overwrite"), dryRun });
+    for (const provider of Object.keys(copied)) {
+      if (copied[provider] === 0 && skipped[provider] === 0) continue;
+      console.log(
+        `${provider}: ${dryRun ? "would copy" : "copied"} ${copied[provider]} user(s)` +
+          (skipped[provider] > 0 ? `, skipped ${skipped[provider]} already in ${to.path} (--overwrite replaces them)` : ""),
+      );
+    }
+    const total = Object.values(copied).reduce((sum, count) => sum + count, 0);
+    console.log(`${dryRun ? "would copy" : "copied"} ${total} user(s) from ${from.path} to ${to.path}`);
+    if (!dryRun && total > 0) {
+      // zoom refresh tokens are spent when used, so a refresh through the old store strands the copy
+      console.log(`now run the server with TOKEN_STORE=${toConfig.tokenStore}; tokens refreshed in ${from.path} from here on are not in ${to.path}`);
+    }
+    return 0;
+  } finally {
+    from.close?.();
+    to.close?.();
+  }
+}
@@ -0,0 +1,78 @@
+import type { RemovedUser } from "../removals.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs } from "./flags.js";
+
+/** Revokes a user's authorization at Zoom and removes their tokens from a running instance. */
+export async function revokeCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const userId = parsed.positionals[0];
+  if (!userId) {
+    throw new CommandError("usage: revoke <user-id>");
+  }
+
+  const admin = new AdminClient(parsed);
+  await admin.request("POST", `/admin/tokens/${encodeURIComponent(userId)}/revoke`);
+  console.log(`revoked zoom authorization for user ${userId} and removed it from ${admin.url}`);
+  return 0;
+}
+
+/** Removes a user's tokens from a running instance without contacting Zoom; --hard also forgets the removed user. */
+export async function purgeCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const userId = parsed.positionals[0];
+  if (!userId) {
+    throw new CommandError("usage: purge <user-id> [--hard]");
+  }
+
+  const admin = new AdminClient(parsed);
+  const hard = booleanFlag(parsed, "hard");
+  await admin.request("DELETE", `/admin/tokens/${encodeURIComponent(userId)}${hard ? "?hard=true" : ""}`);
+  if (hard) {
+    console.log(`deleted user ${userId} from ${admin.url}, nothing about them is kept`);
+    return 0;
+  }
+  console.log(`removed tokens for user ${userId} from ${admin.url}; they are still valid at zoom until they expire, use revoke to invalidate them`);
+  return 0;
+}
+
+/** Lists the users a running instance keeps soft-deleted records of, most recently removed first. */
+export async function removedUsersCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const { users } = await admin.request<{ users: RemovedUser[] }>("GET", "/admin/removed-users");
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(users, null, 2));
+    return 0;
+  }
+  if (users.length === 0) {
+    console.log("no removed users");
+    return 0;
+  }
+  for (const user of users) {
+    console.log(
+      [
+        user.removed_at,
+        user.user_id,
+        user.removal.padEnd(7),
+        user.restored_as ? `restored as ${user.restored_as}` : `purged after ${user.purge_after}`,
+        user.notes.at(-1)?.note ?? "-",
+      ].join("  "),
+    );
+  }
+  return 0;
+}
+
+/** Adds a note to a removed user's record, e.g. why an accidental revocation happened. */
+export async function annotateCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const [userId, ...words] = parsed.positionals;
+  if (!userId || words.length === 0) {
+    throw new CommandError("usage: annotate <user-id> <note>");
+  }
+
+  const admin = new AdminClient(parsed);
+  await admin.request("POST", `/admin/removed-users/${encodeURIComponent(userId)}/notes`, { note: words.join(" ") });
+  console.log(`added a note to removed user ${userId}`);
+  return 0;
+}
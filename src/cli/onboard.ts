@@ -0,0 +1,96 @@
+import { readFileSync } from "fs";
+import type { Invitation, Invitee } from "../onboarding.js";
+import { parseInviteesCsv } from "../onboarding.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+
+const INVITE_USAGE = "usage: invite [EMAIL...] [--file users.csv|users.json] [--send] [--json]";
+
+// a .json file holds an array of emails or {email, name} objects, or {"users": [...]}; anything else is read as CSV
+function readInvitees(path: string): Invitee[] {
+  let text: string;
+  try {
+    text = readFileSync(path, "utf8");
+  } catch (error) {
+    throw new CommandError(`could not read ${path}: ${error instanceof Error ? error.message : String(error)}`);
+  }
+  if (!path.endsWith(".json")) return parseInviteesCsv(text);
+  try {
+    const parsed = JSON.parse(text) as Invitee[] | { users: Invitee[] };
+    return Array.isArray(parsed) ? parsed : parsed.users;
+  } catch (error) {
+    throw new CommandError(`${path} is not JSON: ${error instanceof Error ? error.message : String(error)}`);
+  }
+}
+
+/** Invites users to connect their Zoom accounts, printing each one's consent link and, with --send, emailing it to them. */
+export async function inviteCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const file = stringFlag(parsed, "file");
+  const users = [...parsed.positionals.map((email) => ({ email })), ...(file ? readInvitees(file) : [])];
+  if (users.length === 0) {
+    throw new CommandError(INVITE_USAGE);
+  }
+
+  const admin = new AdminClient(parsed);
+  const result = await admin.request<{ created: number; emailed: number; invitations: (Invitation & { created: boolean })[] }>(
+    "POST",
+    "/admin/invitations",
+    { users, email: booleanFlag(parsed, "send") },
+  );
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(result.invitations, null, 2));
+    return 0;
+  }
+  for (const invitation of result.invitations) {
+    const state = invitation.status === "completed" ? `connected as ${invitation.user_id}` : invitation.created ? "invited" : "already invited";
+    console.log([invitation.email, state.padEnd(15), invitation.email_error ? `not emailed: ${invitation.email_error}` : invitation.link].join("  "));
+  }
+  console.log(`${result.created} new invitation(s) of ${result.invitations.length}${booleanFlag(parsed, "send") ? `, ${result.emailed} emailed` : ""}`);
+  return result.invitations.some((invitation) => invitation.email_error) ? 1 : 0;
+}
+
+/** Lists onboarding invitations and who has connected, most recently invited first. */
+export async function invitationsCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const query = booleanFlag(parsed, "pending") ? "?status=pending" : "";
+  const { invitations, pending, completed } = await admin.request<{ invitations: Invitation[]; pending: number; completed: number }>(
+    "GET",
+    `/admin/invitations${query}`,
+  );
+  if (booleanFlag(parsed, "json")) {
+    console.log(JSON.stringify(invitations, null, 2));
+    return 0;
+  }
+  for (const invitation of invitations) {
+    console.log(
+      [
+        invitation.created_at,
+        invitation.email,
+        invitation.status.padEnd(9),
+        invitation.status === "completed"
+          ? `${invitation.completed_at} as ${invitation.user_id}`
+          : invitation.emailed_at
+            ? `emailed ${invitation.emailed_at}${invitation.reminders_sent > 0 ? `, reminded ${invitation.reminders_sent}x` : ""}`
+            : "not emailed",
+      ].join("  "),
+    );
+  }
+  console.log(`${completed} connected, ${pending} pending`);
+  return 0;
+}
+
+/** Emails a reminder to the given invited users, or to everyone invited, that haven't connected yet. */
+export async function remindCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const emails = parsed.positionals;
+  const { invitations } = await admin.request<{ invitations: Invitation[] }>("POST", "/admin/invitations/remind", emails.length > 0 ? { emails } : {});
+  for (const invitation of invitations) {
+    console.log(`${invitation.email}  reminder ${invitation.reminders_sent}`);
+  }
+  console.log(`reminded ${invitations.length} user(s) who haven't connected yet`);
+  return 0;
+}
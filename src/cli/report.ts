@@ -0,0 +1,27 @@
+export type CheckStatus = "ok" | "warn" | "fail";
+
+export interface CheckResult {
+  status: CheckStatus;
+  name: string;
+  detail: string;
+}
+
+function colorize(status: CheckStatus): string {
+  const label = status.toUpperCase().padEnd(4);
+  if (!process.stdout.isTTY || process.env.NO_COLOR) return label;
+  const color = status === "ok" ? 32 : status === "warn" ? 33 : 31;
+  return `\x1b[${color}m${label}\x1b[0m`;
+}
+
+/** Prints one colour-coded line per result and a summary; returns the exit code (1 if anything failed). */
+export function printReport(results: CheckResult[]): number {
+  const width = Math.max(...results.map((result) => result.name.length));
+  for (const result of results) {
+    console.log(`${colorize(result.status)}  ${result.name.padEnd(width)}  ${result.detail}`);
+  }
+
+  const failures = results.filter((result) => result.status === "fail").length;
+  const warnings = results.filter((result) => result.status === "warn").length;
+  console.log(`\n${failures} failed, ${warnings} warnings, ${results.length - failures - warnings} ok`);
+  return failures === 0 ? 0 : 1;
+}
@@ -0,0 +1,121 @@
+import { randomBytes, randomUUID } from "crypto";
+import { chmod, readFile, rename, writeFile } from "fs/promises";
+import { recallCallbackUrl } from "../zoomrecall/index.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, stringFlag } from "./flags.js";
+
+const DEFAULT_SECRET_BYTES = 32;
+const DEFAULT_SECRET_NAMES = ["RECALL_CALLBACK_SECRET"];
+
+// base64url so secrets can be passed as query parameters (Recall sends auth_token in the URL) without escaping
+function generateSecret(bytes: number = DEFAULT_SECRET_BYTES): string {
+  return randomBytes(bytes).toString("base64url");
+}
+
+async function readEnvFile(path: string): Promise<string[]> {
+  try {
+    const content = await readFile(path, "utf8");
+    return content === "" ? [] : content.replace(/\n$/, "").split("\n");
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code === "ENOENT") return [];
+    throw error;
+  }
+}
+
+async function writeSecrets(path: string, secrets: Map<string, string>, force: boolean): Promise<void> {
+  const lines = await readEnvFile(path);
+  for (const [name, value] of secrets) {
+    const index = lines.findIndex((line) => line.replace(/^export\s+/, "").startsWith(`${name}=`));
+    if (index === -1) {
+      lines.push(`${name}=${value}`);
+    } else if (force) {
+      lines[index] = `${name}=${value}`;
+    } else {
+      throw new CommandError(`${name} is already set in ${path}, pass --force to replace it`);
+    }
+  }
+  await writeEnvFile(path, lines);
+}
+
+async function writeEnvFile(path: string, lines: string[]): Promise<void> {
+  // write next to the target and rename so a crash never leaves a truncated file behind
+  const temporary = `${path}.${process.pid}.tmp`;
+  await writeFile(temporary, `${lines.join("\n")}\n`, { mode: 0o600 });
+  await rename(temporary, path);
+  await chmod(path, 0o600);
+}
+
+/**
+ * Generates random secrets for the given variable names (RECALL_CALLBACK_SECRET
+ * by default) and prints them, or stores them in an env file with --env-file.
+ */
+export async function generateSecretCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const bytes = Number(stringFlag(parsed, "bytes") ?? DEFAULT_SECRET_BYTES);
+  if (!Number.isInteger(bytes) || bytes < 16 || bytes > 1024) {
+    throw new CommandError("--bytes must be an integer between 16 and 1024");
+  }
+  const names = parsed.positionals.length > 0 ? parsed.positionals : DEFAULT_SECRET_NAMES;
+  for (const name of names) {
+    if (!/^[A-Z_][A-Z0-9_]*$/.test(name)) {
+      throw new CommandError(`invalid variable name: ${name}`);
+    }
+  }
+
+  const secrets = new Map(names.map((name) => [name, generateSecret(bytes)]));
+  const envFile = stringFlag(parsed, "env-file");
+  if (!envFile) {
+    for (const [name, value] of secrets) {
+      console.log(`${name}=${value}`);
+    }
+    return 0;
+  }
+
+  await writeSecrets(envFile, secrets, booleanFlag(parsed, "force"));
+  console.log(`wrote ${names.join(", ")} to ${envFile}`);
+  return 0;
+}
+
+/**
+ * Generates a canary token for CANARY_TOKENS, labelled with where it is
+ * going to be planted, and prints Recall callback URLs that carry it. The
+ * URLs look like real ones but are never answered with a token; any request
+ * with them raises a canary.triggered alert.
+ */
+export async function generateCanaryCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const [label] = parsed.positionals;
+  if (!label || !/^[\w.-]+$/.test(label)) {
+    throw new CommandError("usage: generate-canary <label> [--url URL] [--user-id ID] [--env-file FILE], the label made of letters, digits, '.', '_' or '-'");
+  }
+  const token = generateSecret();
+  // a user ID shaped like the real ones, so nothing in the URL gives the canary away
+  const userId = stringFlag(parsed, "user-id") ?? randomUUID();
+  const baseUrl = stringFlag(parsed, "url") ?? process.env.BASE_URL ?? "";
+
+  const envFile = stringFlag(parsed, "env-file");
+  if (envFile) {
+    const lines = await readEnvFile(envFile);
+    const index = lines.findIndex((line) => line.replace(/^export\s+/, "").startsWith("CANARY_TOKENS="));
+    if (index === -1) {
+      lines.push(`CANARY_TOKENS=${label}=${token}`);
+    } else if (lines[index].slice(lines[index].indexOf("=") + 1).split(",").some((entry) => entry.split("=")[0].trim() === label)) {
+      throw new CommandError(`${envFile} already has a canary labelled ${label}`);
+    } else {
+      lines[index] = `${lines[index]}${lines[index].endsWith("=") ? "" : ","}${label}=${token}`;
+    }
+    await writeEnvFile(envFile, lines);
+    console.log(`added canary ${label} to CANARY_TOKENS in ${envFile}`);
+  } else {
+    console.log(`add to CANARY_TOKENS: ${label}=${token}`);
+  }
+
+  if (!baseUrl) {
+    console.log("pass --url or set BASE_URL to get callback URLs to plant");
+    return 0;
+  }
+  for (const callback of ["obf-callback", "zak-callback", "oauth-callback"] as const) {
+    console.log(`${callback}: ${recallCallbackUrl(baseUrl, callback, token, userId)}`);
+  }
+  return 0;
+}
@@ -0,0 +1,36 @@
+import { readFileSync } from "fs";
+import { createApp } from "../app.js";
+import { ConfigError, DEFAULT_PORT, loadConfig, withSsmParameters } from "../config.js";
+import { createGrpcServer } from "../grpc.js";
+
+export async function serve(): Promise<number> {
+  const config = loadConfig(await withSsmParameters());
+  const { app, tokens, zoomApps, tenants, teamsTokens, googleTokens, policy, served } = createApp(config);
+  // a shared store is read asynchronously; don't answer callbacks before its users are known
+  try {
+    await Promise.all([tokens, ...zoomApps.values(), ...tenants.values(), teamsTokens, googleTokens].map((manager) => manager?.ready));
+  } catch (error) {
+    throw new ConfigError(`could not restore tokens from the ${config.tokenStore} token store: ${error instanceof Error ? error.message : String(error)}`);
+  }
+  if (config.tokenStore === "memory") {
+    console.warn("tokens are kept in memory only and are lost on restart, set TOKEN_STORE=sqlite and TOKEN_STORE_PATH to keep them in one file");
+  }
+  app.listen(DEFAULT_PORT, "::");
+  if (config.grpcPort) {
+    const grpc = createGrpcServer({
+      tokens,
+      policy,
+      resolveHosts: config.resolveMeetingHosts,
+      resolveOccurrences: config.resolveMeetingOccurrences,
+      onServed: ({ kind, userId, meetingId, source }) =>
+        served({ kind, userId, zoomUserId: tokens.zoomUserId(userId), meetingId, source }),
+      cert: readFileSync(config.grpcTlsCert),
+      key: readFileSync(config.grpcTlsKey),
+      ca: readFileSync(config.grpcTlsCa),
+    });
+    grpc.listen(config.grpcPort, "::");
+    console.log(`grpc token service listening on port ${config.grpcPort}`);
+  }
+  // keep the process alive; the server exits via signals
+  return new Promise<number>(() => undefined);
+}
@@ -0,0 +1,107 @@
+import { DEFAULT_PORT, DEFAULT_RECALL_CALLBACK_SECRET } from "../config.js";
+import { parseMeetingId } from "../zoomrecall/index.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { parseArgs, stringFlag } from "./flags.js";
+import { resolveUserId } from "./jointoken.js";
+import { printReport } from "./report.js";
+import type { CheckResult } from "./report.js";
+
+const SLOW_RESPONSE_MS = 5 * 1000;
+const REQUEST_TIMEOUT_MS = 30 * 1000;
+// Zoom OAuth, OBF and ZAK tokens are all JWTs
+const JWT_PATTERN = /^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$/;
+
+async function callAsRecall(url: string, name: string): Promise<CheckResult[]> {
+  const started = Date.now();
+  let response: Response;
+  let body: string;
+  try {
+    // Recall sends a plain GET without an Accept header and uses the body verbatim as the token
+    response = await fetch(url, { signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS) });
+    body = await response.text();
+  } catch (error) {
+    return [{ status: "fail", name, detail: `request failed: ${error instanceof Error ? error.message : String(error)}` }];
+  }
+  const elapsed = Date.now() - started;
+
+  if (response.status !== 200) {
+    return [{ status: "fail", name, detail: `HTTP ${response.status}: ${body.trim()}` }];
+  }
+  if (body.trim() === "") {
+    return [{ status: "fail", name, detail: "HTTP 200 with an empty body" }];
+  }
+
+  const results: CheckResult[] = [];
+  const contentType = response.headers.get("content-type") ?? "";
+  if (!contentType.startsWith("text/plain")) {
+    results.push({ status: "warn", name, detail: `Content-Type is '${contentType}', expected text/plain` });
+  }
+  if (body !== body.trim()) {
+    results.push({ status: "fail", name, detail: "body has surrounding whitespace, which would become part of the token" });
+  } else if (/^[{<[]/.test(body) || /\s/.test(body)) {
+    results.push({ status: "fail", name, detail: `body is not a bare token: ${body.slice(0, 60)}` });
+  } else if (!JWT_PATTERN.test(body)) {
+    results.push({ status: "warn", name, detail: "body does not look like a Zoom token (JWT)" });
+  }
+  if (!/no-store/.test(response.headers.get("cache-control") ?? "")) {
+    results.push({ status: "warn", name, detail: "response is cacheable, tokens could be stored by proxies" });
+  }
+  if (elapsed > SLOW_RESPONSE_MS) {
+    results.push({ status: "warn", name, detail: `took ${elapsed}ms, bots may time out joining` });
+  }
+  if (!results.some((result) => result.status === "fail")) {
+    results.unshift({ status: "ok", name, detail: `HTTP 200 with a ${body.length} character token in ${elapsed}ms` });
+  }
+  return results;
+}
+
+async function checkRejectsWrongSecret(baseUrl: string, userId: string): Promise<CheckResult> {
+  const name = "wrong secret";
+  try {
+    const query = new URLSearchParams({ auth_token: `${Date.now()}-not-the-secret`, user_id: userId });
+    const response = await fetch(`${baseUrl}/recall/oauth-callback?${query}`, { signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS) });
+    if (response.status === 200) {
+      return { status: "fail", name, detail: "a token was returned without the correct auth_token" };
+    }
+    return { status: "ok", name, detail: `rejected with HTTP ${response.status}` };
+  } catch (error) {
+    return { status: "fail", name, detail: `request failed: ${error instanceof Error ? error.message : String(error)}` };
+  }
+}
+
+/**
+ * Calls a running instance's /recall/* endpoints the way Recall does and
+ * reports whether the responses would be accepted.
+ */
+export async function simulateRecallCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const baseUrl = (stringFlag(parsed, "url") ?? process.env.BASE_URL ?? `http://localhost:${DEFAULT_PORT}`).replace(/\/$/, "");
+  const secret = stringFlag(parsed, "secret") ?? process.env.RECALL_CALLBACK_SECRET ?? DEFAULT_RECALL_CALLBACK_SECRET;
+  const rawMeetingId = stringFlag(parsed, "meeting-id");
+  const meetingId = rawMeetingId === undefined ? undefined : parseMeetingId(rawMeetingId);
+  if (rawMeetingId !== undefined && !meetingId) {
+    throw new CommandError(`invalid --meeting-id: ${rawMeetingId}`);
+  }
+
+  let userId = stringFlag(parsed, "user-id");
+  if (!userId) {
+    if (!stringFlag(parsed, "admin-key") && !process.env.ADMIN_API_KEY) {
+      throw new CommandError("pass --user-id, or set ADMIN_API_KEY to pick the only connected user");
+    }
+    userId = await resolveUserId(new AdminClient(parsed, { ...process.env, ADMIN_URL: process.env.ADMIN_URL ?? baseUrl }), parsed);
+  }
+
+  const query = new URLSearchParams({ auth_token: secret, user_id: userId });
+  const obfQuery = new URLSearchParams(query);
+  if (meetingId) obfQuery.set("meeting_id", meetingId);
+  console.log(`simulating Recall against ${baseUrl} as user ${userId}\n`);
+
+  const results = [
+    ...(await callAsRecall(`${baseUrl}/recall/oauth-callback?${query}`, "oauth-callback")),
+    ...(await callAsRecall(`${baseUrl}/recall/obf-callback?${obfQuery}`, "obf-callback")),
+    ...(await callAsRecall(`${baseUrl}/recall/zak-callback?${query}`, "zak-callback")),
+    await checkRejectsWrongSecret(baseUrl, userId),
+  ];
+  return printReport(results);
+}
@@ -0,0 +1,14 @@
+import { writeFileSync } from "fs";
+import { AdminClient } from "./adminclient.js";
+import { parseArgs, stringFlag } from "./flags.js";
+
+/** Saves a running instance's redacted support bundle, to attach to a support request. */
+export async function supportBundleCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const admin = new AdminClient(parsed);
+  const output = stringFlag(parsed, "output") ?? `support-bundle-${new Date().toISOString().replace(/[-:]|\.\d+/g, "")}.tar.gz`;
+  const bundle = await admin.download("/admin/support-bundle");
+  writeFileSync(output, bundle, { mode: 0o600 });
+  console.log(`saved the support bundle of ${admin.url} to ${output}, secrets and tokens are redacted but user and meeting IDs aren't`);
+  return 0;
+}
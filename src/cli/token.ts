@@ -0,0 +1,114 @@
+import { formatTimestamp } from "../timezone.js";
+import { AdminClient } from "./adminclient.js";
+import { CommandError } from "./command.js";
+import { booleanFlag, parseArgs, timeZoneFlag } from "./flags.js";
+
+interface TokenStatusJSON {
+  user_id: string;
+  expires_at: string;
+  next_refresh_at: string | null;
+  last_refreshed_at: string | null;
+  needs_reauthorization: boolean;
+  deactivated: boolean;
+  missing_scopes?: string[];
+  reauthorization_due_at?: string | null;
+  refresh_failures?: number;
+  email?: string | null;
+  time_zone?: string | null;
+  access_token?: string;
+}
+
+function describe(status: TokenStatusJSON, timeZone: string): string {
+  const time = (value: string | null, none: string) => (value === null ? none : formatTimestamp(value, timeZone));
+  const state = status.deactivated
+    ? "DEACTIVATED"
+    : status.needs_reauthorization
+      ? "NEEDS RE-AUTH"
+      : new Date(status.expires_at) <= new Date()
+        ? "EXPIRED"
+        : status.missing_scopes?.length
+          ? "SCOPES NARROWED"
+          : "ok";
+  return [
+    status.user_id,
+    ...(status.email ? [status.email] : []),
+    state,
+    `expires ${time(status.expires_at, "-")}`,
+    `next refresh ${time(status.next_refresh_at, "-")}`,
+    `last refreshed ${time(status.last_refreshed_at, "never")}`,
+    ...(status.refresh_failures ? [`${status.refresh_failures} failed refresh(es)`] : []),
+    ...(status.reauthorization_due_at ? [`re-authorize by ${time(status.reauthorization_due_at, "-")}`] : []),
+    ...(status.time_zone ? [`zoom time zone ${status.time_zone}`] : []),
+  ].join("  ");
+}
+
+export async function tokenCommand(args: string[]): Promise<number> {
+  const parsed = parseArgs(args);
+  const [subcommand, userId] = parsed.positionals;
+  const admin = new AdminClient(parsed);
+  const timeZone = timeZoneFlag(parsed);
+
+  switch (subcommand) {
+    case "status": {
+      if (userId) {
+        const status = await admin.request<TokenStatusJSON>("GET", `/admin/tokens/${encodeURIComponent(userId)}`);
+        console.log(booleanFlag(parsed, "json") ? JSON.stringify(status, null, 2) : describe(status, timeZone));
+        return 0;
+      }
+      const { tokens } = await admin.request<{ tokens: TokenStatusJSON[] }>("GET", "/admin/tokens");
+      if (booleanFlag(parsed, "json")) {
+        console.log(JSON.stringify(tokens, null, 2));
+      } else if (tokens.length === 0) {
+        console.log(`no tokens stored on ${admin.url}`);
+      } else {
+        tokens.forEach((status) => console.log(describe(status, timeZone)));
+      }
+      return 0;
+    }
+    case "get": {
+      if (!userId) {
+        throw new CommandError("usage: token get <user-id>");
+      }
+      const status = await admin.request<TokenStatusJSON>(
+        "GET",
+        `/admin/tokens/${encodeURIComponent(userId)}?include_token=true`,
+      );
+      console.error(describe(status, timeZone));
+      console.log(status.access_token ?? "");
+      return 0;
+    }
+    case "verify": {
+      if (!userId) {
+        throw new CommandError("usage: token verify <user-id>");
+      }
+      const check = await admin.request<{ works: boolean; detail: string; email: string | null; account_id: string | null; scopes: string[] | null; expires_at: string }>(
+        "POST",
+        `/admin/tokens/${encodeURIComponent(userId)}/verify`,
+      );
+      if (booleanFlag(parsed, "json")) {
+        console.log(JSON.stringify(check, null, 2));
+      } else {
+        console.log(
+          [
+            userId,
+            check.works ? "WORKS" : "REJECTED",
+            ...(check.email ? [check.email] : []),
+            ...(check.account_id ? [`account ${check.account_id}`] : []),
+            `scopes ${check.scopes?.join(",") || "-"}`,
+            `expires ${formatTimestamp(check.expires_at, timeZone)}`,
+          ].join("  "),
+        );
+        console.log(check.detail);
+      }
+      return check.works ? 0 : 1;
+    }
+    case "sync": {
+      const result = await admin.request<{ checked: number; deactivated: string[] }>("POST", "/admin/tokens/sync");
+      console.log(`checked ${result.checked} user(s) against zoom, deactivated ${result.deactivated.length}`);
+      result.deactivated.forEach((deactivated) => console.log(deactivated));
+      return 0;
+    }
+    default:
+      throw new CommandError("usage: token status [user-id] [--json] [--time-zone ZONE] | token get <user-id> | token verify <user-id> [--json] | token sync");
+  }
+}
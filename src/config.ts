@@ -0,0 +1,1128 @@
+import { randomBytes } from "crypto";
+import { hostname } from "os";
+import { defaultUserAgent } from "./about.js";
+import type { CanaryToken } from "./canaries.js";
+import { DEFAULT_CONSENT_SESSION_TTL_MS } from "./consent.js";
+import { DEFAULT_LOCALE, isLocale, LOCALES } from "./i18n.js";
+import type { Locale } from "./i18n.js";
+import { DEFAULT_NOTIFY_ROUTES, DEFAULT_PAGERDUTY_EVENTS_URL, NOTIFIER_NAMES } from "./notify.js";
+import type { NotifierName, NotifyRoutes } from "./notify.js";
+import { REALTIME_EVENT_TYPES } from "./realtime.js";
+import {
+  DEFAULT_AUDIT_RETENTION_MS,
+  DEFAULT_BOT_IDENTITY_RETENTION_MS,
+  DEFAULT_DEAD_LETTER_RETENTION_MS,
+  DEFAULT_REMOVED_USER_RETENTION_MS,
+  DEFAULT_RETENTION_INTERVAL_MS,
+  DEFAULT_TOKEN_HISTORY_RETENTION_MS,
+} from "./retention.js";
+import { DEFAULT_LATENCY_SLO_OBJECTIVE, LATENCY_SLO_ENDPOINTS } from "./slo.js";
+import type { LatencySlo, LatencySloEndpoint } from "./slo.js";
+import { DEFAULT_TIME_ZONE, isTimeZone } from "./timezone.js";
+import { WEBHOOK_EVENT_TYPES } from "./webhooks.js";
+import {
+  AgeProvider,
+  AwsCredentialProvider,
+  awsCredentialSource,
+  AwsJsonClient,
+  AwsKmsProvider,
+  AzureCredentialProvider,
+  azureCredentialSource,
+  DEFAULT_AZURE_KEY_VAULT_SECRET_NAME,
+  DEFAULT_CLOCK_SKEW_WARNING_MS,
+  DEFAULT_DYNAMODB_TTL_MS,
+  GcpCredentialProvider,
+  GcpKmsProvider,
+  DEFAULT_GOOGLE_AUTH_BASE_URL,
+  DEFAULT_GOOGLE_SCOPES,
+  DEFAULT_GOOGLE_TOKEN_BASE_URL,
+  DEFAULT_ISSUANCE_ANOMALY_THRESHOLD,
+  DEFAULT_MICROSOFT_LOGIN_BASE_URL,
+  DEFAULT_MICROSOFT_SCOPES,
+  DEFAULT_MICROSOFT_TENANT,
+  DEFAULT_OBF_CACHE_TTL_MS,
+  DEFAULT_PROXY_TOKEN_TTL_MS,
+  DEFAULT_RECALL_API_BASE_URL,
+  DEFAULT_REAUTHORIZATION_WARNING_MS,
+  DEFAULT_REDIS_KEY_PREFIX,
+  DEFAULT_REFRESH_TOKEN_LIFETIME_MS,
+  DEFAULT_STALE_TOKEN_GRACE_MS,
+  DEFAULT_TOKEN_REFRESH_INTERVAL_MS,
+  DEFAULT_TOKEN_REFRESH_MARGIN_MS,
+  DEFAULT_VAULT_KUBERNETES_AUTH_PATH,
+  DEFAULT_VAULT_KUBERNETES_TOKEN_PATH,
+  DEFAULT_VAULT_KV_MOUNT,
+  DEFAULT_VAULT_PATH_PREFIX,
+  DEFAULT_ZAK_CACHE_TTL_MS,
+  DEFAULT_ZOOM_API_BASE_URL,
+  DEFAULT_ZOOM_OAUTH_BASE_URL,
+  isDynamoDbTable,
+  isGcpKmsKeyName,
+  isGcpSecretName,
+  isKeyVaultSecretName,
+  isKubernetesSecretName,
+  isSsmParameterPath,
+  keyVaultResource,
+  kmsKeyArnRegion,
+  kubernetesApiUrl,
+  LocalKeyProvider,
+  parseEncryptionKey,
+  parseMeetingId,
+  PgpProvider,
+  secretArnRegion,
+  SsmParameterClient,
+  tableArnRegion,
+  TOKEN_RESPONSE_FORMATS,
+  withUserAgent,
+} from "./zoomrecall/index.js";
+import type {
+  AwsCredentialSource,
+  AwsSecretsManagerTokenStoreOptions,
+  AzureCredentialSource,
+  AzureKeyVaultTokenStoreOptions,
+  DynamoDbTokenStoreOptions,
+  EncryptedTokenStoreOptions,
+  EncryptionProvider,
+  GcpSecretManagerTokenStoreOptions,
+  HttpClient,
+  IssuanceRules,
+  KubernetesSecretTokenStoreOptions,
+  StaleTokenPolicy,
+  TokenResponseFormat,
+  VaultTokenStoreOptions,
+} from "./zoomrecall/index.js";
+
+export const DEFAULT_RECALL_CALLBACK_SECRET = "helloWorld";
+
+// the stores only one instance uses; the others are there to be shared
+const SINGLE_INSTANCE_TOKEN_STORES: readonly string[] = ["memory", "file", "sqlite"];
+export const TOKEN_STORES = ["memory", "file", "sqlite", "redis", "vault", "aws-secrets-manager", "dynamodb", "gcp-secret-manager", "azure-key-vault", "kubernetes-secret"] as const;
+
+export const TOKEN_ENCRYPTION_PROVIDERS = ["local", "aws-kms", "gcp-kms", "age", "pgp"] as const;
+
+// what happens while RECALL_CALLBACK_SECRET is unset or the default
+export const DEFAULT_SECRET_POLICIES = ["warn", "refuse", "generate"] as const;
+export type DefaultSecretPolicy = (typeof DEFAULT_SECRET_POLICIES)[number];
+export const DEFAULT_PORT = 9567;
+// onboarding invitations still pending get at most this many reminders
+export const DEFAULT_ONBOARDING_MAX_REMINDERS = 3;
+
+/** A Zoom OAuth app besides the one of ZOOM_CLIENT_ID, whose users' tokens are kept apart. */
+export interface ZoomAppConfig {
+  name: string;
+  clientId: string;
+  clientSecret: string;
+  redirectUri: string;
+}
+
+/** A customer served under /t/<name>/, with Zoom credentials, callback secret and stored tokens of its own. */
+export interface TenantConfig {
+  name: string;
+  zoomClientId: string;
+  zoomClientSecret: string;
+  zoomRedirectUri: string;
+  recallCallbackSecret: string;
+}
+
+export interface Config {
+  zoomClientId: string;
+  zoomClientSecret: string;
+  // set for a Server-to-Server OAuth app: the account's token comes from its credentials and nobody consents
+  zoomAccountId: string;
+  // the connected admin of an account-level app whose token mints for the account's hosts who never connected
+  zoomAccountAdminUserId: string;
+  zoomRedirectUri: string;
+  // further Zoom apps, e.g. staging's, selected with ?app=<name> on consent and the Recall callbacks
+  zoomApps: ZoomAppConfig[];
+  tenants: TenantConfig[];
+  baseUrl: string;
+  recallCallbackSecret: string;
+  // "default" while the secret is DEFAULT_RECALL_CALLBACK_SECRET, "generated" when it was made up at startup
+  recallCallbackSecretSource: "env" | "default" | "generated";
+  // "refuse" answers /recall requests with 503 while the secret is the default; "production" NODE_ENV defaults to it
+  defaultSecretPolicy: DefaultSecretPolicy;
+  recallApiKey: string;
+  zoomOauthBaseUrl: string;
+  zoomApiBaseUrl: string;
+  recallApiBaseUrl: string;
+  httpTimeoutMs: number;
+  // names this instance in the User-Agent of outbound requests and in GET /about
+  instanceId: string;
+  userAgent: string;
+  zakCacheTtlMs: number;
+  obfCacheTtlMs: number;
+  tokenRefreshIntervalMs: number;
+  tokenRefreshMarginMs: number;
+  staleTokenPolicy: StaleTokenPolicy;
+  staleTokenGraceMs: number;
+  // how long refresh tokens and consents last, for forecasting when users must consent again
+  refreshTokenLifetimeMs: number;
+  consentLifetimeMs: number;
+  reauthorizationWarningMs: number;
+  // how far the local clock may be off Zoom's before it is warned about
+  clockSkewWarningMs: number;
+  // latency targets of Recall callbacks, and the share of requests that have to meet them
+  latencySlos: LatencySlo[];
+  latencySloObjective: number;
+  issuanceRules: IssuanceRules;
+  // callback secrets that are never accepted and raise an alert when used
+  canaryTokens: CanaryToken[];
+  zoomUserSyncIntervalMs: number;
+  resolveMeetingHosts: boolean;
+  // checks meetings before OBF and ZAK tokens are minted for them, picking the occurrence of recurring ones
+  resolveMeetingOccurrences: boolean;
+  // refuses RECALL_CALLBACK_SECRET on the Recall callbacks, so each user's have to use their own callback secret
+  requireUserCallbackSecrets: boolean;
+  // takes connected users' Personal Meeting IDs and personal links as their meetings
+  resolvePersonalMeetings: boolean;
+  // adds the host's meeting passcode to JSON ZAK responses
+  zakMeetingPasscodes: boolean;
+  // how /recall/* callbacks write tokens: exact bytes as text/plain by default
+  recallResponseFormat: TokenResponseFormat;
+  // /recall/oauth-callback hands out proxy tokens, redeemed at /recall/token-exchange, when proxyTokens is set
+  proxyTokens: boolean;
+  proxyTokenTtlMs: number;
+  proxyTokenExchangeAccess: boolean;
+  // Zoom event notifications are accepted when zoomWebhookSecretToken is set
+  zoomWebhookSecretToken: string;
+  // bots with these display names are let through connected hosts' waiting rooms; empty disables it
+  autoAdmitBotNames: string[];
+  // language of consent pages when the browser's Accept-Language matches none of LOCALES
+  defaultLocale: Locale;
+  // IANA time zone that times in notifications and the command line are shown in
+  displayTimeZone: string;
+  // consent pages are branded when brandingConfig, a JSON file path, is set; the logo is served from brandingAssetsDir
+  brandingConfig: string;
+  brandingAssetsDir: string;
+  // the hosts of URLs consent may return people to, from ?return_to= on /zoom/oauth; none without them
+  consentReturnHosts: string[];
+  // consent flows left unfinished resume from a cookie signed with consentSessionSecret for consentSessionTtlMs; 0 turns resuming
+  // off, though the cookie still ties each callback to the browser that started it.
+  // Made up at startup when unset, so sessions then only resume on the same instance until it restarts
+  consentSessionTtlMs: number;
+  consentSessionSecret: string;
+  // internal services listed in brokerConfig, a JSON file path, can get connected users' access tokens from /broker
+  brokerConfig: string;
+  // "memory" loses tokens on restart; "file" and "sqlite" keep them in the JSON file or SQLite database at tokenStorePath;
+  // "redis" shares them between instances through the Redis at redisUrl; "vault" keeps them in Vault's KV engine at vaultAddr;
+  // "aws-secrets-manager" keeps them in the secret awsSecretArn, "dynamodb" in the table dynamoDbTable, "gcp-secret-manager" in the secret gcpSecret,
+  // "azure-key-vault" in the secret azureKeyVaultSecretName of the vault at azureKeyVaultUrl,
+  // "kubernetes-secret" in the Secret kubernetesSecretName through the API server at kubernetesApiUrl
+  tokenStore: (typeof TOKEN_STORES)[number];
+  tokenStorePath: string;
+  redisUrl: string;
+  redisKeyPrefix: string;
+  // Vault is logged into with vaultToken, or with the Kubernetes service account token against vaultKubernetesRole
+  vaultAddr: string;
+  vaultToken: string;
+  vaultKubernetesRole: string;
+  vaultKubernetesAuthPath: string;
+  vaultKubernetesTokenPath: string;
+  vaultKvMount: string;
+  vaultPathPrefix: string;
+  vaultNamespace: string;
+  awsSecretArn: string;
+  // from the standard AWS_* variables; the endpoints are only set to point at something other than AWS
+  awsCredentialSource: AwsCredentialSource | null;
+  awsSecretsManagerEndpoint: string;
+  awsStsEndpoint: string;
+  // a table name or ARN; dynamoDbRegion is the ARN's or AWS_REGION for a name; users not saved for dynamoDbTtlMs expire, 0 never
+  dynamoDbTable: string;
+  dynamoDbRegion: string;
+  dynamoDbTtlMs: number;
+  dynamoDbEndpoint: string;
+  // a resource name such as projects/my-project/secrets/zoom-oauth; access tokens come from the metadata server at gcpMetadataHost
+  gcpSecret: string;
+  gcpMetadataHost: string;
+  gcpSecretManagerEndpoint: string;
+  azureKeyVaultUrl: string;
+  azureKeyVaultSecretName: string;
+  // from the standard AZURE_* and IDENTITY_* variables, the instance metadata service without any
+  azureCredentialSource: AzureCredentialSource;
+  // the namespace defaults to the pod's; the service account's token and the cluster's CA are read from kubernetesServiceAccountDir
+  kubernetesApiUrl: string;
+  kubernetesNamespace: string;
+  kubernetesSecretName: string;
+  kubernetesServiceAccountDir: string;
+  // when set, tokens are sealed before they reach the store with keys from this provider: "local" uses tokenEncryptionKey,
+  // "aws-kms" and "gcp-kms" wrap data keys with awsKmsKeyId or gcpKmsKey, "age" and "pgp" with ageRecipient or pgpRecipient
+  tokenEncryptionProvider: (typeof TOKEN_ENCRYPTION_PROVIDERS)[number] | null;
+  // the local keys still open older tokens, tokenEncryptionKey too once another provider is chosen
+  tokenEncryptionKey: Buffer | null;
+  tokenEncryptionPreviousKeys: Buffer[];
+  // a key ID, ARN or alias; awsKmsRegion is the ARN's or AWS_REGION for a bare ID or alias name
+  awsKmsKeyId: string;
+  awsKmsRegion: string;
+  awsKmsEndpoint: string;
+  // e.g. projects/my-project/locations/global/keyRings/zoom-oauth/cryptoKeys/tokens
+  gcpKmsKey: string;
+  gcpKmsEndpoint: string;
+  ageRecipient: string;
+  ageIdentityFile: string;
+  pgpRecipient: string;
+  // bot launches and the tokens served for them are appended to this file as JSON lines; empty keeps them in memory only
+  botIdentityLog: string;
+  // pending webhook deliveries, and waiting rooms earlier versions left to turn back on, are appended to this file so they survive restarts
+  jobJournal: string;
+  // purged and revoked users are remembered, without tokens, for removedUserRetentionMs, in removedUsersFile when set; 0 remembers none
+  removedUsersFile: string;
+  removedUserRetentionMs: number;
+  // which connected user a bot's callbacks are served as, by bot ID, metadata or meeting host; kept in userMappingsFile when set
+  userMappingsFile: string;
+  // inbound webhooks whose processing failed are kept for replay, in deadLetterFile when set
+  deadLetterFile: string;
+  // expired caches are cleared and what is older than these ages removed every retentionIntervalMs; an age of 0 keeps it
+  retentionIntervalMs: number;
+  auditRetentionMs: number;
+  botIdentityRetentionMs: number;
+  tokenHistoryRetentionMs: number;
+  deadLetterRetentionMs: number;
+  adminApiKey: string;
+  faultInjectionEnabled: boolean;
+  // Teams support is enabled when teamsClientId is set
+  teamsClientId: string;
+  teamsClientSecret: string;
+  teamsTenant: string;
+  teamsScopes: string[];
+  microsoftLoginBaseUrl: string;
+  // Google support is enabled when googleClientId is set
+  googleClientId: string;
+  googleClientSecret: string;
+  googleScopes: string[];
+  googleAuthBaseUrl: string;
+  googleTokenBaseUrl: string;
+  // the Slack slash command is enabled when slackSigningSecret is set
+  slackSigningSecret: string;
+  webhookUrls: string[];
+  webhookSecret: string;
+  // which notifiers each event type goes to; the notifiers below are enabled by their first field
+  notifyRoutes: NotifyRoutes;
+  slackAlertWebhookUrl: string;
+  smtpUrl: string;
+  alertEmailFrom: string;
+  alertEmailTo: string[];
+  // onboarding invitations are kept in onboardingFile when set, and their links mailed from onboardingEmailFrom through smtpUrl
+  onboardingFile: string;
+  onboardingEmailFrom: string;
+  // emailed invitations still pending are reminded every onboardingReminderIntervalMs, up to onboardingMaxReminders times; 0 sends none
+  onboardingReminderIntervalMs: number;
+  onboardingMaxReminders: number;
+  pagerdutyRoutingKey: string;
+  pagerdutyEventsUrl: string;
+  // inbound Recall webhooks are accepted when recallWebhookSecret is set
+  recallWebhookSecret: string;
+  // bots launched here subscribe to these Recall real-time events, which are streamed at /admin/realtime/events and POSTed to realtimeRelayUrl when set
+  realtimeEvents: string[];
+  realtimeRelayUrl: string;
+  // connected hosts' completed cloud recordings are POSTed here with a download token when set
+  recordingForwardUrl: string;
+  // every token served for a bot is announced here, without the token, when set
+  issuanceWebhookUrl: string;
+  // the gRPC token service is enabled when grpcPort is set; the TLS fields are PEM file paths
+  grpcPort: number | null;
+  grpcTlsCert: string;
+  grpcTlsKey: string;
+  grpcTlsCa: string;
+}
+
+export class ConfigError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "ConfigError";
+  }
+}
+
+export function requireEnv(env: NodeJS.ProcessEnv, name: string, hint?: string): string {
+  const value = env[name] ?? "";
+  if (!value) {
+    throw new ConfigError(`missing required environment variable: ${name}${hint ? ` (hint: ${hint})` : ""}`);
+  }
+  return value;
+}
+
+/**
+ * The User-Agent of requests to Zoom, Recall and everything else the server
+ * and CLI call: USER_AGENT for white-label deployments, otherwise the
+ * service name, version and instance ID.
+ */
+export function userAgent(env: NodeJS.ProcessEnv, instanceId: string = env.INSTANCE_ID || hostname()): string {
+  const value = env.USER_AGENT?.trim() || defaultUserAgent(instanceId);
+  // what a header value may hold; anything else would fail every request
+  if (!/^[\x20-\x7e]+$/.test(value)) {
+    throw new ConfigError("USER_AGENT and INSTANCE_ID may only contain printable ASCII characters");
+  }
+  return value;
+}
+
+function list(env: NodeJS.ProcessEnv, name: string): string[] {
+  return (env[name] ?? "").split(",").map((item) => item.trim()).filter(Boolean);
+}
+
+// parses ZOOM_APPS=staging,dev with each app's credentials in ZOOM_STAGING_CLIENT_ID, ZOOM_STAGING_CLIENT_SECRET and so on
+function zoomApps(env: NodeJS.ProcessEnv, baseUrl: string, zoomClientId: string): ZoomAppConfig[] {
+  const apps: ZoomAppConfig[] = [];
+  for (const name of list(env, "ZOOM_APPS")) {
+    if (!/^[a-z0-9-]+$/.test(name) || name === "default") {
+      throw new ConfigError(`ZOOM_APPS names must be lowercase letters, digits or '-', and not "default": ${name}`);
+    }
+    if (apps.some((app) => app.name === name)) {
+      throw new ConfigError(`ZOOM_APPS has ${name} twice`);
+    }
+    const prefix = `ZOOM_${name.toUpperCase().replace(/-/g, "_")}`;
+    const clientId = requireEnv(env, `${prefix}_CLIENT_ID`, `ZOOM_APPS names ${name}`);
+    if (clientId === zoomClientId || apps.some((app) => app.clientId === clientId)) {
+      throw new ConfigError(`${prefix}_CLIENT_ID is the client ID of another app`);
+    }
+    apps.push({
+      name,
+      clientId,
+      clientSecret: requireEnv(env, `${prefix}_CLIENT_SECRET`, `ZOOM_APPS names ${name}`),
+      redirectUri: env[`${prefix}_REDIRECT_URI`] || `${baseUrl}/zoom/oauth-callback?${new URLSearchParams({ app: name })}`,
+    });
+  }
+  return apps;
+}
+
+// parses TENANTS=acme,globex with each tenant's settings in TENANT_ACME_ZOOM_CLIENT_ID and so on
+function tenants(env: NodeJS.ProcessEnv, baseUrl: string, recallCallbackSecret: string): TenantConfig[] {
+  const tenants: TenantConfig[] = [];
+  for (const name of list(env, "TENANTS")) {
+    if (!/^[a-z0-9-]+$/.test(name)) {
+      throw new ConfigError(`TENANTS names must be lowercase letters, digits or '-': ${name}`);
+    }
+    if (tenants.some((tenant) => tenant.name === name)) {
+      throw new ConfigError(`TENANTS has ${name} twice`);
+    }
+    const prefix = `TENANT_${name.toUpperCase().replace(/-/g, "_")}`;
+    const secret = requireEnv(env, `${prefix}_RECALL_CALLBACK_SECRET`, `TENANTS names ${name}`);
+    if (secret === DEFAULT_RECALL_CALLBACK_SECRET) {
+      throw new ConfigError(`${prefix}_RECALL_CALLBACK_SECRET is the default '${DEFAULT_RECALL_CALLBACK_SECRET}'`);
+    }
+    // a secret that works for two tenants would also fetch tokens across them
+    if (secret === recallCallbackSecret || tenants.some((tenant) => tenant.recallCallbackSecret === secret)) {
+      throw new ConfigError(`${prefix}_RECALL_CALLBACK_SECRET is also another tenant's, or RECALL_CALLBACK_SECRET`);
+    }
+    tenants.push({
+      name,
+      zoomClientId: requireEnv(env, `${prefix}_ZOOM_CLIENT_ID`, `TENANTS names ${name}`),
+      zoomClientSecret: requireEnv(env, `${prefix}_ZOOM_CLIENT_SECRET`, `TENANTS names ${name}`),
+      zoomRedirectUri: env[`${prefix}_ZOOM_REDIRECT_URI`] || `${baseUrl}/t/${name}/zoom/oauth-callback`,
+      recallCallbackSecret: secret,
+    });
+  }
+  return tenants;
+}
+
+/** The Recall real-time events REALTIME_EVENTS subscribes bots to; also read by launch-bot. */
+export function realtimeEvents(env: NodeJS.ProcessEnv): string[] {
+  const events = list(env, "REALTIME_EVENTS");
+  for (const event of events) {
+    if (!(REALTIME_EVENT_TYPES as readonly string[]).includes(event)) {
+      throw new ConfigError(`REALTIME_EVENTS contains unknown event ${event}, use any of ${REALTIME_EVENT_TYPES.join(", ")}`);
+    }
+  }
+  return events;
+}
+
+// parses "label=token,label=token"; a canary has to look like a secret and can't be the real one
+function canaryTokens(env: NodeJS.ProcessEnv, callbackSecret: string): CanaryToken[] {
+  const canaries: CanaryToken[] = [];
+  for (const entry of list(env, "CANARY_TOKENS")) {
+    const separator = entry.indexOf("=");
+    const label = entry.slice(0, separator).trim();
+    const token = entry.slice(separator + 1).trim();
+    if (separator <= 0 || !/^[\w.-]+$/.test(label)) {
+      throw new ConfigError(`CANARY_TOKENS entries must be label=token with a label of letters, digits, '.', '_' or '-': ${entry.slice(0, 40)}`);
+    }
+    if (token.length < 16) {
+      throw new ConfigError(`CANARY_TOKENS token ${label} is shorter than 16 characters, generate one with generate-canary`);
+    }
+    if (token === callbackSecret) {
+      throw new ConfigError(`CANARY_TOKENS token ${label} is RECALL_CALLBACK_SECRET`);
+    }
+    if (canaries.some((canary) => canary.label === label || canary.token === token)) {
+      throw new ConfigError(`CANARY_TOKENS has ${label} or its token twice`);
+    }
+    canaries.push({ label, token });
+  }
+  return canaries;
+}
+
+// parses "app.example.com,*.example.com", the hosts /zoom/oauth?return_to= may send people back to
+function consentReturnHosts(env: NodeJS.ProcessEnv): string[] {
+  return list(env, "CONSENT_RETURN_HOSTS").map((raw) => {
+    const host = raw.toLowerCase();
+    if (!/^(\*\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$/.test(host)) {
+      throw new ConfigError(`CONSENT_RETURN_HOSTS entries must be hostnames, optionally starting with *. for subdomains: ${raw}`);
+    }
+    return host;
+  });
+}
+
+function meetingIds(env: NodeJS.ProcessEnv, name: string): string[] {
+  return list(env, name).map((raw) => {
+    const meetingId = parseMeetingId(raw);
+    if (!meetingId) {
+      throw new ConfigError(`${name} contains an invalid meeting ID: ${raw}`);
+    }
+    return meetingId;
+  });
+}
+
+// parses "type=name,name;*=name" into routes, checking every type and name is known
+function notifyRoutes(env: NodeJS.ProcessEnv, configured: Set<NotifierName>): NotifyRoutes {
+  if (!env.NOTIFY_ROUTES) return DEFAULT_NOTIFY_ROUTES;
+  const routes: NotifyRoutes = {};
+  for (const entry of env.NOTIFY_ROUTES.split(";").map((item) => item.trim()).filter(Boolean)) {
+    const [type, names = ""] = entry.split("=", 2).map((part) => part.trim());
+    if (type !== "*" && !(WEBHOOK_EVENT_TYPES as readonly string[]).includes(type)) {
+      throw new ConfigError(`NOTIFY_ROUTES routes unknown event type ${type}, use one of ${WEBHOOK_EVENT_TYPES.join(", ")} or *`);
+    }
+    routes[type] = names.split(",").map((name) => name.trim()).filter(Boolean);
+    for (const name of routes[type]) {
+      if (!(NOTIFIER_NAMES as readonly string[]).includes(name)) {
+        throw new ConfigError(`NOTIFY_ROUTES sends ${type} to unknown notifier ${name}, use one of ${NOTIFIER_NAMES.join(", ")}`);
+      }
+      if (!configured.has(name as NotifierName)) {
+        throw new ConfigError(`NOTIFY_ROUTES sends ${type} to ${name}, which isn't configured`);
+      }
+    }
+  }
+  return routes;
+}
+
+function count(env: NodeJS.ProcessEnv, name: string, fallback: number): number {
+  const value = Number(env[name] ?? fallback);
+  if (!Number.isInteger(value) || value < 0) {
+    throw new ConfigError(`${name} must be a non-negative integer`);
+  }
+  return value;
+}
+
+// parses LATENCY_SLOS=obf-callback=250,zak-callback=250 into a target in ms per Recall callback
+function latencySlos(env: NodeJS.ProcessEnv): LatencySlo[] {
+  const slos: LatencySlo[] = [];
+  for (const entry of list(env, "LATENCY_SLOS")) {
+    const [endpoint, target] = entry.split("=").map((part) => part.trim());
+    if (!(LATENCY_SLO_ENDPOINTS as readonly string[]).includes(endpoint)) {
+      throw new ConfigError(`LATENCY_SLOS names unknown endpoint ${endpoint}, use one of ${LATENCY_SLO_ENDPOINTS.join(", ")}`);
+    }
+    if (slos.some((slo) => slo.endpoint === endpoint)) {
+      throw new ConfigError(`LATENCY_SLOS has ${endpoint} twice`);
+    }
+    const targetMs = Number(target);
+    if (!(targetMs > 0)) {
+      throw new ConfigError(`LATENCY_SLOS target for ${endpoint} must be a positive number of milliseconds`);
+    }
+    slos.push({ endpoint: endpoint as LatencySloEndpoint, targetMs });
+  }
+  return slos;
+}
+
+function milliseconds(env: NodeJS.ProcessEnv, name: string, fallback: number, allowZero: boolean): number {
+  const value = Number(env[name] ?? fallback);
+  if (!Number.isFinite(value) || value < 0 || (!allowZero && value === 0)) {
+    throw new ConfigError(`${name} must be a ${allowZero ? "non-negative" : "positive"} number of milliseconds`);
+  }
+  return value;
+}
+
+// the variables ZOOM_SSM_PATH provides, each from the parameter of the same name under it
+export const SSM_PARAMETER_VARIABLES = ["ZOOM_CLIENT_ID", "ZOOM_CLIENT_SECRET"] as const;
+
+/**
+ * env with ZOOM_CLIENT_ID and ZOOM_CLIENT_SECRET read from AWS Systems
+ * Manager Parameter Store when ZOOM_SSM_PATH is set, e.g. to
+ * /zoom-oauth/production holding /zoom-oauth/production/ZOOM_CLIENT_SECRET
+ * as a SecureString; env itself otherwise. Call it before loadConfig;
+ * parameters are read once, so a changed one takes a restart.
+ */
+export async function withSsmParameters(env: NodeJS.ProcessEnv = process.env, httpClient: HttpClient = withUserAgent(userAgent(env))): Promise<NodeJS.ProcessEnv> {
+  const path = env.ZOOM_SSM_PATH?.replace(/\/+$/, "");
+  if (!path) return env;
+  if (!isSsmParameterPath(path)) {
+    throw new ConfigError("ZOOM_SSM_PATH must be a parameter path such as /zoom-oauth/production");
+  }
+  const alsoSet = SSM_PARAMETER_VARIABLES.filter((name) => env[name]);
+  if (alsoSet.length > 0) {
+    throw new ConfigError(`set either ZOOM_SSM_PATH or ${alsoSet.join(" and ")}, not both`);
+  }
+  const region = env.AWS_REGION || env.AWS_DEFAULT_REGION;
+  if (!region) {
+    throw new ConfigError("ZOOM_SSM_PATH requires AWS_REGION, the region of the parameters");
+  }
+  const source = awsCredentialSource(env);
+  if (!source) {
+    throw new ConfigError("ZOOM_SSM_PATH requires AWS credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, an EKS service account role or ECS task role");
+  }
+  const client = new SsmParameterClient({
+    region,
+    credentials: new AwsCredentialProvider({ source, httpClient, region, stsEndpoint: env.AWS_ENDPOINT_URL_STS || env.AWS_ENDPOINT_URL || undefined }),
+    httpClient,
+    endpoint: env.AWS_ENDPOINT_URL_SSM || env.AWS_ENDPOINT_URL || undefined,
+  });
+  let values: Record<string, string>;
+  try {
+    values = await client.getParameters(SSM_PARAMETER_VARIABLES.map((name) => `${path}/${name}`));
+  } catch (error) {
+    throw new ConfigError(`could not read ZOOM_SSM_PATH ${path}: ${error instanceof Error ? error.message : String(error)}`);
+  }
+  return { ...env, ...Object.fromEntries(SSM_PARAMETER_VARIABLES.map((name) => [name, values[`${path}/${name}`]])) };
+}
+
+export function loadConfig(env: NodeJS.ProcessEnv = process.env): Config {
+  const zoomClientId = requireEnv(env, "ZOOM_CLIENT_ID");
+  const zoomClientSecret = requireEnv(env, "ZOOM_CLIENT_SECRET");
+  const baseUrl = requireEnv(env, "BASE_URL", "set to the public URL of this server, e.g. https://your-ngrok-url.ngrok.io");
+  const instanceId = env.INSTANCE_ID || hostname();
+
+  const defaultSecretPolicy = (env.DEFAULT_SECRET_POLICY ?? (env.NODE_ENV === "production" ? "refuse" : "warn")) as DefaultSecretPolicy;
+  if (!DEFAULT_SECRET_POLICIES.includes(defaultSecretPolicy)) {
+    throw new ConfigError(`DEFAULT_SECRET_POLICY must be one of ${DEFAULT_SECRET_POLICIES.join(", ")}`);
+  }
+  let recallCallbackSecret = env.RECALL_CALLBACK_SECRET ?? "";
+  let recallCallbackSecretSource: Config["recallCallbackSecretSource"] = "env";
+  if (!recallCallbackSecret || recallCallbackSecret === DEFAULT_RECALL_CALLBACK_SECRET) {
+    const problem = recallCallbackSecret ? `RECALL_CALLBACK_SECRET is the default '${DEFAULT_RECALL_CALLBACK_SECRET}'` : "RECALL_CALLBACK_SECRET is not set";
+    if (defaultSecretPolicy === "generate") {
+      recallCallbackSecret = randomBytes(32).toString("base64url");
+      recallCallbackSecretSource = "generated";
+      console.warn(`${problem}. generated '${recallCallbackSecret}' for this run, it changes on every restart`);
+    } else {
+      recallCallbackSecret = DEFAULT_RECALL_CALLBACK_SECRET;
+      recallCallbackSecretSource = "default";
+      console.warn(
+        defaultSecretPolicy === "refuse"
+          ? `${problem}. /recall requests are refused until it is set`
+          : `${problem}. setting to the default value of '${DEFAULT_RECALL_CALLBACK_SECRET}'`,
+      );
+    }
+  }
+
+  const staleTokenPolicy = (env.STALE_TOKEN_POLICY ?? "serve-stale") as StaleTokenPolicy;
+  if (!["reject", "serve-stale", "grace"].includes(staleTokenPolicy)) {
+    throw new ConfigError("STALE_TOKEN_POLICY must be one of reject, serve-stale, grace");
+  }
+
+  const tokenStore = (env.TOKEN_STORE ?? "memory") as Config["tokenStore"];
+  if (!TOKEN_STORES.includes(tokenStore)) {
+    throw new ConfigError(`TOKEN_STORE must be one of ${TOKEN_STORES.join(", ")}`);
+  }
+  const tokenStorePath = env.TOKEN_STORE_PATH ?? "";
+  if ((tokenStore === "file" || tokenStore === "sqlite") && !tokenStorePath) {
+    throw new ConfigError(`TOKEN_STORE=${tokenStore} requires TOKEN_STORE_PATH`);
+  }
+  const redisUrl = env.REDIS_URL ?? "";
+  if (tokenStore === "redis" && !/^rediss?:\/\//.test(redisUrl)) {
+    throw new ConfigError("TOKEN_STORE=redis requires REDIS_URL, e.g. redis://localhost:6379");
+  }
+  const vaultAddr = env.VAULT_ADDR ?? "";
+  const vaultToken = env.VAULT_TOKEN ?? "";
+  const vaultKubernetesRole = env.VAULT_K8S_ROLE ?? "";
+  if (tokenStore === "vault") {
+    if (!/^https?:\/\//.test(vaultAddr)) {
+      throw new ConfigError("TOKEN_STORE=vault requires VAULT_ADDR, e.g. https://vault.internal:8200");
+    }
+    if (!vaultToken && !vaultKubernetesRole) {
+      throw new ConfigError("TOKEN_STORE=vault requires VAULT_TOKEN, or VAULT_K8S_ROLE to log in with the Kubernetes service account");
+    }
+    if (vaultToken && vaultKubernetesRole) {
+      throw new ConfigError("set either VAULT_TOKEN or VAULT_K8S_ROLE, not both");
+    }
+  }
+  const awsSecretArn = env.AWS_SECRET_ARN ?? "";
+  const awsCredentials = awsCredentialSource(env);
+  if (tokenStore === "aws-secrets-manager") {
+    if (!secretArnRegion(awsSecretArn)) {
+      throw new ConfigError("TOKEN_STORE=aws-secrets-manager requires AWS_SECRET_ARN, e.g. arn:aws:secretsmanager:eu-west-1:123456789012:secret:zoom-oauth-AbCdEf");
+    }
+    if (!awsCredentials) {
+      throw new ConfigError(
+        "TOKEN_STORE=aws-secrets-manager requires AWS credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, an EKS service account role or ECS task role",
+      );
+    }
+  }
+  const dynamoDbTable = env.DYNAMODB_TABLE ?? "";
+  const dynamoDbRegion = tableArnRegion(dynamoDbTable) ?? env.AWS_REGION ?? env.AWS_DEFAULT_REGION ?? "";
+  if (tokenStore === "dynamodb") {
+    if (!isDynamoDbTable(dynamoDbTable)) {
+      throw new ConfigError("TOKEN_STORE=dynamodb requires DYNAMODB_TABLE, a table name such as zoom-oauth-tokens or its ARN");
+    }
+    if (!dynamoDbRegion) {
+      throw new ConfigError("DYNAMODB_TABLE is not an ARN, set AWS_REGION to the region of the table");
+    }
+    if (!awsCredentials) {
+      throw new ConfigError("TOKEN_STORE=dynamodb requires AWS credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, an EKS service account role or ECS task role");
+    }
+  }
+  const gcpSecret = env.GCP_SECRET ?? "";
+  if (tokenStore === "gcp-secret-manager" && !isGcpSecretName(gcpSecret)) {
+    throw new ConfigError("TOKEN_STORE=gcp-secret-manager requires GCP_SECRET, e.g. projects/my-project/secrets/zoom-oauth");
+  }
+  const azureKeyVaultUrl = env.AZURE_KEY_VAULT_URL ?? "";
+  const azureKeyVaultSecretName = env.AZURE_KEY_VAULT_SECRET_NAME || DEFAULT_AZURE_KEY_VAULT_SECRET_NAME;
+  if (tokenStore === "azure-key-vault") {
+    if (!/^https?:\/\//.test(azureKeyVaultUrl)) {
+      throw new ConfigError("TOKEN_STORE=azure-key-vault requires AZURE_KEY_VAULT_URL, e.g. https://my-vault.vault.azure.net");
+    }
+    if (!isKeyVaultSecretName(azureKeyVaultSecretName)) {
+      throw new ConfigError("AZURE_KEY_VAULT_SECRET_NAME may only hold up to 127 letters, digits and dashes");
+    }
+  }
+  const kubernetesApi = env.KUBERNETES_API_URL || kubernetesApiUrl(env) || "";
+  const kubernetesSecretName = env.KUBERNETES_SECRET_NAME ?? "";
+  if (tokenStore === "kubernetes-secret") {
+    if (!isKubernetesSecretName(kubernetesSecretName)) {
+      throw new ConfigError("TOKEN_STORE=kubernetes-secret requires KUBERNETES_SECRET_NAME, lowercase letters, digits, dashes and dots, e.g. zoom-oauth-tokens");
+    }
+    if (!/^https?:\/\//.test(kubernetesApi)) {
+      throw new ConfigError("TOKEN_STORE=kubernetes-secret requires KUBERNETES_API_URL outside a pod, e.g. http://127.0.0.1:8001 for kubectl proxy");
+    }
+  }
+  const tokenEncryptionKey = env.TOKEN_ENCRYPTION_KEY ? parseEncryptionKey(env.TOKEN_ENCRYPTION_KEY) : null;
+  if (env.TOKEN_ENCRYPTION_KEY && !tokenEncryptionKey) {
+    throw new ConfigError("TOKEN_ENCRYPTION_KEY must be 32 bytes in base64, generate one with `generate-secret TOKEN_ENCRYPTION_KEY`");
+  }
+  const tokenEncryptionPreviousKeys = list(env, "TOKEN_ENCRYPTION_PREVIOUS_KEYS").map((value, index) => {
+    const key = parseEncryptionKey(value);
+    if (!key) throw new ConfigError(`TOKEN_ENCRYPTION_PREVIOUS_KEYS entry ${index + 1} must be 32 bytes in base64`);
+    return key;
+  });
+  const tokenEncryptionProvider = (env.TOKEN_ENCRYPTION_PROVIDER || (tokenEncryptionKey ? "local" : null)) as Config["tokenEncryptionProvider"];
+  if (tokenEncryptionProvider !== null && !TOKEN_ENCRYPTION_PROVIDERS.includes(tokenEncryptionProvider)) {
+    throw new ConfigError(`TOKEN_ENCRYPTION_PROVIDER must be one of ${TOKEN_ENCRYPTION_PROVIDERS.join(", ")}`);
+  }
+  if (tokenEncryptionProvider === "local" && !tokenEncryptionKey) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=local requires TOKEN_ENCRYPTION_KEY, generate one with `generate-secret TOKEN_ENCRYPTION_KEY`");
+  }
+  if (tokenEncryptionPreviousKeys.length > 0 && !tokenEncryptionProvider) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PREVIOUS_KEYS requires TOKEN_ENCRYPTION_KEY or TOKEN_ENCRYPTION_PROVIDER, what tokens are sealed with from now on");
+  }
+  const awsKmsKeyId = env.AWS_KMS_KEY_ID ?? "";
+  const awsKmsRegion = kmsKeyArnRegion(awsKmsKeyId) ?? env.AWS_REGION ?? env.AWS_DEFAULT_REGION ?? "";
+  if (tokenEncryptionProvider === "aws-kms") {
+    if (!awsKmsKeyId) {
+      throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=aws-kms requires AWS_KMS_KEY_ID, a key ID, ARN or alias such as alias/zoom-oauth");
+    }
+    if (!awsKmsRegion) {
+      throw new ConfigError("AWS_KMS_KEY_ID is not an ARN, set AWS_REGION to the region of the key");
+    }
+    if (!awsCredentials) {
+      throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=aws-kms requires AWS credentials: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, an EKS service account role or ECS task role");
+    }
+  }
+  const gcpKmsKey = env.GCP_KMS_KEY ?? "";
+  if (tokenEncryptionProvider === "gcp-kms" && !isGcpKmsKeyName(gcpKmsKey)) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=gcp-kms requires GCP_KMS_KEY, e.g. projects/my-project/locations/global/keyRings/zoom-oauth/cryptoKeys/tokens");
+  }
+  const ageRecipient = env.AGE_RECIPIENT ?? "";
+  if (tokenEncryptionProvider === "age" && !/^age1[0-9a-z]+$/.test(ageRecipient)) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=age requires AGE_RECIPIENT, the age1... public key tokens are sealed for");
+  }
+  const ageIdentityFile = env.AGE_IDENTITY_FILE ?? "";
+  if (tokenEncryptionProvider === "age" && !ageIdentityFile) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=age requires AGE_IDENTITY_FILE, the file with the identity that opens the tokens");
+  }
+  const pgpRecipient = env.PGP_RECIPIENT ?? "";
+  if (tokenEncryptionProvider === "pgp" && !pgpRecipient) {
+    throw new ConfigError("TOKEN_ENCRYPTION_PROVIDER=pgp requires PGP_RECIPIENT, the ID, fingerprint or email of a key in the gpg keyring");
+  }
+
+  const recallResponseFormat = (env.RECALL_RESPONSE_FORMAT ?? "text") as TokenResponseFormat;
+  if (!TOKEN_RESPONSE_FORMATS.includes(recallResponseFormat)) {
+    throw new ConfigError(`RECALL_RESPONSE_FORMAT must be one of ${TOKEN_RESPONSE_FORMATS.join(", ")}`);
+  }
+
+  const defaultLocale = env.DEFAULT_LOCALE ?? DEFAULT_LOCALE;
+  if (!isLocale(defaultLocale)) {
+    throw new ConfigError(`DEFAULT_LOCALE must be one of ${LOCALES.join(", ")}`);
+  }
+  const displayTimeZone = env.DISPLAY_TIME_ZONE ?? DEFAULT_TIME_ZONE;
+  if (!isTimeZone(displayTimeZone)) {
+    throw new ConfigError(`DISPLAY_TIME_ZONE must be an IANA time zone such as Europe/Berlin, got ${displayTimeZone}`);
+  }
+
+  const adminApiKey = env.ADMIN_API_KEY ?? "";
+  const faultInjectionEnabled = env.FAULT_INJECTION_ENABLED === "true";
+  if (faultInjectionEnabled) {
+    if (!adminApiKey) {
+      throw new ConfigError("FAULT_INJECTION_ENABLED requires ADMIN_API_KEY to be set");
+    }
+    console.warn("FAULT_INJECTION_ENABLED is set. zoom failures can be simulated via /debug/faults, do not use in production");
+  }
+
+  const teamsClientId = env.TEAMS_CLIENT_ID ?? "";
+  const teamsClientSecret = teamsClientId ? requireEnv(env, "TEAMS_CLIENT_SECRET", "required when TEAMS_CLIENT_ID is set") : "";
+  const googleClientId = env.GOOGLE_CLIENT_ID ?? "";
+  const googleClientSecret = googleClientId ? requireEnv(env, "GOOGLE_CLIENT_SECRET", "required when GOOGLE_CLIENT_ID is set") : "";
+  // the Teams and Google callbacks only know the shared secret, their users can't be given secrets of their own
+  if (env.REQUIRE_USER_CALLBACK_SECRETS === "true" && (teamsClientId || googleClientId)) {
+    throw new ConfigError("REQUIRE_USER_CALLBACK_SECRETS can't be used with TEAMS_CLIENT_ID or GOOGLE_CLIENT_ID, their callbacks only take RECALL_CALLBACK_SECRET");
+  }
+  // proxy tokens live in the memory of the instance that issued them, so behind a load balancer most exchanges would miss
+  if (env.PROXY_TOKENS === "true" && !SINGLE_INSTANCE_TOKEN_STORES.includes(tokenStore)) {
+    throw new ConfigError(`PROXY_TOKENS can't be used with TOKEN_STORE=${tokenStore}, proxy tokens are only known to the instance that issued them and don't work across several; use memory, file or sqlite`);
+  }
+  const slackSigningSecret = env.SLACK_SIGNING_SECRET ?? "";
+  if (slackSigningSecret && !env.RECALL_API_KEY) {
+    throw new ConfigError("SLACK_SIGNING_SECRET requires RECALL_API_KEY to be set so the slash command can launch bots");
+  }
+  const autoAdmitBotNames = list(env, "AUTO_ADMIT_BOT_NAMES");
+  if (autoAdmitBotNames.length > 0 && !env.ZOOM_WEBHOOK_SECRET_TOKEN) {
+    throw new ConfigError("AUTO_ADMIT_BOT_NAMES requires ZOOM_WEBHOOK_SECRET_TOKEN, waiting rooms are watched through zoom webhooks");
+  }
+  const webhookUrls = list(env, "WEBHOOK_URLS");
+  for (const url of webhookUrls) {
+    if (!URL.canParse(url)) {
+      throw new ConfigError(`WEBHOOK_URLS contains an invalid URL: ${url}`);
+    }
+  }
+  const realtimeRelayUrl = env.REALTIME_RELAY_URL ?? "";
+  if (realtimeRelayUrl && !URL.canParse(realtimeRelayUrl)) {
+    throw new ConfigError("REALTIME_RELAY_URL must be a URL");
+  }
+  const relayedEvents = realtimeEvents(env);
+  if (realtimeRelayUrl && relayedEvents.length === 0) {
+    throw new ConfigError("REALTIME_RELAY_URL requires REALTIME_EVENTS, which names the events to relay");
+  }
+  const recordingForwardUrl = env.RECORDING_FORWARD_URL ?? "";
+  if (recordingForwardUrl && !URL.canParse(recordingForwardUrl)) {
+    throw new ConfigError("RECORDING_FORWARD_URL must be a URL");
+  }
+  if (recordingForwardUrl && !env.ZOOM_WEBHOOK_SECRET_TOKEN) {
+    throw new ConfigError("RECORDING_FORWARD_URL requires ZOOM_WEBHOOK_SECRET_TOKEN, recordings are reported through zoom webhooks");
+  }
+  const latencySloObjective = Number(env.LATENCY_SLO_OBJECTIVE ?? DEFAULT_LATENCY_SLO_OBJECTIVE);
+  if (!(latencySloObjective > 0 && latencySloObjective < 1)) {
+    throw new ConfigError("LATENCY_SLO_OBJECTIVE must be between 0 and 1, e.g. 0.99");
+  }
+  const issuanceWebhookUrl = env.ISSUANCE_WEBHOOK_URL ?? "";
+  if (issuanceWebhookUrl && !URL.canParse(issuanceWebhookUrl)) {
+    throw new ConfigError("ISSUANCE_WEBHOOK_URL must be a URL");
+  }
+  const webhookSecret =
+    webhookUrls.length > 0 || realtimeRelayUrl || recordingForwardUrl || issuanceWebhookUrl
+      ? requireEnv(env, "WEBHOOK_SECRET", "required when WEBHOOK_URLS, REALTIME_RELAY_URL, RECORDING_FORWARD_URL or ISSUANCE_WEBHOOK_URL is set")
+      : "";
+  const slackAlertWebhookUrl = env.SLACK_ALERT_WEBHOOK_URL ?? "";
+  if (slackAlertWebhookUrl && !URL.canParse(slackAlertWebhookUrl)) {
+    throw new ConfigError("SLACK_ALERT_WEBHOOK_URL must be a URL");
+  }
+  const smtpUrl = env.SMTP_URL ?? "";
+  if (smtpUrl && !/^smtps?:\/\//.test(smtpUrl)) {
+    throw new ConfigError("SMTP_URL must start with smtp:// or smtps://");
+  }
+  const alertEmailFrom = smtpUrl ? requireEnv(env, "ALERT_EMAIL_FROM", "required when SMTP_URL is set") : "";
+  const alertEmailTo = list(env, "ALERT_EMAIL_TO");
+  if (smtpUrl && alertEmailTo.length === 0) {
+    throw new ConfigError("missing required environment variable: ALERT_EMAIL_TO (hint: required when SMTP_URL is set)");
+  }
+  const onboardingReminderIntervalMs = milliseconds(env, "ONBOARDING_REMINDER_INTERVAL_MS", 0, true);
+  if (onboardingReminderIntervalMs > 0 && !smtpUrl) {
+    throw new ConfigError("ONBOARDING_REMINDER_INTERVAL_MS requires SMTP_URL to email the reminders through");
+  }
+  const pagerdutyRoutingKey = env.PAGERDUTY_ROUTING_KEY ?? "";
+  const configuredNotifiers = new Set<NotifierName>(["webhook"]);
+  if (slackAlertWebhookUrl) configuredNotifiers.add("slack");
+  if (smtpUrl) configuredNotifiers.add("email");
+  if (pagerdutyRoutingKey) configuredNotifiers.add("pagerduty");
+  const routes = notifyRoutes(env, configuredNotifiers);
+  for (const name of configuredNotifiers) {
+    if (name !== "webhook" && !Object.values(routes).some((names) => names.includes(name))) {
+      throw new ConfigError(`${name} notifications are configured but NOTIFY_ROUTES sends nothing to ${name}`);
+    }
+  }
+
+  const zoomAccountAdminUserId = env.ZOOM_ACCOUNT_ADMIN_USER_ID ?? "";
+  if (zoomAccountAdminUserId && env.ZOOM_ACCOUNT_ID) {
+    throw new ConfigError("ZOOM_ACCOUNT_ADMIN_USER_ID can't be used with ZOOM_ACCOUNT_ID, a server-to-server app already mints for every user of the account");
+  }
+
+  let grpcPort: number | null = null;
+  if (env.GRPC_PORT) {
+    grpcPort = Number(env.GRPC_PORT);
+    if (!Number.isInteger(grpcPort) || grpcPort <= 0 || grpcPort > 65535 || grpcPort === DEFAULT_PORT) {
+      throw new ConfigError(`GRPC_PORT must be a port number other than ${DEFAULT_PORT}`);
+    }
+  }
+  const grpcTls = (name: string) => (grpcPort ? requireEnv(env, name, "the gRPC service only accepts mutual TLS") : "");
+
+  return {
+    zoomClientId,
+    zoomClientSecret,
+    zoomAccountId: env.ZOOM_ACCOUNT_ID ?? "",
+    zoomAccountAdminUserId,
+    zoomRedirectUri: env.ZOOM_REDIRECT_URI || `${baseUrl}/zoom/oauth-callback`,
+    zoomApps: zoomApps(env, baseUrl, zoomClientId),
+    tenants: tenants(env, baseUrl, recallCallbackSecret),
+    baseUrl,
+    recallCallbackSecret,
+    recallCallbackSecretSource,
+    defaultSecretPolicy,
+    recallApiKey: env.RECALL_API_KEY ?? "",
+    zoomOauthBaseUrl: env.ZOOM_OAUTH_BASE_URL ?? DEFAULT_ZOOM_OAUTH_BASE_URL,
+    zoomApiBaseUrl: env.ZOOM_API_BASE_URL ?? DEFAULT_ZOOM_API_BASE_URL,
+    recallApiBaseUrl: env.RECALL_API_BASE_URL ?? DEFAULT_RECALL_API_BASE_URL,
+    httpTimeoutMs: milliseconds(env, "HTTP_TIMEOUT_MS", 10 * 1000, false),
+    instanceId,
+    userAgent: userAgent(env, instanceId),
+    zakCacheTtlMs: milliseconds(env, "ZAK_CACHE_TTL_MS", DEFAULT_ZAK_CACHE_TTL_MS, true),
+    obfCacheTtlMs: milliseconds(env, "OBF_CACHE_TTL_MS", DEFAULT_OBF_CACHE_TTL_MS, true),
+    tokenRefreshIntervalMs: milliseconds(env, "TOKEN_REFRESH_INTERVAL_MS", DEFAULT_TOKEN_REFRESH_INTERVAL_MS, false),
+    tokenRefreshMarginMs: milliseconds(env, "TOKEN_REFRESH_MARGIN_MS", DEFAULT_TOKEN_REFRESH_MARGIN_MS, true),
+    staleTokenPolicy,
+    staleTokenGraceMs: milliseconds(env, "STALE_TOKEN_GRACE_MS", DEFAULT_STALE_TOKEN_GRACE_MS, true),
+    refreshTokenLifetimeMs: milliseconds(env, "REFRESH_TOKEN_LIFETIME_MS", DEFAULT_REFRESH_TOKEN_LIFETIME_MS, true),
+    consentLifetimeMs: milliseconds(env, "CONSENT_LIFETIME_MS", 0, true),
+    reauthorizationWarningMs: milliseconds(env, "REAUTHORIZATION_WARNING_MS", DEFAULT_REAUTHORIZATION_WARNING_MS, true),
+    clockSkewWarningMs: milliseconds(env, "CLOCK_SKEW_WARNING_MS", DEFAULT_CLOCK_SKEW_WARNING_MS, false),
+    latencySlos: latencySlos(env),
+    latencySloObjective,
+    issuanceRules: {
+      allowedMeetings: meetingIds(env, "ISSUANCE_ALLOWED_MEETINGS"),
+      deniedMeetings: meetingIds(env, "ISSUANCE_DENIED_MEETINGS"),
+      allowedUsers: list(env, "ISSUANCE_ALLOWED_USERS"),
+      deniedUsers: list(env, "ISSUANCE_DENIED_USERS"),
+      meetingQuotaPerHour: count(env, "ISSUANCE_QUOTA_PER_MEETING", 0),
+      userQuotaPerHour: count(env, "ISSUANCE_QUOTA_PER_USER", 0),
+      anomalyThreshold: count(env, "ISSUANCE_ANOMALY_THRESHOLD", DEFAULT_ISSUANCE_ANOMALY_THRESHOLD),
+    },
+    canaryTokens: canaryTokens(env, recallCallbackSecret),
+    zoomUserSyncIntervalMs: milliseconds(env, "ZOOM_USER_SYNC_INTERVAL_MS", 60 * 60 * 1000, true),
+    zoomWebhookSecretToken: env.ZOOM_WEBHOOK_SECRET_TOKEN ?? "",
+    autoAdmitBotNames,
+    defaultLocale,
+    displayTimeZone,
+    brandingConfig: env.BRANDING_CONFIG ?? "",
+    brandingAssetsDir: env.BRANDING_ASSETS_DIR ?? "",
+    consentReturnHosts: consentReturnHosts(env),
+    consentSessionTtlMs: milliseconds(env, "CONSENT_SESSION_TTL_MS", DEFAULT_CONSENT_SESSION_TTL_MS, true),
+    consentSessionSecret: env.CONSENT_SESSION_SECRET || randomBytes(32).toString("base64url"),
+    brokerConfig: env.BROKER_CONFIG ?? "",
+    tokenStore,
+    tokenStorePath,
+    redisUrl,
+    redisKeyPrefix: env.REDIS_KEY_PREFIX ?? DEFAULT_REDIS_KEY_PREFIX,
+    vaultAddr,
+    vaultToken,
+    vaultKubernetesRole,
+    vaultKubernetesAuthPath: env.VAULT_K8S_AUTH_PATH ?? DEFAULT_VAULT_KUBERNETES_AUTH_PATH,
+    vaultKubernetesTokenPath: env.VAULT_K8S_TOKEN_PATH ?? DEFAULT_VAULT_KUBERNETES_TOKEN_PATH,
+    vaultKvMount: env.VAULT_KV_MOUNT ?? DEFAULT_VAULT_KV_MOUNT,
+    vaultPathPrefix: env.VAULT_PATH_PREFIX ?? DEFAULT_VAULT_PATH_PREFIX,
+    vaultNamespace: env.VAULT_NAMESPACE ?? "",
+    awsSecretArn,
+    awsCredentialSource: awsCredentials,
+    awsSecretsManagerEndpoint: env.AWS_ENDPOINT_URL_SECRETS_MANAGER ?? env.AWS_ENDPOINT_URL ?? "",
+    awsStsEndpoint: env.AWS_ENDPOINT_URL_STS ?? env.AWS_ENDPOINT_URL ?? "",
+    dynamoDbTable,
+    dynamoDbRegion,
+    dynamoDbTtlMs: milliseconds(env, "DYNAMODB_TTL_MS", DEFAULT_DYNAMODB_TTL_MS, true),
+    dynamoDbEndpoint: env.AWS_ENDPOINT_URL_DYNAMODB ?? env.AWS_ENDPOINT_URL ?? "",
+    gcpSecret,
+    gcpMetadataHost: env.GCE_METADATA_HOST ?? "",
+    gcpSecretManagerEndpoint: env.GCP_SECRET_MANAGER_ENDPOINT ?? "",
+    azureKeyVaultUrl,
+    azureKeyVaultSecretName,
+    azureCredentialSource: azureCredentialSource(env),
+    kubernetesApiUrl: kubernetesApi,
+    kubernetesNamespace: env.KUBERNETES_NAMESPACE ?? "",
+    kubernetesSecretName,
+    kubernetesServiceAccountDir: env.KUBERNETES_SERVICE_ACCOUNT_DIR ?? "",
+    tokenEncryptionProvider,
+    tokenEncryptionKey,
+    tokenEncryptionPreviousKeys,
+    awsKmsKeyId,
+    awsKmsRegion,
+    awsKmsEndpoint: env.AWS_ENDPOINT_URL_KMS ?? env.AWS_ENDPOINT_URL ?? "",
+    gcpKmsKey,
+    gcpKmsEndpoint: env.GCP_KMS_ENDPOINT ?? "",
+    ageRecipient,
+    ageIdentityFile,
+    pgpRecipient,
+    botIdentityLog: env.BOT_IDENTITY_LOG ?? "",
+    jobJournal: env.JOB_JOURNAL ?? "",
+    removedUsersFile: env.REMOVED_USERS_FILE ?? "",
+    removedUserRetentionMs: milliseconds(env, "REMOVED_USER_RETENTION_MS", DEFAULT_REMOVED_USER_RETENTION_MS, true),
+    userMappingsFile: env.USER_MAPPINGS_FILE ?? "",
+    deadLetterFile: env.DEAD_LETTER_FILE ?? "",
+    retentionIntervalMs: milliseconds(env, "RETENTION_INTERVAL_MS", DEFAULT_RETENTION_INTERVAL_MS, true),
+    auditRetentionMs: milliseconds(env, "AUDIT_RETENTION_MS", DEFAULT_AUDIT_RETENTION_MS, true),
+    botIdentityRetentionMs: milliseconds(env, "BOT_IDENTITY_RETENTION_MS", DEFAULT_BOT_IDENTITY_RETENTION_MS, true),
+    tokenHistoryRetentionMs: milliseconds(env, "TOKEN_HISTORY_RETENTION_MS", DEFAULT_TOKEN_HISTORY_RETENTION_MS, true),
+    deadLetterRetentionMs: milliseconds(env, "DEAD_LETTER_RETENTION_MS", DEFAULT_DEAD_LETTER_RETENTION_MS, true),
+    resolveMeetingHosts: env.RESOLVE_MEETING_HOSTS === "true",
+    resolveMeetingOccurrences: env.RESOLVE_MEETING_OCCURRENCES === "true",
+    resolvePersonalMeetings: env.RESOLVE_PERSONAL_MEETINGS === "true",
+    requireUserCallbackSecrets: env.REQUIRE_USER_CALLBACK_SECRETS === "true",
+    zakMeetingPasscodes: env.ZAK_MEETING_PASSCODES === "true",
+    recallResponseFormat,
+    proxyTokens: env.PROXY_TOKENS === "true",
+    proxyTokenTtlMs: milliseconds(env, "PROXY_TOKEN_TTL_MS", DEFAULT_PROXY_TOKEN_TTL_MS, false),
+    proxyTokenExchangeAccess: env.PROXY_TOKEN_EXCHANGE_ACCESS === "true",
+    adminApiKey,
+    faultInjectionEnabled,
+    teamsClientId,
+    teamsClientSecret,
+    teamsTenant: env.TEAMS_TENANT_ID ?? DEFAULT_MICROSOFT_TENANT,
+    teamsScopes: env.TEAMS_SCOPES ? env.TEAMS_SCOPES.split(/[\s,]+/).filter(Boolean) : DEFAULT_MICROSOFT_SCOPES,
+    microsoftLoginBaseUrl: env.MICROSOFT_LOGIN_BASE_URL ?? DEFAULT_MICROSOFT_LOGIN_BASE_URL,
+    googleClientId,
+    googleClientSecret,
+    googleScopes: env.GOOGLE_SCOPES ? env.GOOGLE_SCOPES.split(/[\s,]+/).filter(Boolean) : DEFAULT_GOOGLE_SCOPES,
+    googleAuthBaseUrl: env.GOOGLE_AUTH_BASE_URL ?? DEFAULT_GOOGLE_AUTH_BASE_URL,
+    googleTokenBaseUrl: env.GOOGLE_TOKEN_BASE_URL ?? DEFAULT_GOOGLE_TOKEN_BASE_URL,
+    slackSigningSecret,
+    webhookUrls,
+    webhookSecret,
+    notifyRoutes: routes,
+    slackAlertWebhookUrl,
+    smtpUrl,
+    alertEmailFrom,
+    alertEmailTo,
+    onboardingFile: env.ONBOARDING_FILE ?? "",
+    onboardingEmailFrom: env.ONBOARDING_EMAIL_FROM || alertEmailFrom,
+    onboardingReminderIntervalMs,
+    onboardingMaxReminders: count(env, "ONBOARDING_MAX_REMINDERS", DEFAULT_ONBOARDING_MAX_REMINDERS),
+    pagerdutyRoutingKey,
+    pagerdutyEventsUrl: env.PAGERDUTY_EVENTS_URL ?? DEFAULT_PAGERDUTY_EVENTS_URL,
+    recallWebhookSecret: env.RECALL_WEBHOOK_SECRET ?? "",
+    realtimeEvents: relayedEvents,
+    realtimeRelayUrl,
+    recordingForwardUrl,
+    issuanceWebhookUrl,
+    grpcPort,
+    grpcTlsCert: grpcTls("GRPC_TLS_CERT"),
+    grpcTlsKey: grpcTls("GRPC_TLS_KEY"),
+    grpcTlsCa: grpcTls("GRPC_TLS_CA"),
+  };
+}
+
+/** The Vault store config describes, less the HTTP client it is given. */
+export function vaultStoreOptions(config: Config): Omit<VaultTokenStoreOptions, "httpClient"> {
+  return {
+    address: config.vaultAddr,
+    auth: config.vaultToken
+      ? { method: "token", token: config.vaultToken }
+      : {
+          method: "kubernetes",
+          role: config.vaultKubernetesRole,
+          authPath: config.vaultKubernetesAuthPath,
+          serviceAccountTokenPath: config.vaultKubernetesTokenPath,
+        },
+    kvMount: config.vaultKvMount,
+    pathPrefix: config.vaultPathPrefix,
+    namespace: config.vaultNamespace,
+  };
+}
+
+/** The Secrets Manager store config describes, its credentials fetched with httpClient. */
+export function awsSecretsManagerStoreOptions(config: Config, httpClient: HttpClient): AwsSecretsManagerTokenStoreOptions {
+  return {
+    secretArn: config.awsSecretArn,
+    credentials: new AwsCredentialProvider({
+      source: config.awsCredentialSource!,
+      httpClient,
+      region: secretArnRegion(config.awsSecretArn)!,
+      stsEndpoint: config.awsStsEndpoint || undefined,
+    }),
+    httpClient,
+    endpoint: config.awsSecretsManagerEndpoint || undefined,
+  };
+}
+
+/** The DynamoDB store config describes, its credentials fetched with httpClient. */
+export function dynamoDbStoreOptions(config: Config, httpClient: HttpClient): DynamoDbTokenStoreOptions {
+  return {
+    table: config.dynamoDbTable,
+    region: config.dynamoDbRegion,
+    credentials: new AwsCredentialProvider({
+      source: config.awsCredentialSource!,
+      httpClient,
+      region: config.dynamoDbRegion,
+      stsEndpoint: config.awsStsEndpoint || undefined,
+    }),
+    httpClient,
+    ttlMs: config.dynamoDbTtlMs,
+    endpoint: config.dynamoDbEndpoint || undefined,
+  };
+}
+
+/** The Secret Manager store config describes, its access tokens fetched with httpClient. */
+export function gcpSecretManagerStoreOptions(config: Config, httpClient: HttpClient): GcpSecretManagerTokenStoreOptions {
+  return {
+    secret: config.gcpSecret,
+    credentials: new GcpCredentialProvider({ httpClient, metadataHost: config.gcpMetadataHost || undefined }),
+    httpClient,
+    endpoint: config.gcpSecretManagerEndpoint || undefined,
+  };
+}
+
+/** The Key Vault store config describes, its access tokens fetched with httpClient. */
+export function azureKeyVaultStoreOptions(config: Config, httpClient: HttpClient): AzureKeyVaultTokenStoreOptions {
+  return {
+    vaultUrl: config.azureKeyVaultUrl,
+    secretName: config.azureKeyVaultSecretName,
+    credentials: new AzureCredentialProvider({ source: config.azureCredentialSource, httpClient, resource: keyVaultResource(config.azureKeyVaultUrl) }),
+    httpClient,
+  };
+}
+
+/** The Kubernetes Secret store config describes; httpClient is used when the cluster's CA isn't mounted. */
+export function kubernetesSecretStoreOptions(config: Config, httpClient: HttpClient): KubernetesSecretTokenStoreOptions {
+  return {
+    apiUrl: config.kubernetesApiUrl,
+    name: config.kubernetesSecretName,
+    namespace: config.kubernetesNamespace || undefined,
+    serviceAccountDir: config.kubernetesServiceAccountDir || undefined,
+    httpClient,
+  };
+}
+
+/** What the encrypted store config describes seals tokens with, null without encryption; KMS calls go through httpClient. */
+export function tokenEncryptionOptions(config: Config, httpClient: HttpClient): Omit<EncryptedTokenStoreOptions, "store"> | null {
+  if (!config.tokenEncryptionProvider) return null;
+  const local = new LocalKeyProvider({
+    key: config.tokenEncryptionProvider === "local" ? config.tokenEncryptionKey! : undefined,
+    previousKeys: [...(config.tokenEncryptionProvider !== "local" && config.tokenEncryptionKey ? [config.tokenEncryptionKey] : []), ...config.tokenEncryptionPreviousKeys],
+  });
+  let provider: EncryptionProvider;
+  switch (config.tokenEncryptionProvider) {
+    case "local":
+      return { provider: local };
+    case "aws-kms":
+      provider = new AwsKmsProvider({
+        keyId: config.awsKmsKeyId,
+        client: new AwsJsonClient({
+          service: "kms",
+          targetPrefix: "TrentService",
+          region: config.awsKmsRegion,
+          credentials: new AwsCredentialProvider({
+            source: config.awsCredentialSource!,
+            httpClient,
+            region: config.awsKmsRegion,
+            stsEndpoint: config.awsStsEndpoint || undefined,
+          }),
+          httpClient,
+          endpoint: config.awsKmsEndpoint || undefined,
+        }),
+      });
+      break;
+    case "gcp-kms":
+      provider = new GcpKmsProvider({
+        keyName: config.gcpKmsKey,
+        credentials: new GcpCredentialProvider({ httpClient, metadataHost: config.gcpMetadataHost || undefined }),
+        httpClient,
+        endpoint: config.gcpKmsEndpoint || undefined,
+      });
+      break;
+    case "age":
+      provider = new AgeProvider({ recipient: config.ageRecipient, identityFile: config.ageIdentityFile });
+      break;
+    case "pgp":
+      provider = new PgpProvider({ recipient: config.pgpRecipient });
+      break;
+  }
+  // local keys only open tokens sealed before the move to provider
+  return { provider, previousProviders: config.tokenEncryptionKey || config.tokenEncryptionPreviousKeys.length > 0 ? [local] : [] };
+}
@@ -0,0 +1,146 @@
+import { createHash, createHmac, randomBytes, timingSafeEqual } from "crypto";
+import { TtlCache } from "./zoomrecall/ttlcache.js";
+
+// longer than anyone should need on a consent screen; Zoom's codes themselves only last minutes
+export const CONSENT_STATE_TTL_MS = 15 * 60 * 1000;
+const MAX_PENDING_CONSENTS = 10000;
+// long enough to come back to an onboarding email the next week
+export const DEFAULT_CONSENT_SESSION_TTL_MS = 7 * 24 * 60 * 60 * 1000;
+export const CONSENT_SESSION_COOKIE = "zoom_consent_session";
+
+/**
+ * The URL to send people to after consent, if returnTo is an https URL on
+ * one of hosts: a hostname, or "*.example.com" for any subdomain of
+ * example.com. Undefined for anything else, so the consent flow can't be
+ * used to redirect people to arbitrary sites.
+ */
+export function allowedReturnUrl(returnTo: string, hosts: string[]): string | undefined {
+  let url: URL;
+  try {
+    url = new URL(returnTo);
+  } catch {
+    return undefined;
+  }
+  if (url.protocol !== "https:" || url.username || url.password) return undefined;
+  const host = url.hostname.toLowerCase();
+  const allowed = hosts.some((pattern) => (pattern.startsWith("*.") ? host.endsWith(pattern.slice(1)) : host === pattern));
+  return allowed ? url.href : undefined;
+}
+
+/** The S256 PKCE code challenge of verifier, as sent with the authorization request. */
+export function codeChallenge(verifier: string): string {
+  return createHash("sha256").update(verifier).digest("base64url");
+}
+
+/**
+ * Tracks consent flows started here by an unguessable OAuth state, so each
+ * callback is matched to the flow that started it and completes it at most
+ * once, however many people are consenting at the same time. Each flow also
+ * gets a PKCE code verifier, so a code intercepted on its way back is useless
+ * without the verifier only this server knows.
+ */
+export class ConsentStates {
+  // state to the provider consent was started for, where to send the user once it completes, and its PKCE code verifier
+  private readonly pending = new TtlCache<{ provider: string; returnTo: string | undefined; codeVerifier: string }>({
+    ttlMs: CONSENT_STATE_TTL_MS,
+    maxEntries: MAX_PENDING_CONSENTS,
+  });
+
+  // returnTo has to have been checked with allowedReturnUrl
+  start(provider: string, returnTo?: string): string {
+    const state = randomBytes(16).toString("base64url");
+    // 43 characters, the shortest verifier RFC 7636 allows, from 256 random bits
+    this.pending.set(state, { provider, returnTo, codeVerifier: randomBytes(32).toString("base64url") });
+    return state;
+  }
+
+  /** The code challenge to send with state's authorization request; undefined if state is unknown or expired. */
+  codeChallengeOf(state: string): string | undefined {
+    const verifier = this.pending.get(state)?.codeVerifier;
+    return verifier === undefined ? undefined : codeChallenge(verifier);
+  }
+
+  /** The code verifier state's code is exchanged with, without completing the flow. */
+  codeVerifierOf(state: string): string | undefined {
+    return this.pending.get(state)?.codeVerifier;
+  }
+
+  /** The provider state's flow was started for, without completing it; undefined if it's unknown or expired. */
+  providerOf(state: string): string | undefined {
+    return this.pending.get(state)?.provider;
+  }
+
+  /** Where state's flow sends the user once it completes, without completing it; undefined for the success page. */
+  returnToOf(state: string): string | undefined {
+    return this.pending.get(state)?.returnTo;
+  }
+
+  /** Completes the flow state belongs to; returns false if it's unknown, expired, already completed or for another provider. */
+  claim(state: string, provider: string): boolean {
+    if (this.pending.get(state)?.provider !== provider) return false;
+    this.pending.delete(state);
+    return true;
+  }
+
+  /** Forgets flows that were started but never completed in time; returns how many. */
+  purgeExpired(): number {
+    return this.pending.purgeExpired();
+  }
+}
+
+/** What a consent flow was started with, to start it again the same way. */
+export interface ConsentSession {
+  // "zoom", "zoom:<app>" or "tenant:<name>", as for ConsentStates
+  provider: string;
+  invitationId?: string;
+  returnTo?: string;
+  // the ConsentStates state of the latest flow, which its callback has to come back with
+  state?: string;
+}
+
+/**
+ * Seals consent flows into a cookie signed with HMAC-SHA256, so someone who
+ * leaves consent and comes back to /zoom/oauth later picks up the invitation
+ * and return URL they started with instead of needing a new link, and a
+ * callback is only taken from the browser that started its flow. Nothing is
+ * kept server-side, so a cookie opens on any instance with the same secret;
+ * with a secret made up per process, only on the one that sealed it. A
+ * session is only as good as its invitation and return URL still are when
+ * it's opened.
+ */
+export class ConsentSessions {
+  readonly ttlMs: number;
+  private readonly secret: string;
+
+  constructor(options: { secret: string; ttlMs: number }) {
+    this.secret = options.secret;
+    this.ttlMs = options.ttlMs;
+  }
+
+  /** The cookie value for session, valid for ttlMs from now. */
+  seal(session: ConsentSession, now: number = Date.now()): string {
+    const payload = Buffer.from(JSON.stringify({ ...session, expires_at: now + this.ttlMs })).toString("base64url");
+    return `${payload}.${this.sign(payload)}`;
+  }
+
+  /** The session a cookie value holds if it was sealed here and hasn't expired; undefined for anything else. */
+  open(value: string | undefined, now: number = Date.now()): ConsentSession | undefined {
+    const [payload, signature, extra] = value?.split(".") ?? [];
+    if (!payload || !signature || extra !== undefined) return undefined;
+    const expected = Buffer.from(this.sign(payload));
+    const given = Buffer.from(signature);
+    if (expected.length !== given.length || !timingSafeEqual(expected, given)) return undefined;
+    let session: ConsentSession & { expires_at: number };
+    try {
+      session = JSON.parse(Buffer.from(payload, "base64url").toString("utf8")) as ConsentSession & { expires_at: number };
+    } catch {
+      return undefined;
+    }
+    if (!(session.expires_at > now) || typeof session.provider !== "string") return undefined;
+    return { provider: session.provider, invitationId: session.invitationId, returnTo: session.returnTo, state: session.state };
+  }
+
+  private sign(payload: string): string {
+    return createHmac("sha256", this.secret).update(`consent-session:${payload}`).digest("base64url");
+  }
+}
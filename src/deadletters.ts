@@ -0,0 +1,175 @@
+import { randomUUID } from "crypto";
+import { readFileSync, renameSync, writeFileSync } from "fs";
+import { ConfigError } from "./config.js";
+
+const DEFAULT_MAX_LETTERS = 1000;
+
+export type WebhookSource = "zoom" | "recall";
+
+/** Does what a verified webhook of one source asks for; throws if that failed and replaying it could help. */
+export type WebhookProcessor = (body: unknown) => Promise<void>;
+
+/** A verified inbound webhook whose processing failed, kept for replay. */
+export interface DeadLetter {
+  id: string;
+  source: WebhookSource;
+  // e.g. "meeting.participant_joined_waiting_room"; null when the body names none
+  event: string | null;
+  received_at: string;
+  attempts: number;
+  last_attempt_at: string;
+  last_error: string;
+  // the webhook's JSON body as received
+  body: unknown;
+}
+
+export interface DeadLettersOptions {
+  // kept in memory only without one
+  path?: string;
+  maxLetters?: number;
+}
+
+function eventOf(body: unknown): string | null {
+  const event = (body as { event?: unknown } | null)?.event;
+  return typeof event === "string" ? event : null;
+}
+
+/**
+ * The dead-letter queue of inbound Zoom and Recall webhooks. Webhooks are
+ * acknowledged once their signature checks out and processed after that,
+ * so a processing failure can't be answered with an error for the sender to
+ * retry; instead the webhook is kept here until an operator replays or
+ * discards it, or retention removes it. With a path, letters are written to
+ * it as one JSON document and read back at startup. Once maxLetters are
+ * kept the oldest is dropped for each new one.
+ */
+export class DeadLetters {
+  private readonly path: string | undefined;
+  private readonly maxLetters: number;
+  private readonly processors = new Map<WebhookSource, WebhookProcessor>();
+  private readonly letters = new Map<string, DeadLetter>();
+
+  constructor(options: DeadLettersOptions = {}) {
+    this.path = options.path || undefined;
+    this.maxLetters = options.maxLetters ?? DEFAULT_MAX_LETTERS;
+    if (this.path) {
+      this.load(this.path);
+    }
+  }
+
+  /** Makes processor the one source's webhooks, and replays of them, go through. */
+  register(source: WebhookSource, processor: WebhookProcessor): void {
+    this.processors.set(source, processor);
+  }
+
+  /** Processes body with source's processor, keeping it as a dead letter if that fails; resolves with whether it succeeded. */
+  async process(source: WebhookSource, body: unknown): Promise<boolean> {
+    try {
+      await this.processWith(source, body);
+      return true;
+    } catch (error) {
+      const now = new Date().toISOString();
+      const letter: DeadLetter = {
+        id: randomUUID(),
+        source,
+        event: eventOf(body),
+        received_at: now,
+        attempts: 1,
+        last_attempt_at: now,
+        last_error: error instanceof Error ? error.message : String(error),
+        body,
+      };
+      console.error(`could not process ${source} webhook ${letter.event ?? "without an event"}, kept as dead letter ${letter.id}`, error);
+      this.letters.set(letter.id, letter);
+      for (const oldest of this.letters.keys()) {
+        if (this.letters.size <= this.maxLetters) break;
+        this.letters.delete(oldest);
+      }
+      this.save();
+      return false;
+    }
+  }
+
+  /**
+   * Processes the dead letter id again; it is removed if that succeeds and
+   * kept with the new error if not. Null if there is no such letter.
+   */
+  async replay(id: string): Promise<{ replayed: boolean; letter: DeadLetter } | null> {
+    const letter = this.letters.get(id);
+    if (!letter) return null;
+    letter.attempts++;
+    letter.last_attempt_at = new Date().toISOString();
+    try {
+      await this.processWith(letter.source, letter.body);
+    } catch (error) {
+      letter.last_error = error instanceof Error ? error.message : String(error);
+      this.save();
+      return { replayed: false, letter };
+    }
+    this.letters.delete(id);
+    this.save();
+    return { replayed: true, letter };
+  }
+
+  get(id: string): DeadLetter | undefined {
+    return this.letters.get(id);
+  }
+
+  /** Returns every letter, most recently received first. */
+  list(): DeadLetter[] {
+    return [...this.letters.values()].reverse();
+  }
+
+  /** Drops the letter id without processing it; false if there was none. */
+  discard(id: string): boolean {
+    if (!this.letters.delete(id)) return false;
+    this.save();
+    return true;
+  }
+
+  /** Drops letters received before before, in ms since the epoch; returns how many. */
+  prune(before: number): number {
+    let pruned = 0;
+    for (const letter of [...this.letters.values()]) {
+      if (Date.parse(letter.received_at) >= before) continue;
+      this.letters.delete(letter.id);
+      pruned++;
+    }
+    if (pruned > 0) this.save();
+    return pruned;
+  }
+
+  private async processWith(source: WebhookSource, body: unknown): Promise<void> {
+    const processor = this.processors.get(source);
+    if (!processor) {
+      // e.g. a letter read back after ZOOM_WEBHOOK_SECRET_TOKEN was unset
+      throw new Error(`${source} webhooks aren't received by this instance`);
+    }
+    await processor(body);
+  }
+
+  private save(): void {
+    if (!this.path) return;
+    try {
+      const temporary = `${this.path}.tmp`;
+      writeFileSync(temporary, `${JSON.stringify({ version: 1, letters: [...this.letters.values()] }, null, 2)}\n`, { mode: 0o600 });
+      renameSync(temporary, this.path);
+    } catch (error) {
+      console.error(`could not write dead letters to ${this.path}`, error);
+    }
+  }
+
+  private load(path: string): void {
+    let contents: { version: number; letters: DeadLetter[] };
+    try {
+      contents = JSON.parse(readFileSync(path, "utf8")) as { version: number; letters: DeadLetter[] };
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read DEAD_LETTER_FILE ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    if (contents.version !== 1 || !Array.isArray(contents.letters)) {
+      throw new ConfigError(`DEAD_LETTER_FILE ${path} does not hold version 1 dead letters`);
+    }
+    for (const letter of contents.letters) this.letters.set(letter.id, letter);
+  }
+}
@@ -0,0 +1,137 @@
+import express from "express";
+import type { HttpClient } from "./zoomrecall/index.js";
+import { HttpError } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+export interface FaultSettings {
+  latencyMs: number;
+  rateLimit: boolean;
+  invalidGrant: boolean;
+  // shifts the Date header of Zoom's responses by this much, as if this machine's clock were that far behind
+  dateSkewMs: number;
+  // chance in [0, 1] that an eligible request is affected
+  probability: number;
+}
+
+const NO_FAULTS: FaultSettings = { latencyMs: 0, rateLimit: false, invalidGrant: false, dateSkewMs: 0, probability: 1 };
+
+function jsonResponse(status: number, body: unknown, headers: Record<string, string> = {}): Response {
+  return new Response(JSON.stringify(body), {
+    status,
+    headers: { "Content-Type": "application/json", ...headers },
+  });
+}
+
+/**
+ * Simulates Zoom misbehaving (slow responses, 429s, invalid_grant on token
+ * requests, a clock off from this machine's) so failure handling and
+ * alerting can be rehearsed. Only wired up when FAULT_INJECTION_ENABLED is
+ * set.
+ */
+export class FaultInjector {
+  private settings: FaultSettings = { ...NO_FAULTS };
+  private readonly zoomBaseUrls: string[];
+
+  constructor(zoomBaseUrls: string[]) {
+    this.zoomBaseUrls = zoomBaseUrls;
+  }
+
+  get current(): FaultSettings {
+    return { ...this.settings };
+  }
+
+  update(settings: Partial<FaultSettings>): FaultSettings {
+    this.settings = { ...this.settings, ...settings };
+    return this.current;
+  }
+
+  clear(): void {
+    this.settings = { ...NO_FAULTS };
+  }
+
+  wrap(httpClient: HttpClient): HttpClient {
+    return async (input, init) => {
+      const url = input.toString();
+      if (!this.zoomBaseUrls.some((base) => url.startsWith(base)) || Math.random() >= this.settings.probability) {
+        return httpClient(input, init);
+      }
+
+      const { latencyMs, rateLimit, invalidGrant, dateSkewMs } = this.settings;
+      if (latencyMs > 0) {
+        await new Promise((resolve) => setTimeout(resolve, latencyMs));
+      }
+      if (rateLimit) {
+        return jsonResponse(429, { code: 429, message: "injected fault: rate limited" }, { "Retry-After": "1" });
+      }
+      if (invalidGrant && new URL(url).pathname.endsWith("/oauth/token")) {
+        return jsonResponse(400, { reason: "injected fault: invalid grant", error: "invalid_grant" });
+      }
+      const response = await httpClient(input, init);
+      if (dateSkewMs === 0) return response;
+      const headers = new Headers(response.headers);
+      headers.set("date", new Date(Date.now() + dateSkewMs).toUTCString());
+      return new Response(response.body, { status: response.status, statusText: response.statusText, headers });
+    };
+  }
+}
+
+function parseSettings(body: Record<string, unknown>): Partial<FaultSettings> {
+  const settings: Partial<FaultSettings> = {};
+  if (body.latency_ms !== undefined) {
+    const latencyMs = Number(body.latency_ms);
+    if (!Number.isFinite(latencyMs) || latencyMs < 0) throw new HttpError(400, "latency_ms must be a non-negative number");
+    settings.latencyMs = latencyMs;
+  }
+  if (body.date_skew_ms !== undefined) {
+    const dateSkewMs = Number(body.date_skew_ms);
+    if (!Number.isFinite(dateSkewMs)) throw new HttpError(400, "date_skew_ms must be a number");
+    settings.dateSkewMs = dateSkewMs;
+  }
+  if (body.probability !== undefined) {
+    const probability = Number(body.probability);
+    if (!Number.isFinite(probability) || probability < 0 || probability > 1) {
+      throw new HttpError(400, "probability must be between 0 and 1");
+    }
+    settings.probability = probability;
+  }
+  if (body.rate_limit !== undefined) settings.rateLimit = body.rate_limit === true || body.rate_limit === "true";
+  if (body.invalid_grant !== undefined) settings.invalidGrant = body.invalid_grant === true || body.invalid_grant === "true";
+  return settings;
+}
+
+function toJSON(settings: FaultSettings): Record<string, unknown> {
+  return {
+    latency_ms: settings.latencyMs,
+    rate_limit: settings.rateLimit,
+    invalid_grant: settings.invalidGrant,
+    date_skew_ms: settings.dateSkewMs,
+    probability: settings.probability,
+  };
+}
+
+export function createFaultRouter(faults: FaultInjector): express.Router {
+  const router = express.Router();
+  router.use(express.json());
+
+  router.get("/", (_req, res) => {
+    writeJSON(res, 200, toJSON(faults.current));
+  });
+
+  router.post("/", (req, res) => {
+    try {
+      const settings = faults.update(parseSettings((req.body ?? {}) as Record<string, unknown>));
+      console.warn("fault injection updated", toJSON(settings));
+      writeJSON(res, 200, toJSON(settings));
+    } catch (error) {
+      writeError(req, res, error, "error updating faults");
+    }
+  });
+
+  router.delete("/", (_req, res) => {
+    faults.clear();
+    console.warn("fault injection cleared");
+    writeJSON(res, 200, toJSON(faults.current));
+  });
+
+  return router;
+}
@@ -0,0 +1,307 @@
+import http2 from "http2";
+import type { TLSSocket } from "tls";
+import {
+  HostNotConnectedError,
+  HttpError,
+  InvalidGrantError,
+  parseMeetingId,
+  statusForError,
+  TokenNotSetError,
+  UserDeactivatedError,
+} from "./zoomrecall/index.js";
+import type { IssuancePolicy, ServedToken, TokenManager } from "./zoomrecall/index.js";
+
+// see proto/zoomrecall/v1/tokens.proto; messages are small enough to encode by hand
+const SERVICE_PATH = "/zoomrecall.v1.TokenService/";
+const MAX_MESSAGE_BYTES = 64 * 1024;
+
+// https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const GrpcStatus = {
+  OK: 0,
+  INVALID_ARGUMENT: 3,
+  NOT_FOUND: 5,
+  PERMISSION_DENIED: 7,
+  RESOURCE_EXHAUSTED: 8,
+  FAILED_PRECONDITION: 9,
+  UNIMPLEMENTED: 12,
+  INTERNAL: 13,
+  UNAVAILABLE: 14,
+  UNAUTHENTICATED: 16,
+} as const;
+
+type Fields = Map<number, string | number>;
+
+class GrpcError extends Error {
+  readonly code: number;
+
+  constructor(code: number, message: string) {
+    super(message);
+    this.name = "GrpcError";
+    this.code = code;
+  }
+}
+
+function grpcStatusForError(error: unknown): number {
+  if (error instanceof GrpcError) return error.code;
+  // the caller's credentials are fine; the user has to (re-)authorize, so retrying won't help
+  if (
+    error instanceof TokenNotSetError ||
+    error instanceof InvalidGrantError ||
+    error instanceof UserDeactivatedError ||
+    error instanceof HostNotConnectedError
+  ) {
+    return GrpcStatus.FAILED_PRECONDITION;
+  }
+  switch (statusForError(error)) {
+    case 400:
+      return GrpcStatus.INVALID_ARGUMENT;
+    case 401:
+      return GrpcStatus.UNAUTHENTICATED;
+    case 403:
+      return GrpcStatus.PERMISSION_DENIED;
+    case 404:
+      return GrpcStatus.NOT_FOUND;
+    case 429:
+      return GrpcStatus.RESOURCE_EXHAUSTED;
+    case 502:
+    case 503:
+      return GrpcStatus.UNAVAILABLE;
+    default:
+      return GrpcStatus.INTERNAL;
+  }
+}
+
+function readVarint(buf: Buffer, offset: number): [number, number] {
+  let value = 0;
+  let scale = 1;
+  for (let i = offset; i < buf.length && i < offset + 10; i++) {
+    value += (buf[i] & 0x7f) * scale;
+    scale *= 128;
+    if ((buf[i] & 0x80) === 0) return [value, i + 1];
+  }
+  throw new GrpcError(GrpcStatus.INVALID_ARGUMENT, "malformed protobuf varint");
+}
+
+function writeVarint(value: number): Buffer {
+  const bytes: number[] = [];
+  do {
+    let byte = value % 128;
+    value = Math.floor(value / 128);
+    if (value > 0) byte |= 0x80;
+    bytes.push(byte);
+  } while (value > 0);
+  return Buffer.from(bytes);
+}
+
+/** Decodes the string and integer fields of a protobuf message, skipping anything else. */
+function decodeMessage(buf: Buffer): Fields {
+  const fields: Fields = new Map();
+  let offset = 0;
+  while (offset < buf.length) {
+    const [key, afterKey] = readVarint(buf, offset);
+    const field = Math.floor(key / 8);
+    offset = afterKey;
+    switch (key & 7) {
+      case 0: {
+        const [value, next] = readVarint(buf, offset);
+        fields.set(field, value);
+        offset = next;
+        break;
+      }
+      case 1:
+        offset += 8;
+        break;
+      case 2: {
+        const [length, next] = readVarint(buf, offset);
+        if (next + length > buf.length) {
+          throw new GrpcError(GrpcStatus.INVALID_ARGUMENT, "truncated protobuf message");
+        }
+        fields.set(field, buf.toString("utf8", next, next + length));
+        offset = next + length;
+        break;
+      }
+      case 5:
+        offset += 4;
+        break;
+      default:
+        throw new GrpcError(GrpcStatus.INVALID_ARGUMENT, `unsupported protobuf wire type ${key & 7}`);
+    }
+  }
+  return fields;
+}
+
+function encodeTokenResponse(token: string, expiresAt: number): Buffer {
+  const value = Buffer.from(token);
+  const parts = [Buffer.from([0x0a]), writeVarint(value.length), value];
+  if (expiresAt > 0) {
+    parts.push(Buffer.from([0x10]), writeVarint(expiresAt));
+  }
+  return Buffer.concat(parts);
+}
+
+function stringField(fields: Fields, field: number): string {
+  const value = fields.get(field);
+  return typeof value === "string" ? value : "";
+}
+
+function requireUserId(fields: Fields): string {
+  const userId = stringField(fields, 1);
+  if (!userId) {
+    throw new HttpError(400, "no user_id provided");
+  }
+  return userId;
+}
+
+type Method = (fields: Fields, client: string) => Promise<{ token: string; expiresAt: number }>;
+
+function meetingIdField(fields: Fields): string | undefined {
+  const raw = stringField(fields, 2);
+  const meetingId = raw ? parseMeetingId(raw) : undefined;
+  if (raw && !meetingId) {
+    throw new HttpError(400, `invalid meeting_id: ${raw}`);
+  }
+  return meetingId;
+}
+
+function tokenServiceMethods(
+  tokens: TokenManager,
+  policy: IssuancePolicy | undefined,
+  resolveHosts: boolean,
+  resolveOccurrences: boolean,
+  onServed: ((served: ServedToken) => void) | undefined,
+): Record<string, Method> {
+  const userIdFor = async (fields: Fields) => {
+    const meetingId = meetingIdField(fields);
+    return resolveHosts && !stringField(fields, 1) && meetingId ? tokens.resolveHost(meetingId) : requireUserId(fields);
+  };
+
+  return {
+    GetAccessToken: async (fields, client) => {
+      const userId = requireUserId(fields);
+      policy?.enforce({ kind: "access", userId, source: `grpc:${client}` });
+      const { accessToken } = tokens.get(userId);
+      onServed?.({ kind: "access", userId, meetingId: undefined, source: `grpc:${client}` });
+      return { token: accessToken, expiresAt: Math.floor(tokens.status(userId).expiresAt.getTime() / 1000) };
+    },
+    GenerateObfToken: async (fields, client) => {
+      const userId = await userIdFor(fields);
+      const meetingId = meetingIdField(fields);
+      if (resolveOccurrences && meetingId) await tokens.meetingOccurrence(userId, meetingId);
+      policy?.enforce({ kind: "obf", userId, meetingId, source: `grpc:${client}` });
+      const token = await tokens.generateObfToken(userId, meetingId);
+      onServed?.({ kind: "obf", userId, meetingId, source: `grpc:${client}` });
+      return { token, expiresAt: 0 };
+    },
+    GenerateZakToken: async (fields, client) => {
+      const userId = await userIdFor(fields);
+      const meetingId = meetingIdField(fields);
+      if (resolveOccurrences && meetingId) await tokens.meetingOccurrence(userId, meetingId);
+      policy?.enforce({ kind: "zak", userId, meetingId, source: `grpc:${client}` });
+      const token = await tokens.generateZakToken(userId);
+      onServed?.({ kind: "zak", userId, meetingId, source: `grpc:${client}` });
+      return { token, expiresAt: 0 };
+    },
+  };
+}
+
+export interface GrpcServerOptions {
+  tokens: TokenManager;
+  policy?: IssuancePolicy;
+  // see RecallRouterOptions.resolveHosts
+  resolveHosts?: boolean;
+  // see RecallRouterOptions.resolveOccurrences; there is no occurrence field, the next to come is checked
+  resolveOccurrences?: boolean;
+  onServed?(served: ServedToken): void;
+  // PEM contents; clients must present a certificate signed by ca
+  cert: string | Buffer;
+  key: string | Buffer;
+  ca: string | Buffer;
+}
+
+/**
+ * Serves zoomrecall.v1.TokenService (unary calls only) over HTTP/2 with
+ * mutual TLS. Connections without a client certificate trusted by ca are
+ * refused during the handshake.
+ */
+export function createGrpcServer(options: GrpcServerOptions): http2.Http2SecureServer {
+  const methods = tokenServiceMethods(options.tokens, options.policy, options.resolveHosts ?? false, options.resolveOccurrences ?? false, options.onServed);
+  const server = http2.createSecureServer({
+    cert: options.cert,
+    key: options.key,
+    ca: options.ca,
+    requestCert: true,
+    rejectUnauthorized: true,
+  });
+
+  server.on("stream", (stream, headers) => {
+    const path = headers[":path"] ?? "";
+    const client = (stream.session?.socket as TLSSocket | undefined)?.getPeerCertificate().subject?.CN ?? "unknown";
+
+    const finish = (error: unknown) => {
+      const code = grpcStatusForError(error);
+      if (code === GrpcStatus.INTERNAL) {
+        console.error(`grpc ${path} from ${client}: error`, error);
+      } else {
+        console.warn(`grpc ${path} from ${client}: ${error instanceof Error ? error.message : String(error)}`);
+      }
+      const message = code === GrpcStatus.INTERNAL ? "internal error" : error instanceof Error ? error.message : String(error);
+      if (stream.headersSent) {
+        stream.close(http2.constants.NGHTTP2_INTERNAL_ERROR);
+        return;
+      }
+      // a trailers-only response
+      stream.respond(
+        { ":status": 200, "content-type": "application/grpc", "grpc-status": String(code), "grpc-message": encodeURIComponent(message) },
+        { endStream: true },
+      );
+    };
+
+    const name = path.startsWith(SERVICE_PATH) ? path.slice(SERVICE_PATH.length) : "";
+    const method = Object.hasOwn(methods, name) ? methods[name] : undefined;
+    if (!method || headers[":method"] !== "POST") {
+      stream.resume();
+      finish(new GrpcError(GrpcStatus.UNIMPLEMENTED, `unknown method: ${path}`));
+      return;
+    }
+    if (!String(headers["content-type"] ?? "").startsWith("application/grpc")) {
+      stream.respond({ ":status": 415 }, { endStream: true });
+      return;
+    }
+
+    const chunks: Buffer[] = [];
+    let received = 0;
+    stream.on("data", (chunk: Buffer) => {
+      received += chunk.length;
+      if (received <= MAX_MESSAGE_BYTES + 5) chunks.push(chunk);
+    });
+    stream.on("end", async () => {
+      try {
+        const frame = Buffer.concat(chunks);
+        if (received > MAX_MESSAGE_BYTES + 5) {
+          throw new GrpcError(GrpcStatus.RESOURCE_EXHAUSTED, "request message too large");
+        }
+        // every message is prefixed with a compressed flag and a 4-byte big-endian length
+        if (frame.length < 5 || frame.readUInt32BE(1) !== frame.length - 5) {
+          throw new GrpcError(GrpcStatus.INVALID_ARGUMENT, "expected exactly one length-prefixed request message");
+        }
+        if (frame[0] !== 0) {
+          throw new GrpcError(GrpcStatus.UNIMPLEMENTED, "compressed messages are not supported");
+        }
+
+        const { token, expiresAt } = await method(decodeMessage(frame.subarray(5)), client);
+        const message = encodeTokenResponse(token, expiresAt);
+        const prefix = Buffer.alloc(5);
+        prefix.writeUInt32BE(message.length, 1);
+
+        stream.respond({ ":status": 200, "content-type": "application/grpc" }, { waitForTrailers: true });
+        stream.on("wantTrailers", () => stream.sendTrailers({ "grpc-status": String(GrpcStatus.OK) }));
+        stream.end(Buffer.concat([prefix, message]));
+      } catch (error) {
+        finish(error);
+      }
+    });
+    stream.on("error", (error) => console.error(`grpc ${path} from ${client}: stream error`, error));
+  });
+
+  return server;
+}
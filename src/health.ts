@@ -0,0 +1,185 @@
+import { escapeHTML } from "./pages.js";
+import { RateLimitedError } from "./zoomrecall/index.js";
+import type { TokenManagerHooks, TokenStatus } from "./zoomrecall/index.js";
+
+const EVALUATE_INTERVAL_MS = 30 * 1000;
+
+/** Worst first; when several apply, the service is in the first of them. */
+export const HEALTH_STATES = ["NO_TOKEN", "ZOOM_UNREACHABLE", "STORE_DOWN", "DEGRADED_NO_REFRESH", "OK"] as const;
+export type HealthState = (typeof HEALTH_STATES)[number];
+
+// states in which callbacks can still be answered
+export const READY_STATES: readonly HealthState[] = ["OK", "DEGRADED_NO_REFRESH", "STORE_DOWN"];
+
+export interface HealthReport {
+  state: HealthState;
+  ready: boolean;
+  since: Date;
+  // one per state that applies, worst first; never names users
+  reasons: string[];
+  transitions: number;
+}
+
+export interface HealthMonitorOptions {
+  users: () => TokenStatus[];
+  onChange?(from: HealthState, to: HealthState, reasons: string[]): void;
+}
+
+// zoom answered, even if with an error, so it is reachable
+function zoomAnswered(error: unknown): boolean {
+  if (error instanceof RateLimitedError) return true;
+  const status = (error as { status?: unknown }).status;
+  return typeof status === "number" && status < 500;
+}
+
+/**
+ * Folds what the token manager reports into one health state, so readiness,
+ * metrics, the launch page and alerts agree on it. Re-evaluated on every
+ * report and every EVALUATE_INTERVAL_MS, since tokens also expire on their
+ * own.
+ */
+export class HealthMonitor {
+  private readonly users: () => TokenStatus[];
+  private readonly onChange: HealthMonitorOptions["onChange"];
+  // users whose latest refresh failed, and whether zoom answered it
+  private readonly failedRefreshes = new Map<string, { zoomAnswered: boolean }>();
+  private storeError: string | null = null;
+  private current: HealthReport | null = null;
+  private readonly timer: NodeJS.Timeout;
+
+  constructor(options: HealthMonitorOptions) {
+    this.users = options.users;
+    this.onChange = options.onChange;
+    this.timer = setInterval(() => this.report(), EVALUATE_INTERVAL_MS);
+    this.timer.unref();
+  }
+
+  /** Wraps hooks so the monitor sees refreshes and store writes too. */
+  observe(hooks: TokenManagerHooks): TokenManagerHooks {
+    return {
+      ...hooks,
+      onRefresh: (status) => {
+        this.failedRefreshes.delete(status.userId);
+        hooks.onRefresh?.(status);
+        this.report();
+      },
+      onRefreshFailed: (userId, error) => {
+        this.failedRefreshes.set(userId, { zoomAnswered: zoomAnswered(error) });
+        hooks.onRefreshFailed?.(userId, error);
+        this.report();
+      },
+      onStoreSaved: () => {
+        // saves follow every change to the users, so this also notices connects and removals
+        this.storeError = null;
+        hooks.onStoreSaved?.();
+        this.report();
+      },
+      onStoreFailed: (error) => {
+        this.storeError = error instanceof Error ? error.message : String(error);
+        hooks.onStoreFailed?.(error);
+        this.report();
+      },
+    };
+  }
+
+  /** Evaluates the current state, calling onChange if it differs from the last one. */
+  report(): HealthReport {
+    const reasons = new Map<HealthState, string>();
+    const now = Date.now();
+    const users = this.users();
+    const usable = users.filter((user) => !user.needsReauthorization && !user.deactivated && user.expiresAt.getTime() > now);
+    if (usable.length === 0) {
+      reasons.set("NO_TOKEN", users.length === 0 ? "no user has connected" : `none of ${users.length} user(s) has a usable token`);
+    }
+    const known = new Set(users.map((user) => user.userId));
+    const failed = [...this.failedRefreshes].filter(([userId]) => known.has(userId));
+    const unreachable = failed.filter(([, failure]) => !failure.zoomAnswered).length;
+    if (unreachable > 0 && unreachable === failed.length) {
+      reasons.set("ZOOM_UNREACHABLE", `the latest refresh of ${unreachable} user(s) got no answer from zoom`);
+    }
+    if (this.storeError !== null) {
+      reasons.set("STORE_DOWN", `the token store can't be written: ${this.storeError}`);
+    }
+    if (failed.length > 0 && !reasons.has("ZOOM_UNREACHABLE")) {
+      reasons.set("DEGRADED_NO_REFRESH", `refreshing failed for ${failed.length} user(s), their current tokens are still served`);
+    }
+
+    const state = HEALTH_STATES.find((candidate) => reasons.has(candidate)) ?? "OK";
+    const ordered = HEALTH_STATES.filter((candidate) => reasons.has(candidate)).map((candidate) => reasons.get(candidate)!);
+    const previous = this.current;
+    this.current = {
+      state,
+      ready: READY_STATES.includes(state),
+      since: previous && previous.state === state ? previous.since : new Date(now),
+      reasons: ordered,
+      transitions: (previous?.transitions ?? 0) + (previous && previous.state !== state ? 1 : 0),
+    };
+    if (previous && previous.state !== state) {
+      const log = state === "OK" ? console.log : console.warn;
+      log(`health ${previous.state} -> ${state}${ordered.length > 0 ? `: ${ordered.join("; ")}` : ""}`);
+      this.onChange?.(previous.state, state, ordered);
+    }
+    return this.current;
+  }
+
+  close(): void {
+    clearInterval(this.timer);
+  }
+}
+
+export function healthJSON(report: HealthReport): Record<string, unknown> {
+  return { state: report.state, ready: report.ready, since: report.since.toISOString(), reasons: report.reasons };
+}
+
+/** Renders the state in the Prometheus text format. */
+export function healthMetrics(report: HealthReport): string {
+  const lines = [
+    "# HELP zoom_oauth_health_state Current health state; 1 for the state the service is in, 0 for the others.",
+    "# TYPE zoom_oauth_health_state gauge",
+    ...HEALTH_STATES.map((state) => `zoom_oauth_health_state{state="${state}"} ${state === report.state ? 1 : 0}`),
+    "# HELP zoom_oauth_health_ready Whether the readiness endpoint reports ready.",
+    "# TYPE zoom_oauth_health_ready gauge",
+    `zoom_oauth_health_ready ${report.ready ? 1 : 0}`,
+    "# HELP zoom_oauth_health_transitions_total Health state changes since startup.",
+    "# TYPE zoom_oauth_health_transitions_total counter",
+    `zoom_oauth_health_transitions_total ${report.transitions}`,
+  ];
+  return `${lines.join("\n")}\n`;
+}
+
+/** Prometheus gauges of when users usable now are forecast to have to consent again. */
+export function reauthorizationMetrics(users: TokenStatus[], warningMs: number): string {
+  const now = Date.now();
+  const due = users
+    .filter((user) => !user.needsReauthorization && !user.deactivated)
+    .map((user) => user.reauthorizationDueAt?.getTime())
+    .filter((dueAt): dueAt is number => dueAt !== undefined);
+  const lines = [
+    "# HELP zoom_oauth_reauthorization_due_users Users forecast to have to consent again within REAUTHORIZATION_WARNING_MS.",
+    "# TYPE zoom_oauth_reauthorization_due_users gauge",
+    `zoom_oauth_reauthorization_due_users ${due.filter((dueAt) => dueAt - now <= warningMs).length}`,
+    "# HELP zoom_oauth_next_reauthorization_due_timestamp_seconds When the earliest forecast re-authorization is due; 0 when none is.",
+    "# TYPE zoom_oauth_next_reauthorization_due_timestamp_seconds gauge",
+    `zoom_oauth_next_reauthorization_due_timestamp_seconds ${due.length === 0 ? 0 : Math.floor(Math.min(...due) / 1000)}`,
+  ];
+  return `${lines.join("\n")}\n`;
+}
+
+/** A Prometheus gauge of how far the local clock is off Zoom's, as last measured. */
+export function clockSkewMetrics(measuredMs: number | null): string {
+  const lines = [
+    "# HELP zoom_oauth_clock_skew_seconds How far the local clock is ahead of Zoom's (negative: behind), from the Date header of its latest response.",
+    "# TYPE zoom_oauth_clock_skew_seconds gauge",
+    ...(measuredMs === null ? [] : [`zoom_oauth_clock_skew_seconds ${(measuredMs / 1000).toFixed(3)}`]),
+  ];
+  return `${lines.join("\n")}\n`;
+}
+
+/** A banner for operator pages describing what's wrong; empty while the state is OK. */
+export function healthBanner(report: HealthReport): string {
+  if (report.state === "OK") return "";
+  const color = report.ready ? "#fff4ce" : "#fde7e9";
+  return `<div role="alert" style="background: ${color}; padding: 8px 12px; margin-bottom: 12px">
+    <strong>${report.state}</strong> since ${escapeHTML(report.since.toISOString())}: ${escapeHTML(report.reasons.join("; "))}
+  </div>`;
+}
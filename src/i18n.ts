@@ -0,0 +1,213 @@
+import type express from "express";
+
+export const LOCALES = ["en", "de", "es", "fr", "ja", "pt"] as const;
+export type Locale = (typeof LOCALES)[number];
+export const DEFAULT_LOCALE: Locale = "en";
+
+type MessageKey =
+  | "consent.connected"
+  | "consent.account"
+  | "consent.email"
+  | "consent.scopes"
+  | "consent.user_id"
+  | "consent.stored_provider"
+  | "consent.slack_linked"
+  | "consent.missing_code"
+  | "consent.denied"
+  | "consent.failed"
+  | "consent.internal"
+  | "consent.expired"
+  | "consent.unknown_invitation"
+  | "expired.title"
+  | "expired.message"
+  | "expired.retry"
+  | "page.success_title"
+  | "page.failure_title"
+  | "connect.title"
+  | "connect.intro"
+  | "connect.button";
+
+type Catalog = Record<MessageKey, string>;
+
+// {name} placeholders are filled in by translate; keep them in every translation
+const catalogs: Record<Locale, Catalog> = {
+  en: {
+    "consent.connected": "connected your Zoom account, check that it is the one you meant to connect",
+    "consent.account": "account",
+    "consent.email": "email",
+    "consent.scopes": "granted scopes",
+    "consent.user_id": "user ID",
+    "consent.stored_provider": "successfully stored {provider} oauth token for user: {user_id}",
+    "consent.slack_linked": "your Slack account is now linked to zoom user {user_id}, you can go back to Slack and use /recordmeeting",
+    "consent.missing_code": "no auth code provided for oauth handler",
+    "consent.denied": "{provider} consent failed: {reason}",
+    "consent.failed": "authorization failed: {reason}",
+    "consent.internal": "something went wrong on our side, please try again",
+    "consent.expired": "this sign-in link has expired or was already used, start over at {url}",
+    "consent.unknown_invitation": "this onboarding link is not valid or was withdrawn, ask whoever sent it for a new one",
+    "expired.title": "This link has expired",
+    "expired.message": "Approving access took longer than {provider} allows, or this page was reloaded. Start over to get a fresh link.",
+    "expired.retry": "Start over",
+    "page.success_title": "You're connected",
+    "page.failure_title": "Something went wrong",
+    "connect.title": "Connect your account",
+    "connect.intro": "{product} needs access to your meetings to record them. You'll be asked to approve this on the next page.",
+    "connect.button": "Connect {provider}",
+  },
+  de: {
+    "consent.connected": "Ihr Zoom-Konto ist verbunden, prüfen Sie, ob es das Konto ist, das Sie verbinden wollten",
+    "consent.account": "Konto",
+    "consent.email": "E-Mail",
+    "consent.scopes": "erteilte Berechtigungen",
+    "consent.user_id": "Benutzer-ID",
+    "consent.stored_provider": "{provider}-OAuth-Token für Benutzer {user_id} erfolgreich gespeichert",
+    "consent.slack_linked": "Ihr Slack-Konto ist jetzt mit dem Zoom-Benutzer {user_id} verknüpft. Sie können zu Slack zurückkehren und /recordmeeting verwenden",
+    "consent.missing_code": "Es wurde kein Autorisierungscode übergeben",
+    "consent.denied": "Zustimmung bei {provider} fehlgeschlagen: {reason}",
+    "consent.failed": "Autorisierung fehlgeschlagen: {reason}",
+    "consent.internal": "auf unserer Seite ist ein Fehler aufgetreten, bitte versuchen Sie es erneut",
+    "consent.expired": "dieser Anmeldelink ist abgelaufen oder wurde bereits verwendet, starten Sie unter {url} neu",
+    "consent.unknown_invitation": "dieser Onboarding-Link ist ungültig oder wurde zurückgezogen, bitten Sie den Absender um einen neuen",
+    "expired.title": "Dieser Link ist abgelaufen",
+    "expired.message": "Die Freigabe hat länger gedauert, als {provider} erlaubt, oder diese Seite wurde neu geladen. Starten Sie neu, um einen neuen Link zu erhalten.",
+    "expired.retry": "Neu starten",
+    "page.success_title": "Verbindung hergestellt",
+    "page.failure_title": "Etwas ist schiefgelaufen",
+    "connect.title": "Konto verbinden",
+    "connect.intro": "{product} benötigt Zugriff auf Ihre Meetings, um sie aufzuzeichnen. Auf der nächsten Seite werden Sie gebeten, dies zu bestätigen.",
+    "connect.button": "Mit {provider} verbinden",
+  },
+  es: {
+    "consent.connected": "se conectó tu cuenta de Zoom, comprueba que sea la que querías conectar",
+    "consent.account": "cuenta",
+    "consent.email": "correo electrónico",
+    "consent.scopes": "permisos concedidos",
+    "consent.user_id": "ID de usuario",
+    "consent.stored_provider": "se guardó correctamente el token de OAuth de {provider} para el usuario: {user_id}",
+    "consent.slack_linked": "tu cuenta de Slack ya está vinculada al usuario de Zoom {user_id}, puedes volver a Slack y usar /recordmeeting",
+    "consent.missing_code": "no se recibió ningún código de autorización",
+    "consent.denied": "falló el consentimiento de {provider}: {reason}",
+    "consent.failed": "falló la autorización: {reason}",
+    "consent.internal": "algo salió mal de nuestro lado, inténtalo de nuevo",
+    "consent.expired": "este enlace de inicio de sesión caducó o ya se usó, vuelve a empezar en {url}",
+    "consent.unknown_invitation": "este enlace de incorporación no es válido o fue retirado, pide uno nuevo a quien te lo envió",
+    "expired.title": "Este enlace ha caducado",
+    "expired.message": "La aprobación tardó más de lo que {provider} permite, o se recargó esta página. Vuelve a empezar para obtener un enlace nuevo.",
+    "expired.retry": "Volver a empezar",
+    "page.success_title": "Conexión completada",
+    "page.failure_title": "Algo salió mal",
+    "connect.title": "Conecta tu cuenta",
+    "connect.intro": "{product} necesita acceso a tus reuniones para grabarlas. En la página siguiente se te pedirá que lo apruebes.",
+    "connect.button": "Conectar {provider}",
+  },
+  fr: {
+    "consent.connected": "votre compte Zoom est connecté, vérifiez qu'il s'agit bien de celui que vous vouliez connecter",
+    "consent.account": "compte",
+    "consent.email": "e-mail",
+    "consent.scopes": "autorisations accordées",
+    "consent.user_id": "ID utilisateur",
+    "consent.stored_provider": "le jeton OAuth {provider} a bien été enregistré pour l'utilisateur : {user_id}",
+    "consent.slack_linked": "votre compte Slack est maintenant lié à l'utilisateur Zoom {user_id}, vous pouvez revenir sur Slack et utiliser /recordmeeting",
+    "consent.missing_code": "aucun code d'autorisation n'a été fourni",
+    "consent.denied": "le consentement {provider} a échoué : {reason}",
+    "consent.failed": "l'autorisation a échoué : {reason}",
+    "consent.internal": "une erreur s'est produite de notre côté, veuillez réessayer",
+    "consent.expired": "ce lien de connexion a expiré ou a déjà été utilisé, recommencez sur {url}",
+    "consent.unknown_invitation": "ce lien d'intégration n'est pas valide ou a été retiré, demandez-en un nouveau à la personne qui vous l'a envoyé",
+    "expired.title": "Ce lien a expiré",
+    "expired.message": "L'autorisation a pris plus de temps que {provider} ne le permet, ou cette page a été rechargée. Recommencez pour obtenir un nouveau lien.",
+    "expired.retry": "Recommencer",
+    "page.success_title": "Connexion réussie",
+    "page.failure_title": "Une erreur s'est produite",
+    "connect.title": "Connectez votre compte",
+    "connect.intro": "{product} a besoin d'accéder à vos réunions pour les enregistrer. Vous devrez l'autoriser sur la page suivante.",
+    "connect.button": "Connecter {provider}",
+  },
+  ja: {
+    "consent.connected": "Zoom アカウントを接続しました。接続したかったアカウントであることを確認してください",
+    "consent.account": "アカウント",
+    "consent.email": "メールアドレス",
+    "consent.scopes": "許可されたスコープ",
+    "consent.user_id": "ユーザー ID",
+    "consent.stored_provider": "ユーザー {user_id} の {provider} OAuth トークンを保存しました",
+    "consent.slack_linked": "Slack アカウントが Zoom ユーザー {user_id} と連携されました。Slack に戻って /recordmeeting を使用できます",
+    "consent.missing_code": "認可コードが指定されていません",
+    "consent.denied": "{provider} の同意に失敗しました: {reason}",
+    "consent.failed": "認可に失敗しました: {reason}",
+    "consent.internal": "サーバー側で問題が発生しました。もう一度お試しください",
+    "consent.expired": "このサインインリンクは期限切れか、すでに使用されています。{url} からやり直してください",
+    "consent.unknown_invitation": "このオンボーディングリンクは無効か、取り消されています。送信者に新しいリンクを依頼してください",
+    "expired.title": "このリンクは期限切れです",
+    "expired.message": "承認に {provider} の許容時間を超えたか、このページが再読み込みされました。やり直して新しいリンクを取得してください。",
+    "expired.retry": "やり直す",
+    "page.success_title": "接続しました",
+    "page.failure_title": "問題が発生しました",
+    "connect.title": "アカウントを接続",
+    "connect.intro": "{product} が会議を録画するには、会議へのアクセスが必要です。次のページで承認を求められます。",
+    "connect.button": "{provider} を接続",
+  },
+  pt: {
+    "consent.connected": "sua conta do Zoom foi conectada, confira se é a que você queria conectar",
+    "consent.account": "conta",
+    "consent.email": "e-mail",
+    "consent.scopes": "permissões concedidas",
+    "consent.user_id": "ID do usuário",
+    "consent.stored_provider": "token OAuth do {provider} armazenado com sucesso para o usuário: {user_id}",
+    "consent.slack_linked": "sua conta do Slack agora está vinculada ao usuário do Zoom {user_id}, você pode voltar ao Slack e usar /recordmeeting",
+    "consent.missing_code": "nenhum código de autorização foi fornecido",
+    "consent.denied": "o consentimento do {provider} falhou: {reason}",
+    "consent.failed": "a autorização falhou: {reason}",
+    "consent.internal": "algo deu errado do nosso lado, tente novamente",
+    "consent.expired": "este link de acesso expirou ou já foi usado, recomece em {url}",
+    "consent.unknown_invitation": "este link de integração não é válido ou foi retirado, peça um novo a quem o enviou",
+    "expired.title": "Este link expirou",
+    "expired.message": "A aprovação demorou mais do que o {provider} permite, ou esta página foi recarregada. Recomece para obter um novo link.",
+    "expired.retry": "Recomeçar",
+    "page.success_title": "Conta conectada",
+    "page.failure_title": "Algo deu errado",
+    "connect.title": "Conecte sua conta",
+    "connect.intro": "{product} precisa de acesso às suas reuniões para gravá-las. Na próxima página, você precisará aprovar isso.",
+    "connect.button": "Conectar {provider}",
+  },
+};
+
+export function isLocale(value: string): value is Locale {
+  return (LOCALES as readonly string[]).includes(value);
+}
+
+/**
+ * Picks the best supported locale for an Accept-Language header, matching
+ * "pt-BR" to "pt" when there's no exact match. Languages are tried in order
+ * of their q-values; fallback is used when none is supported.
+ */
+export function negotiateLocale(acceptLanguage: string | undefined, fallback: Locale = DEFAULT_LOCALE): Locale {
+  if (!acceptLanguage) return fallback;
+  const ranges = acceptLanguage
+    .split(",")
+    .map((part, index) => {
+      const [tag, ...params] = part.trim().split(";");
+      const q = params.map((param) => param.trim()).find((param) => param.startsWith("q="));
+      return { tag: tag.toLowerCase(), q: q === undefined ? 1 : Number(q.slice(2)) || 0, index };
+    })
+    .filter((range) => range.tag && range.q > 0)
+    .sort((a, b) => b.q - a.q || a.index - b.index);
+  for (const { tag } of ranges) {
+    if (tag === "*") return fallback;
+    const primary = tag.split("-")[0];
+    if (isLocale(primary)) return primary;
+  }
+  return fallback;
+}
+
+/** Returns the message for key in locale with its {placeholders} replaced by params. */
+export function translate(locale: Locale, key: MessageKey, params: Record<string, string> = {}): string {
+  return catalogs[locale][key].replace(/\{(\w+)\}/g, (placeholder, name: string) => params[name] ?? placeholder);
+}
+
+/** Negotiates the locale for req and sets Content-Language on res to match. */
+export function localeFor(req: express.Request, res: express.Response, fallback: Locale = DEFAULT_LOCALE): Locale {
+  const locale = negotiateLocale(req.headers["accept-language"], fallback);
+  res.set("Content-Language", locale);
+  res.vary("Accept-Language");
+  return locale;
+}
@@ -0,0 +1,167 @@
+import { appendFileSync, readFileSync, renameSync, writeFileSync } from "fs";
+import { ConfigError } from "./config.js";
+
+const DEFAULT_MAX_RECORDS = 100000;
+// token requests this soon after a launch by the same user are taken to be that bot's
+export const BOT_LINK_WINDOW_MS = 30 * 60 * 1000;
+
+export interface BotIdentity {
+  at: string;
+  event: "bot.launched" | "token.served";
+  // null when a served token couldn't be tied to a launch
+  bot_id: string | null;
+  user_id: string;
+  zoom_user_id: string | null;
+  meeting_id: string | null;
+  // what was served, e.g. "obf"; only on token.served
+  token_kind?: string;
+  // e.g. "web", "slack", "grpc:<client>" or the caller's IP
+  source: string;
+}
+
+export interface BotIdentityQuery {
+  botId?: string;
+  // matches either the user ID or the Zoom user ID
+  userId?: string;
+  meetingId?: string;
+}
+
+/**
+ * Records which connected user, and so which Zoom identity, each Recall bot
+ * was launched with and whose tokens were served for it. With a path,
+ * records are appended to it as JSON lines and the most recent are read back
+ * at startup, so lookups survive restarts; without one they're only kept in
+ * memory.
+ */
+export class BotIdentityLog {
+  private readonly path: string | undefined;
+  private readonly maxRecords: number;
+  private readonly records: BotIdentity[] = [];
+  // lines in the file, which keeps records memory has already let go of
+  private written = 0;
+
+  constructor(path?: string, maxRecords: number = DEFAULT_MAX_RECORDS) {
+    this.path = path || undefined;
+    this.maxRecords = maxRecords;
+    if (this.path) {
+      this.load(this.path);
+    }
+  }
+
+  launched(entry: { botId: string; userId: string; zoomUserId?: string; meetingId?: string; source: string }): BotIdentity {
+    return this.append({
+      at: new Date().toISOString(),
+      event: "bot.launched",
+      bot_id: entry.botId,
+      user_id: entry.userId,
+      zoom_user_id: entry.zoomUserId ?? null,
+      meeting_id: entry.meetingId ?? null,
+      source: entry.source,
+    });
+  }
+
+  /**
+   * Records a token served for userId, attributed to the bot they launched
+   * for the same meeting within BOT_LINK_WINDOW_MS. Without a meeting ID the
+   * token is only attributed when the user launched exactly one bot in that
+   * window.
+   */
+  served(entry: { kind: string; userId: string; zoomUserId?: string; meetingId?: string; source: string }): BotIdentity {
+    const now = Date.now();
+    const launches = this.records.filter(
+      (record) =>
+        record.event === "bot.launched" &&
+        record.user_id === entry.userId &&
+        now - Date.parse(record.at) <= BOT_LINK_WINDOW_MS &&
+        (entry.meetingId === undefined || record.meeting_id === entry.meetingId),
+    );
+    const launch = entry.meetingId !== undefined || launches.length === 1 ? launches.at(-1) : undefined;
+    return this.append({
+      at: new Date(now).toISOString(),
+      event: "token.served",
+      bot_id: launch?.bot_id ?? null,
+      user_id: entry.userId,
+      zoom_user_id: entry.zoomUserId ?? launch?.zoom_user_id ?? null,
+      meeting_id: entry.meetingId ?? launch?.meeting_id ?? null,
+      token_kind: entry.kind,
+      source: entry.source,
+    });
+  }
+
+  /** Returns the records matching every field of query, newest first. */
+  find(query: BotIdentityQuery, limit: number = this.maxRecords): BotIdentity[] {
+    const { botId, userId, meetingId } = query;
+    return this.records
+      .filter(
+        (record) =>
+          (botId === undefined || record.bot_id === botId) &&
+          (userId === undefined || record.user_id === userId || record.zoom_user_id === userId) &&
+          (meetingId === undefined || record.meeting_id === meetingId),
+      )
+      .slice(-limit)
+      .reverse();
+  }
+
+  /**
+   * Forgets records from before before, in ms since the epoch, and rewrites
+   * the file with only the ones kept; returns how many records were dropped
+   * from memory or the file.
+   */
+  prune(before: number): number {
+    const kept = this.records.findIndex((record) => Date.parse(record.at) >= before);
+    const pruned = this.records.splice(0, kept === -1 ? this.records.length : kept).length;
+    if (!this.path || this.written === this.records.length) return pruned;
+    // synchronous like append, so no record is appended to the file being replaced
+    const dropped = this.written - this.records.length;
+    const temporary = `${this.path}.tmp`;
+    writeFileSync(temporary, this.records.map((record) => `${JSON.stringify(record)}\n`).join(""), { mode: 0o600 });
+    renameSync(temporary, this.path);
+    this.written = this.records.length;
+    return dropped;
+  }
+
+  private append(record: BotIdentity): BotIdentity {
+    this.keep(record);
+    if (this.path) {
+      try {
+        appendFileSync(this.path, `${JSON.stringify(record)}\n`, { mode: 0o600 });
+        this.written++;
+      } catch (error) {
+        console.error(`could not write bot identity to ${this.path}`, error);
+      }
+    }
+    return record;
+  }
+
+  private keep(record: BotIdentity): void {
+    this.records.push(record);
+    if (this.records.length > this.maxRecords) {
+      this.records.shift();
+    }
+  }
+
+  private load(path: string): void {
+    let contents: string;
+    try {
+      contents = readFileSync(path, "utf8");
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read BOT_IDENTITY_LOG ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    let skipped = 0;
+    const lines = contents.split("\n");
+    this.written = lines.filter((line) => line.trim()).length;
+    for (const line of lines.slice(-this.maxRecords - 1)) {
+      if (!line.trim()) continue;
+      try {
+        this.keep(JSON.parse(line) as BotIdentity);
+      } catch {
+        // e.g. a line cut short by a crash mid-write
+        skipped++;
+      }
+    }
+    if (skipped > 0) {
+      console.warn(`skipped ${skipped} unreadable line(s) in ${path}`);
+    }
+  }
+}
@@ -0,0 +1,123 @@
+import { appendFileSync, readFileSync, renameSync, writeFileSync } from "fs";
+import { ConfigError } from "./config.js";
+
+export type JobKind = "webhook.delivery" | "waiting_room.restore";
+
+export interface Job {
+  id: string;
+  kind: JobKind;
+  // when the job should run next
+  due_at: string;
+  payload: Record<string, unknown>;
+}
+
+interface JobRecord extends Job {
+  at: string;
+  state: "pending" | "done";
+}
+
+/**
+ * Remembers background jobs that are waiting to run, so that ones
+ * interrupted by a restart are picked back up. With a path, every change is
+ * appended to it as a JSON line and at startup the file is read back and
+ * rewritten with only the jobs still pending; without one the journal
+ * forgets everything, like the jobs' own timers.
+ */
+export class JobJournal {
+  readonly path: string | undefined;
+  private readonly jobs = new Map<string, Job>();
+  // lines in the file, of which only those of pending jobs are still needed
+  private written = 0;
+
+  constructor(path?: string) {
+    this.path = path || undefined;
+    if (this.path) {
+      this.load(this.path);
+    }
+  }
+
+  /** Records job as pending, replacing what was recorded for its ID before. */
+  schedule(job: Job): void {
+    if (!this.path) return;
+    this.jobs.set(job.id, job);
+    this.append({ at: new Date().toISOString(), state: "pending", ...job });
+  }
+
+  /** Records that the job with id ran, or won't run again. */
+  done(id: string): void {
+    const job = this.jobs.get(id);
+    if (!job) return;
+    this.jobs.delete(id);
+    this.append({ at: new Date().toISOString(), state: "done", ...job });
+  }
+
+  /** The jobs of kind still pending, oldest first. */
+  pending(kind: JobKind): Job[] {
+    return [...this.jobs.values()].filter((job) => job.kind === kind);
+  }
+
+  /** Rewrites the file with only the jobs still pending; returns how many records of finished or rescheduled jobs were dropped. */
+  compact(): number {
+    if (!this.path || this.written === this.jobs.size) return 0;
+    const dropped = this.written - this.jobs.size;
+    this.rewrite(this.path);
+    return dropped;
+  }
+
+  private append(record: JobRecord): void {
+    try {
+      appendFileSync(this.path!, `${JSON.stringify(record)}\n`, { mode: 0o600 });
+      this.written++;
+    } catch (error) {
+      console.error(`could not write job ${record.id} to ${this.path}`, error);
+    }
+  }
+
+  private load(path: string): void {
+    let contents: string;
+    try {
+      contents = readFileSync(path, "utf8");
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read JOB_JOURNAL ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    let skipped = 0;
+    for (const line of contents.split("\n")) {
+      if (!line.trim()) continue;
+      let record: JobRecord;
+      try {
+        record = JSON.parse(line) as JobRecord;
+      } catch {
+        // e.g. a line cut short by a crash mid-write
+        skipped++;
+        continue;
+      }
+      const { at: _at, state, ...job } = record;
+      if (state === "done") this.jobs.delete(job.id);
+      else this.jobs.set(job.id, job);
+    }
+    if (skipped > 0) {
+      console.warn(`skipped ${skipped} unreadable line(s) in ${path}`);
+    }
+
+    // keeps the file from growing with jobs that finished long ago
+    try {
+      this.rewrite(path);
+    } catch (error) {
+      throw new ConfigError(`could not rewrite JOB_JOURNAL ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    if (this.jobs.size > 0) {
+      console.log(`resuming ${this.jobs.size} interrupted job(s) from ${path}`);
+    }
+  }
+
+  // synchronous like append, so no record is appended to the file being replaced
+  private rewrite(path: string): void {
+    const now = new Date().toISOString();
+    const lines = [...this.jobs.values()].map((job) => `${JSON.stringify({ at: now, state: "pending", ...job })}\n`);
+    const temporary = `${path}.tmp`;
+    writeFileSync(temporary, lines.join(""), { mode: 0o600 });
+    renameSync(temporary, path);
+    this.written = lines.length;
+  }
+}
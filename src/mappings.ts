@@ -0,0 +1,111 @@
+import { readFileSync, renameSync, writeFileSync } from "fs";
+import { ConfigError } from "./config.js";
+import type { UserMapper } from "./zoomrecall/index.js";
+
+export const USER_MAPPING_KINDS = ["bot", "metadata", "host"] as const;
+export type UserMappingKind = (typeof USER_MAPPING_KINDS)[number];
+
+/** Which connected user a Recall bot's callbacks are served as. */
+export interface UserMapping {
+  kind: UserMappingKind;
+  // a bot ID, a key=value of the metadata bots are created with, or the meeting host's Zoom user ID or email
+  match: string;
+  user_id: string;
+  created_at: string;
+}
+
+/** The match a mapping of kind is kept under, or an error message when it can't be one; emails are compared lowercased. */
+export function normalizeMappingMatch(kind: UserMappingKind, match: string): string | { error: string } {
+  const trimmed = match.trim();
+  if (!trimmed) return { error: "match must not be empty" };
+  if (kind === "metadata" && !/^[^=]+=.+$/.test(trimmed)) {
+    return { error: `metadata mappings match a key=value, not ${trimmed}` };
+  }
+  return kind === "host" && trimmed.includes("@") ? trimmed.toLowerCase() : trimmed;
+}
+
+/**
+ * Mappings from what Recall tells the callbacks about a bot to the
+ * connected user whose tokens it is served: its bot ID, a key and value of
+ * the metadata it was created with, or the Zoom user hosting its meeting.
+ * A bot ID wins over metadata, and both over the host; with a path,
+ * mappings are written to it as one JSON document and read back at startup.
+ */
+export class UserMappings implements UserMapper {
+  private readonly path: string | undefined;
+  private readonly mappings = new Map<string, UserMapping>();
+
+  constructor(options: { path?: string } = {}) {
+    this.path = options.path || undefined;
+    if (this.path) {
+      this.load(this.path);
+    }
+  }
+
+  /** Maps match, already normalized, to userId, replacing any earlier mapping of it. */
+  set(kind: UserMappingKind, match: string, userId: string): UserMapping {
+    const mapping: UserMapping = { kind, match, user_id: userId, created_at: new Date().toISOString() };
+    this.mappings.set(`${kind}:${match}`, mapping);
+    this.save();
+    return mapping;
+  }
+
+  get(kind: UserMappingKind, match: string): UserMapping | undefined {
+    return this.mappings.get(`${kind}:${match}`);
+  }
+
+  /** Returns every mapping, or userId's, by kind and match. */
+  list(userId?: string): UserMapping[] {
+    return [...this.mappings.values()]
+      .filter((mapping) => userId === undefined || mapping.user_id === userId)
+      .sort((a, b) => a.kind.localeCompare(b.kind) || a.match.localeCompare(b.match));
+  }
+
+  /** Removes the mapping of match; false if there was none. */
+  remove(kind: UserMappingKind, match: string): boolean {
+    if (!this.mappings.delete(`${kind}:${match}`)) return false;
+    this.save();
+    return true;
+  }
+
+  userForBot(botId: string | undefined, metadata: Record<string, string>): string | undefined {
+    if (botId !== undefined) {
+      const mapped = this.get("bot", botId);
+      if (mapped) return mapped.user_id;
+    }
+    for (const [key, value] of Object.entries(metadata).sort(([a], [b]) => a.localeCompare(b))) {
+      const mapped = this.get("metadata", `${key}=${value}`);
+      if (mapped) return mapped.user_id;
+    }
+    return undefined;
+  }
+
+  userForHost(zoomUserId: string, email: string | undefined): string | undefined {
+    return (this.get("host", zoomUserId) ?? (email ? this.get("host", email.toLowerCase()) : undefined))?.user_id;
+  }
+
+  private save(): void {
+    if (!this.path) return;
+    try {
+      const temporary = `${this.path}.tmp`;
+      writeFileSync(temporary, `${JSON.stringify({ version: 1, mappings: [...this.mappings.values()] }, null, 2)}\n`, { mode: 0o600 });
+      renameSync(temporary, this.path);
+    } catch (error) {
+      console.error(`could not write user mappings to ${this.path}`, error);
+    }
+  }
+
+  private load(path: string): void {
+    let contents: { version: number; mappings: UserMapping[] };
+    try {
+      contents = JSON.parse(readFileSync(path, "utf8")) as { version: number; mappings: UserMapping[] };
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read USER_MAPPINGS_FILE ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    if (contents.version !== 1 || !Array.isArray(contents.mappings)) {
+      throw new ConfigError(`USER_MAPPINGS_FILE ${path} does not hold version 1 user mappings`);
+    }
+    for (const mapping of contents.mappings) this.mappings.set(`${mapping.kind}:${mapping.match}`, mapping);
+  }
+}
@@ -0,0 +1,168 @@
+import type { Config } from "./config.js";
+import { openSqlite, setSqliteSchemaVersion, SQLITE_MIGRATIONS, sqliteSchemaVersion } from "./zoomrecall/index.js";
+import type { TokenStore } from "./zoomrecall/index.js";
+
+// the providers the server's token managers keep users under
+export const STORE_PROVIDERS = ["zoom", "microsoft", "google"] as const;
+
+export interface Migration {
+  version: number;
+  description: string;
+  up(): Promise<void>;
+  down(): Promise<void>;
+}
+
+/**
+ * A persistent backend with a versioned schema. Versions start at 0 (empty)
+ * and migrations are applied in version order.
+ */
+export interface SchemaBackend {
+  name: string;
+  migrations: Migration[];
+  currentVersion(): Promise<number>;
+  // records the version after a migration step; called inside the same unit of work where the backend supports it
+  setVersion(version: number): Promise<void>;
+  close(): Promise<void>;
+}
+
+export interface MigrationStatus {
+  current: number;
+  latest: number;
+  pending: Migration[];
+}
+
+export class MigrationError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "MigrationError";
+  }
+}
+
+function sorted(backend: SchemaBackend): Migration[] {
+  return [...backend.migrations].sort((a, b) => a.version - b.version);
+}
+
+export async function migrationStatus(backend: SchemaBackend): Promise<MigrationStatus> {
+  const migrations = sorted(backend);
+  const current = await backend.currentVersion();
+  return {
+    current,
+    latest: migrations.at(-1)?.version ?? 0,
+    pending: migrations.filter((migration) => migration.version > current),
+  };
+}
+
+/** Applies pending migrations up to and including target (the latest by default). */
+export async function migrateUp(backend: SchemaBackend, target?: number): Promise<Migration[]> {
+  const { current, latest, pending } = await migrationStatus(backend);
+  const to = target ?? latest;
+  if (to < current) {
+    throw new MigrationError(`${backend.name} is at version ${current}, use down to go back to ${to}`);
+  }
+  if (to > latest) {
+    throw new MigrationError(`${backend.name} has no migration ${to}, the latest is ${latest}`);
+  }
+
+  const applied: Migration[] = [];
+  for (const migration of pending.filter((candidate) => candidate.version <= to)) {
+    await migration.up();
+    await backend.setVersion(migration.version);
+    applied.push(migration);
+  }
+  return applied;
+}
+
+/** Reverts applied migrations until the schema is at target (one step back by default). */
+export async function migrateDown(backend: SchemaBackend, target?: number): Promise<Migration[]> {
+  const migrations = sorted(backend);
+  const current = await backend.currentVersion();
+  const applied = migrations.filter((migration) => migration.version <= current).reverse();
+  const to = target ?? applied[1]?.version ?? 0;
+  if (to > current) {
+    throw new MigrationError(`${backend.name} is at version ${current}, use up to go forward to ${to}`);
+  }
+
+  const reverted: Migration[] = [];
+  for (const [index, migration] of applied.entries()) {
+    if (migration.version <= to) break;
+    await migration.down();
+    await backend.setVersion(applied[index + 1]?.version ?? 0);
+    reverted.push(migration);
+  }
+  return reverted;
+}
+
+export interface StoreCopyResult {
+  // users per provider, of those found in the source
+  copied: Record<string, number>;
+  // already in the destination and left alone
+  skipped: Record<string, number>;
+}
+
+/**
+ * Copies every user of every provider from one token store to another, e.g.
+ * from the file store to Redis, so moving backends doesn't take new
+ * consents. Users the destination already has are left alone unless
+ * overwrite is set; with dryRun nothing is written.
+ */
+export async function copyTokenStore(
+  from: TokenStore,
+  to: TokenStore,
+  options: { overwrite?: boolean; dryRun?: boolean } = {},
+): Promise<StoreCopyResult> {
+  const result: StoreCopyResult = { copied: {}, skipped: {} };
+  for (const provider of STORE_PROVIDERS) {
+    result.copied[provider] = 0;
+    result.skipped[provider] = 0;
+    for (const user of await from.list(provider)) {
+      if (!options.overwrite && (await to.get(provider, user.userId))) {
+        result.skipped[provider]++;
+        continue;
+      }
+      if (!options.dryRun) await to.save(provider, user);
+      result.copied[provider]++;
+    }
+  }
+  return result;
+}
+
+/**
+ * Returns the schema backend for the configured token store, or null when the
+ * store keeps no persistent schema.
+ */
+export function schemaBackendFor(config: Config): SchemaBackend | null {
+  // neither the memory store nor the JSON file store has a schema; stores that do register here as they are added
+  if (config.tokenStore === "sqlite") {
+    return sqliteSchemaBackend(config.tokenStorePath);
+  }
+  return null;
+}
+
+// each step and its version update commit together, so a failed step leaves the schema where it was
+function sqliteSchemaBackend(path: string): SchemaBackend {
+  const db = openSqlite(path);
+  const step = (sql: string) => async () => {
+    db.exec("BEGIN IMMEDIATE");
+    try {
+      db.exec(sql);
+    } catch (error) {
+      db.exec("ROLLBACK");
+      throw error;
+    }
+  };
+  return {
+    name: `sqlite ${path}`,
+    migrations: SQLITE_MIGRATIONS.map((migration) => ({
+      version: migration.version,
+      description: migration.description,
+      up: step(migration.up),
+      down: step(migration.down),
+    })),
+    currentVersion: async () => sqliteSchemaVersion(db),
+    setVersion: async (version) => {
+      setSqliteSchemaVersion(db, version);
+      db.exec("COMMIT");
+    },
+    close: async () => db.close(),
+  };
+}
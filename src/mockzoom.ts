@@ -0,0 +1,331 @@
+import { createHash, randomBytes } from "crypto";
+import express from "express";
+
+// every mock user belongs to the same Zoom account
+export const MOCK_ACCOUNT_ID = "mock-account";
+
+export interface MockZoomOptions {
+  clientId: string;
+  clientSecret: string;
+  // further OAuth apps the mock accepts, as if published from the same account
+  otherApps?: { clientId: string; clientSecret: string }[];
+}
+
+export interface MockZoomState {
+  accessTokens: Set<string>;
+  refreshTokens: Set<string>;
+  // code to the Zoom user consenting again with it, or null for a new one
+  authCodes: Map<string, string | null>;
+  // the latest access token issued to the clientId app, otherApps' don't change it
+  latestAccessToken: string | undefined;
+  refreshCount: number;
+  // zoomUserId is whom the token was minted for
+  issuedTokens: { type: string; token: string; zoomUserId: string }[];
+  revokedTokens: Set<string>;
+  // keyed by zoom user ID; every authorization code exchange creates a user, unless consent named a returning one
+  users: Map<string, { id: string; email: string; account_id: string; status: string; timezone: string; display_name?: string; pmi?: number; vanity_url?: string }>;
+  // access and refresh tokens to the zoom user ID they belong to
+  tokenUsers: Map<string, string>;
+  // access and refresh tokens to the client ID of the app they were issued to
+  tokenClients: Map<string, string>;
+  // access tokens of the account's server-to-server app, which act for any of its users
+  accountTokens: Set<string>;
+  // zoom user IDs of account admins, whose tokens act for any user of their account too
+  admins: Set<string>;
+  // meeting ID to its host's zoom user ID; any valid token can read any meeting, like an admin's
+  meetings: Map<string, string>;
+  // meeting ID to its passcode, for the meetings that have one
+  passcodes: Map<string, string>;
+  // meeting ID to the occurrences of recurring meetings; the others are scheduled meetings
+  occurrences: Map<string, { occurrence_id: string; start_time: string; duration: number; status: string }[]>;
+  // waiting room settings changed through the API, by meeting ID
+  waitingRooms: Map<string, boolean>;
+  // participants admitted from waiting rooms through the API, by meeting ID
+  admittedParticipants: Map<string, string[]>;
+  // set to simulate an account without the on-behalf-of token feature
+  obfDisabled: boolean;
+  // the scope field of issued tokens; change it to simulate edited app scopes
+  scope: string;
+  // every User-Agent the token and REST endpoints were called with; /oauth/authorize is a browser's
+  userAgents: Set<string>;
+}
+
+function randomToken(prefix: string): string {
+  return `${prefix}_${randomBytes(12).toString("hex")}`;
+}
+
+/**
+ * A minimal stand-in for the Zoom OAuth and REST endpoints this server calls.
+ * Mount it at the root; the OAuth endpoints live under /oauth and the REST
+ * API under /v2.
+ */
+export function createMockZoom(options: MockZoomOptions): { app: express.Express; state: MockZoomState } {
+  const state: MockZoomState = {
+    accessTokens: new Set(),
+    refreshTokens: new Set(),
+    authCodes: new Map(),
+    latestAccessToken: undefined,
+    refreshCount: 0,
+    issuedTokens: [],
+    revokedTokens: new Set(),
+    users: new Map(),
+    tokenUsers: new Map(),
+    tokenClients: new Map(),
+    accountTokens: new Set(),
+    admins: new Set(),
+    meetings: new Map(),
+    passcodes: new Map(),
+    occurrences: new Map(),
+    waitingRooms: new Map(),
+    admittedParticipants: new Map(),
+    obfDisabled: false,
+    scope: "user:read:zak user:read:token",
+    userAgents: new Set(),
+  };
+  // the Authorization header each app's client calls with, to its client ID
+  const clients = new Map(
+    [{ clientId: options.clientId, clientSecret: options.clientSecret }, ...(options.otherApps ?? [])].map(({ clientId, clientSecret }) => [
+      `Basic ${Buffer.from(`${clientId}:${clientSecret}`).toString("base64")}`,
+      clientId,
+    ]),
+  );
+  const clientIds = new Set(clients.values());
+  // authorization code to the client ID of the app consented to
+  const codeClients = new Map<string, string>();
+  // the S256 PKCE challenge a code was requested with, which its exchange has to answer
+  const codeChallenges = new Map<string, string>();
+
+  function issueTokens(res: express.Response, zoomUserId: string, clientId: string): void {
+    const accessToken = randomToken("access");
+    const refreshToken = randomToken("refresh");
+    state.accessTokens.add(accessToken);
+    state.refreshTokens.add(refreshToken);
+    state.tokenUsers.set(accessToken, zoomUserId);
+    state.tokenUsers.set(refreshToken, zoomUserId);
+    state.tokenClients.set(accessToken, clientId);
+    state.tokenClients.set(refreshToken, clientId);
+    if (clientId === options.clientId) state.latestAccessToken = accessToken;
+    res.json({
+      access_token: accessToken,
+      token_type: "bearer",
+      refresh_token: refreshToken,
+      expires_in: 3600,
+      scope: state.scope,
+      api_url: "https://api.zoom.us",
+    });
+  }
+
+  const app = express();
+  app.use((req, _res, next) => {
+    if (req.path !== "/oauth/authorize") state.userAgents.add(req.headers["user-agent"] ?? "");
+    next();
+  });
+  app.use(express.urlencoded({ extended: true }));
+
+  app.get("/oauth/authorize", (req, res) => {
+    const redirectUri = req.query.redirect_uri as string | undefined;
+    if (!clientIds.has(req.query.client_id as string) || !redirectUri) {
+      res.status(400).json({ reason: "Invalid client_id or redirect_uri", error: "invalid_request" });
+      return;
+    }
+    if (req.query.code_challenge !== undefined && req.query.code_challenge_method !== "S256") {
+      res.status(400).json({ reason: "Unsupported code_challenge_method", error: "invalid_request" });
+      return;
+    }
+    const code = randomToken("code");
+    // not Zoom's: lets a check consent again as a Zoom user it already connected
+    const returning = typeof req.query.zoom_user === "string" && state.users.has(req.query.zoom_user) ? req.query.zoom_user : null;
+    state.authCodes.set(code, returning);
+    codeClients.set(code, req.query.client_id as string);
+    if (typeof req.query.code_challenge === "string") codeChallenges.set(code, req.query.code_challenge);
+    const location = new URL(redirectUri);
+    location.searchParams.set("code", code);
+    if (typeof req.query.state === "string") {
+      location.searchParams.set("state", req.query.state);
+    }
+    res.redirect(location.toString());
+  });
+
+  app.post("/oauth/token", (req, res) => {
+    const clientId = clients.get(req.headers.authorization ?? "");
+    if (!clientId) {
+      res.status(401).json({ reason: "Invalid client_id or client_secret", error: "invalid_client" });
+      return;
+    }
+
+    if (req.body.grant_type === "authorization_code") {
+      const returning = state.authCodes.get(req.body.code);
+      const challenge = codeChallenges.get(req.body.code);
+      const verified = challenge === undefined || (typeof req.body.code_verifier === "string" && createHash("sha256").update(req.body.code_verifier).digest("base64url") === challenge);
+      // a code is only good for the app it was issued to, and with the verifier of its challenge
+      if (codeClients.get(req.body.code) !== clientId || !verified || !state.authCodes.delete(req.body.code)) {
+        res.status(400).json({ reason: verified ? "Invalid authorization code" : "Invalid code verifier", error: "invalid_grant" });
+        return;
+      }
+      codeClients.delete(req.body.code);
+      codeChallenges.delete(req.body.code);
+      const zoomUserId = returning ?? randomToken("zoomuser");
+      if (!returning) {
+        state.users.set(zoomUserId, { id: zoomUserId, email: `${zoomUserId}@example.com`, account_id: MOCK_ACCOUNT_ID, status: "active", timezone: "America/New_York", display_name: `Mock ${zoomUserId}`, pmi: 9000000001 + state.users.size });
+      }
+      issueTokens(res, zoomUserId, clientId);
+      return;
+    }
+
+    if (req.body.grant_type === "account_credentials") {
+      if (req.body.account_id !== MOCK_ACCOUNT_ID) {
+        res.status(400).json({ reason: "Invalid account_id", error: "invalid_request" });
+        return;
+      }
+      const accessToken = randomToken("account");
+      state.accessTokens.add(accessToken);
+      state.accountTokens.add(accessToken);
+      res.json({ access_token: accessToken, token_type: "bearer", expires_in: 3600, scope: "user:read:admin user:read:token:admin user:read:zak:admin meeting:read:admin", api_url: "https://api.zoom.us" });
+      return;
+    }
+
+    if (req.body.grant_type === "refresh_token") {
+      if (state.tokenClients.get(req.body.refresh_token) !== clientId || !state.refreshTokens.delete(req.body.refresh_token)) {
+        res.status(400).json({ reason: "Invalid Token!", error: "invalid_grant" });
+        return;
+      }
+      state.refreshCount++;
+      issueTokens(res, state.tokenUsers.get(req.body.refresh_token) ?? "", clientId);
+      return;
+    }
+
+    res.status(400).json({ reason: "Unsupported grant type", error: "unsupported_grant_type" });
+  });
+
+  app.post("/oauth/revoke", (req, res) => {
+    if (!clients.has(req.headers.authorization ?? "")) {
+      res.status(401).json({ reason: "Invalid client_id or client_secret", error: "invalid_client" });
+      return;
+    }
+    if (!state.accessTokens.delete(req.body.token)) {
+      res.status(400).json({ reason: "Invalid Token!", error: "invalid_request" });
+      return;
+    }
+    state.revokedTokens.add(req.body.token);
+    res.json({ status: "success" });
+  });
+
+  // "me" is the token's own user; account and admin tokens name any user of the account by ID or email
+  function userOf(accessToken: string, zoomUserId: string) {
+    const own = state.users.get(state.tokenUsers.get(accessToken) ?? "");
+    if (zoomUserId === "me") return own;
+    const user = state.users.get(zoomUserId) ?? [...state.users.values()].find((candidate) => candidate.email === zoomUserId);
+    if (state.accountTokens.has(accessToken)) return user;
+    return own && state.admins.has(own.id) && user?.account_id === own.account_id ? user : undefined;
+  }
+
+  app.get("/v2/users/:userId", (req, res) => {
+    const accessToken = req.headers.authorization?.replace(/^Bearer /, "");
+    if (!accessToken || !state.accessTokens.has(accessToken)) {
+      res.status(401).json({ code: 124, message: "Invalid access token." });
+      return;
+    }
+    const user = userOf(accessToken, req.params.userId);
+    if (!user) {
+      res.status(404).json({ code: 1001, message: "User does not exist." });
+      return;
+    }
+    res.json(user);
+  });
+
+  app.get("/v2/meetings/:meetingId", (req, res) => {
+    const accessToken = req.headers.authorization?.replace(/^Bearer /, "");
+    if (!accessToken || !state.accessTokens.has(accessToken)) {
+      res.status(401).json({ code: 124, message: "Invalid access token." });
+      return;
+    }
+    // a Personal Meeting ID is its owner's meeting
+    const personal = [...state.users.values()].find((user) => String(user.pmi) === req.params.meetingId);
+    const hostId = state.meetings.get(req.params.meetingId) ?? personal?.id;
+    if (!hostId) {
+      res.status(404).json({ code: 3001, message: "Meeting does not exist." });
+      return;
+    }
+    res.json({
+      id: Number(req.params.meetingId),
+      host_id: hostId,
+      host_email: state.users.get(hostId)?.email,
+      topic: "Mock meeting",
+      type: personal ? 4 : state.occurrences.has(req.params.meetingId) ? 8 : 2,
+      occurrences: state.occurrences.get(req.params.meetingId),
+      status: "waiting",
+      start_time: "2030-01-01T15:00:00Z",
+      timezone: "UTC",
+      duration: 30,
+      password: state.passcodes.get(req.params.meetingId) ?? "",
+      settings: { approval_type: 2, waiting_room: true, join_before_host: false },
+    });
+  });
+
+  app.patch("/v2/meetings/:meetingId", express.json(), (req, res) => {
+    const accessToken = req.headers.authorization?.replace(/^Bearer /, "");
+    if (!accessToken || !state.accessTokens.has(accessToken)) {
+      res.status(401).json({ code: 124, message: "Invalid access token." });
+      return;
+    }
+    if (!state.meetings.has(req.params.meetingId)) {
+      res.status(404).json({ code: 3001, message: "Meeting does not exist." });
+      return;
+    }
+    const waitingRoom = req.body?.settings?.waiting_room;
+    if (typeof waitingRoom === "boolean") {
+      state.waitingRooms.set(req.params.meetingId, waitingRoom);
+    }
+    res.status(204).end();
+  });
+
+  app.patch("/v2/live_meetings/:meetingId/participants/:participantId/status", express.json(), (req, res) => {
+    const accessToken = req.headers.authorization?.replace(/^Bearer /, "");
+    if (!accessToken || !state.accessTokens.has(accessToken)) {
+      res.status(401).json({ code: 124, message: "Invalid access token." });
+      return;
+    }
+    if (!state.meetings.has(req.params.meetingId)) {
+      res.status(404).json({ code: 3001, message: "Meeting does not exist." });
+      return;
+    }
+    if (req.body?.action !== "admit") {
+      res.status(400).json({ code: 300, message: "Invalid action." });
+      return;
+    }
+    const admitted = state.admittedParticipants.get(req.params.meetingId) ?? [];
+    state.admittedParticipants.set(req.params.meetingId, [...admitted, req.params.participantId]);
+    res.status(204).end();
+  });
+
+  app.get("/v2/users/:userId/token", (req, res) => {
+    const accessToken = req.headers.authorization?.replace(/^Bearer /, "");
+    if (!accessToken || !state.accessTokens.has(accessToken)) {
+      res.status(401).json({ code: 124, message: "Invalid access token." });
+      return;
+    }
+    const user = req.params.userId === "me" ? undefined : userOf(accessToken, req.params.userId);
+    if (req.params.userId !== "me" && !user) {
+      res.status(404).json({ code: 1001, message: "User does not exist." });
+      return;
+    }
+    const type = req.query.type as string | undefined;
+    if (type !== "zak" && type !== "onbehalf") {
+      res.status(400).json({ code: 300, message: "Invalid token type." });
+      return;
+    }
+    if (type === "onbehalf" && state.obfDisabled) {
+      res.status(400).json({ code: 300, message: "The on-behalf-of token is not enabled for this account." });
+      return;
+    }
+    if (type === "onbehalf" && req.query.meeting_id !== undefined && !/^\d+$/.test(String(req.query.meeting_id))) {
+      res.status(404).json({ code: 3001, message: "Meeting does not exist." });
+      return;
+    }
+    const token = randomToken(type);
+    state.issuedTokens.push({ type, token, zoomUserId: user?.id ?? state.tokenUsers.get(accessToken) ?? "" });
+    res.json({ token });
+  });
+
+  return { app, state };
+}
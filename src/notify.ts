@@ -0,0 +1,258 @@
+import { randomUUID } from "crypto";
+import { READY_STATES } from "./health.js";
+import type { HealthState } from "./health.js";
+import { sendMail } from "./smtp.js";
+import { DEFAULT_TIME_ZONE, formatTime, formatTimestamp } from "./timezone.js";
+import type { WebhookEvent, WebhookEventType } from "./webhooks.js";
+import type { HttpClient } from "./zoomrecall/index.js";
+
+export const NOTIFIER_NAMES = ["webhook", "slack", "email", "pagerduty"] as const;
+export type NotifierName = (typeof NOTIFIER_NAMES)[number];
+
+export const DEFAULT_PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/v2/enqueue";
+
+/**
+ * A destination for events. Adding one means implementing this and giving
+ * it a name NOTIFY_ROUTES can refer to; the places events are emitted from
+ * don't change.
+ */
+export interface Notifier {
+  readonly name: string;
+  send(event: WebhookEvent): Promise<void>;
+  close?(): void;
+}
+
+// event type, or "*" for every type without an entry of its own, to the names of the notifiers it goes to
+export type NotifyRoutes = Record<string, string[]>;
+
+export const DEFAULT_NOTIFY_ROUTES: NotifyRoutes = { "*": ["webhook"] };
+
+/** One line saying what happened, for people rather than programs, with times in timeZone. */
+export function describeEvent(event: WebhookEvent, timeZone: string = DEFAULT_TIME_ZONE): string {
+  const data = event.data;
+  const who = `${String(data.provider ?? "zoom")} user ${String(data.user_id)}`;
+  switch (event.type) {
+    case "health.changed":
+      return `health changed from ${String(data.from)} to ${String(data.to)}${
+        Array.isArray(data.reasons) && data.reasons.length > 0 ? `: ${data.reasons.join("; ")}` : ""
+      }`;
+    case "token.refreshed":
+      return `${who} refreshed, expires at ${formatTimestamp(data.expires_at, timeZone)}`;
+    case "token.reauthorization_required":
+      return `${who} has to authorize again: ${String(data.reason)}`;
+    case "token.deactivated":
+      return `${who} was deactivated: ${String(data.reason)}`;
+    case "token.scopes_narrowed":
+      return `${who} lost scopes ${Array.isArray(data.missing_scopes) ? data.missing_scopes.join(", ") : ""}`;
+    case "token.reauthorization_due":
+      return `${who} will have to authorize again by ${formatTimestamp(data.due_at, timeZone)}`;
+    case "token.served":
+      return `${String(data.token_kind)} token served as user ${String(data.user_id)}${data.bot_id ? ` for bot ${String(data.bot_id)}` : ""}${
+        data.meeting_id ? ` in meeting ${String(data.meeting_id)}` : ""
+      }`;
+    case "issuance.anomaly":
+      return `${String(data.count)} ${String(data.kind)} token requests for ${
+        data.meeting_id ? `meeting ${String(data.meeting_id)}` : `user ${String(data.user_id)}`
+      } within an hour of ${formatTimestamp(data.window_started_at, timeZone)}`;
+    case "canary.triggered":
+      return `canary token ${String(data.label)} was used on ${String(data.path)} from ${String(data.ip)}${
+        data.user_agent ? ` (${String(data.user_agent)})` : ""
+      }, wherever it was planted has leaked`;
+    case "bot.launched":
+      return `bot ${String(data.bot_id)} launched for ${String(data.meeting_url)} as user ${String(data.user_id)}`;
+    case "bot.done":
+      return `bot ${String(data.bot_id)} is done`;
+    case "transcript.ready":
+      return `transcript of bot ${String(data.bot_id)} is ready`;
+    case "recording.completed":
+      return `zoom recording of meeting ${String(data.meeting_id)}${data.topic ? ` (${String(data.topic)})` : ""} by user ${String(data.user_id)} is ready, ${String(data.file_count)} file(s)`;
+  }
+}
+
+/** Posts a one-line summary of each event to a Slack incoming webhook. */
+export class SlackNotifier implements Notifier {
+  readonly name = "slack";
+  private readonly webhookUrl: string;
+  private readonly httpClient: HttpClient;
+  private readonly timeZone: string;
+
+  constructor(webhookUrl: string, httpClient: HttpClient, timeZone: string = DEFAULT_TIME_ZONE) {
+    this.webhookUrl = webhookUrl;
+    this.httpClient = httpClient;
+    this.timeZone = timeZone;
+  }
+
+  async send(event: WebhookEvent): Promise<void> {
+    const response = await this.httpClient(this.webhookUrl, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ text: `*${event.type}*: ${describeEvent(event, this.timeZone)}` }),
+    });
+    if (!response.ok) {
+      throw new Error(`slack answered ${response.status}: ${await response.text()}`);
+    }
+  }
+}
+
+export interface EmailNotifierOptions {
+  // smtp:// or smtps:// with credentials, see sendMail
+  smtpUrl: string;
+  from: string;
+  to: string[];
+  timeZone?: string;
+}
+
+/** Mails each event, its summary as the subject and its data in the body. */
+export class EmailNotifier implements Notifier {
+  readonly name = "email";
+  private readonly options: EmailNotifierOptions;
+
+  constructor(options: EmailNotifierOptions) {
+    this.options = options;
+  }
+
+  async send(event: WebhookEvent): Promise<void> {
+    const { smtpUrl, from, to, timeZone = DEFAULT_TIME_ZONE } = this.options;
+    const summary = describeEvent(event, timeZone);
+    const at = formatTime(new Date(event.created_at), timeZone);
+    await sendMail(smtpUrl, {
+      from,
+      to,
+      subject: `[zoom oauth] ${summary}`,
+      text: `${summary}\n\nevent: ${event.type}\nid: ${event.id}\nat: ${at} (${event.created_at})\n\n${JSON.stringify(event.data, null, 2)}\n`,
+    });
+  }
+}
+
+export interface PagerDutyNotifierOptions {
+  routingKey: string;
+  // shown as the alert's source, e.g. BASE_URL
+  source: string;
+  httpClient: HttpClient;
+  eventsUrl?: string;
+}
+
+/**
+ * Raises PagerDuty incidents through the Events API v2. Events about the
+ * same thing share a dedup key, so repeats update one incident, and health
+ * returning to OK resolves the incident its earlier changes raised.
+ */
+export class PagerDutyNotifier implements Notifier {
+  readonly name = "pagerduty";
+  private readonly routingKey: string;
+  private readonly source: string;
+  private readonly httpClient: HttpClient;
+  private readonly eventsUrl: string;
+
+  constructor(options: PagerDutyNotifierOptions) {
+    this.routingKey = options.routingKey;
+    this.source = options.source;
+    this.httpClient = options.httpClient;
+    this.eventsUrl = options.eventsUrl ?? DEFAULT_PAGERDUTY_EVENTS_URL;
+  }
+
+  async send(event: WebhookEvent): Promise<void> {
+    const resolved = event.type === "health.changed" && event.data.to === "OK";
+    const body = resolved
+      ? { routing_key: this.routingKey, event_action: "resolve", dedup_key: dedupKey(event) }
+      : {
+          routing_key: this.routingKey,
+          event_action: "trigger",
+          dedup_key: dedupKey(event),
+          payload: {
+            summary: describeEvent(event),
+            source: this.source,
+            severity: severity(event),
+            timestamp: event.created_at,
+            class: event.type,
+            custom_details: event.data,
+          },
+        };
+    const response = await this.httpClient(this.eventsUrl, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(body),
+    });
+    if (!response.ok) {
+      throw new Error(`pagerduty answered ${response.status}: ${await response.text()}`);
+    }
+  }
+}
+
+function dedupKey(event: WebhookEvent): string {
+  const data = event.data;
+  switch (event.type) {
+    case "health.changed":
+      return "health";
+    case "token.reauthorization_required":
+    case "token.deactivated":
+    case "token.scopes_narrowed":
+    case "token.reauthorization_due":
+      return `${event.type}:${String(data.provider)}:${String(data.user_id)}`;
+    case "issuance.anomaly":
+      return `${event.type}:${String(data.kind)}:${String(data.meeting_id ?? data.user_id)}`;
+    case "canary.triggered":
+      return `${event.type}:${String(data.label)}`;
+    default:
+      return event.id;
+  }
+}
+
+function severity(event: WebhookEvent): "critical" | "error" | "warning" | "info" {
+  switch (event.type) {
+    case "health.changed":
+      return READY_STATES.includes(event.data.to as HealthState) ? "warning" : "critical";
+    case "canary.triggered":
+      return "critical";
+    case "token.reauthorization_required":
+    case "token.deactivated":
+      return "error";
+    case "token.scopes_narrowed":
+    case "token.reauthorization_due":
+    case "issuance.anomaly":
+      return "warning";
+    default:
+      return "info";
+  }
+}
+
+export interface NotificationsOptions {
+  notifiers: Notifier[];
+  routes?: NotifyRoutes;
+}
+
+/**
+ * Where events are emitted. Each event goes to the notifiers its type is
+ * routed to, or those routed for "*" if its type has no route; a notifier
+ * failing is logged and doesn't keep the event from the others.
+ */
+export class Notifications {
+  private readonly notifiers = new Map<string, Notifier>();
+  private readonly routes: NotifyRoutes;
+
+  constructor(options: NotificationsOptions) {
+    for (const notifier of options.notifiers) {
+      this.notifiers.set(notifier.name, notifier);
+    }
+    this.routes = options.routes ?? DEFAULT_NOTIFY_ROUTES;
+  }
+
+  emit(type: WebhookEventType, data: Record<string, unknown>): WebhookEvent {
+    const event: WebhookEvent = { id: randomUUID(), type, created_at: new Date().toISOString(), data };
+    for (const name of this.routes[type] ?? this.routes["*"] ?? []) {
+      const notifier = this.notifiers.get(name);
+      if (!notifier) continue;
+      notifier.send(event).catch((error) => {
+        console.error(`could not send ${type} event ${event.id} to ${name}: ${error instanceof Error ? error.message : String(error)}`);
+      });
+    }
+    return event;
+  }
+
+  /** Stops every notifier, e.g. before shutting down. */
+  close(): void {
+    for (const notifier of this.notifiers.values()) {
+      notifier.close?.();
+    }
+  }
+}
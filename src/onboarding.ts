@@ -0,0 +1,360 @@
+import { randomBytes } from "crypto";
+import { readFileSync, renameSync, writeFileSync } from "fs";
+import { CONSENT_STATE_TTL_MS } from "./consent.js";
+import { ConfigError, DEFAULT_ONBOARDING_MAX_REMINDERS } from "./config.js";
+import { sendMail } from "./smtp.js";
+import { TtlCache } from "./zoomrecall/ttlcache.js";
+
+const MAX_PENDING_CONSENTS = 10000;
+// how often invitations are checked for a reminder being due
+const REMINDER_CHECK_INTERVAL_MS = 60 * 60 * 1000;
+
+/** Someone asked to connect their Zoom account through a link of their own. */
+export interface Invitation {
+  // unguessable, carried by the link so its consent can be told apart
+  id: string;
+  email: string;
+  name: string | null;
+  link: string;
+  created_at: string;
+  status: "pending" | "completed";
+  // set by the latest consent through the link
+  completed_at: string | null;
+  user_id: string | null;
+  zoom_user_id: string | null;
+  emailed_at: string | null;
+  reminders_sent: number;
+  last_reminded_at: string | null;
+  // why the latest attempt to email the link, or a reminder, failed
+  email_error: string | null;
+}
+
+export interface Invitee {
+  email: string;
+  name?: string;
+}
+
+export interface InvitationsOptions {
+  // consent links are `${baseUrl}/zoom/oauth?invitation=<id>`
+  baseUrl: string;
+  // kept in memory only without one
+  path?: string;
+  // links are only emailed with both
+  smtpUrl?: string;
+  from?: string;
+  // emailed invitations still pending this long after the latest email are reminded, up to maxReminders times; 0 sends no reminders
+  reminderIntervalMs?: number;
+  maxReminders?: number;
+  // how often due reminders are looked for
+  checkIntervalMs?: number;
+}
+
+const EMAIL_PATTERN = /^[^\s@,;<>]+@[^\s@,;<>]+\.[^\s@,;<>]+$/;
+
+function splitCsvLine(line: string): string[] {
+  const fields: string[] = [];
+  let field = "";
+  let quoted = false;
+  for (let i = 0; i < line.length; i++) {
+    const char = line[i];
+    if (quoted) {
+      if (char === '"' && line[i + 1] === '"') {
+        field += '"';
+        i++;
+      } else if (char === '"') {
+        quoted = false;
+      } else {
+        field += char;
+      }
+    } else if (char === '"') {
+      quoted = true;
+    } else if (char === ",") {
+      fields.push(field.trim());
+      field = "";
+    } else {
+      field += char;
+    }
+  }
+  fields.push(field.trim());
+  return fields;
+}
+
+/**
+ * Reads invitees from CSV: with a header row naming an email column, and
+ * optionally a name column, or without one as email[,name] per line. Blank
+ * lines are skipped.
+ */
+export function parseInviteesCsv(text: string): Invitee[] {
+  const rows = text
+    .split(/\r?\n/)
+    .filter((line) => line.trim())
+    .map(splitCsvLine);
+  if (rows.length === 0) return [];
+  const header = rows[0].map((column) => column.toLowerCase());
+  let emailColumn = 0;
+  let nameColumn = 1;
+  if (header.includes("email")) {
+    emailColumn = header.indexOf("email");
+    nameColumn = header.indexOf("name");
+    rows.shift();
+  }
+  return rows.map((row) => ({ email: row[emailColumn] ?? "", ...(nameColumn >= 0 && row[nameColumn] ? { name: row[nameColumn] } : {}) }));
+}
+
+/** Checks invitees, returning them with their emails lowercased or the first problem found. */
+export function validateInvitees(invitees: unknown): Invitee[] | string {
+  if (!Array.isArray(invitees) || invitees.length === 0) return "at least one user is required";
+  const valid: Invitee[] = [];
+  for (const [index, invitee] of invitees.entries()) {
+    const { email, name } = (typeof invitee === "string" ? { email: invitee } : (invitee ?? {})) as { email?: unknown; name?: unknown };
+    if (typeof email !== "string" || !EMAIL_PATTERN.test(email.trim())) {
+      return `user ${index + 1} has no valid email: ${typeof email === "string" ? email : JSON.stringify(invitee)}`;
+    }
+    if (name !== undefined && typeof name !== "string") return `user ${index + 1}'s name must be a string`;
+    valid.push({ email: email.trim().toLowerCase(), ...(name?.trim() ? { name: name.trim() } : {}) });
+  }
+  return valid;
+}
+
+/**
+ * Onboarding invitations, for connecting many people at once: each invited
+ * email gets a consent link of its own, optionally mailed to it, and the
+ * invitation is completed by the first consent through that link, so who
+ * hasn't connected yet can be seen. Inviting an email again returns its
+ * existing invitation. Pending invitations can be nudged with a reminder,
+ * on demand or, with a reminder interval, on a schedule. With a path,
+ * invitations are written to it as one JSON document and read back at
+ * startup.
+ */
+export class Invitations {
+  private readonly baseUrl: string;
+  private readonly path: string | undefined;
+  private readonly smtpUrl: string;
+  private readonly from: string;
+  private readonly reminderIntervalMs: number;
+  private readonly maxReminders: number;
+  private readonly timer: NodeJS.Timeout | null;
+  private reminding: Promise<Invitation[]> | null = null;
+  private readonly invitations = new Map<string, Invitation>();
+  // consent state to the invitation whose link started it
+  private readonly pending = new TtlCache<string>({ ttlMs: CONSENT_STATE_TTL_MS, maxEntries: MAX_PENDING_CONSENTS });
+
+  constructor(options: InvitationsOptions) {
+    this.baseUrl = options.baseUrl;
+    this.path = options.path || undefined;
+    this.smtpUrl = options.smtpUrl ?? "";
+    this.from = options.from ?? "";
+    this.reminderIntervalMs = options.reminderIntervalMs ?? 0;
+    this.maxReminders = options.maxReminders ?? DEFAULT_ONBOARDING_MAX_REMINDERS;
+    if (this.path) {
+      this.load(this.path);
+    }
+    this.timer =
+      this.reminderIntervalMs > 0 && this.canEmail
+        ? setInterval(() => void this.remindDue(), options.checkIntervalMs ?? Math.min(this.reminderIntervalMs, REMINDER_CHECK_INTERVAL_MS))
+        : null;
+    this.timer?.unref();
+  }
+
+  /** Whether links can be emailed. */
+  get canEmail(): boolean {
+    return Boolean(this.smtpUrl && this.from);
+  }
+
+  /** Invites each of invitees that isn't already, returning every one's invitation and whether it is new. */
+  invite(invitees: Invitee[]): { invitation: Invitation; created: boolean }[] {
+    const results: { invitation: Invitation; created: boolean }[] = [];
+    for (const { email, name } of invitees) {
+      const existing = this.findByEmail(email);
+      if (existing) {
+        if (name && !existing.name) existing.name = name;
+        results.push({ invitation: existing, created: false });
+        continue;
+      }
+      const id = randomBytes(16).toString("base64url");
+      const invitation: Invitation = {
+        id,
+        email,
+        name: name ?? null,
+        link: `${this.baseUrl}/zoom/oauth?invitation=${id}`,
+        created_at: new Date().toISOString(),
+        status: "pending",
+        completed_at: null,
+        user_id: null,
+        zoom_user_id: null,
+        emailed_at: null,
+        reminders_sent: 0,
+        last_reminded_at: null,
+        email_error: null,
+      };
+      this.invitations.set(id, invitation);
+      results.push({ invitation, created: true });
+    }
+    this.save();
+    return results;
+  }
+
+  /**
+   * Mails each invitation its link, one after another, as a reminder when
+   * reminder is set; a failure is recorded on the invitation and the rest
+   * are still sent.
+   */
+  async email(invitations: Invitation[], reminder = false): Promise<void> {
+    if (!this.canEmail) throw new Error("invitations can't be emailed without SMTP_URL and ONBOARDING_EMAIL_FROM");
+    for (const invitation of invitations) {
+      try {
+        await sendMail(this.smtpUrl, {
+          from: this.from,
+          to: [invitation.email],
+          subject: reminder ? "Reminder: connect your Zoom account" : "Connect your Zoom account",
+          text: `Hi${invitation.name ? ` ${invitation.name}` : ""},\n\n${reminder ? "Your Zoom account isn't connected yet. " : ""}Please connect your Zoom account so meetings can be recorded for you. Open this link and approve access:\n\n${invitation.link}\n\nThe link is yours alone, please don't forward it.\n`,
+        });
+        const now = new Date().toISOString();
+        if (reminder) {
+          invitation.reminders_sent++;
+          invitation.last_reminded_at = now;
+        } else {
+          invitation.emailed_at = now;
+        }
+        invitation.email_error = null;
+      } catch (error) {
+        invitation.email_error = error instanceof Error ? error.message : String(error);
+        console.error(`could not email the onboarding link to ${invitation.email}`, error);
+      }
+    }
+    this.save();
+  }
+
+  /** Emails a reminder to each of invitations still pending, or to every pending one; returns those reminded. */
+  async remind(invitations: Invitation[] = this.list()): Promise<Invitation[]> {
+    const pending = invitations.filter((invitation) => invitation.status === "pending");
+    await this.email(pending, true);
+    return pending.filter((invitation) => !invitation.email_error);
+  }
+
+  /**
+   * Reminds the emailed invitations still pending reminderIntervalMs after
+   * their latest email that haven't had maxReminders yet; returns those
+   * reminded. Runs on the schedule too, once at a time.
+   */
+  remindDue(now: number = Date.now()): Promise<Invitation[]> {
+    this.reminding ??= (async () => {
+      const due = this.list().filter((invitation) => {
+        const lastEmailed = invitation.last_reminded_at ?? invitation.emailed_at;
+        return (
+          invitation.status === "pending" &&
+          lastEmailed !== null &&
+          invitation.reminders_sent < this.maxReminders &&
+          Date.parse(lastEmailed) + this.reminderIntervalMs <= now
+        );
+      });
+      if (due.length === 0) return [];
+      const reminded = await this.remind(due);
+      console.log(`reminded ${reminded.length} of ${due.length} pending onboarding invitation(s)`);
+      return reminded;
+    })()
+      .catch((error: unknown) => {
+        console.error("could not send onboarding reminders", error);
+        return [];
+      })
+      .finally(() => (this.reminding = null));
+    return this.reminding;
+  }
+
+  close(): void {
+    if (this.timer) clearInterval(this.timer);
+  }
+
+  /** Remembers that consent state was started from invitation id's link. */
+  started(id: string, state: string): void {
+    this.pending.set(state, id);
+  }
+
+  /** The invitation whose link started consent state, if any. */
+  startedFrom(state: string): Invitation | undefined {
+    const id = this.pending.get(state);
+    return id === undefined ? undefined : this.invitations.get(id);
+  }
+
+  /** Completes the invitation whose link started consent state, for userId; null if it wasn't started from one. */
+  completed(state: string, userId: string, zoomUserId?: string): Invitation | null {
+    const invitation = this.startedFrom(state);
+    if (!invitation) return null;
+    this.pending.delete(state);
+    invitation.status = "completed";
+    invitation.completed_at = new Date().toISOString();
+    invitation.user_id = userId;
+    invitation.zoom_user_id = zoomUserId ?? null;
+    this.save();
+    return invitation;
+  }
+
+  get(id: string): Invitation | undefined {
+    return this.invitations.get(id);
+  }
+
+  findByEmail(email: string): Invitation | undefined {
+    const wanted = email.toLowerCase();
+    return [...this.invitations.values()].find((invitation) => invitation.email === wanted);
+  }
+
+  /** Returns every invitation, most recently created first. */
+  list(): Invitation[] {
+    return [...this.invitations.values()].reverse();
+  }
+
+  /** Withdraws invitation id, so its link stops working; false if there was none. */
+  remove(id: string): boolean {
+    if (!this.invitations.delete(id)) return false;
+    this.save();
+    return true;
+  }
+
+  /** Forgets consents started from links but never completed in time; returns how many. */
+  purgeExpired(): number {
+    return this.pending.purgeExpired();
+  }
+
+  private save(): void {
+    if (!this.path) return;
+    try {
+      const temporary = `${this.path}.tmp`;
+      writeFileSync(temporary, `${JSON.stringify({ version: 1, invitations: [...this.invitations.values()] }, null, 2)}\n`, { mode: 0o600 });
+      renameSync(temporary, this.path);
+    } catch (error) {
+      console.error(`could not write onboarding invitations to ${this.path}`, error);
+    }
+  }
+
+  private load(path: string): void {
+    let contents: { version: number; invitations: Invitation[] };
+    try {
+      contents = JSON.parse(readFileSync(path, "utf8")) as { version: number; invitations: Invitation[] };
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read ONBOARDING_FILE ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    if (contents.version !== 1 || !Array.isArray(contents.invitations)) {
+      throw new ConfigError(`ONBOARDING_FILE ${path} does not hold version 1 invitations`);
+    }
+    for (const invitation of contents.invitations) {
+      // BASE_URL may have changed since
+      invitation.link = `${this.baseUrl}/zoom/oauth?invitation=${invitation.id}`;
+      invitation.reminders_sent ??= 0;
+      invitation.last_reminded_at ??= null;
+      this.invitations.set(invitation.id, invitation);
+    }
+  }
+}
+
+/** Prometheus gauges of how many invitations are pending and completed. */
+export function invitationMetrics(invitations: Invitation[]): string {
+  const lines = [
+    "# HELP zoom_oauth_invitations Onboarding invitations by status.",
+    "# TYPE zoom_oauth_invitations gauge",
+    ...(["pending", "completed"] as const).map(
+      (status) => `zoom_oauth_invitations{status="${status}"} ${invitations.filter((invitation) => invitation.status === status).length}`,
+    ),
+  ];
+  return `${lines.join("\n")}\n`;
+}
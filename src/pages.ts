@@ -0,0 +1,218 @@
+import { readFileSync, statSync } from "fs";
+import { join } from "path";
+import type express from "express";
+import { ConfigError } from "./config.js";
+import { translate } from "./i18n.js";
+import type { Locale } from "./i18n.js";
+import { HttpError } from "./zoomrecall/index.js";
+import { writeError } from "./zoomrecall/httpx.js";
+
+const COLOR = /^#(?:[0-9a-f]{3}|[0-9a-f]{6})$/i;
+
+export interface Branding {
+  productName: string;
+  // file name of the logo within the assets directory, served under /branding
+  logo: string | undefined;
+  primaryColor: string;
+  backgroundColor: string;
+  textColor: string;
+}
+
+// what pages look like without a branding file
+const DEFAULT_BRANDING: Branding = {
+  productName: "Recall",
+  logo: undefined,
+  primaryColor: "#2563eb",
+  backgroundColor: "#ffffff",
+  textColor: "#111827",
+};
+
+interface BrandingFile {
+  product_name?: unknown;
+  logo?: unknown;
+  colors?: { primary?: unknown; background?: unknown; text?: unknown };
+}
+
+/**
+ * Reads a branding file, e.g. {"product_name": "Acme Notes", "logo":
+ * "logo.svg", "colors": {"primary": "#4f46e5"}}, checking that the logo
+ * exists in assetsDir. Throws ConfigError on anything invalid.
+ */
+export function loadBranding(path: string, assetsDir: string): Branding {
+  let file: BrandingFile;
+  try {
+    file = JSON.parse(readFileSync(path, "utf8")) as BrandingFile;
+  } catch (error) {
+    throw new ConfigError(`could not read BRANDING_CONFIG ${path}: ${error instanceof Error ? error.message : String(error)}`);
+  }
+
+  const text = (value: unknown, name: string, fallback: string) => {
+    if (value === undefined) return fallback;
+    if (typeof value !== "string" || !value.trim()) throw new ConfigError(`branding ${name} must be a non-empty string`);
+    return value.trim();
+  };
+  const color = (value: unknown, name: string, fallback: string) => {
+    const parsed = text(value, `colors.${name}`, fallback);
+    if (!COLOR.test(parsed)) throw new ConfigError(`branding colors.${name} must be a hex color like #4f46e5`);
+    return parsed;
+  };
+
+  let logo: string | undefined;
+  if (file.logo !== undefined) {
+    logo = text(file.logo, "logo", "");
+    if (!assetsDir) throw new ConfigError("branding logo requires BRANDING_ASSETS_DIR to be set");
+    if (logo.includes("/") || logo.includes("\\") || logo.startsWith(".")) {
+      throw new ConfigError("branding logo must be a file name within BRANDING_ASSETS_DIR");
+    }
+    if (!statSync(join(assetsDir, logo), { throwIfNoEntry: false })?.isFile()) {
+      throw new ConfigError(`branding logo ${logo} does not exist in ${assetsDir}`);
+    }
+  }
+
+  return {
+    productName: text(file.product_name, "product_name", DEFAULT_BRANDING.productName),
+    logo,
+    primaryColor: color(file.colors?.primary, "primary", DEFAULT_BRANDING.primaryColor),
+    backgroundColor: color(file.colors?.background, "background", DEFAULT_BRANDING.backgroundColor),
+    textColor: color(file.colors?.text, "text", DEFAULT_BRANDING.textColor),
+  };
+}
+
+export function escapeHTML(value: string): string {
+  return value.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+interface PageContent {
+  title: string;
+  message: string;
+  // labelled facts listed under the message
+  details?: PageDetail[];
+  // links rendered as buttons
+  actions?: { label: string; href: string }[];
+}
+
+export interface PageDetail {
+  label: string;
+  value: string;
+}
+
+function renderPage(branding: Branding, locale: Locale, content: PageContent): string {
+  const { productName, logo, primaryColor, backgroundColor, textColor } = branding;
+  const logoHTML = logo ? `<img class="logo" src="/branding/${encodeURIComponent(logo)}" alt="${escapeHTML(productName)}">` : "";
+  const actions = (content.actions ?? [])
+    .map((action) => `<a class="button" href="${escapeHTML(action.href)}">${escapeHTML(action.label)}</a>`)
+    .join("\n    ");
+  const details = content.details?.length
+    ? `<dl>${content.details.map((detail) => `<dt>${escapeHTML(detail.label)}</dt><dd>${escapeHTML(detail.value)}</dd>`).join("")}</dl>`
+    : "";
+  return `<!doctype html>
+<html lang="${locale}">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>${escapeHTML(content.title)} - ${escapeHTML(productName)}</title>
+  <style>
+    body { margin: 0; min-height: 100vh; display: flex; align-items: center; justify-content: center;
+      font-family: system-ui, -apple-system, "Segoe UI", sans-serif; background: ${backgroundColor}; color: ${textColor}; }
+    main { max-width: 32rem; padding: 2rem; text-align: center; }
+    .logo { max-height: 4rem; max-width: 12rem; margin-bottom: 1.5rem; }
+    h1 { font-size: 1.5rem; margin: 0 0 1rem; }
+    p { line-height: 1.5; overflow-wrap: anywhere; }
+    dl { display: grid; grid-template-columns: auto 1fr; gap: 0.25rem 1rem; text-align: left; overflow-wrap: anywhere; }
+    dt { font-weight: 600; }
+    dd { margin: 0; }
+    .button { display: inline-block; margin: 0.5rem; padding: 0.75rem 1.5rem; border-radius: 0.5rem;
+      background: ${primaryColor}; color: #ffffff; text-decoration: none; font-weight: 600; }
+  </style>
+</head>
+<body>
+  <main>
+    ${logoHTML}
+    <h1>${escapeHTML(content.title)}</h1>
+    <p>${escapeHTML(content.message)}</p>
+    ${details}
+    ${actions}
+  </main>
+</body>
+</html>
+`;
+}
+
+/**
+ * Writes the pages people see around consent. With branding, browsers get
+ * HTML pages in the configured style; without it, or for clients that don't
+ * take HTML, the plain responses.
+ */
+export class ConsentPages {
+  private readonly branding: Branding | null;
+
+  constructor(branding: Branding | null) {
+    this.branding = branding;
+  }
+
+  get productName(): string {
+    return (this.branding ?? DEFAULT_BRANDING).productName;
+  }
+
+  success(req: express.Request, res: express.Response, locale: Locale, message: string, details: PageDetail[] = []): void {
+    res.set("Cache-Control", "no-store");
+    if (!this.wantsPage(req)) {
+      res.send([message, ...details.map((detail) => `${detail.label}: ${detail.value}`)].join("\n"));
+      return;
+    }
+    res.type("html").send(renderPage(this.branding!, locale, { title: translate(locale, "page.success_title"), message, details }));
+  }
+
+  /** Writes a failed consent, logging it like writeError does. */
+  failure(req: express.Request, res: express.Response, locale: Locale, error: HttpError): void {
+    if (!this.wantsPage(req)) {
+      writeError(req, res, error);
+      return;
+    }
+    console.error(`${req.method} ${req.baseUrl}${req.path}: ${error.message}`);
+    res.set("Cache-Control", "no-store");
+    res
+      .status(error.status)
+      .type("html")
+      .send(renderPage(this.branding!, locale, { title: translate(locale, "page.failure_title"), message: error.message }));
+  }
+
+  /**
+   * Writes the page for a consent whose authorization code had expired or
+   * was already used, linking to retryHref to start over. Browsers get a
+   * page even without branding, since the link is the way out.
+   */
+  expired(req: express.Request, res: express.Response, locale: Locale, provider: string, retryHref: string): void {
+    if (req.accepts(["text/plain", "text/html", "application/json"]) !== "text/html") {
+      writeError(req, res, new HttpError(400, translate(locale, "consent.expired", { url: retryHref })));
+      return;
+    }
+    console.warn(`${req.method} ${req.baseUrl}${req.path}: authorization code expired or was already used`);
+    res.set("Cache-Control", "no-store");
+    res
+      .status(400)
+      .type("html")
+      .send(
+        renderPage(this.branding ?? DEFAULT_BRANDING, locale, {
+          title: translate(locale, "expired.title"),
+          message: translate(locale, "expired.message", { provider }),
+          actions: [{ label: translate(locale, "expired.retry"), href: retryHref }],
+        }),
+      );
+  }
+
+  /** Writes a landing page linking to each provider's consent; only available with branding. */
+  connect(req: express.Request, res: express.Response, locale: Locale, providers: { name: string; href: string }[]): void {
+    res.type("html").send(
+      renderPage(this.branding!, locale, {
+        title: translate(locale, "connect.title"),
+        message: translate(locale, "connect.intro", { product: this.productName }),
+        actions: providers.map(({ name, href }) => ({ label: translate(locale, "connect.button", { provider: name }), href })),
+      }),
+    );
+  }
+
+  private wantsPage(req: express.Request): boolean {
+    return this.branding !== null && req.accepts(["text/plain", "text/html", "application/json"]) === "text/html";
+  }
+}
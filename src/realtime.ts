@@ -0,0 +1,187 @@
+import { randomUUID } from "crypto";
+import express from "express";
+import type { BotIdentityLog } from "./identities.js";
+import { signWebhook } from "./webhooks.js";
+import { HttpError } from "./zoomrecall/index.js";
+import type { CreateBotRequest, HttpClient } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+export const REALTIME_EVENT_TYPES = [
+  "participant_events.join",
+  "participant_events.leave",
+  "participant_events.update",
+  "participant_events.speech_on",
+  "participant_events.speech_off",
+  "participant_events.webcam_on",
+  "participant_events.webcam_off",
+  "participant_events.screenshare_on",
+  "participant_events.screenshare_off",
+  "participant_events.chat_message",
+  "transcript.data",
+  "transcript.partial_data",
+] as const;
+
+// SSE comments sent this often keep proxies from closing idle streams
+const STREAM_KEEPALIVE_MS = 15 * 1000;
+
+/** One of Recall's real-time events, as it is relayed downstream. */
+export interface RealtimeEvent {
+  id: string;
+  event: string;
+  received_at: string;
+  bot_id: string | null;
+  // whose credentials the bot was launched with, when the server recorded the launch
+  user_id: string | null;
+  zoom_user_id: string | null;
+  // Recall's event data, e.g. the participant and timestamp, or the transcript words
+  data: Record<string, unknown>;
+}
+
+interface RecallRealtimeWebhook {
+  event?: string;
+  data?: {
+    data?: Record<string, unknown>;
+    bot?: { id?: string };
+  };
+}
+
+/**
+ * The real-time endpoint to give Recall when creating a bot, so it sends
+ * events to `/recall/realtime` authenticated like the token callbacks;
+ * undefined when no events are relayed.
+ */
+export function realtimeRecordingConfig(baseUrl: string, callbackSecret: string, events: string[]): CreateBotRequest["recording_config"] {
+  if (events.length === 0) return undefined;
+  const query = new URLSearchParams({ auth_token: callbackSecret });
+  return { realtime_endpoints: [{ type: "webhook", url: `${baseUrl}/recall/realtime?${query}`, events }] };
+}
+
+export interface RealtimeRelayOptions {
+  // receives each event as a signed POST when set
+  url?: string;
+  secret?: string;
+  httpClient: HttpClient;
+  // attributes events to the user their bot was launched for
+  identities: BotIdentityLog;
+}
+
+interface Subscriber {
+  botId?: string;
+  userId?: string;
+  listener: (event: RealtimeEvent) => void;
+}
+
+/**
+ * Relays Recall's real-time events to an internal endpoint and to the
+ * streams subscribed to them. Events are live data, so a delivery that
+ * fails is logged and not retried, and a stream only sees events from
+ * after it subscribed.
+ */
+export class RealtimeRelay {
+  private readonly url: string | undefined;
+  private readonly secret: string;
+  private readonly httpClient: HttpClient;
+  private readonly identities: BotIdentityLog;
+  private readonly subscribers = new Set<Subscriber>();
+
+  constructor(options: RealtimeRelayOptions) {
+    this.url = options.url || undefined;
+    this.secret = options.secret ?? "";
+    this.httpClient = options.httpClient;
+    this.identities = options.identities;
+  }
+
+  /** Calls listener with every event of the bot and user in filter, all events when it is empty; returns a function that unsubscribes. */
+  subscribe(filter: { botId?: string; userId?: string }, listener: (event: RealtimeEvent) => void): () => void {
+    const subscriber: Subscriber = { ...filter, listener };
+    this.subscribers.add(subscriber);
+    return () => this.subscribers.delete(subscriber);
+  }
+
+  async publish(webhook: RecallRealtimeWebhook): Promise<RealtimeEvent | null> {
+    if (!webhook.event) return null;
+    const botId = webhook.data?.bot?.id ?? null;
+    const launch = botId ? this.identities.find({ botId }).find((record) => record.event === "bot.launched") : undefined;
+    const event: RealtimeEvent = {
+      id: randomUUID(),
+      event: webhook.event,
+      received_at: new Date().toISOString(),
+      bot_id: botId,
+      user_id: launch?.user_id ?? null,
+      zoom_user_id: launch?.zoom_user_id ?? null,
+      data: webhook.data?.data ?? {},
+    };
+    for (const { botId, userId, listener } of this.subscribers) {
+      if ((botId === undefined || botId === event.bot_id) && (userId === undefined || userId === event.user_id || userId === event.zoom_user_id)) {
+        listener(event);
+      }
+    }
+    if (this.url) await this.deliver(this.url, event);
+    return event;
+  }
+
+  private async deliver(url: string, event: RealtimeEvent): Promise<void> {
+    const body = JSON.stringify(event);
+    const timestamp = Math.floor(Date.now() / 1000);
+    try {
+      const response = await this.httpClient(url, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+          "X-Webhook-Id": event.id,
+          "X-Webhook-Timestamp": String(timestamp),
+          "X-Webhook-Signature": signWebhook(this.secret, timestamp, body),
+        },
+        body,
+      });
+      if (!response.ok) {
+        console.warn(`relaying ${event.event} for bot ${event.bot_id} to ${url} failed with status ${response.status}`);
+      }
+    } catch (error) {
+      console.warn(`relaying ${event.event} for bot ${event.bot_id} to ${url} failed: ${error instanceof Error ? error.message : String(error)}`);
+    }
+  }
+}
+
+/** Receives the real-time events Recall sends for bots given realtimeRecordingConfig; mount at `/recall/realtime`. */
+export function createRealtimeRouter(options: { callbackSecret: string; relay: RealtimeRelay }): express.Router {
+  const { callbackSecret, relay } = options;
+  const router = express.Router();
+
+  router.post("/", express.json({ limit: "1mb" }), (req, res) => {
+    if (req.query.auth_token !== callbackSecret) {
+      writeError(req, res, new HttpError(401, "recall auth secret provided is incorrect"));
+      return;
+    }
+    void relay.publish((req.body ?? {}) as RecallRealtimeWebhook);
+    writeJSON(res, 200, { received: true });
+  });
+
+  return router;
+}
+
+/**
+ * Streams relayed events as server-sent events, each named after its Recall
+ * event with the RealtimeEvent as data, optionally only those of one bot
+ * (`?bot_id=`) or user (`?user_id=`); mount behind requireAdminKey.
+ */
+export function createRealtimeStreamRouter(relay: RealtimeRelay): express.Router {
+  const router = express.Router();
+
+  router.get("/events", (req, res) => {
+    const botId = typeof req.query.bot_id === "string" ? req.query.bot_id : undefined;
+    const userId = typeof req.query.user_id === "string" ? req.query.user_id : undefined;
+    res.writeHead(200, { "Content-Type": "text/event-stream", "Cache-Control": "no-cache", Connection: "keep-alive" });
+    res.write(": connected\n\n");
+    const unsubscribe = relay.subscribe({ botId, userId }, (event) => {
+      res.write(`id: ${event.id}\nevent: ${event.event}\ndata: ${JSON.stringify(event)}\n\n`);
+    });
+    const keepalive = setInterval(() => res.write(": keepalive\n\n"), STREAM_KEEPALIVE_MS);
+    req.on("close", () => {
+      clearInterval(keepalive);
+      unsubscribe();
+    });
+  });
+
+  return router;
+}
@@ -0,0 +1,103 @@
+import { createHmac, timingSafeEqual } from "crypto";
+import express from "express";
+import type { DeadLetters } from "./deadletters.js";
+import type { Notifications } from "./notify.js";
+import { HttpError } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+const MAX_WEBHOOK_AGE_SECONDS = 5 * 60;
+
+interface WebhookRequest extends express.Request {
+  rawBody?: Buffer;
+}
+
+interface RecallWebhook {
+  event?: string;
+  data?: {
+    bot?: { id?: string };
+    bot_id?: string;
+    status?: { code?: string };
+    data?: { code?: string };
+    transcript?: { id?: string };
+  };
+}
+
+/**
+ * Verifies a Recall webhook signed in the Svix / Standard Webhooks format:
+ * base64 HMAC-SHA256 over `${id}.${timestamp}.${body}` keyed with the
+ * base64-decoded `whsec_` secret.
+ */
+export function verifyRecallWebhook(
+  secret: string,
+  headers: express.Request["headers"],
+  rawBody: Buffer,
+  now: number = Date.now(),
+): boolean {
+  const header = (name: string) => (headers[`webhook-${name}`] ?? headers[`svix-${name}`]) as string | undefined;
+  const id = header("id");
+  const timestamp = header("timestamp");
+  const signatures = header("signature");
+  if (!id || !timestamp || !signatures || Math.abs(now / 1000 - Number(timestamp)) > MAX_WEBHOOK_AGE_SECONDS) {
+    return false;
+  }
+
+  const key = Buffer.from(secret.replace(/^whsec_/, ""), "base64");
+  const expected = Buffer.from(createHmac("sha256", key).update(`${id}.${timestamp}.`).update(rawBody).digest("base64"));
+  // the header lists one or more "v1,<signature>" entries separated by spaces, to allow secret rotation
+  return signatures.split(" ").some((entry) => {
+    const [version, signature = ""] = entry.split(",", 2);
+    const provided = Buffer.from(signature);
+    return version === "v1" && provided.length === expected.length && timingSafeEqual(provided, expected);
+  });
+}
+
+export interface RecallWebhookRouterOptions {
+  secret: string;
+  notifications: Notifications;
+  // keeps webhooks whose processing failed for replay
+  deadLetters: DeadLetters;
+}
+
+/** Forwards a verified Recall webhook as a normalized event; what deadLetters replays. */
+async function processRecallWebhook(notifications: Notifications, body: RecallWebhook): Promise<void> {
+  const { event, data = {} } = body;
+  const botId = data.bot?.id ?? data.bot_id;
+  const statusCode = data.status?.code ?? data.data?.code;
+  if (event === "bot.done" || (event === "bot.status_change" && statusCode === "done")) {
+    notifications.emit("bot.done", { bot_id: botId });
+  } else if (event === "transcript.done") {
+    notifications.emit("transcript.ready", { bot_id: botId, transcript_id: data.transcript?.id });
+  }
+}
+
+/**
+ * Receives Recall's bot and transcript webhooks and forwards them as
+ * normalized events, keeping those that can't be forwarded in deadLetters;
+ * mount ahead of other body parsers.
+ */
+export function createRecallWebhookRouter(options: RecallWebhookRouterOptions): express.Router {
+  const { secret, notifications, deadLetters } = options;
+  const router = express.Router();
+  deadLetters.register("recall", (body) => processRecallWebhook(notifications, body as RecallWebhook));
+
+  router.post(
+    "/",
+    express.json({
+      verify: (req, _res, buf) => {
+        (req as WebhookRequest).rawBody = buf;
+      },
+    }),
+    (req, res) => {
+      if (!verifyRecallWebhook(secret, req.headers, (req as WebhookRequest).rawBody ?? Buffer.alloc(0))) {
+        writeError(req, res, new HttpError(401, "invalid recall webhook signature"));
+        return;
+      }
+
+      void deadLetters.process("recall", req.body ?? {});
+      // acknowledge events we don't forward, and those kept as dead letters, so Recall doesn't retry them
+      writeJSON(res, 200, { received: true });
+    },
+  );
+
+  return router;
+}
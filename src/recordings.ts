@@ -0,0 +1,110 @@
+import type { Notifications } from "./notify.js";
+import type { WebhookDispatcher } from "./webhooks.js";
+import type { TokenManager } from "./zoomrecall/index.js";
+
+interface ZoomRecordingFile {
+  id?: string;
+  file_type?: string;
+  file_extension?: string;
+  file_size?: number;
+  recording_type?: string;
+  recording_start?: string;
+  recording_end?: string;
+  status?: string;
+  download_url?: string;
+  play_url?: string;
+}
+
+/** The object of Zoom's recording.completed event: the meeting and its cloud recording files. */
+export interface ZoomRecording {
+  uuid?: string;
+  id?: string | number;
+  host_id?: string;
+  host_email?: string;
+  topic?: string;
+  start_time?: string;
+  duration?: number;
+  share_url?: string;
+  recording_files?: ZoomRecordingFile[];
+}
+
+export interface RecordingIngestOptions {
+  tokens: TokenManager;
+  notifications: Notifications;
+  // receives each recording with its download URLs and a token to fetch them with, when set
+  forwarder?: WebhookDispatcher;
+}
+
+/**
+ * Takes in the cloud recordings Zoom reports completed for meetings hosted
+ * by connected users, announcing each as a recording.completed event and,
+ * with a forwarder, handing its files' download URLs on together with the
+ * host's access token, which Zoom accepts as their download token.
+ * Recordings of hosts that haven't connected are ignored.
+ */
+export class RecordingIngest {
+  private readonly tokens: TokenManager;
+  private readonly notifications: Notifications;
+  private readonly forwarder: WebhookDispatcher | undefined;
+
+  constructor(options: RecordingIngestOptions) {
+    this.tokens = options.tokens;
+    this.notifications = options.notifications;
+    this.forwarder = options.forwarder;
+  }
+
+  async completed(recording: ZoomRecording): Promise<void> {
+    const meetingId = recording.id === undefined ? "" : String(recording.id);
+    const hostId = recording.host_id ?? "";
+    const userId = hostId ? await this.tokens.userForZoomUser(hostId) : undefined;
+    if (!userId) {
+      console.log(`ignoring the recording of meeting ${meetingId}, its host ${hostId || "(unknown)"} hasn't connected`);
+      return;
+    }
+    const files = recording.recording_files ?? [];
+    const meeting = {
+      meeting_id: meetingId,
+      meeting_uuid: recording.uuid ?? null,
+      topic: recording.topic ?? null,
+      start_time: recording.start_time ?? null,
+      duration_minutes: recording.duration ?? null,
+      user_id: userId,
+      zoom_user_id: hostId,
+    };
+    // the announcement may go to Slack or email, so it says what was recorded without saying where to fetch it
+    this.notifications.emit("recording.completed", {
+      ...meeting,
+      file_count: files.length,
+      total_size: files.reduce((total, file) => total + (file.file_size ?? 0), 0),
+    });
+    if (!this.forwarder) return;
+
+    const { accessToken } = this.tokens.get(userId);
+    await this.forwarder.send({
+      // the meeting's UUID, so receivers dropping duplicates see a recording once even if Zoom's event is replayed
+      id: recording.uuid ?? meetingId,
+      type: "recording.completed",
+      created_at: new Date().toISOString(),
+      data: {
+        ...meeting,
+        host_email: recording.host_email ?? null,
+        share_url: recording.share_url ?? null,
+        recording_files: files.map((file) => ({
+          id: file.id ?? null,
+          file_type: file.file_type ?? null,
+          file_extension: file.file_extension ?? null,
+          file_size: file.file_size ?? null,
+          recording_type: file.recording_type ?? null,
+          recording_start: file.recording_start ?? null,
+          recording_end: file.recording_end ?? null,
+          status: file.status ?? null,
+          download_url: file.download_url ?? null,
+          play_url: file.play_url ?? null,
+        })),
+        download_token: accessToken,
+        download_token_expires_at: this.tokens.status(userId).expiresAt.toISOString(),
+      },
+    });
+    console.log(`forwarded the recording of meeting ${meetingId} by user ${userId}, ${files.length} file(s)`);
+  }
+}
@@ -0,0 +1,159 @@
+import { readFileSync, renameSync, writeFileSync } from "fs";
+import { ConfigError } from "./config.js";
+import type { TokenStatus } from "./zoomrecall/index.js";
+
+/** What is left of a user whose tokens were removed: who they were and why, never a credential. */
+export interface RemovedUser {
+  user_id: string;
+  zoom_user_id: string | null;
+  removed_at: string;
+  // "revoked" at Zoom too, or only "purged" from this server
+  removal: "purged" | "revoked";
+  // e.g. "admin"
+  source: string;
+  // the user's state when removed
+  scopes: string[] | null;
+  last_refreshed_at: string | null;
+  needs_reauthorization: boolean;
+  deactivated: boolean;
+  notes: { at: string; note: string }[];
+  // set when the same Zoom user consented again, as restored_as
+  restored_at: string | null;
+  restored_as: string | null;
+  // hard deleted once this passes
+  purge_after: string;
+}
+
+export interface RemovedUsersOptions {
+  // kept in memory only without one
+  path?: string;
+  // how long a record is kept; 0 keeps none, so removals are hard deletes
+  retentionMs: number;
+}
+
+/**
+ * Soft-deleted users: when a user's tokens are purged or revoked, what the
+ * server knew about them is kept, without the tokens, for retentionMs, so
+ * audit entries and bot records still lead somewhere and an accidental
+ * removal can be annotated. A record is marked restored when the same Zoom
+ * user consents again, and hard deleted once its window passes or when
+ * purged. With a path, records are written to it as one JSON document and
+ * read back at startup.
+ */
+export class RemovedUsers {
+  private readonly path: string | undefined;
+  private readonly retentionMs: number;
+  private readonly users = new Map<string, RemovedUser>();
+
+  constructor(options: RemovedUsersOptions) {
+    this.path = options.path || undefined;
+    this.retentionMs = options.retentionMs;
+    if (this.path) {
+      this.load(this.path);
+    }
+  }
+
+  /** Records the removal of the user status describes; null when no records are kept. */
+  removed(entry: { status: TokenStatus; zoomUserId?: string; removal: RemovedUser["removal"]; source: string }): RemovedUser | null {
+    if (this.retentionMs <= 0) return null;
+    const now = Date.now();
+    const { status } = entry;
+    const user: RemovedUser = {
+      user_id: status.userId,
+      zoom_user_id: entry.zoomUserId ?? null,
+      removed_at: new Date(now).toISOString(),
+      removal: entry.removal,
+      source: entry.source,
+      scopes: status.scopes,
+      last_refreshed_at: status.lastRefreshedAt?.toISOString() ?? null,
+      needs_reauthorization: status.needsReauthorization,
+      deactivated: status.deactivated,
+      notes: this.users.get(status.userId)?.notes ?? [],
+      restored_at: null,
+      restored_as: null,
+      purge_after: new Date(now + this.retentionMs).toISOString(),
+    };
+    this.users.set(user.user_id, user);
+    this.save();
+    return user;
+  }
+
+  /**
+   * Marks the records of userId, and of Zoom user zoomUserId when known, as
+   * restored by tokens stored for userId, e.g. by a new consent; returns how
+   * many.
+   */
+  restored(userId: string, zoomUserId?: string): number {
+    let restored = 0;
+    for (const user of this.users.values()) {
+      if (user.restored_at !== null || (user.user_id !== userId && (!zoomUserId || user.zoom_user_id !== zoomUserId))) continue;
+      user.restored_at = new Date().toISOString();
+      user.restored_as = userId;
+      restored++;
+    }
+    if (restored > 0) this.save();
+    return restored;
+  }
+
+  /** Adds note to userId's record; null if there is none. */
+  annotate(userId: string, note: string): RemovedUser | null {
+    const user = this.users.get(userId);
+    if (!user) return null;
+    user.notes.push({ at: new Date().toISOString(), note });
+    this.save();
+    return user;
+  }
+
+  get(userId: string): RemovedUser | undefined {
+    return this.users.get(userId);
+  }
+
+  /** Returns every record, most recently removed first. */
+  list(): RemovedUser[] {
+    return [...this.users.values()].sort((a, b) => b.removed_at.localeCompare(a.removed_at));
+  }
+
+  /** Hard deletes userId's record; false if there was none. */
+  purge(userId: string): boolean {
+    if (!this.users.delete(userId)) return false;
+    this.save();
+    return true;
+  }
+
+  /** Hard deletes records whose window passed as of now, in ms since the epoch; returns how many. */
+  prune(now: number): number {
+    let pruned = 0;
+    for (const user of [...this.users.values()]) {
+      if (Date.parse(user.purge_after) > now) continue;
+      this.users.delete(user.user_id);
+      pruned++;
+    }
+    if (pruned > 0) this.save();
+    return pruned;
+  }
+
+  private save(): void {
+    if (!this.path) return;
+    try {
+      const temporary = `${this.path}.tmp`;
+      writeFileSync(temporary, `${JSON.stringify({ version: 1, users: [...this.users.values()] }, null, 2)}\n`, { mode: 0o600 });
+      renameSync(temporary, this.path);
+    } catch (error) {
+      console.error(`could not write removed users to ${this.path}`, error);
+    }
+  }
+
+  private load(path: string): void {
+    let contents: { version: number; users: RemovedUser[] };
+    try {
+      contents = JSON.parse(readFileSync(path, "utf8")) as { version: number; users: RemovedUser[] };
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") return;
+      throw new ConfigError(`could not read REMOVED_USERS_FILE ${path}: ${error instanceof Error ? error.message : String(error)}`);
+    }
+    if (contents.version !== 1 || !Array.isArray(contents.users)) {
+      throw new ConfigError(`REMOVED_USERS_FILE ${path} does not hold version 1 removed users`);
+    }
+    for (const user of contents.users) this.users.set(user.user_id, user);
+  }
+}
@@ -0,0 +1,82 @@
+export const DEFAULT_RETENTION_INTERVAL_MS = 60 * 60 * 1000;
+export const DEFAULT_AUDIT_RETENTION_MS = 30 * 24 * 60 * 60 * 1000;
+export const DEFAULT_BOT_IDENTITY_RETENTION_MS = 90 * 24 * 60 * 60 * 1000;
+export const DEFAULT_TOKEN_HISTORY_RETENTION_MS = 365 * 24 * 60 * 60 * 1000;
+export const DEFAULT_REMOVED_USER_RETENTION_MS = 30 * 24 * 60 * 60 * 1000;
+export const DEFAULT_DEAD_LETTER_RETENTION_MS = 14 * 24 * 60 * 60 * 1000;
+
+/**
+ * One kind of data retention cleans up: sweep removes what is expired,
+ * orphaned or older than its limit as of now and returns how many records
+ * it removed.
+ */
+export interface RetentionSweep {
+  // names the count in reports, e.g. "audit_entries"
+  name: string;
+  sweep(now: number): number | Promise<number>;
+}
+
+export interface RetentionReport {
+  at: string;
+  // records removed per sweep; a sweep that failed is missing here and listed in errors
+  removed: Record<string, number>;
+  errors: Record<string, string>;
+}
+
+export interface RetentionOptions {
+  sweeps: RetentionSweep[];
+  // sweeps run this often; 0 only runs them when asked to
+  intervalMs: number;
+}
+
+/**
+ * Runs the sweeps that keep long-running deployments from growing without
+ * bound, every intervalMs and on demand. A sweep that fails is logged and
+ * tried again next time; the others still run.
+ */
+export class Retention {
+  private readonly sweeps: RetentionSweep[];
+  private readonly timer: NodeJS.Timeout | null;
+  private running: Promise<RetentionReport> | null = null;
+  private last: RetentionReport | null = null;
+
+  constructor(options: RetentionOptions) {
+    this.sweeps = options.sweeps;
+    this.timer = options.intervalMs > 0 ? setInterval(() => void this.run(), options.intervalMs) : null;
+    this.timer?.unref();
+  }
+
+  /** The report of the latest run, null before the first one. */
+  get lastReport(): RetentionReport | null {
+    return this.last;
+  }
+
+  /** Runs every sweep now, or waits for the run already going. */
+  run(): Promise<RetentionReport> {
+    this.running ??= this.sweepAll().finally(() => (this.running = null));
+    return this.running;
+  }
+
+  close(): void {
+    if (this.timer) clearInterval(this.timer);
+  }
+
+  private async sweepAll(): Promise<RetentionReport> {
+    const now = Date.now();
+    const report: RetentionReport = { at: new Date(now).toISOString(), removed: {}, errors: {} };
+    for (const { name, sweep } of this.sweeps) {
+      try {
+        report.removed[name] = await sweep(now);
+      } catch (error) {
+        report.errors[name] = error instanceof Error ? error.message : String(error);
+        console.error(`retention could not remove ${name.replace(/_/g, " ")}`, error);
+      }
+    }
+    const removed = Object.entries(report.removed).filter(([, count]) => count > 0);
+    if (removed.length > 0) {
+      console.log(`retention removed ${removed.map(([name, count]) => `${count} ${name.replace(/_/g, " ")}`).join(", ")}`);
+    }
+    this.last = report;
+    return report;
+  }
+}
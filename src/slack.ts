@@ -0,0 +1,239 @@
+import { createHmac, randomBytes, timingSafeEqual } from "crypto";
+import express from "express";
+import { codeChallenge } from "./consent.js";
+import type { BotIdentityLog } from "./identities.js";
+import type { Notifications } from "./notify.js";
+import { HttpError, meetingIdFromUrl, RecallApiError, recallCallbackUrl } from "./zoomrecall/index.js";
+import type { CreateBotRequest, HttpClient, RecallClient, TokenManager, ZoomClient } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+import { TtlCache } from "./zoomrecall/ttlcache.js";
+
+// Slack's recommended window for rejecting replayed requests
+const MAX_REQUEST_AGE_SECONDS = 5 * 60;
+const PENDING_LINK_TTL_MS = 10 * 60 * 1000;
+
+interface SlackRequest extends express.Request {
+  rawBody?: Buffer;
+}
+
+interface SlashCommand {
+  team_id?: string;
+  user_id?: string;
+  text?: string;
+  response_url?: string;
+}
+
+/** Checks the `X-Slack-Signature` of a request against the app's signing secret. */
+export function verifySlackSignature(
+  signingSecret: string,
+  timestamp: string | undefined,
+  signature: string | undefined,
+  rawBody: Buffer,
+  now: number = Date.now(),
+): boolean {
+  const seconds = Number(timestamp);
+  if (!timestamp || !signature || !Number.isFinite(seconds) || Math.abs(now / 1000 - seconds) > MAX_REQUEST_AGE_SECONDS) {
+    return false;
+  }
+  const expected = `v0=${createHmac("sha256", signingSecret).update(`v0:${timestamp}:`).update(rawBody).digest("hex")}`;
+  return expected.length === signature.length && timingSafeEqual(Buffer.from(expected), Buffer.from(signature));
+}
+
+/**
+ * Remembers which connected Zoom user each Slack user launches bots as. A
+ * link is made by sending the Slack user through Zoom consent with a one-time
+ * state value and, like consent started at /zoom/oauth, a PKCE code verifier.
+ */
+export class SlackLinks {
+  private readonly pending = new TtlCache<{ slackUser: string; codeVerifier: string }>({ ttlMs: PENDING_LINK_TTL_MS, maxEntries: 1000 });
+  private readonly links = new Map<string, string>();
+
+  start(slackUser: string): string {
+    const state = `slack_${randomBytes(16).toString("hex")}`;
+    this.pending.set(state, { slackUser, codeVerifier: randomBytes(32).toString("base64url") });
+    return state;
+  }
+
+  /** The code challenge to send with state's authorization request; undefined if state isn't a pending link. */
+  codeChallengeOf(state: string): string | undefined {
+    const verifier = this.pending.get(state)?.codeVerifier;
+    return verifier === undefined ? undefined : codeChallenge(verifier);
+  }
+
+  /** The code verifier state's code is exchanged with, without completing the link. */
+  codeVerifierOf(state: string): string | undefined {
+    return this.pending.get(state)?.codeVerifier;
+  }
+
+  /** Links the Slack user that started consent with state to zoomUserId; returns false if state isn't a pending link. */
+  complete(state: string, zoomUserId: string): boolean {
+    const slackUser = this.pending.get(state)?.slackUser;
+    if (slackUser === undefined) return false;
+    this.pending.delete(state);
+    this.links.set(slackUser, zoomUserId);
+    return true;
+  }
+
+  isPending(state: string): boolean {
+    return this.pending.get(state) !== undefined;
+  }
+
+  /** Moves a pending link to a fresh state, for consent that has to start over; returns undefined if state isn't pending. */
+  renew(state: string): string | undefined {
+    const slackUser = this.pending.get(state)?.slackUser;
+    if (slackUser === undefined) return undefined;
+    this.pending.delete(state);
+    return this.start(slackUser);
+  }
+
+  zoomUserFor(slackUser: string): string | undefined {
+    return this.links.get(slackUser);
+  }
+
+  /** Forgets pending links that expired; returns how many. */
+  purgeExpired(): number {
+    return this.pending.purgeExpired();
+  }
+
+  /** Forgets links to users connected says are gone, e.g. removed since they linked; returns how many. */
+  forgetUnless(connected: (userId: string) => boolean): number {
+    let forgotten = 0;
+    for (const [slackUser, userId] of this.links) {
+      if (connected(userId)) continue;
+      this.links.delete(slackUser);
+      forgotten++;
+    }
+    return forgotten;
+  }
+}
+
+export interface SlackRouterOptions {
+  signingSecret: string;
+  zoom: ZoomClient;
+  tokens: TokenManager;
+  recall: RecallClient;
+  links: SlackLinks;
+  baseUrl: string;
+  callbackSecret: string;
+  httpClient: HttpClient;
+  notifications: Notifications;
+  identities: BotIdentityLog;
+  // subscribes launched bots to real-time events when set
+  recordingConfig?: CreateBotRequest["recording_config"];
+}
+
+// Slack wraps links as <https://...> or <https://...|label> when link escaping is on
+function parseMeetingUrl(text: string): URL | undefined {
+  const raw = text.trim().replace(/^<([^|>]+)(\|[^>]*)?>$/, "$1");
+  try {
+    const url = new URL(raw);
+    return url.protocol === "https:" && /(^|\.)zoom\.us$/.test(url.hostname) ? url : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+/** Serves the `/recordmeeting` slash command; mount at `/slack`, ahead of any other body parser. */
+export function createSlackRouter(options: SlackRouterOptions): express.Router {
+  const { signingSecret, zoom, tokens, recall, links, baseUrl, callbackSecret, httpClient, notifications, identities, recordingConfig } = options;
+  const router = express.Router();
+
+  async function respondLater(responseUrl: string, body: Record<string, unknown>): Promise<void> {
+    try {
+      const response = await httpClient(responseUrl, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+      });
+      if (!response.ok) {
+        console.error(`slack rejected a delayed response with ${response.status}`);
+      }
+    } catch (error) {
+      console.error("error sending delayed slack response", error);
+    }
+  }
+
+  async function launch(meetingUrl: URL, zoomUserId: string, slackUserId: string, responseUrl: string): Promise<void> {
+    try {
+      const bot = await recall.createBot({
+        meeting_url: meetingUrl.toString(),
+        bot_name: "Recall Bot",
+        zoom: { obf_token_url: recallCallbackUrl(baseUrl, "obf-callback", tokens.callbackSecret(zoomUserId) ?? callbackSecret, zoomUserId) },
+        automatic_leave: { waiting_room_timeout: 1200 },
+        ...(recordingConfig ? { recording_config: recordingConfig } : {}),
+      });
+      const status = (await recall.getBot(bot.id).catch(() => bot)).status_changes?.at(-1)?.code ?? "ready";
+      console.log(`slack user ${slackUserId} launched bot ${bot.id} as zoom user ${zoomUserId}`);
+      notifications.emit("bot.launched", { bot_id: bot.id, meeting_url: meetingUrl.toString(), user_id: zoomUserId, source: "slack" });
+      identities.launched({
+        botId: bot.id,
+        userId: zoomUserId,
+        zoomUserId: tokens.zoomUserId(zoomUserId),
+        meetingId: meetingIdFromUrl(meetingUrl.toString()),
+        source: "slack",
+      });
+      await respondLater(responseUrl, {
+        response_type: "in_channel",
+        text: `<@${slackUserId}> launched a recording bot for ${meetingUrl} (bot ${bot.id}, status: ${status})`,
+      });
+    } catch (error) {
+      console.error("error launching bot from slack", error);
+      const reason = error instanceof RecallApiError ? error.message : "internal error, see server logs";
+      await respondLater(responseUrl, { response_type: "ephemeral", text: `could not launch a bot: ${reason}` });
+    }
+  }
+
+  router.post(
+    "/commands",
+    express.urlencoded({
+      extended: false,
+      verify: (req, _res, buf) => {
+        (req as SlackRequest).rawBody = buf;
+      },
+    }),
+    (req, res) => {
+      const timestamp = req.headers["x-slack-request-timestamp"] as string | undefined;
+      const signature = req.headers["x-slack-signature"] as string | undefined;
+      if (!verifySlackSignature(signingSecret, timestamp, signature, (req as SlackRequest).rawBody ?? Buffer.alloc(0))) {
+        writeError(req, res, new HttpError(401, "invalid slack signature"));
+        return;
+      }
+
+      const command = (req.body ?? {}) as SlashCommand;
+      const slackUser = `${command.team_id ?? ""}:${command.user_id ?? ""}`;
+      const text = command.text?.trim() ?? "";
+      const reply = (message: string) => writeJSON(res, 200, { response_type: "ephemeral", text: message });
+
+      if (text === "" || text === "help") {
+        reply("usage: `/recordmeeting <zoom meeting url>` launches a recording bot; `/recordmeeting connect` links your Zoom account first");
+        return;
+      }
+      if (text === "connect") {
+        const state = links.start(slackUser);
+        reply(`connect your Zoom account so bots can join as you: ${zoom.authorizeUrl(state, links.codeChallengeOf(state))}`);
+        return;
+      }
+
+      const meetingUrl = parseMeetingUrl(text);
+      if (!meetingUrl) {
+        reply(`that doesn't look like a Zoom meeting URL: ${text}`);
+        return;
+      }
+      const zoomUserId = links.zoomUserFor(slackUser);
+      if (!zoomUserId || !tokens.has(zoomUserId)) {
+        reply("your Slack account isn't linked to a connected Zoom account yet, run `/recordmeeting connect` first");
+        return;
+      }
+      if (!command.response_url) {
+        writeError(req, res, new HttpError(400, "no response_url provided"));
+        return;
+      }
+
+      // Slack expects an answer within 3 seconds, so the launch result follows via response_url
+      reply(`launching a recording bot for ${meetingUrl}...`);
+      void launch(meetingUrl, zoomUserId, command.user_id ?? "", command.response_url);
+    },
+  );
+
+  return router;
+}
@@ -0,0 +1,160 @@
+import type express from "express";
+
+export const DEFAULT_LATENCY_SLO_OBJECTIVE = 0.99;
+// the Recall callbacks, by their path under /recall, that latency targets can be set for
+export const LATENCY_SLO_ENDPOINTS = [
+  "oauth-callback",
+  "obf-callback",
+  "zak-callback",
+  "meeting",
+  "token-exchange",
+  "teams/oauth-callback",
+  "google/oauth-callback",
+] as const;
+export type LatencySloEndpoint = (typeof LATENCY_SLO_ENDPOINTS)[number];
+// the windows burn rates are reported over: a fast one that pages, a slow one for the trend
+export const BURN_RATE_WINDOWS = [
+  { name: "5m", ms: 5 * 60 * 1000 },
+  { name: "1h", ms: 60 * 60 * 1000 },
+] as const;
+const BUCKET_MS = 60 * 1000;
+
+export interface LatencySlo {
+  endpoint: LatencySloEndpoint;
+  targetMs: number;
+}
+
+export interface LatencySloReport {
+  endpoint: LatencySloEndpoint;
+  targetMs: number;
+  // since startup; good requests were answered below 500 within the target
+  requests: number;
+  good: number;
+  // the share of bad requests in each window, over the share the objective allows to be bad; 1 spends the budget
+  // exactly as fast as it accrues, 0 when nothing was requested in the window
+  burnRates: Record<(typeof BURN_RATE_WINDOWS)[number]["name"], number>;
+}
+
+interface Bucket {
+  startedAt: number;
+  requests: number;
+  good: number;
+}
+
+interface Tracked {
+  slo: LatencySlo;
+  requests: number;
+  good: number;
+  // one a minute, oldest first, no older than the longest window
+  buckets: Bucket[];
+}
+
+/**
+ * Counts how many requests to each Recall callback with a latency target
+ * were answered within it, since slow token responses hold up bot joins.
+ * Totals since startup are exported for Prometheus to compute its own burn
+ * rates from; burn rates over BURN_RATE_WINDOWS are kept here too, in
+ * one-minute buckets, for GET /admin/slo and alerting without it.
+ */
+export class LatencySlos {
+  readonly objective: number;
+  private readonly tracked = new Map<string, Tracked>();
+
+  constructor(slos: LatencySlo[], objective: number = DEFAULT_LATENCY_SLO_OBJECTIVE) {
+    this.objective = objective;
+    for (const slo of slos) {
+      this.tracked.set(slo.endpoint, { slo, requests: 0, good: 0, buckets: [] });
+    }
+  }
+
+  get size(): number {
+    return this.tracked.size;
+  }
+
+  record(endpoint: string, durationMs: number, status: number, now: number = Date.now()): void {
+    const tracked = this.tracked.get(endpoint);
+    if (!tracked) return;
+    const good = status < 500 && durationMs <= tracked.slo.targetMs;
+    tracked.requests++;
+    if (good) tracked.good++;
+    let bucket = tracked.buckets.at(-1);
+    if (!bucket || now - bucket.startedAt >= BUCKET_MS) {
+      bucket = { startedAt: now - (now % BUCKET_MS), requests: 0, good: 0 };
+      tracked.buckets.push(bucket);
+      const longest = Math.max(...BURN_RATE_WINDOWS.map((window) => window.ms));
+      while (tracked.buckets[0].startedAt <= now - longest - BUCKET_MS) tracked.buckets.shift();
+    }
+    bucket.requests++;
+    if (good) bucket.good++;
+  }
+
+  report(now: number = Date.now()): LatencySloReport[] {
+    const budget = 1 - this.objective;
+    return [...this.tracked.values()].map(({ slo, requests, good, buckets }) => {
+      const burnRates = Object.fromEntries(
+        BURN_RATE_WINDOWS.map((window) => {
+          const recent = buckets.filter((bucket) => bucket.startedAt > now - window.ms - BUCKET_MS);
+          const total = recent.reduce((sum, bucket) => sum + bucket.requests, 0);
+          const bad = total - recent.reduce((sum, bucket) => sum + bucket.good, 0);
+          return [window.name, total === 0 ? 0 : bad / total / budget];
+        }),
+      ) as LatencySloReport["burnRates"];
+      return { endpoint: slo.endpoint, targetMs: slo.targetMs, requests, good, burnRates };
+    });
+  }
+}
+
+/** Times every request to a Recall callback with a latency target, including tenants' under /t/<tenant>/recall. */
+export function trackLatency(slos: LatencySlos): express.RequestHandler {
+  return (req, res, next) => {
+    const endpoint = /^(?:\/t\/[^/]+)?\/recall\/(.+?)\/?$/.exec(req.path)?.[1];
+    if (endpoint === undefined) {
+      next();
+      return;
+    }
+    const startedAt = process.hrtime.bigint();
+    res.on("finish", () => slos.record(endpoint, Number(process.hrtime.bigint() - startedAt) / 1e6, res.statusCode));
+    next();
+  };
+}
+
+export function latencySloJSON(slos: LatencySlos): Record<string, unknown> {
+  return {
+    objective: slos.objective,
+    endpoints: slos.report().map((report) => ({
+      endpoint: report.endpoint,
+      target_ms: report.targetMs,
+      requests: report.requests,
+      good: report.good,
+      compliance: report.requests === 0 ? null : report.good / report.requests,
+      burn_rates: report.burnRates,
+    })),
+  };
+}
+
+/** Renders the latency SLOs in the Prometheus text format; nothing when none are configured. */
+export function latencySloMetrics(slos: LatencySlos): string {
+  if (slos.size === 0) return "";
+  const reports = slos.report();
+  const label = (report: LatencySloReport) => `endpoint="${report.endpoint}"`;
+  const lines = [
+    "# HELP zoom_oauth_latency_slo_target_seconds The latency target of a Recall callback.",
+    "# TYPE zoom_oauth_latency_slo_target_seconds gauge",
+    ...reports.map((report) => `zoom_oauth_latency_slo_target_seconds{${label(report)}} ${report.targetMs / 1000}`),
+    "# HELP zoom_oauth_latency_slo_objective The share of requests that have to be good.",
+    "# TYPE zoom_oauth_latency_slo_objective gauge",
+    `zoom_oauth_latency_slo_objective ${slos.objective}`,
+    "# HELP zoom_oauth_latency_slo_requests_total Requests to a Recall callback with a latency target.",
+    "# TYPE zoom_oauth_latency_slo_requests_total counter",
+    ...reports.map((report) => `zoom_oauth_latency_slo_requests_total{${label(report)}} ${report.requests}`),
+    "# HELP zoom_oauth_latency_slo_good_requests_total Those answered below 500 within the target.",
+    "# TYPE zoom_oauth_latency_slo_good_requests_total counter",
+    ...reports.map((report) => `zoom_oauth_latency_slo_good_requests_total{${label(report)}} ${report.good}`),
+    "# HELP zoom_oauth_latency_slo_burn_rate How fast the error budget is spent over the window; 1 spends it as fast as it accrues.",
+    "# TYPE zoom_oauth_latency_slo_burn_rate gauge",
+    ...reports.flatMap((report) =>
+      BURN_RATE_WINDOWS.map((window) => `zoom_oauth_latency_slo_burn_rate{${label(report)},window="${window.name}"} ${report.burnRates[window.name].toFixed(3)}`),
+    ),
+  ];
+  return `${lines.join("\n")}\n`;
+}
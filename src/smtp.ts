@@ -0,0 +1,181 @@
+import { hostname } from "os";
+import { connect as connectTcp } from "net";
+import type { Socket } from "net";
+import { connect as connectTls } from "tls";
+
+const DEFAULT_SMTP_TIMEOUT_MS = 10 * 1000;
+
+export class SmtpError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "SmtpError";
+  }
+}
+
+export interface MailMessage {
+  from: string;
+  to: string[];
+  subject: string;
+  text: string;
+}
+
+interface SmtpReply {
+  code: number;
+  lines: string[];
+}
+
+/**
+ * Reads SMTP replies off one connection. Replies are collected as they
+ * arrive and handed out in order by next; the socket can be swapped for a
+ * TLS one after STARTTLS.
+ */
+class SmtpReader {
+  private socket: Socket;
+  private buffer = "";
+  private lines: string[] = [];
+  private readonly replies: (SmtpReply | Error)[] = [];
+  private waiting: ((reply: SmtpReply | Error) => void) | null = null;
+  private readonly onData = (chunk: Buffer) => this.receive(chunk.toString("utf8"));
+  private readonly onClose = () => this.push(new SmtpError("the mail server closed the connection"));
+  private readonly onError = (error: Error) => this.push(error);
+
+  constructor(socket: Socket) {
+    this.socket = socket;
+    this.attach();
+  }
+
+  get current(): Socket {
+    return this.socket;
+  }
+
+  /** Stops reading from the current socket, e.g. to hand it to TLS. */
+  detach(): Socket {
+    this.socket.off("data", this.onData).off("close", this.onClose).off("error", this.onError);
+    return this.socket;
+  }
+
+  replace(socket: Socket): void {
+    this.socket = socket;
+    this.attach();
+  }
+
+  next(): Promise<SmtpReply> {
+    const reply = this.replies.shift();
+    if (reply) return reply instanceof Error ? Promise.reject(reply) : Promise.resolve(reply);
+    return new Promise((resolve, reject) => {
+      this.waiting = (received) => (received instanceof Error ? reject(received) : resolve(received));
+    });
+  }
+
+  private attach(): void {
+    this.socket.on("data", this.onData).on("close", this.onClose).on("error", this.onError);
+  }
+
+  private receive(text: string): void {
+    this.buffer += text;
+    let end: number;
+    while ((end = this.buffer.indexOf("\r\n")) !== -1) {
+      const line = this.buffer.slice(0, end);
+      this.buffer = this.buffer.slice(end + 2);
+      this.lines.push(line.slice(4));
+      // "250-..." continues a reply, "250 ..." ends it
+      if (line[3] !== "-") {
+        this.push({ code: Number(line.slice(0, 3)), lines: this.lines });
+        this.lines = [];
+      }
+    }
+  }
+
+  private push(reply: SmtpReply | Error): void {
+    const waiting = this.waiting;
+    this.waiting = null;
+    if (waiting) waiting(reply);
+    else this.replies.push(reply);
+  }
+}
+
+function connect(url: URL): Promise<Socket> {
+  const host = url.hostname.replace(/^\[|\]$/g, "");
+  const tls = url.protocol === "smtps:";
+  const port = Number(url.port || (tls ? 465 : 587));
+  return new Promise((resolve, reject) => {
+    const socket = tls ? connectTls({ host, port, servername: host }) : connectTcp({ host, port });
+    socket.once(tls ? "secureConnect" : "connect", () => {
+      socket.off("error", reject);
+      resolve(socket);
+    });
+    socket.once("error", reject);
+  });
+}
+
+// lines starting with a dot get another one, so the message can't end the DATA command early
+function messageData(message: MailMessage): string {
+  const headers = [
+    `From: ${message.from}`,
+    `To: ${message.to.join(", ")}`,
+    `Subject: ${message.subject.replace(/[\r\n]+/g, " ")}`,
+    `Date: ${new Date().toUTCString()}`,
+    "MIME-Version: 1.0",
+    "Content-Type: text/plain; charset=utf-8",
+    "Content-Transfer-Encoding: 8bit",
+  ];
+  const body = message.text.replace(/\r?\n/g, "\r\n").replace(/^\./gm, "..");
+  return `${headers.join("\r\n")}\r\n\r\n${body}\r\n.\r\n`;
+}
+
+/**
+ * Sends one plain-text message through the mail server at url, either
+ * smtp://[user:password@]host[:port] (port 587, upgraded with STARTTLS when
+ * the server offers it) or smtps:// (port 465, TLS from the start).
+ */
+export async function sendMail(url: string, message: MailMessage, timeoutMs: number = DEFAULT_SMTP_TIMEOUT_MS): Promise<void> {
+  const server = new URL(url);
+  if (server.protocol !== "smtp:" && server.protocol !== "smtps:") {
+    throw new SmtpError(`unsupported mail server URL scheme ${server.protocol}, use smtp:// or smtps://`);
+  }
+  const reader = new SmtpReader(await connect(server));
+  const timer = setTimeout(() => reader.current.destroy(new SmtpError(`timed out talking to ${server.host}`)), timeoutMs);
+  const expect = async (codes: number[], what: string): Promise<SmtpReply> => {
+    const reply = await reader.next();
+    if (!codes.includes(reply.code)) {
+      throw new SmtpError(`mail server rejected ${what}: ${reply.code} ${reply.lines.join(" ")}`);
+    }
+    return reply;
+  };
+  const send = (command: string, codes: number[], what: string = command.split(" ")[0]) => {
+    reader.current.write(`${command}\r\n`);
+    return expect(codes, what);
+  };
+
+  try {
+    await expect([220], "the connection");
+    let hello = await send(`EHLO ${hostname()}`, [250]);
+    if (server.protocol === "smtp:" && hello.lines.some((line) => line.toUpperCase() === "STARTTLS")) {
+      await send("STARTTLS", [220]);
+      const plain = reader.detach();
+      const host = server.hostname.replace(/^\[|\]$/g, "");
+      const secure = await new Promise<Socket>((resolve, reject) => {
+        const upgraded = connectTls({ socket: plain, servername: host });
+        upgraded.once("secureConnect", () => resolve(upgraded));
+        upgraded.once("error", reject);
+      });
+      reader.replace(secure);
+      hello = await send(`EHLO ${hostname()}`, [250]);
+    }
+    if (server.username) {
+      const credentials = Buffer.from(`\0${decodeURIComponent(server.username)}\0${decodeURIComponent(server.password)}`).toString("base64");
+      await send(`AUTH PLAIN ${credentials}`, [235], "the credentials");
+    }
+    await send(`MAIL FROM:<${message.from}>`, [250], `the sender ${message.from}`);
+    for (const recipient of message.to) {
+      await send(`RCPT TO:<${recipient}>`, [250, 251], `the recipient ${recipient}`);
+    }
+    await send("DATA", [354]);
+    reader.current.write(messageData(message));
+    await expect([250], "the message");
+    await send("QUIT", [221]).catch(() => {});
+  } finally {
+    clearTimeout(timer);
+    reader.current.destroy();
+  }
+}
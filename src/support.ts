@@ -0,0 +1,212 @@
+import { format } from "util";
+import { gzipSync } from "zlib";
+import { aboutJSON } from "./about.js";
+import type { Config } from "./config.js";
+import type { HealthMonitor } from "./health.js";
+import { healthJSON } from "./health.js";
+import type { HttpClient } from "./zoomrecall/index.js";
+
+const MAX_LOG_LINES = 2000;
+const MAX_ZOOM_ERRORS = 50;
+// error bodies are short; anything longer is cut so one bad response can't crowd out the rest
+const MAX_ERROR_BODY_CHARS = 4000;
+const REDACTED = "[redacted]";
+// config fields, at any depth, whose values are secrets or carry one, e.g. Slack's webhook URL
+const SECRET_FIELD = /(secret|secrettoken|password|passphrase|apikey|routingkey|encryptionkey|previouskeys|vaulttoken|^token|slackalertwebhookurl)$/i;
+// bearer credentials, Zoom's JWT access tokens and the Recall callback secret in logged URLs
+const SECRET_PATTERNS: [RegExp, string][] = [
+  [/\b(Bearer|Basic)\s+[\w.~+/=-]+/g, `$1 ${REDACTED}`],
+  [/\beyJ[\w-]+\.[\w-]+\.[\w-]+/g, REDACTED],
+  [/\b(auth_token|access_token|refresh_token|code)=[^&\s"]+/g, `$1=${REDACTED}`],
+];
+
+export interface LogLine {
+  at: string;
+  level: "log" | "warn" | "error";
+  message: string;
+}
+
+const logLines: LogLine[] = [];
+let capturing = false;
+
+/**
+ * Keeps the last MAX_LOG_LINES lines written with console.log, warn and
+ * error, still writing them as before, so a support bundle can include
+ * recent logs. The console is shared by the whole process, so it is only
+ * wrapped once however often this is called.
+ */
+export function captureConsole(): void {
+  if (capturing) return;
+  capturing = true;
+  for (const level of ["log", "warn", "error"] as const) {
+    const write = console[level].bind(console);
+    console[level] = (...args: unknown[]) => {
+      logLines.push({ at: new Date().toISOString(), level, message: format(...args) });
+      if (logLines.length > MAX_LOG_LINES) logLines.shift();
+      write(...args);
+    };
+  }
+}
+
+/** The log lines captureConsole kept, oldest first. */
+export function recentLogs(): LogLine[] {
+  return [...logLines];
+}
+
+export interface ZoomErrorRecord {
+  at: string;
+  method: string;
+  // without the query, which can carry codes and tokens
+  url: string;
+  status: number;
+  body: string;
+}
+
+/** Keeps the last MAX_ZOOM_ERRORS error responses from Zoom, as Zoom sent them. */
+export class ZoomErrorLog {
+  private readonly baseUrls: string[];
+  private readonly errors: ZoomErrorRecord[] = [];
+
+  constructor(baseUrls: string[]) {
+    this.baseUrls = baseUrls;
+  }
+
+  wrap(httpClient: HttpClient): HttpClient {
+    return async (input, init) => {
+      const response = await httpClient(input, init);
+      const url = input.toString();
+      if (!response.ok && this.baseUrls.some((base) => url.startsWith(base))) {
+        // a copy, the caller reads the body too
+        const body = await response
+          .clone()
+          .text()
+          .catch((error: unknown) => `(unreadable: ${error instanceof Error ? error.message : String(error)})`);
+        this.errors.push({
+          at: new Date().toISOString(),
+          method: init?.method ?? "GET",
+          url: url.split("?")[0],
+          status: response.status,
+          body: body.slice(0, MAX_ERROR_BODY_CHARS),
+        });
+        if (this.errors.length > MAX_ZOOM_ERRORS) this.errors.shift();
+      }
+      return response;
+    };
+  }
+
+  list(): ZoomErrorRecord[] {
+    return [...this.errors];
+  }
+}
+
+// every secret in the config, to be blanked wherever it turns up, e.g. in a log line
+function secretValues(value: unknown, field = ""): string[] {
+  if (Buffer.isBuffer(value)) return [value.toString("base64"), value.toString("hex")];
+  if (typeof value === "string") return SECRET_FIELD.test(field) && value.length >= 6 ? [value] : [];
+  if (Array.isArray(value)) return value.flatMap((item) => secretValues(item, field));
+  if (value instanceof Map) return [...value.values()].flatMap((item) => secretValues(item, field));
+  if (value && typeof value === "object") return Object.entries(value).flatMap(([key, item]) => secretValues(item, key));
+  return [];
+}
+
+/** The config with every secret replaced, and credentials taken out of URLs. */
+export function redactedConfig(value: unknown, field = ""): unknown {
+  if (Buffer.isBuffer(value)) return REDACTED;
+  if (typeof value === "string") {
+    if (SECRET_FIELD.test(field)) return value ? REDACTED : value;
+    // e.g. a password in REDIS_URL or SMTP_URL
+    return value.replace(/^([a-z][a-z0-9+.-]*:\/\/)[^/@]*@/i, `$1${REDACTED}@`);
+  }
+  if (Array.isArray(value)) return value.map((item) => redactedConfig(item, field));
+  if (value instanceof Map) return Object.fromEntries([...value].map(([key, item]) => [String(key), redactedConfig(item, String(key))]));
+  if (value && typeof value === "object") {
+    return Object.fromEntries(Object.entries(value).map(([key, item]) => [key, redactedConfig(item, key)]));
+  }
+  return value;
+}
+
+// a tar file of one directory of regular files, enough for any tar to unpack
+function tarArchive(directory: string, files: { name: string; contents: string }[]): Buffer {
+  const blocks: Buffer[] = [];
+  const mtime = Math.floor(Date.now() / 1000);
+  for (const file of files) {
+    const contents = Buffer.from(file.contents, "utf8");
+    const header = Buffer.alloc(512);
+    const field = (offset: number, length: number, value: string) => header.write(value, offset, length, "ascii");
+    const octal = (offset: number, length: number, value: number) => field(offset, length, `${value.toString(8).padStart(length - 1, "0")}\0`);
+    field(0, 100, `${directory}/${file.name}`);
+    octal(100, 8, 0o600);
+    octal(108, 8, 0);
+    octal(116, 8, 0);
+    octal(124, 12, contents.length);
+    octal(136, 12, mtime);
+    // the checksum is taken with its own field as spaces
+    field(148, 8, "        ");
+    field(156, 1, "0");
+    field(257, 6, "ustar\0");
+    field(263, 2, "00");
+    let checksum = 0;
+    for (const byte of header) checksum += byte;
+    field(148, 8, `${checksum.toString(8).padStart(6, "0")}\0 `);
+    blocks.push(header, contents, Buffer.alloc((512 - (contents.length % 512)) % 512));
+  }
+  blocks.push(Buffer.alloc(1024));
+  return Buffer.concat(blocks);
+}
+
+export interface SupportBundleOptions {
+  config: Config;
+  health: HealthMonitor;
+  zoomErrors: ZoomErrorLog;
+}
+
+/**
+ * Gathers what support needs to look into a misbehaving deployment into
+ * one .tar.gz: version and features, the config, the health state, recent
+ * error responses from Zoom and recent log lines. Secrets are replaced
+ * throughout, as are tokens and callback secrets in logs; user and meeting
+ * IDs are left in, they are what a problem is traced by.
+ */
+export class SupportBundle {
+  private readonly config: Config;
+  private readonly health: HealthMonitor;
+  private readonly zoomErrors: ZoomErrorLog;
+
+  constructor(options: SupportBundleOptions) {
+    this.config = options.config;
+    this.health = options.health;
+    this.zoomErrors = options.zoomErrors;
+  }
+
+  /** The name the bundle is saved under, without extension, e.g. "support-bundle-pod-1-20261014T120000Z". */
+  name(now: Date = new Date()): string {
+    return `support-bundle-${this.config.instanceId}-${now.toISOString().replace(/[-:]|\.\d+/g, "")}`;
+  }
+
+  archive(now: Date = new Date()): Buffer {
+    const secrets = [...new Set(secretValues(this.config))].sort((a, b) => b.length - a.length);
+    const redact = (text: string) =>
+      SECRET_PATTERNS.reduce(
+        (redacted, [pattern, replacement]) => redacted.replace(pattern, replacement),
+        secrets.reduce((redacted, secret) => redacted.split(secret).join(REDACTED), text),
+      );
+    const json = (value: unknown) => `${JSON.stringify(value, null, 2)}\n`;
+    const files = [
+      {
+        name: "version.json",
+        contents: json({
+          ...aboutJSON(this.config),
+          generated_at: now.toISOString(),
+          node_version: process.version,
+          platform: `${process.platform}-${process.arch}`,
+          uptime_seconds: Math.round(process.uptime()),
+        }),
+      },
+      { name: "config.json", contents: json(redactedConfig(this.config)) },
+      { name: "health.json", contents: json(healthJSON(this.health.report())) },
+      { name: "zoom-errors.json", contents: redact(json(this.zoomErrors.list())) },
+      { name: "logs.txt", contents: redact(recentLogs().map((line) => `${line.at} ${line.level.toUpperCase()} ${line.message}\n`).join("")) },
+    ];
+    return gzipSync(tarArchive(this.name(now), files));
+  }
+}
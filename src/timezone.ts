@@ -0,0 +1,38 @@
+export const DEFAULT_TIME_ZONE = "UTC";
+
+/** Reports whether name is an IANA time zone this Node.js knows, e.g. "Europe/Berlin". */
+export function isTimeZone(name: string): boolean {
+  try {
+    new Intl.DateTimeFormat("en-US", { timeZone: name });
+    return true;
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Formats date as local time in timeZone with that zone's abbreviation or
+ * offset at that moment, e.g. "2026-03-08 03:00 EDT", so times on either
+ * side of a DST change read correctly.
+ */
+export function formatTime(date: Date, timeZone: string = DEFAULT_TIME_ZONE): string {
+  const parts = new Intl.DateTimeFormat("en-US", {
+    timeZone,
+    year: "numeric",
+    month: "2-digit",
+    day: "2-digit",
+    hour: "2-digit",
+    minute: "2-digit",
+    hourCycle: "h23",
+    timeZoneName: "short",
+  }).formatToParts(date);
+  const part = (type: Intl.DateTimeFormatPartTypes) => parts.find((candidate) => candidate.type === type)?.value ?? "";
+  return `${part("year")}-${part("month")}-${part("day")} ${part("hour")}:${part("minute")} ${part("timeZoneName")}`;
+}
+
+/** formatTime for an ISO timestamp as found in JSON; anything else is returned unchanged. */
+export function formatTimestamp(value: unknown, timeZone: string = DEFAULT_TIME_ZONE): string {
+  if (typeof value !== "string") return String(value);
+  const date = new Date(value);
+  return Number.isNaN(date.getTime()) ? value : formatTime(date, timeZone);
+}
@@ -0,0 +1,174 @@
+import { createHmac, randomUUID } from "crypto";
+import type { Job, JobJournal } from "./jobs.js";
+import type { Notifier } from "./notify.js";
+import type { HttpClient } from "./zoomrecall/index.js";
+
+export const WEBHOOK_EVENT_TYPES = [
+  "token.refreshed",
+  "token.reauthorization_required",
+  "token.deactivated",
+  "token.scopes_narrowed",
+  "token.reauthorization_due",
+  "token.served",
+  "bot.launched",
+  "bot.done",
+  "transcript.ready",
+  "recording.completed",
+  "issuance.anomaly",
+  "canary.triggered",
+  "health.changed",
+] as const;
+export type WebhookEventType = (typeof WEBHOOK_EVENT_TYPES)[number];
+
+export interface WebhookEvent {
+  id: string;
+  type: WebhookEventType;
+  created_at: string;
+  data: Record<string, unknown>;
+}
+
+export const DEFAULT_WEBHOOK_MAX_ATTEMPTS = 6;
+export const DEFAULT_WEBHOOK_RETRY_DELAY_MS = 1000;
+
+/** Signs `${timestamp}.${body}` the way receivers are told to verify the X-Webhook-Signature header. */
+export function signWebhook(secret: string, timestamp: number, body: string): string {
+  return `v1=${createHmac("sha256", secret).update(`${timestamp}.${body}`).digest("hex")}`;
+}
+
+export interface WebhookDispatcherOptions {
+  urls: string[];
+  secret: string;
+  httpClient: HttpClient;
+  maxAttempts?: number;
+  // delay before the first retry; doubles with every further attempt
+  retryDelayMs?: number;
+  // keeps pending deliveries across restarts; see resume
+  journal?: JobJournal;
+}
+
+interface Delivery {
+  // the journal's job ID; one per event and URL
+  id: string;
+  url: string;
+  event: WebhookEvent;
+  attempt: number;
+}
+
+/**
+ * Delivers events to customer webhook URLs with an HMAC signature, retrying
+ * failed deliveries with exponential backoff. Pending deliveries are only
+ * kept in memory unless a journal is given.
+ */
+export class WebhookDispatcher implements Notifier {
+  readonly name = "webhook";
+  private readonly urls: string[];
+  private readonly secret: string;
+  private readonly httpClient: HttpClient;
+  private readonly maxAttempts: number;
+  private readonly retryDelayMs: number;
+  private readonly journal: JobJournal | undefined;
+  private readonly retryTimers = new Set<NodeJS.Timeout>();
+
+  constructor(options: WebhookDispatcherOptions) {
+    this.urls = options.urls;
+    this.secret = options.secret;
+    this.httpClient = options.httpClient;
+    this.maxAttempts = options.maxAttempts ?? DEFAULT_WEBHOOK_MAX_ATTEMPTS;
+    this.retryDelayMs = options.retryDelayMs ?? DEFAULT_WEBHOOK_RETRY_DELAY_MS;
+    this.journal = options.journal;
+  }
+
+  /** Queues event for every configured URL; a no-op when none are configured. */
+  async send(event: WebhookEvent): Promise<void> {
+    for (const url of this.urls) {
+      const delivery: Delivery = { id: randomUUID(), url, event, attempt: 1 };
+      this.record(delivery, new Date());
+      void this.deliver(delivery);
+    }
+  }
+
+  /**
+   * Picks up the deliveries the journal says were pending when the process
+   * last stopped, at the attempt and time they were due. They keep their
+   * event ID, so receivers deduplicating on X-Webhook-Id see each event once
+   * even if it was delivered just before the stop.
+   */
+  resume(): void {
+    for (const job of this.journal?.pending("webhook.delivery") ?? []) {
+      const delivery = deliveryFromJob(job);
+      if (!this.urls.includes(delivery.url)) {
+        console.warn(`dropping pending ${delivery.event.type} event ${delivery.event.id} for ${delivery.url}, which is no longer in WEBHOOK_URLS`);
+        this.journal!.done(job.id);
+        continue;
+      }
+      this.later(delivery, Math.max(0, Date.parse(job.due_at) - Date.now()));
+    }
+  }
+
+  /** Cancels pending retries, e.g. before shutting down. */
+  close(): void {
+    for (const timer of this.retryTimers) {
+      clearTimeout(timer);
+    }
+    this.retryTimers.clear();
+  }
+
+  private async deliver(delivery: Delivery): Promise<void> {
+    const { url, event, attempt } = delivery;
+    const body = JSON.stringify(event);
+    const timestamp = Math.floor(Date.now() / 1000);
+    let failure: string;
+    try {
+      const response = await this.httpClient(url, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+          "X-Webhook-Id": event.id,
+          "X-Webhook-Timestamp": String(timestamp),
+          "X-Webhook-Signature": signWebhook(this.secret, timestamp, body),
+        },
+        body,
+      });
+      if (response.ok) {
+        this.journal?.done(delivery.id);
+        return;
+      }
+      failure = `status ${response.status}`;
+    } catch (error) {
+      failure = error instanceof Error ? error.message : String(error);
+    }
+
+    if (attempt >= this.maxAttempts) {
+      console.error(`giving up delivering ${event.type} event ${event.id} to ${url} after ${attempt} attempts: ${failure}`);
+      this.journal?.done(delivery.id);
+      return;
+    }
+    const delay = this.retryDelayMs * 2 ** (attempt - 1);
+    console.warn(`delivering ${event.type} event ${event.id} to ${url} failed (${failure}), retrying in ${delay}ms`);
+    const retry: Delivery = { ...delivery, attempt: attempt + 1 };
+    this.record(retry, new Date(Date.now() + delay));
+    this.later(retry, delay);
+  }
+
+  private later(delivery: Delivery, delay: number): void {
+    const timer = setTimeout(() => {
+      this.retryTimers.delete(timer);
+      void this.deliver(delivery);
+    }, delay);
+    this.retryTimers.add(timer);
+  }
+
+  private record(delivery: Delivery, dueAt: Date): void {
+    this.journal?.schedule({
+      id: delivery.id,
+      kind: "webhook.delivery",
+      due_at: dueAt.toISOString(),
+      payload: { url: delivery.url, event: delivery.event, attempt: delivery.attempt },
+    });
+  }
+}
+
+function deliveryFromJob(job: Job): Delivery {
+  const { url, event, attempt } = job.payload as { url: string; event: WebhookEvent; attempt: number };
+  return { id: job.id, url, event, attempt };
+}
@@ -0,0 +1,98 @@
+import { HttpError } from "./errors.js";
+import { DEFAULT_REFRESH_POLICY, retryRefreshDelay } from "./schedule.js";
+import { TokenManager } from "./tokens.js";
+import type { TokenManagerOptions, UserSyncResult, UserTokens } from "./tokens.js";
+
+export interface AccountTokenManagerOptions extends Omit<TokenManagerOptions, "provider" | "userSyncIntervalMs"> {
+  // the Zoom account the Server-to-Server OAuth app belongs to
+  accountId: string;
+}
+
+/**
+ * A TokenManager for Zoom Server-to-Server OAuth apps. Nobody consents: one
+ * access token for the whole account, stored under the account ID, is got
+ * with the account_credentials grant and got again ahead of its expiry. OBF
+ * and ZAK tokens are minted with it for any user of the account, whom
+ * callers name by Zoom user ID or email instead of a connected user ID.
+ */
+export class AccountTokenManager extends TokenManager {
+  readonly accountId: string;
+  private retryTimer: NodeJS.Timeout | null = null;
+
+  constructor(options: AccountTokenManagerOptions) {
+    const { zoom, accountId } = options;
+    super({
+      ...options,
+      provider: {
+        exchangeCode: async () => {
+          throw new HttpError(404, "this server uses server-to-server oauth, users don't consent");
+        },
+        // there is no refresh token, the account credentials get a new access token
+        refreshToken: () => zoom.requestAccountToken(accountId),
+      },
+      // an account has no users of its own to check, see syncUsers
+      userSyncIntervalMs: 0,
+    });
+    this.accountId = accountId;
+    // a token restored from the store keeps being renewed, otherwise the first one is got now
+    this.ready.then(
+      () => (this.has(accountId) ? undefined : this.connectAccount()),
+      () => this.connectAccount(),
+    );
+  }
+
+  /** Gets a new account token now, retrying until Zoom hands one out. */
+  async connectAccount(): Promise<void> {
+    if (this.retryTimer) {
+      clearTimeout(this.retryTimer);
+      this.retryTimer = null;
+    }
+    try {
+      this.set(this.accountId, await this.zoom.requestAccountToken(this.accountId));
+      console.log(`got a server-to-server oauth token for zoom account ${this.accountId}`);
+    } catch (error) {
+      const delayMs = retryRefreshDelay(DEFAULT_REFRESH_POLICY);
+      console.error(`could not get a server-to-server oauth token for zoom account ${this.accountId}, retrying in ${delayMs}ms`, error);
+      this.retryTimer = setTimeout(() => void this.connectAccount(), delayMs);
+    }
+  }
+
+  /** Serves only the account's own token; users of the account have none, only OBF and ZAK tokens. */
+  override get(userId: string): UserTokens {
+    if (userId !== this.accountId) {
+      throw new HttpError(400, `${userId} has no access token of their own with server-to-server oauth, ask for an OBF or ZAK token`);
+    }
+    return super.get(userId);
+  }
+
+  override close(): void {
+    super.close();
+    if (this.retryTimer) {
+      clearTimeout(this.retryTimer);
+    }
+  }
+
+  // Zoom takes an email wherever it takes a user ID
+  override async userForEmail(email: string): Promise<string> {
+    return email;
+  }
+
+  // any user of the account can host, so it is whoever Zoom says hosts the meeting
+  override async resolveHost(meetingId: string): Promise<string> {
+    return (await this.zoom.getMeeting(this.get(this.accountId).accessToken, meetingId)).hostId;
+  }
+
+  // the account's users never connect one by one, so nobody's PMI is known
+  override async personalMeeting(): Promise<{ userId: string; pmi: string } | undefined> {
+    return undefined;
+  }
+
+  // the account's users come and go at Zoom, and tokens minted for one who is gone are refused there
+  override async syncUsers(): Promise<UserSyncResult> {
+    return { checked: 0, deactivated: [] };
+  }
+
+  protected override minter(userId: string): { tokenUserId: string; zoomUserId: string } {
+    return { tokenUserId: this.accountId, zoomUserId: userId };
+  }
+}
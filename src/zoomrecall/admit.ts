@@ -0,0 +1,104 @@
+import type { JobJournal } from "../jobs.js";
+import type { TokenManager } from "./tokens.js";
+
+export interface WaitingRoomParticipant {
+  meetingId: string;
+  // the meeting host's Zoom user ID
+  hostZoomUserId: string;
+  // identifies the participant across events, e.g. Zoom's participant_uuid
+  participantKey: string;
+  // what Zoom's API addresses the participant by in the meeting, the user_id of participant webhooks
+  participantId: string;
+  name: string;
+}
+
+export interface WaitingRoomAdmission {
+  meetingId: string;
+  // the connected host whose token admitted the bot
+  userId: string;
+  botName: string;
+}
+
+export interface WaitingRoomAdmitterOptions {
+  tokens: TokenManager;
+  // display names of bots to admit, compared case-insensitively
+  botNames: string[];
+  onAdmitted?(admission: WaitingRoomAdmission): void;
+  // waiting rooms earlier versions turned off and left to turn back on; see resume
+  journal?: JobJournal;
+}
+
+/**
+ * Lets Recall bots through the waiting room of meetings hosted by connected
+ * users. Each bot is admitted on its own with the host's token, so the
+ * waiting room stays on for everyone else. Fed by Zoom meeting participant
+ * webhooks; the admissions in progress are kept in memory.
+ */
+export class WaitingRoomAdmitter {
+  private readonly tokens: TokenManager;
+  private readonly botNames: Set<string>;
+  private readonly onAdmitted: ((admission: WaitingRoomAdmission) => void) | undefined;
+  private readonly journal: JobJournal | undefined;
+  // meeting ID and participant key of bots being admitted, so a repeated webhook doesn't admit them twice
+  private readonly admitting = new Set<string>();
+
+  constructor(options: WaitingRoomAdmitterOptions) {
+    this.tokens = options.tokens;
+    this.botNames = new Set(options.botNames.map((name) => name.trim().toLowerCase()));
+    this.onAdmitted = options.onAdmitted;
+    this.journal = options.journal;
+  }
+
+  /**
+   * Turns back on the waiting rooms the journal says were turned off by an
+   * earlier version, which admitted bots that way, when it last stopped.
+   * Turning a waiting room on twice is harmless.
+   */
+  async resume(): Promise<void> {
+    for (const job of this.journal?.pending("waiting_room.restore") ?? []) {
+      const { meeting_id: meetingId, user_id: userId } = job.payload as { meeting_id: string; user_id: string };
+      try {
+        await this.tokens.setWaitingRoom(userId, meetingId, true);
+        console.log(`turned the waiting room of meeting ${meetingId} back on`);
+      } catch (error) {
+        console.warn(`could not turn the waiting room of meeting ${meetingId} back on`, error);
+      }
+      this.journal?.done(job.id);
+    }
+  }
+
+  isBot(name: string): boolean {
+    return this.botNames.has(name.trim().toLowerCase());
+  }
+
+  /**
+   * Handles a participant entering the waiting room, admitting them if
+   * they're a bot. Rejects if Zoom didn't admit them, so handling the same
+   * participant again tries once more.
+   */
+  async participantWaiting(participant: WaitingRoomParticipant): Promise<void> {
+    const { meetingId, name } = participant;
+    const key = `${meetingId}:${participant.participantKey}`;
+    if (!this.isBot(name) || this.admitting.has(key)) return;
+    if (!participant.participantId) {
+      console.log(`not admitting ${name} to meeting ${meetingId}: zoom didn't say which participant it is`);
+      return;
+    }
+
+    this.admitting.add(key);
+    try {
+      const userId = await this.tokens.userForZoomUser(participant.hostZoomUserId);
+      if (userId === undefined) {
+        console.log(`not admitting ${name} to meeting ${meetingId}: its host hasn't connected`);
+        return;
+      }
+      await this.tokens.admitParticipant(userId, meetingId, participant.participantId);
+      console.log(`admitted ${name} to meeting ${meetingId} from the waiting room`);
+      this.onAdmitted?.({ meetingId, userId, botName: name });
+    } catch (error) {
+      throw new Error(`could not admit ${name} to meeting ${meetingId}: ${error instanceof Error ? error.message : String(error)}`, { cause: error });
+    } finally {
+      this.admitting.delete(key);
+    }
+  }
+}
@@ -0,0 +1,241 @@
+import { createHash, createHmac } from "crypto";
+import { readFile } from "fs/promises";
+import type { HttpClient } from "./http.js";
+
+// refreshes temporary credentials this long before they expire
+const AWS_CREDENTIALS_MARGIN_MS = 5 * 60 * 1000;
+const ECS_CREDENTIALS_HOST = "http://169.254.170.2";
+
+export class AwsError extends Error {
+  readonly status: number;
+  // the exception's name, e.g. "ResourceNotFoundException"
+  readonly code: string;
+
+  constructor(status: number, code: string, message: string) {
+    super(message);
+    this.name = "AwsError";
+    this.status = status;
+    this.code = code;
+  }
+}
+
+export interface AwsCredentials {
+  accessKeyId: string;
+  secretAccessKey: string;
+  sessionToken?: string;
+  // null for long-lived keys
+  expiresAt: number | null;
+}
+
+/**
+ * Where AWS credentials come from, as found in the environment: keys set
+ * directly, the web identity token EKS mounts for a service account's role
+ * (IRSA), or the credentials endpoint ECS and EKS Pod Identity provide.
+ */
+export type AwsCredentialSource =
+  | { kind: "static"; accessKeyId: string; secretAccessKey: string; sessionToken?: string }
+  | { kind: "web-identity"; roleArn: string; tokenFile: string; sessionName: string }
+  | { kind: "container"; url: string; authorizationToken?: string; authorizationTokenFile?: string };
+
+/** The credential source the standard AWS variables in env describe, or null if they describe none. */
+export function awsCredentialSource(env: NodeJS.ProcessEnv): AwsCredentialSource | null {
+  if (env.AWS_ACCESS_KEY_ID && env.AWS_SECRET_ACCESS_KEY) {
+    return { kind: "static", accessKeyId: env.AWS_ACCESS_KEY_ID, secretAccessKey: env.AWS_SECRET_ACCESS_KEY, sessionToken: env.AWS_SESSION_TOKEN || undefined };
+  }
+  if (env.AWS_WEB_IDENTITY_TOKEN_FILE && env.AWS_ROLE_ARN) {
+    return { kind: "web-identity", roleArn: env.AWS_ROLE_ARN, tokenFile: env.AWS_WEB_IDENTITY_TOKEN_FILE, sessionName: env.AWS_ROLE_SESSION_NAME || "zoom-oauth-server" };
+  }
+  const url = env.AWS_CONTAINER_CREDENTIALS_FULL_URI || (env.AWS_CONTAINER_CREDENTIALS_RELATIVE_URI && `${ECS_CREDENTIALS_HOST}${env.AWS_CONTAINER_CREDENTIALS_RELATIVE_URI}`);
+  if (url) {
+    return {
+      kind: "container",
+      url,
+      authorizationToken: env.AWS_CONTAINER_AUTHORIZATION_TOKEN || undefined,
+      authorizationTokenFile: env.AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE || undefined,
+    };
+  }
+  return null;
+}
+
+export interface AwsCredentialProviderOptions {
+  source: AwsCredentialSource;
+  httpClient: HttpClient;
+  // STS is only called for web identity; its regional endpoint is used unless stsEndpoint is given
+  region: string;
+  stsEndpoint?: string;
+}
+
+/** Hands out credentials from source, fetching temporary ones again shortly before they expire. */
+export class AwsCredentialProvider {
+  private readonly options: AwsCredentialProviderOptions;
+  private current: Promise<AwsCredentials> | null = null;
+
+  constructor(options: AwsCredentialProviderOptions) {
+    this.options = options;
+  }
+
+  async get(): Promise<AwsCredentials> {
+    const credentials = this.current && (await this.current.catch(() => null));
+    if (credentials && (credentials.expiresAt === null || credentials.expiresAt - AWS_CREDENTIALS_MARGIN_MS > Date.now())) {
+      return credentials;
+    }
+    this.current = this.fetch();
+    return this.current;
+  }
+
+  private async fetch(): Promise<AwsCredentials> {
+    const { source, httpClient } = this.options;
+    if (source.kind === "static") {
+      return { accessKeyId: source.accessKeyId, secretAccessKey: source.secretAccessKey, sessionToken: source.sessionToken, expiresAt: null };
+    }
+    if (source.kind === "container") {
+      const token = source.authorizationTokenFile ? (await readFile(source.authorizationTokenFile, "utf8")).trim() : source.authorizationToken;
+      const response = await httpClient(source.url, { headers: token ? { Authorization: token } : {} });
+      if (!response.ok) {
+        throw new AwsError(response.status, "CredentialsError", `the container credentials endpoint answered ${response.status}: ${await response.text()}`);
+      }
+      const body = (await response.json()) as { AccessKeyId: string; SecretAccessKey: string; Token?: string; Expiration?: string };
+      return {
+        accessKeyId: body.AccessKeyId,
+        secretAccessKey: body.SecretAccessKey,
+        sessionToken: body.Token,
+        expiresAt: body.Expiration ? new Date(body.Expiration).getTime() : null,
+      };
+    }
+
+    // AssumeRoleWithWebIdentity is authenticated by the token itself, so the request isn't signed
+    const query = new URLSearchParams({
+      Action: "AssumeRoleWithWebIdentity",
+      Version: "2011-06-15",
+      RoleArn: source.roleArn,
+      RoleSessionName: source.sessionName,
+      WebIdentityToken: (await readFile(source.tokenFile, "utf8")).trim(),
+    });
+    const endpoint = this.options.stsEndpoint ?? `https://sts.${this.options.region}.amazonaws.com`;
+    const response = await httpClient(`${endpoint.replace(/\/+$/, "")}/?${query}`, { headers: { Accept: "application/json" } });
+    if (!response.ok) {
+      throw new AwsError(response.status, "CredentialsError", `sts refused to assume ${source.roleArn} with ${response.status}: ${await response.text()}`);
+    }
+    const body = (await response.json()) as {
+      AssumeRoleWithWebIdentityResponse: {
+        AssumeRoleWithWebIdentityResult: { Credentials: { AccessKeyId: string; SecretAccessKey: string; SessionToken: string; Expiration: number | string } };
+      };
+    };
+    const credentials = body.AssumeRoleWithWebIdentityResponse.AssumeRoleWithWebIdentityResult.Credentials;
+    return {
+      accessKeyId: credentials.AccessKeyId,
+      secretAccessKey: credentials.SecretAccessKey,
+      sessionToken: credentials.SessionToken,
+      // seconds since the epoch in STS's JSON, an ISO timestamp in its XML
+      expiresAt: typeof credentials.Expiration === "number" ? credentials.Expiration * 1000 : new Date(credentials.Expiration).getTime(),
+    };
+  }
+}
+
+function sha256(data: string | Buffer): string {
+  return createHash("sha256").update(data).digest("hex");
+}
+
+function hmac(key: string | Buffer, data: string): Buffer {
+  return createHmac("sha256", key).update(data).digest();
+}
+
+// RFC 3986, which is stricter than encodeURIComponent
+function awsEncode(value: string): string {
+  return encodeURIComponent(value).replace(/[!'()*]/g, (character) => `%${character.charCodeAt(0).toString(16).toUpperCase()}`);
+}
+
+export interface AwsRequest {
+  method: string;
+  url: URL;
+  headers: Record<string, string>;
+  body: string;
+  service: string;
+  region: string;
+}
+
+/** The headers to send request with, including its Signature Version 4 Authorization, signed at now. */
+export function signAwsRequest(request: AwsRequest, credentials: AwsCredentials, now: Date = new Date()): Record<string, string> {
+  const amzDate = now.toISOString().replace(/[:-]|\.\d{3}/g, "");
+  const date = amzDate.slice(0, 8);
+  const headers: Record<string, string> = { ...request.headers, host: request.url.host, "x-amz-date": amzDate };
+  if (credentials.sessionToken) headers["x-amz-security-token"] = credentials.sessionToken;
+
+  const names = Object.keys(headers).map((name) => name.toLowerCase()).sort();
+  const lowercased = Object.fromEntries(Object.entries(headers).map(([name, value]) => [name.toLowerCase(), value]));
+  const canonicalHeaders = names.map((name) => `${name}:${lowercased[name].trim().replace(/\s+/g, " ")}\n`).join("");
+  const signedHeaders = names.join(";");
+  const query = [...request.url.searchParams]
+    .map(([name, value]) => [awsEncode(name), awsEncode(value)])
+    .sort(([a, x], [b, y]) => (a === b ? (x < y ? -1 : 1) : a < b ? -1 : 1))
+    .map(([name, value]) => `${name}=${value}`)
+    .join("&");
+  const path = request.url.pathname.split("/").map((segment) => awsEncode(decodeURIComponent(segment))).join("/") || "/";
+  const canonicalRequest = [request.method, path, query, canonicalHeaders, signedHeaders, sha256(request.body)].join("\n");
+
+  const scope = `${date}/${request.region}/${request.service}/aws4_request`;
+  const stringToSign = ["AWS4-HMAC-SHA256", amzDate, scope, sha256(canonicalRequest)].join("\n");
+  const key = hmac(hmac(hmac(hmac(`AWS4${credentials.secretAccessKey}`, date), request.region), request.service), "aws4_request");
+  const signature = createHmac("sha256", key).update(stringToSign).digest("hex");
+  headers.authorization = `AWS4-HMAC-SHA256 Credential=${credentials.accessKeyId}/${scope}, SignedHeaders=${signedHeaders}, Signature=${signature}`;
+  return headers;
+}
+
+export interface AwsJsonClientOptions {
+  // e.g. "secretsmanager", as signed
+  service: string;
+  // prefix of the X-Amz-Target header, e.g. "secretsmanager"
+  targetPrefix: string;
+  // the protocol version in the content type; DynamoDB only speaks 1.0
+  jsonVersion?: "1.0" | "1.1";
+  region: string;
+  credentials: AwsCredentialProvider;
+  httpClient: HttpClient;
+  // defaults to https://<service>.<region>.amazonaws.com
+  endpoint?: string;
+}
+
+/** Calls actions of an AWS service that speaks the JSON protocol, such as Secrets Manager. */
+export class AwsJsonClient {
+  readonly endpoint: string;
+  private readonly options: AwsJsonClientOptions;
+
+  constructor(options: AwsJsonClientOptions) {
+    this.options = options;
+    this.endpoint = (options.endpoint ?? `https://${options.service}.${options.region}.amazonaws.com`).replace(/\/+$/, "");
+  }
+
+  async call<T>(action: string, input: Record<string, unknown>): Promise<T> {
+    const { service, targetPrefix, jsonVersion = "1.1", region, credentials, httpClient } = this.options;
+    const body = JSON.stringify(input);
+    const url = new URL(`${this.endpoint}/`);
+    const headers = signAwsRequest(
+      {
+        method: "POST",
+        url,
+        headers: { "content-type": `application/x-amz-json-${jsonVersion}`, "x-amz-target": `${targetPrefix}.${action}` },
+        body,
+        service,
+        region,
+      },
+      await credentials.get(),
+    );
+    // fetch sets Host itself
+    delete headers.host;
+    const response = await httpClient(url, { method: "POST", headers, body });
+    const text = await response.text();
+    if (!response.ok) {
+      let code = "UnknownError";
+      let message = text;
+      try {
+        const error = JSON.parse(text) as { __type?: string; message?: string; Message?: string };
+        code = error.__type?.split("#").pop() ?? code;
+        message = error.message ?? error.Message ?? text;
+      } catch {
+        // not JSON, e.g. from a proxy in between
+      }
+      throw new AwsError(response.status, code, `${service} ${action} failed with ${response.status} ${code}: ${message}`);
+    }
+    return (text ? JSON.parse(text) : {}) as T;
+  }
+}
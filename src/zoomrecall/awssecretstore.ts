@@ -0,0 +1,110 @@
+import { AwsError, AwsJsonClient } from "./aws.js";
+import type { AwsCredentialProvider } from "./aws.js";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+const SECRET_FORMAT_VERSION = 1;
+
+// the same layout as the JSON file store's file
+interface SecretContents {
+  version: number;
+  providers: Record<string, StoredTokensJSON[]>;
+}
+
+export interface AwsSecretsManagerTokenStoreOptions {
+  // ARN of a secret that already exists, e.g. arn:aws:secretsmanager:eu-west-1:123456789012:secret:zoom-oauth-AbCdEf
+  secretArn: string;
+  credentials: AwsCredentialProvider;
+  httpClient: HttpClient;
+  // defaults to the regional Secrets Manager endpoint of the ARN's region
+  endpoint?: string;
+}
+
+/** The region in a Secrets Manager ARN, or null if arn isn't one. */
+export function secretArnRegion(arn: string): string | null {
+  return /^arn:aws[\w-]*:secretsmanager:([a-z0-9-]+):\d{12}:secret:.+$/.exec(arn)?.[1] ?? null;
+}
+
+/**
+ * Keeps token managers' users in one AWS Secrets Manager secret, as the
+ * same JSON document the file store writes, for ECS and EKS deployments
+ * without a local disk. Every user is read from the secret at startup and
+ * the whole document is written back as a new secret version whenever a
+ * user connects, is refreshed or removed. Meant for one instance, like the
+ * file store.
+ */
+export class AwsSecretsManagerTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly client: AwsJsonClient;
+  private contents: SecretContents | null = null;
+  // writes go out one at a time, each with every change before it
+  private writing: Promise<void> = Promise.resolve();
+
+  constructor(options: AwsSecretsManagerTokenStoreOptions) {
+    const region = secretArnRegion(options.secretArn);
+    if (!region) {
+      throw new Error(`${options.secretArn} is not a Secrets Manager secret ARN`);
+    }
+    this.path = options.secretArn;
+    this.client = new AwsJsonClient({
+      service: "secretsmanager",
+      targetPrefix: "secretsmanager",
+      region,
+      credentials: options.credentials,
+      httpClient: options.httpClient,
+      endpoint: options.endpoint,
+    });
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    this.contents = await this.read();
+    return (this.contents.providers[provider] ?? []).map(storedTokensFromJSON);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const contents = this.contents ?? (this.contents = await this.read());
+    const user = contents.providers[provider]?.find((candidate) => candidate.user_id === userId);
+    return user ? storedTokensFromJSON(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.change(provider, (users) => [...users.filter((candidate) => candidate.user_id !== user.userId), storedTokensJSON(user)]);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.change(provider, (users) => users.filter((candidate) => candidate.user_id !== userId));
+  }
+
+  private change(provider: string, update: (users: StoredTokensJSON[]) => StoredTokensJSON[]): Promise<void> {
+    const write = this.writing.then(async () => {
+      const contents = this.contents ?? (this.contents = await this.read());
+      contents.providers[provider] = update(contents.providers[provider] ?? []);
+      await this.client.call("PutSecretValue", { SecretId: this.path, SecretString: JSON.stringify(contents) });
+    });
+    // a failed write doesn't hold up the next one, which writes its changes too
+    this.writing = write.catch(() => {});
+    return write;
+  }
+
+  private async read(): Promise<SecretContents> {
+    let secret: { SecretString?: string };
+    try {
+      secret = await this.client.call<{ SecretString?: string }>("GetSecretValue", { SecretId: this.path });
+    } catch (error) {
+      // a secret created without a value; one that doesn't exist at all is an error
+      if (error instanceof AwsError && error.code === "ResourceNotFoundException" && /value/i.test(error.message)) {
+        return { version: SECRET_FORMAT_VERSION, providers: {} };
+      }
+      throw error;
+    }
+    if (!secret.SecretString?.trim()) {
+      return { version: SECRET_FORMAT_VERSION, providers: {} };
+    }
+    const contents = JSON.parse(secret.SecretString) as SecretContents;
+    if (contents.version !== SECRET_FORMAT_VERSION || typeof contents.providers !== "object" || contents.providers === null) {
+      throw new Error(`${this.path} does not hold version ${SECRET_FORMAT_VERSION} tokens`);
+    }
+    return contents;
+  }
+}
@@ -0,0 +1,122 @@
+import { readFile } from "fs/promises";
+import type { HttpClient } from "./http.js";
+
+export const DEFAULT_AZURE_AUTHORITY_HOST = "https://login.microsoftonline.com";
+export const DEFAULT_AZURE_IMDS_HOST = "http://169.254.169.254";
+
+// fetches a new access token this long before the current one expires
+const AZURE_TOKEN_MARGIN_MS = 5 * 60 * 1000;
+
+export class AzureError extends Error {
+  readonly status: number;
+  // e.g. "SecretNotFound" from Key Vault, "invalid_client" from Entra ID
+  readonly code: string;
+
+  constructor(status: number, code: string, message: string) {
+    super(message);
+    this.name = "AzureError";
+    this.status = status;
+    this.code = code;
+  }
+}
+
+export interface AzureAccessToken {
+  token: string;
+  expiresAt: number;
+}
+
+/**
+ * Where Azure access tokens come from, as found in the environment: AKS
+ * workload identity's federated service account token, the managed
+ * identity endpoint App Service, Functions and Container Apps provide, or
+ * the instance metadata service of VMs and AKS nodes. clientId picks a
+ * user-assigned managed identity.
+ */
+export type AzureCredentialSource =
+  | { kind: "workload-identity"; tenantId: string; clientId: string; tokenFile: string; authorityHost: string }
+  | { kind: "app-service"; endpoint: string; header: string; clientId?: string }
+  | { kind: "imds"; host: string; clientId?: string };
+
+/** The credential source the standard Azure variables in env describe; without any, the instance metadata service. */
+export function azureCredentialSource(env: NodeJS.ProcessEnv): AzureCredentialSource {
+  if (env.AZURE_FEDERATED_TOKEN_FILE && env.AZURE_CLIENT_ID && env.AZURE_TENANT_ID) {
+    return {
+      kind: "workload-identity",
+      tenantId: env.AZURE_TENANT_ID,
+      clientId: env.AZURE_CLIENT_ID,
+      tokenFile: env.AZURE_FEDERATED_TOKEN_FILE,
+      authorityHost: env.AZURE_AUTHORITY_HOST || DEFAULT_AZURE_AUTHORITY_HOST,
+    };
+  }
+  if (env.IDENTITY_ENDPOINT && env.IDENTITY_HEADER) {
+    return { kind: "app-service", endpoint: env.IDENTITY_ENDPOINT, header: env.IDENTITY_HEADER, clientId: env.AZURE_CLIENT_ID || undefined };
+  }
+  return { kind: "imds", host: env.AZURE_POD_IDENTITY_AUTHORITY_HOST || DEFAULT_AZURE_IMDS_HOST, clientId: env.AZURE_CLIENT_ID || undefined };
+}
+
+export interface AzureCredentialProviderOptions {
+  source: AzureCredentialSource;
+  httpClient: HttpClient;
+  // the service tokens are for, e.g. https://vault.azure.net
+  resource: string;
+}
+
+/** Hands out access tokens for resource from source, fetching new ones shortly before they expire. */
+export class AzureCredentialProvider {
+  private readonly options: AzureCredentialProviderOptions;
+  private current: Promise<AzureAccessToken> | null = null;
+
+  constructor(options: AzureCredentialProviderOptions) {
+    this.options = options;
+  }
+
+  async get(): Promise<AzureAccessToken> {
+    const token = this.current && (await this.current.catch(() => null));
+    if (token && token.expiresAt - AZURE_TOKEN_MARGIN_MS > Date.now()) return token;
+    this.current = this.fetch();
+    return this.current;
+  }
+
+  // drops the current token, e.g. after Azure rejected it
+  reset(): void {
+    this.current = null;
+  }
+
+  private async fetch(): Promise<AzureAccessToken> {
+    const { source, httpClient, resource } = this.options;
+    let response: Response;
+    if (source.kind === "workload-identity") {
+      response = await httpClient(`${source.authorityHost.replace(/\/+$/, "")}/${encodeURIComponent(source.tenantId)}/oauth2/v2.0/token`, {
+        method: "POST",
+        headers: { "Content-Type": "application/x-www-form-urlencoded" },
+        body: new URLSearchParams({
+          grant_type: "client_credentials",
+          client_id: source.clientId,
+          scope: `${resource}/.default`,
+          client_assertion_type: "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+          client_assertion: (await readFile(source.tokenFile, "utf8")).trim(),
+        }).toString(),
+      });
+    } else if (source.kind === "app-service") {
+      const query = new URLSearchParams({ resource, "api-version": "2019-08-01", ...(source.clientId ? { client_id: source.clientId } : {}) });
+      response = await httpClient(`${source.endpoint}?${query}`, { headers: { "X-IDENTITY-HEADER": source.header } });
+    } else {
+      const query = new URLSearchParams({ resource, "api-version": "2018-02-01", ...(source.clientId ? { client_id: source.clientId } : {}) });
+      response = await httpClient(`${source.host.replace(/\/+$/, "")}/metadata/identity/oauth2/token?${query}`, { headers: { Metadata: "true" } });
+    }
+    if (!response.ok) {
+      const text = await response.text();
+      let code = "CredentialUnavailable";
+      try {
+        code = (JSON.parse(text) as { error?: string }).error ?? code;
+      } catch {
+        // not JSON
+      }
+      throw new AzureError(response.status, code, `azure ${source.kind} refused an access token for ${resource} with ${response.status}: ${text}`);
+    }
+    // expires_in from Entra ID, expires_on (seconds since the epoch, as a string) from the managed identity endpoints
+    const body = (await response.json()) as { access_token: string; expires_in?: number | string; expires_on?: number | string };
+    const expiresAt = body.expires_on !== undefined ? Number(body.expires_on) * 1000 : Date.now() + Number(body.expires_in) * 1000;
+    return { token: body.access_token, expiresAt };
+  }
+}
@@ -0,0 +1,161 @@
+import { AzureError } from "./azure.js";
+import type { AzureCredentialProvider } from "./azure.js";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+export const DEFAULT_AZURE_KEY_VAULT_SECRET_NAME = "zoom-oauth-tokens";
+
+const KEY_VAULT_API_VERSION = "7.4";
+const SECRET_FORMAT_VERSION = 1;
+
+// the same layout as the JSON file store's file
+interface SecretContents {
+  version: number;
+  providers: Record<string, StoredTokensJSON[]>;
+}
+
+export interface AzureKeyVaultTokenStoreOptions {
+  // e.g. https://my-vault.vault.azure.net
+  vaultUrl: string;
+  // created on the first write if it doesn't exist
+  secretName?: string;
+  credentials: AzureCredentialProvider;
+  httpClient: HttpClient;
+}
+
+/** Whether name can name a Key Vault secret. */
+export function isKeyVaultSecretName(name: string): boolean {
+  return /^[0-9a-zA-Z-]{1,127}$/.test(name);
+}
+
+/**
+ * The resource Key Vault access tokens are requested for: the vault's DNS
+ * suffix, such as https://vault.azure.net for public Azure, or that one
+ * when the URL doesn't end in a Key Vault suffix, e.g. behind a proxy.
+ */
+export function keyVaultResource(vaultUrl: string): string {
+  const suffix = /^[^.]+\.(vault(\.[a-z0-9-]+)+)$/.exec(new URL(vaultUrl).hostname)?.[1];
+  return `https://${suffix ?? "vault.azure.net"}`;
+}
+
+/**
+ * Keeps token managers' users in one Azure Key Vault secret, as the same
+ * JSON document the file store writes, authenticating with the managed or
+ * workload identity the platform provides. Every user is read from the
+ * secret at startup; each change sets the whole document as a new version
+ * and disables the version it replaced, since Key Vault can't delete single
+ * versions. Meant for one instance, like the file store.
+ */
+export class AzureKeyVaultTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly vaultUrl: string;
+  private readonly secretName: string;
+  private readonly credentials: AzureCredentialProvider;
+  private readonly httpClient: HttpClient;
+  private contents: SecretContents | null = null;
+  // the version the contents were read from or last written as, disabled once a newer one is set
+  private version: string | null = null;
+  // writes go out one at a time, each with every change before it
+  private writing: Promise<void> = Promise.resolve();
+
+  constructor(options: AzureKeyVaultTokenStoreOptions) {
+    this.vaultUrl = options.vaultUrl.replace(/\/+$/, "");
+    this.secretName = options.secretName ?? DEFAULT_AZURE_KEY_VAULT_SECRET_NAME;
+    if (!isKeyVaultSecretName(this.secretName)) {
+      throw new Error(`${this.secretName} is not a valid Key Vault secret name, use up to 127 letters, digits and dashes`);
+    }
+    this.path = `${this.vaultUrl}/secrets/${this.secretName}`;
+    this.credentials = options.credentials;
+    this.httpClient = options.httpClient;
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    this.contents = await this.read();
+    return (this.contents.providers[provider] ?? []).map(storedTokensFromJSON);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const contents = this.contents ?? (this.contents = await this.read());
+    const user = contents.providers[provider]?.find((candidate) => candidate.user_id === userId);
+    return user ? storedTokensFromJSON(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.change(provider, (users) => [...users.filter((candidate) => candidate.user_id !== user.userId), storedTokensJSON(user)]);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.change(provider, (users) => users.filter((candidate) => candidate.user_id !== userId));
+  }
+
+  private change(provider: string, update: (users: StoredTokensJSON[]) => StoredTokensJSON[]): Promise<void> {
+    const write = this.writing.then(async () => {
+      const contents = this.contents ?? (this.contents = await this.read());
+      contents.providers[provider] = update(contents.providers[provider] ?? []);
+      const set = await this.request<{ id: string }>("PUT", "", { value: JSON.stringify(contents), contentType: "application/json" });
+      const replaced = this.version;
+      this.version = set.id.split("/").pop() ?? null;
+      if (replaced && replaced !== this.version) {
+        // the new version is already current, so a failure here only leaves an old refresh token readable
+        await this.request("PATCH", `/${replaced}`, { attributes: { enabled: false } }).catch((error: unknown) => {
+          console.warn(`could not disable version ${replaced} of ${this.path}: ${error instanceof Error ? error.message : String(error)}`);
+        });
+      }
+    });
+    // a failed write doesn't hold up the next one, which writes its changes too
+    this.writing = write.catch(() => {});
+    return write;
+  }
+
+  private async read(): Promise<SecretContents> {
+    let secret: { id: string; value?: string };
+    try {
+      secret = await this.request<{ id: string; value?: string }>("GET", "");
+    } catch (error) {
+      // the secret is created by the first write
+      if (error instanceof AzureError && error.code === "SecretNotFound") {
+        this.version = null;
+        return { version: SECRET_FORMAT_VERSION, providers: {} };
+      }
+      throw error;
+    }
+    this.version = secret.id.split("/").pop() ?? null;
+    if (!secret.value?.trim()) {
+      return { version: SECRET_FORMAT_VERSION, providers: {} };
+    }
+    const contents = JSON.parse(secret.value) as SecretContents;
+    if (contents.version !== SECRET_FORMAT_VERSION || typeof contents.providers !== "object" || contents.providers === null) {
+      throw new Error(`${this.path} does not hold version ${SECRET_FORMAT_VERSION} tokens`);
+    }
+    return contents;
+  }
+
+  // version is "" for the current one or "/<version>"; retries once with a new access token after a 401
+  private async request<T>(method: string, version: string, body?: unknown, retried = false): Promise<T> {
+    const { token } = await this.credentials.get();
+    const response = await this.httpClient(`${this.path}${version}?api-version=${KEY_VAULT_API_VERSION}`, {
+      method,
+      headers: { Authorization: `Bearer ${token}`, ...(body === undefined ? {} : { "Content-Type": "application/json" }) },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status === 401 && !retried) {
+      this.credentials.reset();
+      return this.request<T>(method, version, body, true);
+    }
+    const text = await response.text();
+    if (!response.ok) {
+      let code = "Unknown";
+      let message = text;
+      try {
+        const { error } = JSON.parse(text) as { error?: { code?: string; message?: string; innererror?: { code?: string } } };
+        code = error?.innererror?.code ?? error?.code ?? code;
+        message = error?.message ?? text;
+      } catch {
+        // not JSON, e.g. from a proxy in between
+      }
+      throw new AzureError(response.status, code, `key vault answered ${response.status} ${code} to ${method} ${this.secretName}${version}: ${message}`);
+    }
+    return (text ? JSON.parse(text) : {}) as T;
+  }
+}
@@ -0,0 +1,68 @@
+import type { HttpClient } from "./http.js";
+
+// Date headers have one-second resolution, so smaller differences aren't told apart from skew
+export const CLOCK_SKEW_RESOLUTION_MS = 2 * 1000;
+export const DEFAULT_CLOCK_SKEW_WARNING_MS = 30 * 1000;
+
+export interface ClockSkewOptions {
+  // only responses from these are taken as the reference clock, e.g. Zoom's OAuth and API base URLs
+  baseUrls: string[];
+  // how far off the clock may be before it is warned about (default: DEFAULT_CLOCK_SKEW_WARNING_MS)
+  warningMs?: number;
+}
+
+/**
+ * Estimates how far this machine's clock is off from another's, e.g.
+ * Zoom's, from the Date header of each of its responses. Tokens expire on
+ * the other clock's terms, so times shared with other instances, which may
+ * be off differently, are converted with it.
+ */
+export class ClockSkew {
+  private readonly baseUrls: string[];
+  private readonly warningMs: number;
+  private estimateMs: number | null = null;
+  private skewed = false;
+
+  constructor(options: ClockSkewOptions) {
+    this.baseUrls = options.baseUrls;
+    this.warningMs = options.warningMs ?? DEFAULT_CLOCK_SKEW_WARNING_MS;
+  }
+
+  /** Wraps httpClient so every response from the base URLs updates the estimate. */
+  wrap(httpClient: HttpClient): HttpClient {
+    return async (input, init) => {
+      const sentAt = Date.now();
+      const response = await httpClient(input, init);
+      if (this.baseUrls.some((base) => input.toString().startsWith(base))) {
+        this.observe(response.headers.get("date"), sentAt, Date.now());
+      }
+      return response;
+    };
+  }
+
+  observe(date: string | null, sentAt: number, receivedAt: number): void {
+    const remote = date ? Date.parse(date) : NaN;
+    if (Number.isNaN(remote)) return;
+    // the remote clock was read somewhere between sending and receiving, and its milliseconds were dropped
+    this.estimateMs = (sentAt + receivedAt) / 2 - (remote + 500);
+    const skewed = Math.abs(this.estimateMs) > this.warningMs;
+    if (skewed === this.skewed) return;
+    this.skewed = skewed;
+    const seconds = Math.round(Math.abs(this.estimateMs) / 1000);
+    if (skewed) {
+      console.warn(`the local clock is ${seconds}s ${this.estimateMs > 0 ? "ahead of" : "behind"} ${new URL(this.baseUrls[0]).hostname}, stored token times are converted to its clock`);
+    } else {
+      console.log(`the local clock is back within ${this.warningMs / 1000}s of ${new URL(this.baseUrls[0]).hostname}`);
+    }
+  }
+
+  /** How far the local clock is ahead (positive) or behind (negative); 0 until measured and while within CLOCK_SKEW_RESOLUTION_MS. */
+  skewMs(): number {
+    return this.estimateMs === null || Math.abs(this.estimateMs) < CLOCK_SKEW_RESOLUTION_MS ? 0 : Math.round(this.estimateMs);
+  }
+
+  /** The latest estimate as measured, null before the first response. */
+  measuredMs(): number | null {
+    return this.estimateMs;
+  }
+}
@@ -0,0 +1,173 @@
+import { randomUUID } from "crypto";
+import { AwsError, AwsJsonClient } from "./aws.js";
+import type { AwsCredentialProvider } from "./aws.js";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+// Zoom refresh tokens stop working 90 days after they were issued
+export const DEFAULT_DYNAMODB_TTL_MS = 90 * 24 * 60 * 60 * 1000;
+
+// the attribute the table's time to live is turned on for, in seconds since the epoch
+export const DYNAMODB_TTL_ATTRIBUTE = "purge_at";
+
+// refresh locks live beside the users, under their own partition so queries for users don't see them
+const LOCK_SUFFIX = "#lock";
+
+type AttributeValue = { S: string } | { N: string };
+type Item = Record<string, AttributeValue>;
+
+export interface DynamoDbTokenStoreOptions {
+  // a table with partition key "provider" and sort key "user_id", both strings; a name or ARN
+  table: string;
+  region: string;
+  credentials: AwsCredentialProvider;
+  httpClient: HttpClient;
+  // a user not saved for this long is left for DynamoDB to delete; 0 keeps users until they are removed
+  ttlMs?: number;
+  // defaults to the regional DynamoDB endpoint
+  endpoint?: string;
+}
+
+/** The region in a DynamoDB table ARN, or null if arn isn't one. */
+export function tableArnRegion(arn: string): string | null {
+  return /^arn:aws[\w-]*:dynamodb:([a-z0-9-]+):\d{12}:table\/[\w.-]{3,255}$/.exec(arn)?.[1] ?? null;
+}
+
+/** Whether table can name a DynamoDB table, by name or ARN. */
+export function isDynamoDbTable(table: string): boolean {
+  return /^[\w.-]{3,255}$/.test(table) || tableArnRegion(table) !== null;
+}
+
+/**
+ * Keeps token managers' users in a DynamoDB table, one item per user keyed
+ * by provider and user ID, for Lambda and Fargate deployments without a
+ * disk. Items carry a time to live so users that stopped being refreshed
+ * are deleted by DynamoDB once their refresh token can't have survived;
+ * until then they are skipped when read. Refreshes take a per-user lock
+ * with a conditional write, so instances sharing the table never spend the
+ * same refresh token; users another instance changed are picked up at its
+ * next refresh.
+ */
+export class DynamoDbTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly table: string;
+  private readonly ttlMs: number;
+  private readonly client: AwsJsonClient;
+
+  constructor(options: DynamoDbTokenStoreOptions) {
+    if (!isDynamoDbTable(options.table)) {
+      throw new Error(`${options.table} is not a DynamoDB table name or ARN`);
+    }
+    this.table = options.table;
+    this.path = `dynamodb table ${options.table}`;
+    this.ttlMs = options.ttlMs ?? DEFAULT_DYNAMODB_TTL_MS;
+    this.client = new AwsJsonClient({
+      service: "dynamodb",
+      targetPrefix: "DynamoDB_20120810",
+      jsonVersion: "1.0",
+      region: tableArnRegion(options.table) ?? options.region,
+      credentials: options.credentials,
+      httpClient: options.httpClient,
+      endpoint: options.endpoint,
+    });
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    const users: StoredTokens[] = [];
+    let start: Item | undefined;
+    do {
+      const page = await this.client.call<{ Items?: Item[]; LastEvaluatedKey?: Item }>("Query", {
+        TableName: this.table,
+        ConsistentRead: true,
+        KeyConditionExpression: "#provider = :provider",
+        ExpressionAttributeNames: { "#provider": "provider" },
+        ExpressionAttributeValues: { ":provider": { S: provider } },
+        ...(start ? { ExclusiveStartKey: start } : {}),
+      });
+      for (const item of page.Items ?? []) {
+        const user = this.tokensOf(item);
+        if (user) users.push(user);
+      }
+      start = page.LastEvaluatedKey;
+    } while (start);
+    return users;
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const { Item: item } = await this.client.call<{ Item?: Item }>("GetItem", {
+      TableName: this.table,
+      ConsistentRead: true,
+      Key: this.key(provider, userId),
+    });
+    return item ? this.tokensOf(item) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.client.call("PutItem", {
+      TableName: this.table,
+      Item: {
+        ...this.key(provider, user.userId),
+        tokens: { S: JSON.stringify(storedTokensJSON(user)) },
+        ...(this.ttlMs > 0 ? { [DYNAMODB_TTL_ATTRIBUTE]: { N: String(Math.ceil((Date.now() + this.ttlMs) / 1000)) } } : {}),
+      },
+    });
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.client.call("DeleteItem", { TableName: this.table, Key: this.key(provider, userId) });
+  }
+
+  async lock(provider: string, userId: string, ttlMs: number): Promise<(() => Promise<void>) | null> {
+    const key = this.key(`${provider}${LOCK_SUFFIX}`, userId);
+    const owner = randomUUID();
+    const now = Date.now();
+    try {
+      await this.client.call("PutItem", {
+        TableName: this.table,
+        Item: {
+          ...key,
+          owner: { S: owner },
+          locked_until: { N: String(now + ttlMs) },
+          // a lock left by a crashed instance is ignored once locked_until passes and deleted some time after
+          [DYNAMODB_TTL_ATTRIBUTE]: { N: String(Math.ceil((now + ttlMs) / 1000)) },
+        },
+        ConditionExpression: "attribute_not_exists(#provider) OR locked_until < :now",
+        ExpressionAttributeNames: { "#provider": "provider" },
+        ExpressionAttributeValues: { ":now": { N: String(now) } },
+      });
+    } catch (error) {
+      if (error instanceof AwsError && error.code === "ConditionalCheckFailedException") return null;
+      throw error;
+    }
+    return async () => {
+      try {
+        await this.client.call("DeleteItem", {
+          TableName: this.table,
+          Key: key,
+          ConditionExpression: "#owner = :owner",
+          ExpressionAttributeNames: { "#owner": "owner" },
+          ExpressionAttributeValues: { ":owner": { S: owner } },
+        });
+      } catch (error) {
+        // expired and taken by another instance since
+        if (!(error instanceof AwsError && error.code === "ConditionalCheckFailedException")) throw error;
+      }
+    };
+  }
+
+  private key(provider: string, userId: string): Item {
+    return { provider: { S: provider }, user_id: { S: userId } };
+  }
+
+  // null for an item past its time to live that DynamoDB hasn't deleted yet, which can take days
+  private tokensOf(item: Item): StoredTokens | null {
+    const purgeAt = item[DYNAMODB_TTL_ATTRIBUTE];
+    if (purgeAt && "N" in purgeAt && Number(purgeAt.N) * 1000 <= Date.now()) return null;
+    const tokens = item.tokens;
+    if (!tokens || !("S" in tokens)) {
+      throw new Error(`the item of ${"S" in item.user_id ? item.user_id.S : "a user"} in ${this.path} has no tokens attribute`);
+    }
+    return storedTokensFromJSON(JSON.parse(tokens.S) as StoredTokensJSON);
+  }
+}
@@ -0,0 +1,192 @@
+import { createCipheriv, createDecipheriv, randomBytes } from "crypto";
+import type { EncryptionProvider } from "./encryption.js";
+import type { StoredTokens, TokenStore } from "./store.js";
+
+// v1 values are sealed with a local key and name it; v2 values name their provider and the ref of its data key
+const LOCAL_PREFIX = "v1.";
+const PROVIDER_PREFIX = "v2.";
+// the metadata key users' own Recall callback secrets are kept under, a credential like the tokens
+const CALLBACK_SECRET_FIELD = "callback_secret";
+const IV_BYTES = 12;
+const TAG_BYTES = 16;
+
+export interface EncryptedTokenStoreOptions {
+  store: TokenStore;
+  // new values are sealed with provider's data key; values sealed by previousProviders can still be opened
+  provider: EncryptionProvider;
+  previousProviders?: EncryptionProvider[];
+}
+
+/**
+ * Seals users' access and refresh tokens, and their own callback secrets
+ * in metadata, with AES-256-GCM before they reach the store it wraps, so
+ * whatever that store writes to disk or sends over the network never holds
+ * them in plaintext. Keys come from an encryption
+ * provider: local keys, or data keys wrapped by a KMS or a public key. Each
+ * token is bound to its provider, user and field, so a sealed token copied
+ * onto another record doesn't open. Tokens found in plaintext, e.g. saved
+ * before encryption was turned on, or sealed with a previous key or
+ * provider are sealed again with the current one when they are listed.
+ */
+export class EncryptedTokenStore implements TokenStore {
+  readonly path: string;
+  readonly lock?: TokenStore["lock"];
+  readonly watch?: TokenStore["watch"];
+  readonly pruneHistory?: TokenStore["pruneHistory"];
+  private readonly store: TokenStore;
+  private readonly provider: EncryptionProvider;
+  private readonly providers = new Map<string, EncryptionProvider>();
+  // asked for once and shared by every value sealed in this process
+  private dataKey: Promise<{ key: Buffer; ref: string }> | null = null;
+  // data keys unwrapped per provider and ref, so a KMS is asked once per key rather than per token
+  private readonly keys = new Map<string, Promise<Buffer>>();
+  // the last value sealed or opened per provider, user and field, reused while the token doesn't change
+  private readonly sealed = new Map<string, { plaintext: string; sealed: string }>();
+
+  constructor(options: EncryptedTokenStoreOptions) {
+    this.store = options.store;
+    this.path = options.store.path;
+    this.provider = options.provider;
+    for (const provider of [options.provider, ...(options.previousProviders ?? [])]) {
+      if (!/^[a-z0-9-]+$/.test(provider.name)) {
+        throw new Error(`encryption provider names may only hold lowercase letters, digits and dashes, not ${provider.name}`);
+      }
+      if (!this.providers.has(provider.name)) this.providers.set(provider.name, provider);
+    }
+    // only where the wrapped store has them, token managers check for their presence
+    const { lock, watch, pruneHistory } = options.store;
+    if (lock) this.lock = lock.bind(options.store);
+    if (watch) this.watch = watch.bind(options.store);
+    if (pruneHistory) this.pruneHistory = pruneHistory.bind(options.store);
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    const opened: StoredTokens[] = [];
+    let resealed = 0;
+    for (const user of await this.store.list(provider)) {
+      const open = await this.open(provider, user);
+      const secret = user.metadata[CALLBACK_SECRET_FIELD];
+      if (!this.current(user.accessToken) || !this.current(user.refreshToken) || (secret !== undefined && !this.current(secret))) {
+        await this.save(provider, open);
+        resealed++;
+      }
+      opened.push(open);
+    }
+    if (resealed > 0) {
+      console.log(`sealed the tokens of ${resealed} ${provider} user(s) in ${this.path} with ${this.provider.description}`);
+    }
+    return opened;
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const user = await this.store.get(provider, userId);
+    return user ? this.open(provider, user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    const secret = user.metadata[CALLBACK_SECRET_FIELD];
+    await this.store.save(provider, {
+      ...user,
+      accessToken: await this.seal(provider, user.userId, "access_token", user.accessToken),
+      refreshToken: await this.seal(provider, user.userId, "refresh_token", user.refreshToken),
+      metadata:
+        secret === undefined ? user.metadata : { ...user.metadata, [CALLBACK_SECRET_FIELD]: await this.seal(provider, user.userId, CALLBACK_SECRET_FIELD, secret) },
+    });
+  }
+
+  delete(provider: string, userId: string): Promise<void> {
+    for (const field of ["access_token", "refresh_token", CALLBACK_SECRET_FIELD]) this.sealed.delete(`${provider}:${userId}:${field}`);
+    return this.store.delete(provider, userId);
+  }
+
+  close(): void {
+    this.store.close?.();
+  }
+
+  private async open(provider: string, user: StoredTokens): Promise<StoredTokens> {
+    const secret = user.metadata[CALLBACK_SECRET_FIELD];
+    return {
+      ...user,
+      accessToken: await this.unseal(provider, user.userId, "access_token", user.accessToken),
+      refreshToken: await this.unseal(provider, user.userId, "refresh_token", user.refreshToken),
+      metadata:
+        secret === undefined ? user.metadata : { ...user.metadata, [CALLBACK_SECRET_FIELD]: await this.unseal(provider, user.userId, CALLBACK_SECRET_FIELD, secret) },
+    };
+  }
+
+  private current(value: string): boolean {
+    const sealed = parseSealed(value);
+    return sealed !== null && sealed.provider === this.provider.name && this.provider.isCurrent(sealed.ref);
+  }
+
+  // v1.<key ID>.<IV>.<ciphertext and tag> for local keys, v2.<provider>.<ref>.<IV>.<ciphertext and tag> otherwise,
+  // the last two base64url; an unchanged token keeps its sealed value so stores that compare tokens, like SQLite's
+  // history, don't see a change
+  private async seal(provider: string, userId: string, field: string, plaintext: string): Promise<string> {
+    const known = this.sealed.get(`${provider}:${userId}:${field}`);
+    if (known?.plaintext === plaintext && this.current(known.sealed)) return known.sealed;
+    if (!this.dataKey) {
+      this.dataKey = this.provider.dataKey();
+      // a failure is retried by the next save rather than remembered
+      this.dataKey.catch(() => (this.dataKey = null));
+    }
+    const { key, ref } = await this.dataKey;
+    const iv = randomBytes(IV_BYTES);
+    const cipher = createCipheriv("aes-256-gcm", key, iv);
+    cipher.setAAD(Buffer.from(`${provider}:${userId}:${field}`));
+    const sealed = Buffer.concat([cipher.update(plaintext, "utf8"), cipher.final(), cipher.getAuthTag()]);
+    const prefix = this.provider.name === "local" ? `${LOCAL_PREFIX}${ref}` : `${PROVIDER_PREFIX}${this.provider.name}.${ref}`;
+    const value = `${prefix}.${iv.toString("base64url")}.${sealed.toString("base64url")}`;
+    this.sealed.set(`${provider}:${userId}:${field}`, { plaintext, sealed: value });
+    return value;
+  }
+
+  private async unseal(provider: string, userId: string, field: string, value: string): Promise<string> {
+    const known = this.sealed.get(`${provider}:${userId}:${field}`);
+    if (known?.sealed === value) return known.plaintext;
+    const parsed = parseSealed(value);
+    if (!parsed) return value;
+    const key = await this.key(parsed.provider, parsed.ref).catch((error: unknown) => {
+      throw new Error(`the ${field} of ${provider} user ${userId} could not be opened: ${error instanceof Error ? error.message : String(error)}`);
+    });
+    const data = Buffer.from(parsed.sealed, "base64url");
+    try {
+      const decipher = createDecipheriv("aes-256-gcm", key, Buffer.from(parsed.iv, "base64url"));
+      decipher.setAAD(Buffer.from(`${provider}:${userId}:${field}`));
+      decipher.setAuthTag(data.subarray(data.length - TAG_BYTES));
+      const plaintext = Buffer.concat([decipher.update(data.subarray(0, data.length - TAG_BYTES)), decipher.final()]).toString("utf8");
+      this.sealed.set(`${provider}:${userId}:${field}`, { plaintext, sealed: value });
+      return plaintext;
+    } catch {
+      throw new Error(`the ${field} of ${provider} user ${userId} could not be decrypted, it was changed or belongs to another user`);
+    }
+  }
+
+  private key(name: string, ref: string): Promise<Buffer> {
+    const provider = this.providers.get(name);
+    if (!provider) {
+      return Promise.reject(new Error(`it is sealed by the ${name} encryption provider, which is not configured`));
+    }
+    const id = `${name}.${ref}`;
+    let key = this.keys.get(id);
+    if (!key) {
+      key = provider.unwrap(ref);
+      this.keys.set(id, key);
+      // a KMS that was briefly unreachable is asked again next time
+      key.catch(() => this.keys.delete(id));
+    }
+    return key;
+  }
+}
+
+function parseSealed(value: string): { provider: string; ref: string; iv: string; sealed: string } | null {
+  if (value.startsWith(LOCAL_PREFIX)) {
+    const [, ref, iv, sealed] = value.split(".");
+    return { provider: "local", ref: ref ?? "", iv: iv ?? "", sealed: sealed ?? "" };
+  }
+  if (value.startsWith(PROVIDER_PREFIX)) {
+    const [, provider, ref, iv, sealed] = value.split(".");
+    return { provider: provider ?? "", ref: ref ?? "", iv: iv ?? "", sealed: sealed ?? "" };
+  }
+  return null;
+}
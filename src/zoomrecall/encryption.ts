@@ -0,0 +1,100 @@
+import { createHash } from "crypto";
+
+export const DATA_KEY_BYTES = 32;
+
+/** A key tokens are sealed with, and how to find it again: ref is stored next to every value it sealed. */
+export interface DataKey {
+  key: Buffer;
+  // letters, digits, "-" and "_" only
+  ref: string;
+}
+
+/**
+ * Where the AES-256 keys tokens are sealed with come from. The encrypted
+ * store seals and opens tokens itself and only asks a provider for a data
+ * key to seal new values with and for the key behind a ref it stored, so a
+ * provider can keep keys locally or wrap them with a KMS or a public key
+ * without the stores knowing about it.
+ */
+export interface EncryptionProvider {
+  // names the provider in sealed values, e.g. "aws-kms"
+  readonly name: string;
+  // what keys are kept or wrapped with, for logs and doctor, e.g. a KMS key ARN; never key material
+  readonly description: string;
+  // called once per process; the key is kept in memory and reused for every value sealed after
+  dataKey(): Promise<DataKey>;
+  // the key behind a ref from dataKey, possibly from an earlier process; throws if this provider can't open it
+  unwrap(ref: string): Promise<Buffer>;
+  // whether ref was made with what new values are sealed with now, otherwise values under it are sealed again
+  isCurrent(ref: string): boolean;
+}
+
+// a short fingerprint of what a provider wraps keys with, so refs tell whether it changed without giving it away
+export function wrappingTag(value: string | Buffer): string {
+  return createHash("sha256").update("zoom-oauth token key").update(value).digest("hex").slice(0, 8);
+}
+
+// refs of providers that wrap keys: the tag of what wrapped it, then the wrapped key in base64url
+export function wrappedRef(tag: string, wrapped: Buffer): string {
+  return `${tag}-${wrapped.toString("base64url")}`;
+}
+
+export function parseWrappedRef(ref: string): { tag: string; wrapped: Buffer } {
+  const separator = ref.indexOf("-");
+  if (separator === -1) throw new Error(`malformed token key reference ${ref.slice(0, 16)}`);
+  return { tag: ref.slice(0, separator), wrapped: Buffer.from(ref.slice(separator + 1), "base64url") };
+}
+
+/**
+ * Reads a 256-bit key written as base64 or base64url, e.g. by
+ * `generate-secret TOKEN_ENCRYPTION_KEY`; null if value isn't one.
+ */
+export function parseEncryptionKey(value: string): Buffer | null {
+  const key = Buffer.from(value.trim(), "base64url");
+  return key.length === DATA_KEY_BYTES ? key : null;
+}
+
+export interface LocalKeyProviderOptions {
+  // new values are sealed with key; values sealed with previousKeys can still be opened
+  key?: Buffer;
+  previousKeys?: Buffer[];
+}
+
+/**
+ * Seals tokens with keys given to the process, TOKEN_ENCRYPTION_KEY and
+ * TOKEN_ENCRYPTION_PREVIOUS_KEYS. Refs are the keys' tags, so a value names
+ * the key it was sealed with. Without a key it only opens values sealed
+ * with the previous ones, for moving to another provider.
+ */
+export class LocalKeyProvider implements EncryptionProvider {
+  readonly name = "local";
+  readonly description: string;
+  private readonly current: string | null;
+  private readonly keys = new Map<string, Buffer>();
+
+  constructor(options: LocalKeyProviderOptions) {
+    for (const key of [...(options.key ? [options.key] : []), ...(options.previousKeys ?? [])]) {
+      if (key.length !== DATA_KEY_BYTES) {
+        throw new Error(`token encryption keys must be ${DATA_KEY_BYTES} bytes`);
+      }
+      if (!this.keys.has(wrappingTag(key))) this.keys.set(wrappingTag(key), key);
+    }
+    this.current = options.key ? wrappingTag(options.key) : null;
+    this.description = this.current ? `TOKEN_ENCRYPTION_KEY ${this.current}` : `${this.keys.size} previous key(s)`;
+  }
+
+  async dataKey(): Promise<DataKey> {
+    if (!this.current) throw new Error("TOKEN_ENCRYPTION_KEY is not set, tokens can only be opened with the previous keys");
+    return { key: this.keys.get(this.current)!, ref: this.current };
+  }
+
+  async unwrap(ref: string): Promise<Buffer> {
+    const key = this.keys.get(ref);
+    if (!key) throw new Error(`key ${ref} is neither TOKEN_ENCRYPTION_KEY nor one of TOKEN_ENCRYPTION_PREVIOUS_KEYS`);
+    return key;
+  }
+
+  isCurrent(ref: string): boolean {
+    return ref === this.current;
+  }
+}
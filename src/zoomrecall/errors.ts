@@ -0,0 +1,235 @@
+export class HttpError extends Error {
+  readonly status: number;
+
+  constructor(status: number, message: string) {
+    super(message);
+    this.name = "HttpError";
+    this.status = status;
+  }
+}
+
+export class TokenNotSetError extends Error {
+  readonly userId: string;
+
+  constructor(userId: string, consentPath: string = "/zoom/oauth") {
+    super(`oauth token not found for user: ${userId}. please visit ${consentPath}`);
+    this.name = "TokenNotSetError";
+    this.userId = userId;
+  }
+}
+
+/** The stored access token is past expiry and the stale-token policy won't serve it. */
+export class TokenExpiredError extends Error {
+  readonly userId: string;
+
+  constructor(userId: string, expiredForMs: number) {
+    super(`oauth token for user ${userId} expired ${Math.round(expiredForMs / 1000)}s ago and could not be refreshed`);
+    this.name = "TokenExpiredError";
+    this.userId = userId;
+  }
+}
+
+/** The user was deactivated or removed at the provider, so their tokens are no longer served. */
+export class UserDeactivatedError extends Error {
+  readonly userId: string;
+
+  constructor(userId: string, reason: string) {
+    super(`user ${userId} is deactivated (${reason}), their tokens are no longer served`);
+    this.name = "UserDeactivatedError";
+    this.userId = userId;
+  }
+}
+
+/** The meeting's host hasn't connected their Zoom account, so there is no user to issue tokens as. */
+export class HostNotConnectedError extends Error {
+  readonly meetingId: string;
+
+  constructor(meetingId: string, host: string | undefined, consentPath: string = "/zoom/oauth") {
+    super(`the host${host ? ` (${host})` : ""} of meeting ${meetingId} has not connected their zoom account. please visit ${consentPath}`);
+    this.name = "HostNotConnectedError";
+    this.meetingId = meetingId;
+  }
+}
+
+export class InvalidGrantError extends Error {
+  constructor(reason: string, provider: string = "zoom") {
+    super(`${provider} rejected the grant: ${reason}`);
+    this.name = "InvalidGrantError";
+  }
+}
+
+/** The code a consent redirect carried was rejected: it expired before it was exchanged, or was already used. */
+export class AuthorizationCodeExpiredError extends Error {
+  readonly consentPath: string;
+
+  constructor(consentPath: string = "/zoom/oauth") {
+    super(`the authorization code expired or was already used. please visit ${consentPath} to start over`);
+    this.name = "AuthorizationCodeExpiredError";
+    this.consentPath = consentPath;
+  }
+}
+
+/** Zoom refused the code verifier a consent redirect's code was exchanged with, so the code wasn't issued to that flow. */
+export class CodeVerifierMismatchError extends Error {
+  readonly consentPath: string;
+
+  constructor(consentPath: string = "/zoom/oauth") {
+    super(`the authorization code was not issued to this consent, its code verifier doesn't match. please visit ${consentPath} to start over`);
+    this.name = "CodeVerifierMismatchError";
+    this.consentPath = consentPath;
+  }
+}
+
+export class MeetingNotFoundError extends Error {
+  constructor(message: string) {
+    super(`zoom meeting not found: ${message}`);
+    this.name = "MeetingNotFoundError";
+  }
+}
+
+export class RateLimitedError extends Error {
+  readonly retryAfterSeconds: number | undefined;
+
+  constructor(retryAfterSeconds: number | undefined, provider: string = "zoom") {
+    super(`rate limited by ${provider}`);
+    this.name = "RateLimitedError";
+    this.retryAfterSeconds = retryAfterSeconds;
+  }
+}
+
+/** The issuance policy doesn't allow a token for the requested user or meeting. */
+export class IssuanceDeniedError extends Error {
+  constructor(kind: string, reason: string) {
+    super(`${kind} token issuance denied by policy: ${reason}`);
+    this.name = "IssuanceDeniedError";
+  }
+}
+
+export class IssuanceQuotaExceededError extends Error {
+  readonly retryAfterSeconds: number;
+
+  constructor(reason: string, retryAfterSeconds: number) {
+    super(`token issuance quota exceeded: ${reason}`);
+    this.name = "IssuanceQuotaExceededError";
+    this.retryAfterSeconds = retryAfterSeconds;
+  }
+}
+
+export class ZoomApiError extends Error {
+  readonly status: number;
+  readonly code: number | undefined;
+
+  constructor(status: number, code: number | undefined, message: string) {
+    super(`zoom API error (status ${status}${code === undefined ? "" : `, code ${code}`}): ${message}`);
+    this.name = "ZoomApiError";
+    this.status = status;
+    this.code = code;
+  }
+}
+
+export class RecallApiError extends Error {
+  readonly status: number;
+  readonly body: unknown;
+
+  constructor(status: number, body: unknown) {
+    super(`recall API error: ${JSON.stringify(body)}`);
+    this.name = "RecallApiError";
+    this.status = status;
+    this.body = body;
+  }
+}
+
+/** A failure reported by a standard OAuth 2.0 provider such as Microsoft or Google. */
+export class OAuthProviderError extends Error {
+  readonly provider: string;
+  readonly status: number;
+  readonly code: string | undefined;
+
+  constructor(provider: string, status: number, code: string | undefined, message: string) {
+    super(`${provider} API error (status ${status}${code === undefined ? "" : `, ${code}`}): ${message}`);
+    this.name = "OAuthProviderError";
+    this.provider = provider;
+    this.status = status;
+    this.code = code;
+  }
+}
+
+// zoom's error code for "meeting does not exist" on meeting-scoped endpoints
+const ZOOM_MEETING_NOT_FOUND_CODE = 3001;
+// zoom's error code for "user does not exist"
+export const ZOOM_USER_NOT_FOUND_CODE = 1001;
+// zoom's error codes for an access token missing a scope, and for an invalid access token
+export const ZOOM_MISSING_SCOPE_CODE = 4711;
+export const ZOOM_INVALID_TOKEN_CODE = 124;
+
+interface ZoomErrorBody {
+  code?: number;
+  message?: string;
+  error?: string;
+  reason?: string;
+}
+
+export async function errorFromZoomResponse(response: Response): Promise<Error> {
+  if (response.status === 429) {
+    const retryAfter = Number(response.headers.get("retry-after"));
+    return new RateLimitedError(Number.isFinite(retryAfter) && retryAfter > 0 ? retryAfter : undefined);
+  }
+
+  const text = await response.text();
+  let body: ZoomErrorBody = {};
+  try {
+    body = JSON.parse(text) as ZoomErrorBody;
+  } catch {
+    body = { message: text };
+  }
+
+  if (body.error === "invalid_grant") {
+    return new InvalidGrantError(body.reason ?? "invalid_grant");
+  }
+  if (body.code === ZOOM_MEETING_NOT_FOUND_CODE) {
+    return new MeetingNotFoundError(body.message ?? "meeting does not exist");
+  }
+  return new ZoomApiError(response.status, body.code, body.message ?? body.reason ?? body.error ?? "unknown error");
+}
+
+interface OAuthErrorBody {
+  error?: string;
+  error_description?: string;
+}
+
+/** Maps an RFC 6749 error response (`{"error", "error_description"}`) from provider to a typed error. */
+export async function errorFromOAuthResponse(response: Response, provider: string): Promise<Error> {
+  if (response.status === 429) {
+    const retryAfter = Number(response.headers.get("retry-after"));
+    return new RateLimitedError(Number.isFinite(retryAfter) && retryAfter > 0 ? retryAfter : undefined, provider);
+  }
+
+  const text = await response.text();
+  let body: OAuthErrorBody = {};
+  try {
+    body = JSON.parse(text) as OAuthErrorBody;
+  } catch {
+    body = { error_description: text };
+  }
+
+  // Microsoft appends trace and correlation IDs on later lines
+  const description = body.error_description?.split(/\r?\n/)[0];
+  if (body.error === "invalid_grant") {
+    return new InvalidGrantError(description ?? "invalid_grant", provider);
+  }
+  return new OAuthProviderError(provider, response.status, body.error, description ?? "unknown error");
+}
+
+export function statusForError(error: unknown): number {
+  if (error instanceof HttpError) return error.status;
+  if (error instanceof AuthorizationCodeExpiredError || error instanceof CodeVerifierMismatchError) return 400;
+  if (error instanceof TokenNotSetError || error instanceof TokenExpiredError || error instanceof HostNotConnectedError) return 503;
+  if (error instanceof InvalidGrantError) return 401;
+  if (error instanceof IssuanceDeniedError) return 403;
+  if (error instanceof MeetingNotFoundError) return 404;
+  if (error instanceof UserDeactivatedError) return 410;
+  if (error instanceof RateLimitedError || error instanceof IssuanceQuotaExceededError) return 429;
+  if (error instanceof ZoomApiError || error instanceof OAuthProviderError) return 502;
+  if (error instanceof RecallApiError) return error.status;
+  return 500;
+}
@@ -0,0 +1,74 @@
+import { chmodSync, readFileSync, renameSync, writeFileSync } from "fs";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+const FILE_FORMAT_VERSION = 1;
+
+interface StoreFile {
+  version: number;
+  // users by the provider they connected, e.g. "zoom"
+  providers: Record<string, StoredTokensJSON[]>;
+}
+
+/**
+ * Keeps token managers' users in one JSON file, a section per provider. The
+ * file is rewritten in full on every change, through a temporary file and a
+ * rename so a crash never leaves it truncated, and is only readable by its
+ * owner. Fine for the handful of users one instance serves.
+ */
+export class FileTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly contents: StoreFile;
+
+  constructor(path: string) {
+    this.path = path;
+    this.contents = this.read();
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    return (this.contents.providers[provider] ?? []).map(storedTokensFromJSON);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const user = this.contents.providers[provider]?.find((candidate) => candidate.user_id === userId);
+    return user ? storedTokensFromJSON(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    const others = (this.contents.providers[provider] ?? []).filter((candidate) => candidate.user_id !== user.userId);
+    this.write(provider, [...others, storedTokensJSON(user)]);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    const users = this.contents.providers[provider] ?? [];
+    if (!users.some((candidate) => candidate.user_id === userId)) return;
+    this.write(provider, users.filter((candidate) => candidate.user_id !== userId));
+  }
+
+  // the whole file is written, so a change whose write failed is saved with the next one
+  private write(provider: string, users: StoredTokensJSON[]): void {
+    this.contents.providers[provider] = users;
+    const temporary = `${this.path}.${process.pid}.tmp`;
+    writeFileSync(temporary, `${JSON.stringify(this.contents, null, 2)}\n`, { mode: 0o600 });
+    renameSync(temporary, this.path);
+    chmodSync(this.path, 0o600);
+  }
+
+  private read(): StoreFile {
+    let text: string;
+    try {
+      text = readFileSync(this.path, "utf8");
+    } catch (error) {
+      if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+        return { version: FILE_FORMAT_VERSION, providers: {} };
+      }
+      throw error;
+    }
+    // a file that can't be read is left alone rather than overwritten with nothing
+    const contents = JSON.parse(text) as StoreFile;
+    if (contents.version !== FILE_FORMAT_VERSION || typeof contents.providers !== "object" || contents.providers === null) {
+      throw new Error(`${this.path} is not a version ${FILE_FORMAT_VERSION} token file`);
+    }
+    return contents;
+  }
+}
@@ -0,0 +1,113 @@
+import type { HttpClient } from "./http.js";
+
+export const DEFAULT_GCE_METADATA_HOST = "metadata.google.internal";
+
+// fetches a new access token this long before the current one expires
+const GCP_TOKEN_MARGIN_MS = 60 * 1000;
+
+export class GcpError extends Error {
+  readonly status: number;
+  // the canonical error code, e.g. "NOT_FOUND"
+  readonly code: string;
+
+  constructor(status: number, code: string, message: string) {
+    super(message);
+    this.name = "GcpError";
+    this.status = status;
+    this.code = code;
+  }
+}
+
+export interface GcpAccessToken {
+  token: string;
+  expiresAt: number;
+}
+
+export interface GcpCredentialProviderOptions {
+  httpClient: HttpClient;
+  // host of the metadata server, which GKE workload identity answers as the pod's service account
+  metadataHost?: string;
+}
+
+/**
+ * Hands out access tokens of the service account the metadata server acts
+ * as: on GKE with workload identity the Kubernetes service account's
+ * linked Google service account, on Compute Engine and Cloud Run the
+ * instance's. Tokens are fetched again shortly before they expire.
+ */
+export class GcpCredentialProvider {
+  private readonly httpClient: HttpClient;
+  private readonly metadataHost: string;
+  private current: Promise<GcpAccessToken> | null = null;
+
+  constructor(options: GcpCredentialProviderOptions) {
+    this.httpClient = options.httpClient;
+    this.metadataHost = (options.metadataHost || DEFAULT_GCE_METADATA_HOST).replace(/^https?:\/\//, "").replace(/\/+$/, "");
+  }
+
+  async get(): Promise<GcpAccessToken> {
+    const token = this.current && (await this.current.catch(() => null));
+    if (token && token.expiresAt - GCP_TOKEN_MARGIN_MS > Date.now()) return token;
+    this.current = this.fetch();
+    return this.current;
+  }
+
+  // drops the current token, e.g. after Google rejected it
+  reset(): void {
+    this.current = null;
+  }
+
+  private async fetch(): Promise<GcpAccessToken> {
+    const url = `http://${this.metadataHost}/computeMetadata/v1/instance/service-accounts/default/token`;
+    const response = await this.httpClient(url, { headers: { "Metadata-Flavor": "Google" } });
+    if (!response.ok) {
+      throw new GcpError(
+        response.status,
+        "CREDENTIALS_ERROR",
+        `the metadata server at ${this.metadataHost} answered ${response.status} for an access token: ${await response.text()}`,
+      );
+    }
+    const body = (await response.json()) as { access_token: string; expires_in: number };
+    return { token: body.access_token, expiresAt: Date.now() + body.expires_in * 1000 };
+  }
+}
+
+/**
+ * Calls a Google Cloud REST API with the credentials' access token,
+ * fetching a new token and trying once more if Google answers 401.
+ * Resolves to the parsed JSON response; Google's errors become GcpErrors.
+ */
+export async function gcpRequest<T>(
+  credentials: GcpCredentialProvider,
+  httpClient: HttpClient,
+  method: string,
+  url: string,
+  body?: unknown,
+): Promise<T> {
+  for (let attempt = 0; ; attempt++) {
+    const { token } = await credentials.get();
+    const response = await httpClient(url, {
+      method,
+      headers: { Authorization: `Bearer ${token}`, ...(body === undefined ? {} : { "Content-Type": "application/json" }) },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status === 401 && attempt === 0) {
+      credentials.reset();
+      continue;
+    }
+    const text = await response.text();
+    if (!response.ok) {
+      let code = "UNKNOWN";
+      let message = text;
+      try {
+        const { error } = JSON.parse(text) as { error?: { status?: string; message?: string } };
+        code = error?.status ?? code;
+        message = error?.message ?? text;
+      } catch {
+        // not JSON, e.g. from a proxy in between
+      }
+      throw new GcpError(response.status, code, `${method} ${new URL(url).pathname} failed with ${response.status} ${code}: ${message}`);
+    }
+    return (text ? JSON.parse(text) : {}) as T;
+  }
+}
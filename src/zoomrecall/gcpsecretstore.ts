@@ -0,0 +1,127 @@
+import { GcpError, gcpRequest } from "./gcp.js";
+import type { GcpCredentialProvider } from "./gcp.js";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+export const DEFAULT_GCP_SECRET_MANAGER_ENDPOINT = "https://secretmanager.googleapis.com";
+
+const SECRET_FORMAT_VERSION = 1;
+
+// the same layout as the JSON file store's file
+interface SecretContents {
+  version: number;
+  providers: Record<string, StoredTokensJSON[]>;
+}
+
+export interface GcpSecretManagerTokenStoreOptions {
+  // resource name of a secret that already exists, e.g. projects/my-project/secrets/zoom-oauth
+  secret: string;
+  credentials: GcpCredentialProvider;
+  httpClient: HttpClient;
+  // defaults to the global Secret Manager endpoint; set for a regional one or an emulator
+  endpoint?: string;
+}
+
+/** Whether name is a Secret Manager secret's resource name. */
+export function isGcpSecretName(name: string): boolean {
+  return /^projects\/[^/]+\/(locations\/[^/]+\/)?secrets\/[^/]+$/.test(name);
+}
+
+/**
+ * Keeps token managers' users in one Google Cloud Secret Manager secret, as
+ * the same JSON document the file store writes, for GKE deployments without
+ * a database. Authenticates through the metadata server, so with workload
+ * identity no key file is needed. Every user is read from the latest
+ * version at startup; each change adds the whole document as a new version
+ * and destroys the one it replaced, so old refresh tokens don't pile up.
+ * Meant for one instance, like the file store.
+ */
+export class GcpSecretManagerTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly credentials: GcpCredentialProvider;
+  private readonly httpClient: HttpClient;
+  private readonly endpoint: string;
+  private contents: SecretContents | null = null;
+  // the version the contents were read from or last written as, destroyed once a newer one is added
+  private version: string | null = null;
+  // writes go out one at a time, each with every change before it
+  private writing: Promise<void> = Promise.resolve();
+
+  constructor(options: GcpSecretManagerTokenStoreOptions) {
+    if (!isGcpSecretName(options.secret)) {
+      throw new Error(`${options.secret} is not a Secret Manager secret name`);
+    }
+    this.path = options.secret;
+    this.credentials = options.credentials;
+    this.httpClient = options.httpClient;
+    this.endpoint = (options.endpoint ?? DEFAULT_GCP_SECRET_MANAGER_ENDPOINT).replace(/\/+$/, "");
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    this.contents = await this.read();
+    return (this.contents.providers[provider] ?? []).map(storedTokensFromJSON);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const contents = this.contents ?? (this.contents = await this.read());
+    const user = contents.providers[provider]?.find((candidate) => candidate.user_id === userId);
+    return user ? storedTokensFromJSON(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.change(provider, (users) => [...users.filter((candidate) => candidate.user_id !== user.userId), storedTokensJSON(user)]);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.change(provider, (users) => users.filter((candidate) => candidate.user_id !== userId));
+  }
+
+  private change(provider: string, update: (users: StoredTokensJSON[]) => StoredTokensJSON[]): Promise<void> {
+    const write = this.writing.then(async () => {
+      const contents = this.contents ?? (this.contents = await this.read());
+      contents.providers[provider] = update(contents.providers[provider] ?? []);
+      const added = await this.request<{ name: string }>("POST", `${this.path}:addVersion`, {
+        payload: { data: Buffer.from(JSON.stringify(contents)).toString("base64") },
+      });
+      const replaced = this.version;
+      this.version = added.name;
+      if (replaced) {
+        // the new version is already in place, so a failure here only leaves an old refresh token behind
+        await this.request("POST", `${replaced}:destroy`, {}).catch((error: unknown) => {
+          console.warn(`could not destroy ${replaced} after adding ${added.name}: ${error instanceof Error ? error.message : String(error)}`);
+        });
+      }
+    });
+    // a failed write doesn't hold up the next one, which writes its changes too
+    this.writing = write.catch(() => {});
+    return write;
+  }
+
+  private async read(): Promise<SecretContents> {
+    let secret: { name: string; payload: { data?: string } };
+    try {
+      secret = await this.request<{ name: string; payload: { data?: string } }>("GET", `${this.path}/versions/latest:access`);
+    } catch (error) {
+      if (!(error instanceof GcpError && error.code === "NOT_FOUND")) throw error;
+      // Secret Manager answers the same for a secret without versions and one that doesn't exist; only the first is empty
+      await this.request("GET", this.path);
+      this.version = null;
+      return { version: SECRET_FORMAT_VERSION, providers: {} };
+    }
+    this.version = secret.name;
+    const text = Buffer.from(secret.payload.data ?? "", "base64").toString("utf8");
+    if (!text.trim()) {
+      return { version: SECRET_FORMAT_VERSION, providers: {} };
+    }
+    const contents = JSON.parse(text) as SecretContents;
+    if (contents.version !== SECRET_FORMAT_VERSION || typeof contents.providers !== "object" || contents.providers === null) {
+      throw new Error(`${this.path} does not hold version ${SECRET_FORMAT_VERSION} tokens`);
+    }
+    return contents;
+  }
+
+  private request<T>(method: string, resource: string, body?: unknown): Promise<T> {
+    return gcpRequest<T>(this.credentials, this.httpClient, method, `${this.endpoint}/v1/${resource}`, body);
+  }
+}
@@ -0,0 +1,107 @@
+import { errorFromOAuthResponse } from "./errors.js";
+import type { HttpClient } from "./http.js";
+import { parseScopes } from "./zoom.js";
+import type { OAuthTokens } from "./zoom.js";
+
+export const DEFAULT_GOOGLE_AUTH_BASE_URL = "https://accounts.google.com";
+export const DEFAULT_GOOGLE_TOKEN_BASE_URL = "https://oauth2.googleapis.com";
+export const DEFAULT_GOOGLE_SCOPES = ["openid", "email", "https://www.googleapis.com/auth/calendar.readonly"];
+
+interface GoogleTokenResponse {
+  access_token: string;
+  token_type: string;
+  // only returned on the first exchange; refreshes keep using the original one
+  refresh_token?: string;
+  expires_in: number;
+  scope: string;
+  id_token?: string;
+}
+
+export interface GoogleClientOptions {
+  clientId: string;
+  clientSecret: string;
+  redirectUri: string;
+  scopes?: string[];
+  authBaseUrl?: string;
+  tokenBaseUrl?: string;
+  httpClient?: HttpClient;
+}
+
+/** OAuth client for Google accounts, used for Meet bots and calendar access. */
+export class GoogleClient {
+  private readonly clientId: string;
+  private readonly clientSecret: string;
+  private readonly redirectUri: string;
+  private readonly scope: string;
+  private readonly authBaseUrl: string;
+  private readonly tokenBaseUrl: string;
+  private readonly httpClient: HttpClient;
+
+  constructor(options: GoogleClientOptions) {
+    this.clientId = options.clientId;
+    this.clientSecret = options.clientSecret;
+    this.redirectUri = options.redirectUri;
+    this.scope = (options.scopes ?? DEFAULT_GOOGLE_SCOPES).join(" ");
+    this.authBaseUrl = options.authBaseUrl ?? DEFAULT_GOOGLE_AUTH_BASE_URL;
+    this.tokenBaseUrl = options.tokenBaseUrl ?? DEFAULT_GOOGLE_TOKEN_BASE_URL;
+    this.httpClient = options.httpClient ?? fetch;
+  }
+
+  authorizeUrl(state?: string): string {
+    const query = new URLSearchParams({
+      client_id: this.clientId,
+      response_type: "code",
+      redirect_uri: this.redirectUri,
+      scope: this.scope,
+      // offline access returns a refresh token; prompt=consent makes Google return one again on re-consent
+      access_type: "offline",
+      prompt: "consent",
+      include_granted_scopes: "true",
+    });
+    if (state !== undefined) {
+      query.set("state", state);
+    }
+    return `${this.authBaseUrl}/o/oauth2/v2/auth?${query}`;
+  }
+
+  async exchangeCode(authCode: string): Promise<OAuthTokens> {
+    return this.requestToken(
+      new URLSearchParams({
+        grant_type: "authorization_code",
+        code: authCode,
+        redirect_uri: this.redirectUri,
+      }),
+    );
+  }
+
+  async refreshToken(refreshToken: string): Promise<OAuthTokens> {
+    return this.requestToken(
+      new URLSearchParams({
+        grant_type: "refresh_token",
+        refresh_token: refreshToken,
+      }),
+    );
+  }
+
+  private async requestToken(params: URLSearchParams): Promise<OAuthTokens> {
+    params.set("client_id", this.clientId);
+    params.set("client_secret", this.clientSecret);
+    const response = await this.httpClient(`${this.tokenBaseUrl}/token`, {
+      method: "POST",
+      headers: { "Content-Type": "application/x-www-form-urlencoded" },
+      body: params.toString(),
+    });
+    if (!response.ok) {
+      throw await errorFromOAuthResponse(response, "google");
+    }
+
+    const data = (await response.json()) as GoogleTokenResponse;
+    return {
+      accessToken: data.access_token,
+      refreshToken: data.refresh_token ?? params.get("refresh_token") ?? "",
+      expiresIn: data.expires_in,
+      scopes: parseScopes(data.scope),
+      tokenType: data.token_type,
+    };
+  }
+}
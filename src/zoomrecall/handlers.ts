@@ -0,0 +1,450 @@
+import { createHash, timingSafeEqual } from "crypto";
+import express from "express";
+import { HttpError, MeetingNotFoundError } from "./errors.js";
+import { writeError, writeJSON, writeRawToken, writesTokenJSON } from "./httpx.js";
+import type { TokenResponseFormat } from "./httpx.js";
+import type { IssuancePolicy, IssuanceRequest } from "./policy.js";
+import type { ProxyTokens } from "./proxy.js";
+import type { OAuthTokenManager, TokenManager } from "./tokens.js";
+import { parseMeetingId, parseMeetingLink } from "./zoom.js";
+import type { ZoomMeeting, ZoomOccurrence } from "./zoom.js";
+
+export const TOKEN_EXCHANGE_GRANT_TYPE = "urn:ietf:params:oauth:grant-type:token-exchange";
+export const ACCESS_TOKEN_TYPE = "urn:ietf:params:oauth:token-type:access_token";
+export const OBF_TOKEN_TYPE = "urn:zoomrecall:token-type:obf";
+export const ZAK_TOKEN_TYPE = "urn:zoomrecall:token-type:zak";
+
+/**
+ * What dry runs answer with in place of a token: recognizably fake, so it
+ * fails loudly if it is ever used.
+ */
+export function dryRunToken(kind: "access" | "obf" | "zak"): string {
+  return `dry-run-${kind}-token-not-valid`;
+}
+
+// dry_run=true runs every check a request would and answers with dryRunToken instead of a real token
+function isDryRun(req: express.Request): boolean {
+  return req.query.dry_run === "true";
+}
+
+function writeDryRunToken(req: express.Request, res: express.Response, kind: "access" | "obf" | "zak", format?: TokenResponseFormat): void {
+  res.set("Dry-Run", "true");
+  writeRawToken(req, res, dryRunToken(kind), format);
+}
+
+/** Builds the URL Recall should call for a user's credentials, e.g. a bot's zoom.obf_token_url. */
+export function recallCallbackUrl(
+  baseUrl: string,
+  callback: "oauth-callback" | "obf-callback" | "zak-callback" | "teams/oauth-callback" | "google/oauth-callback",
+  callbackSecret: string,
+  userId: string,
+): string {
+  const query = new URLSearchParams({ auth_token: callbackSecret, user_id: userId });
+  return `${baseUrl}/recall/${callback}?${query}`;
+}
+
+/** The JSON shape meeting details are served in, by the Recall router and the admin API. */
+export function meetingJSON(meeting: ZoomMeeting): Record<string, unknown> {
+  return {
+    meeting_id: meeting.id,
+    topic: meeting.topic,
+    host_id: meeting.hostId,
+    host_email: meeting.hostEmail ?? null,
+    start_time: meeting.startTime?.toISOString() ?? null,
+    timezone: meeting.timezone ?? null,
+    duration_minutes: meeting.durationMinutes ?? null,
+    status: meeting.status ?? null,
+    registration_required: meeting.registrationRequired,
+    waiting_room: meeting.waitingRoom,
+    join_before_host: meeting.joinBeforeHost,
+    recurring: meeting.recurring,
+    occurrences: meeting.occurrences.map((occurrence) => ({
+      occurrence_id: occurrence.id,
+      start_time: occurrence.startTime.toISOString(),
+      duration_minutes: occurrence.durationMinutes ?? null,
+      status: occurrence.status ?? null,
+    })),
+  };
+}
+
+/** A token handed to a caller, reported so it can be tied back to the bot that asked for it. */
+export interface ServedToken {
+  // "proxy" when /oauth-callback returned a proxy token instead of the access token
+  kind: "access" | "proxy" | "obf" | "zak";
+  userId: string;
+  meetingId: string | undefined;
+  // the caller's IP, or e.g. "token-exchange:<ip>"
+  source: string;
+}
+
+/** Picks the connected user a bot's callbacks are served as, from what their URL says of the bot. */
+export interface UserMapper {
+  // by the bot_id query parameter, or a metadata[<key>] one, as set in the bot's callback URLs
+  userForBot(botId: string | undefined, metadata: Record<string, string>): string | undefined;
+  // by the host of the meeting_id, with resolveHosts
+  userForHost(zoomUserId: string, email: string | undefined): string | undefined;
+}
+
+export interface RecallRouterOptions {
+  tokens: TokenManager;
+  callbackSecret: string;
+  // checked before every token, and every proxy token, is issued
+  policy?: IssuancePolicy;
+  // lets callers pass only a meeting_id; tokens are then issued as the meeting's connected host
+  resolveHosts?: boolean;
+  // when set, /oauth-callback returns proxy tokens instead of access tokens and /token-exchange redeems them
+  proxyTokens?: ProxyTokens;
+  // lets /token-exchange hand out the access token itself, not just OBF and ZAK tokens
+  exchangeAccessTokens?: boolean;
+  // how tokens are written; errors are unaffected (default: "text")
+  responseFormat?: TokenResponseFormat;
+  // adds the passcode of the user's own meeting to JSON ZAK responses that name a meeting_id
+  meetingPasscodes?: boolean;
+  // looks up every meeting_id of OBF and ZAK requests and picks the occurrence of recurring ones,
+  // refusing tokens for meetings with none to come; occurrence_id is always checked
+  resolveOccurrences?: boolean;
+  // consulted for callers that name neither a user_id nor an email
+  userMappings?: UserMapper;
+  // refuses callbackSecret, so every request needs the auth_token of the user it is for; see TokenManager.issueCallbackSecret
+  requireUserSecrets?: boolean;
+  // takes a meeting_id that is a connected user's Personal Meeting ID, or a meeting_url that is their personal link,
+  // as that user's meeting
+  resolvePersonalMeetings?: boolean;
+  onServed?(served: ServedToken): void;
+}
+
+// what a callback names the meeting by, resolved
+interface MeetingTarget {
+  meetingId: string | undefined;
+  // the connected user whose personal meeting it is
+  personalUserId: string | undefined;
+}
+
+export interface OAuthRecallRouterOptions {
+  tokens: OAuthTokenManager;
+  callbackSecret: string;
+  // provider name for error messages, e.g. "microsoft"
+  provider: string;
+  responseFormat?: TokenResponseFormat;
+}
+
+// the policy allowed get to return an expired token; let the caller know it may be rejected
+function warnIfStale(res: express.Response, tokens: OAuthTokenManager, userId: string): void {
+  if (tokens.isStale(userId)) {
+    console.warn(`serving an expired access token for user ${userId}, refreshing it keeps failing`);
+    res.set("Warning", '110 - "access token is expired, refreshing it keeps failing"');
+  }
+}
+
+// tells the caller which occurrence a token was minted for: in a header, and in JSON responses
+function occurrenceFields(res: express.Response, occurrence: ZoomOccurrence | undefined): Record<string, unknown> {
+  if (!occurrence) return {};
+  res.set("Zoom-Occurrence-Id", occurrence.id);
+  return { occurrence_id: occurrence.id, occurrence_start_time: occurrence.startTime.toISOString() };
+}
+
+// compares digests, so neither the length nor the contents of the secret show in how long it takes
+function isSecret(presented: unknown, callbackSecret: string): boolean {
+  if (typeof presented !== "string") return false;
+  const digest = (value: string) => createHash("sha256").update(value).digest();
+  return timingSafeEqual(digest(presented), digest(callbackSecret));
+}
+
+function checkSecret(req: express.Request, callbackSecret: string): void {
+  if (!isSecret(req.query.auth_token, callbackSecret)) {
+    throw new HttpError(401, "recall auth secret provided is incorrect");
+  }
+}
+
+function authenticate(req: express.Request, callbackSecret: string): string {
+  checkSecret(req, callbackSecret);
+
+  const userId = req.query.user_id as string | undefined;
+  if (!userId) {
+    throw new HttpError(400, "no user_id provided");
+  }
+  return userId;
+}
+
+/**
+ * Builds a router serving the endpoints Recall calls for Zoom credentials:
+ * `/oauth-callback`, `/obf-callback` and `/zak-callback`, plus
+ * `/token-exchange` in proxy mode. Mount it under `/recall` to match the URLs
+ * configured on the Recall bot.
+ */
+export function createRecallRouter(options: RecallRouterOptions): express.Router {
+  const { tokens, callbackSecret, policy, resolveHosts = false, proxyTokens, exchangeAccessTokens = false, responseFormat, meetingPasscodes = false, resolveOccurrences = false, userMappings, resolvePersonalMeetings = false, requireUserSecrets = false, onServed } = options;
+  const router = express.Router();
+
+  function meetingIdFrom(req: express.Request): string | undefined {
+    const raw = req.query.meeting_id as string | undefined;
+    if (raw === undefined) return undefined;
+
+    const meetingId = parseMeetingId(raw);
+    if (!meetingId) {
+      throw new HttpError(400, `invalid meeting_id: ${raw}`);
+    }
+    return meetingId;
+  }
+
+  // the meeting a request is for, by meeting_id or meeting_url, and with resolvePersonalMeetings the user whose personal meeting it is
+  async function meetingFrom(req: express.Request): Promise<MeetingTarget> {
+    let meetingId = meetingIdFrom(req);
+    const meetingUrl = req.query.meeting_url;
+    if (meetingId === undefined && meetingUrl !== undefined) {
+      const link = typeof meetingUrl === "string" ? parseMeetingLink(meetingUrl) : undefined;
+      if (!link) {
+        throw new HttpError(400, `invalid meeting_url: ${String(meetingUrl)}`);
+      }
+      if ("vanityName" in link) {
+        if (!resolvePersonalMeetings) {
+          throw new HttpError(400, `personal links are not resolved here: ${String(meetingUrl)}`);
+        }
+        const personal = await tokens.personalMeeting(link);
+        if (!personal) {
+          throw new MeetingNotFoundError(`no connected user has the personal link ${String(meetingUrl)}`);
+        }
+        return { meetingId: personal.pmi, personalUserId: personal.userId };
+      }
+      meetingId = link.meetingId;
+    }
+    if (meetingId !== undefined && resolvePersonalMeetings) {
+      const personal = await tokens.personalMeeting({ pmi: meetingId });
+      if (personal) return { meetingId, personalUserId: personal.userId };
+    }
+    return { meetingId, personalUserId: undefined };
+  }
+
+  // the occurrence of a recurring meeting a token is for, next to come unless occurrence_id names one
+  async function occurrenceFrom(req: express.Request, userId: string, meetingId: string | undefined): Promise<ZoomOccurrence | undefined> {
+    const occurrenceId = req.query.occurrence_id;
+    if (occurrenceId !== undefined && (typeof occurrenceId !== "string" || !/^\d+$/.test(occurrenceId))) {
+      throw new HttpError(400, `invalid occurrence_id: ${String(occurrenceId)}`);
+    }
+    if (occurrenceId !== undefined && !meetingId) {
+      throw new HttpError(400, "occurrence_id needs a meeting_id");
+    }
+    if (!meetingId || (!resolveOccurrences && occurrenceId === undefined)) return undefined;
+    return tokens.meetingOccurrence(userId, meetingId, occurrenceId);
+  }
+
+  // whom auth_token lets the caller fetch tokens for: null with the shared secret, anyone without one of their own;
+  // with a user's own secret, only that user
+  function callerFrom(req: express.Request): string | null {
+    const secret = req.query.auth_token;
+    if (isSecret(secret, callbackSecret)) {
+      if (requireUserSecrets) {
+        throw new HttpError(401, "the shared recall auth secret is not accepted, use the user's own");
+      }
+      return null;
+    }
+    const userId = typeof secret === "string" && secret ? tokens.userForCallbackSecret(secret) : undefined;
+    if (userId === undefined) {
+      throw new HttpError(401, "recall auth secret provided is incorrect");
+    }
+    return userId;
+  }
+
+  // the user and meeting a request is for, once its auth_token was checked and found to allow tokens for that user
+  async function requestFrom(req: express.Request): Promise<{ userId: string; meetingId: string | undefined }> {
+    const caller = callerFrom(req);
+    const meeting = await meetingFrom(req);
+    const userId = await userIdFrom(req, meeting, caller);
+    if (caller === null && tokens.callbackSecret(userId) !== undefined) {
+      throw new HttpError(401, `user ${userId} has a recall auth secret of their own, the shared one is not accepted for them`);
+    }
+    if (caller !== null && caller !== userId) {
+      throw new HttpError(403, "the recall auth secret provided is for another user");
+    }
+    return { userId, meetingId: meeting.meetingId };
+  }
+
+  // callers name the user by user_id or by the email they connected with, the bot mapped to one, their personal meeting,
+  // their own auth_token, or with resolveHosts only the meeting
+  async function userIdFrom(req: express.Request, { meetingId, personalUserId }: MeetingTarget, caller: string | null): Promise<string> {
+    if (req.query.user_id !== undefined) {
+      const userId = req.query.user_id as string;
+      if (!userId) {
+        throw new HttpError(400, "no user_id provided");
+      }
+      return userId;
+    }
+    if (typeof req.query.email === "string" && req.query.email) {
+      return tokens.userForEmail(req.query.email);
+    }
+    const botId = typeof req.query.bot_id === "string" && req.query.bot_id ? req.query.bot_id : undefined;
+    const metadata = Object.fromEntries(
+      Object.entries(req.query).flatMap(([key, value]) => {
+        const name = /^metadata\[(.+)\]$/.exec(key)?.[1];
+        return name !== undefined && typeof value === "string" ? [[name, value]] : [];
+      }),
+    );
+    const mapped = userMappings?.userForBot(botId, metadata);
+    if (mapped !== undefined) return mapped;
+    if (personalUserId !== undefined) return personalUserId;
+    if (caller !== null) return caller;
+    if (userMappings && !resolveHosts && (botId !== undefined || Object.keys(metadata).length > 0)) {
+      throw new HttpError(404, `no user is mapped to bot ${botId ?? JSON.stringify(metadata)}`);
+    }
+    if (!resolveHosts) {
+      throw new HttpError(400, "no user_id or email provided");
+    }
+    if (!meetingId) {
+      throw new HttpError(400, "no user_id, email or meeting_id provided");
+    }
+    return tokens.resolveHost(meetingId, userMappings && ((zoomUserId, email) => userMappings.userForHost(zoomUserId, email)));
+  }
+
+  router.get("/oauth-callback", async (req, res) => {
+    try {
+      const { userId, meetingId } = await requestFrom(req);
+      // a proxy token that can be exchanged for the access token is as good as one
+      const issuance: IssuanceRequest = { kind: proxyTokens && !exchangeAccessTokens ? "proxy" : "access", userId, meetingId, source: req.ip };
+      if (isDryRun(req)) {
+        policy?.verify(issuance);
+        await tokens.checkIssuance(userId, "access");
+        writeDryRunToken(req, res, "access", responseFormat);
+        return;
+      }
+      policy?.enforce(issuance);
+      const { accessToken } = tokens.get(userId);
+      warnIfStale(res, tokens, userId);
+      writeRawToken(req, res, proxyTokens ? proxyTokens.issue(userId).token : accessToken, responseFormat);
+      onServed?.({ kind: proxyTokens ? "proxy" : "access", userId, meetingId, source: req.ip ?? "" });
+    } catch (error) {
+      writeError(req, res, error, "error fetching oauth token");
+    }
+  });
+
+  if (proxyTokens) {
+    // an RFC 8693 token exchange; the proxy token is the only credential
+    router.post("/token-exchange", express.json(), async (req, res) => {
+      try {
+        const body = (req.body ?? {}) as Record<string, unknown>;
+        if (body.grant_type !== TOKEN_EXCHANGE_GRANT_TYPE) {
+          throw new HttpError(400, `grant_type must be ${TOKEN_EXCHANGE_GRANT_TYPE}`);
+        }
+        const userId = proxyTokens.redeem(typeof body.subject_token === "string" ? body.subject_token : "");
+        let meetingId: string | undefined;
+        if (body.meeting_id !== undefined) {
+          meetingId = parseMeetingId(String(body.meeting_id));
+          if (!meetingId) {
+            throw new HttpError(400, `invalid meeting_id: ${String(body.meeting_id)}`);
+          }
+        }
+
+        const requested = body.requested_token_type ?? OBF_TOKEN_TYPE;
+        let token: string;
+        if (requested === OBF_TOKEN_TYPE) {
+          policy?.enforce({ kind: "obf", userId, meetingId, source: `token-exchange:${req.ip}` });
+          token = await tokens.generateObfToken(userId, meetingId);
+        } else if (requested === ZAK_TOKEN_TYPE) {
+          policy?.enforce({ kind: "zak", userId, meetingId, source: `token-exchange:${req.ip}` });
+          token = await tokens.generateZakToken(userId);
+        } else if (requested === ACCESS_TOKEN_TYPE) {
+          if (!exchangeAccessTokens) {
+            throw new HttpError(403, "exchanging proxy tokens for access tokens is disabled");
+          }
+          policy?.enforce({ kind: "access", userId, meetingId, source: `token-exchange:${req.ip}` });
+          token = tokens.get(userId).accessToken;
+          warnIfStale(res, tokens, userId);
+        } else {
+          throw new HttpError(400, `requested_token_type must be one of ${OBF_TOKEN_TYPE}, ${ZAK_TOKEN_TYPE}, ${ACCESS_TOKEN_TYPE}`);
+        }
+        writeJSON(res, 200, { access_token: token, issued_token_type: requested, token_type: "N_A" });
+        const kind = requested === OBF_TOKEN_TYPE ? "obf" : requested === ZAK_TOKEN_TYPE ? "zak" : "access";
+        onServed?.({ kind, userId, meetingId, source: `token-exchange:${req.ip}` });
+      } catch (error) {
+        writeError(req, res, error, "error exchanging proxy token");
+      }
+    });
+  }
+
+  router.get("/obf-callback", async (req, res) => {
+    try {
+      const { userId, meetingId } = await requestFrom(req);
+      const occurrence = await occurrenceFrom(req, userId, meetingId);
+      if (isDryRun(req)) {
+        policy?.verify({ kind: "obf", userId, meetingId, source: req.ip });
+        await tokens.checkIssuance(userId, "obf");
+        writeDryRunToken(req, res, "obf", responseFormat);
+        return;
+      }
+      policy?.enforce({ kind: "obf", userId, meetingId, source: req.ip });
+      writeRawToken(req, res, await tokens.generateObfToken(userId, meetingId), responseFormat, occurrenceFields(res, occurrence));
+      onServed?.({ kind: "obf", userId, meetingId, source: req.ip ?? "" });
+    } catch (error) {
+      writeError(req, res, error, "error fetching OBF token");
+    }
+  });
+
+  router.get("/meeting", async (req, res) => {
+    try {
+      const { userId, meetingId } = await requestFrom(req);
+      if (!meetingId) {
+        throw new HttpError(400, "no meeting_id provided");
+      }
+      writeJSON(res, 200, meetingJSON(await tokens.getMeeting(userId, meetingId)));
+    } catch (error) {
+      writeError(req, res, error, "error fetching meeting");
+    }
+  });
+
+  router.get("/zak-callback", async (req, res) => {
+    try {
+      // a ZAK isn't scoped to a meeting; meeting_id only tells the policy which meeting it's for
+      const { userId, meetingId } = await requestFrom(req);
+      const occurrence = await occurrenceFrom(req, userId, meetingId);
+      if (isDryRun(req)) {
+        policy?.verify({ kind: "zak", userId, meetingId, source: req.ip });
+        await tokens.checkIssuance(userId, "zak");
+        writeDryRunToken(req, res, "zak", responseFormat);
+        return;
+      }
+      policy?.enforce({ kind: "zak", userId, meetingId, source: req.ip });
+      const zak = await tokens.generateZakToken(userId);
+      if (meetingPasscodes && meetingId && writesTokenJSON(req, responseFormat)) {
+        // bots joining a passcode-protected meeting need both; the ZAK doesn't depend on the lookup
+        const passcode = await tokens.hostedMeetingPasscode(userId, meetingId).catch((error: unknown) => {
+          console.warn(`could not look up the passcode of meeting ${meetingId} for user ${userId}`, error);
+          return null;
+        });
+        writeRawToken(req, res, zak, responseFormat, { ...occurrenceFields(res, occurrence), passcode });
+      } else {
+        writeRawToken(req, res, zak, responseFormat, occurrenceFields(res, occurrence));
+      }
+      onServed?.({ kind: "zak", userId, meetingId, source: req.ip ?? "" });
+    } catch (error) {
+      writeError(req, res, error, "error fetching ZAK token");
+    }
+  });
+
+  return router;
+}
+
+/**
+ * Builds a router serving `/oauth-callback`, which returns a user's access
+ * token for a non-Zoom provider, e.g. Microsoft under `/recall/teams` or
+ * Google under `/recall/google`.
+ */
+export function createOAuthRecallRouter(options: OAuthRecallRouterOptions): express.Router {
+  const { tokens, callbackSecret, provider, responseFormat } = options;
+  const router = express.Router();
+
+  router.get("/oauth-callback", (req, res) => {
+    try {
+      const userId = authenticate(req, callbackSecret);
+      const { accessToken } = tokens.get(userId);
+      if (isDryRun(req)) {
+        writeDryRunToken(req, res, "access", responseFormat);
+        return;
+      }
+      warnIfStale(res, tokens, userId);
+      writeRawToken(req, res, accessToken, responseFormat);
+    } catch (error) {
+      writeError(req, res, error, `error fetching ${provider} oauth token`);
+    }
+  });
+
+  return router;
+}
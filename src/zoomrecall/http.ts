@@ -0,0 +1,50 @@
+import http from "http";
+import https from "https";
+
+export type HttpClient = (input: string | URL, init?: RequestInit) => Promise<Response>;
+
+const DEFAULT_TIMEOUT_MS = 10 * 1000;
+
+export function createHttpClient(timeoutMs: number = DEFAULT_TIMEOUT_MS, baseClient: HttpClient = fetch): HttpClient {
+  return (input, init) => baseClient(input, { ...init, signal: init?.signal ?? AbortSignal.timeout(timeoutMs) });
+}
+
+/** An HttpClient that sends userAgent as the User-Agent of every request that doesn't set its own. */
+export function withUserAgent(userAgent: string, baseClient: HttpClient = fetch): HttpClient {
+  return (input, init) => {
+    const headers = new Headers(init?.headers);
+    if (!headers.has("user-agent")) headers.set("user-agent", userAgent);
+    return baseClient(input, { ...init, headers });
+  };
+}
+
+/**
+ * An HttpClient that only trusts ca for HTTPS, e.g. a cluster's own CA for
+ * the Kubernetes API, which fetch can't be given per request. Bodies are
+ * sent as strings.
+ */
+export function createCaHttpClient(ca: string | Buffer, timeoutMs: number = DEFAULT_TIMEOUT_MS): HttpClient {
+  return (input, init = {}) =>
+    new Promise((resolve, reject) => {
+      const url = new URL(input);
+      const request = (url.protocol === "https:" ? https : http).request(
+        url,
+        { method: init.method ?? "GET", headers: Object.fromEntries(new Headers(init.headers)), ca, signal: init.signal ?? AbortSignal.timeout(timeoutMs) },
+        (response) => {
+          const chunks: Buffer[] = [];
+          response.on("data", (chunk: Buffer) => chunks.push(chunk));
+          response.on("error", reject);
+          response.on("end", () => {
+            const headers = new Headers();
+            for (const [name, value] of Object.entries(response.headers)) {
+              for (const item of Array.isArray(value) ? value : value === undefined ? [] : [value]) headers.append(name, item);
+            }
+            const status = response.statusCode ?? 502;
+            resolve(new Response(status === 204 || status === 304 ? null : Buffer.concat(chunks), { status, statusText: response.statusMessage, headers }));
+          });
+        },
+      );
+      request.on("error", reject);
+      request.end(init.body === undefined || init.body === null ? undefined : String(init.body));
+    });
+}
@@ -0,0 +1,82 @@
+import type express from "express";
+import { HttpError, IssuanceQuotaExceededError, RateLimitedError, statusForError } from "./errors.js";
+
+export const TOKEN_RESPONSE_FORMATS = ["text", "text-newline", "json"] as const;
+// "text" is the token's exact bytes; "text-newline" adds a \n for line-oriented clients; "json" is {"token": ...} whatever the Accept header
+export type TokenResponseFormat = (typeof TOKEN_RESPONSE_FORMATS)[number];
+
+function setNoStore(res: express.Response): void {
+  res.set("Cache-Control", "no-store");
+  res.set("Pragma", "no-cache");
+}
+
+function wantsJSON(req: express.Request): boolean {
+  return req.accepts(["text/plain", "application/json"]) === "application/json";
+}
+
+export function writeJSON(res: express.Response, status: number, body: unknown): void {
+  setNoStore(res);
+  res.status(status).json(body);
+}
+
+/** Whether writeRawToken answers req with JSON, which has room for more than the token. */
+export function writesTokenJSON(req: express.Request, format: TokenResponseFormat = "text"): boolean {
+  return format === "json" || wantsJSON(req);
+}
+
+/**
+ * Writes a credential as text/plain, or as {"token": ...} when the caller
+ * asks for JSON or format is "json". Surrounding whitespace, e.g. from a
+ * pasted token, is never sent. fields are added to the JSON and left out of
+ * text.
+ */
+export function writeRawToken(
+  req: express.Request,
+  res: express.Response,
+  token: string,
+  format: TokenResponseFormat = "text",
+  fields: Record<string, unknown> = {},
+): void {
+  const trimmed = token.trim();
+  if (writesTokenJSON(req, format)) {
+    writeJSON(res, 200, { token: trimmed, ...fields });
+    return;
+  }
+  setNoStore(res);
+  res
+    .status(200)
+    .type("text/plain; charset=utf-8")
+    .send(Buffer.from(format === "text-newline" ? `${trimmed}\n` : trimmed, "utf8"));
+}
+
+/**
+ * Logs error and writes it with the status from statusForError. Messages of
+ * unexpected (500) errors are replaced by fallbackMessage so internals don't
+ * leak to the caller.
+ */
+export function writeError(
+  req: express.Request,
+  res: express.Response,
+  error: unknown,
+  fallbackMessage: string = "internal server error",
+): void {
+  const status = statusForError(error);
+  const message =
+    error instanceof HttpError || (status !== 500 && error instanceof Error) ? error.message : fallbackMessage;
+  const route = `${req.method} ${req.baseUrl}${req.path}`;
+  if (status === 500 && !(error instanceof HttpError)) {
+    console.error(`${route}: ${fallbackMessage}`, error);
+  } else {
+    console.error(`${route}: ${message}`);
+  }
+
+  if ((error instanceof RateLimitedError || error instanceof IssuanceQuotaExceededError) && error.retryAfterSeconds !== undefined) {
+    res.set("Retry-After", String(error.retryAfterSeconds));
+  }
+  if (wantsJSON(req)) {
+    writeJSON(res, status, { error: message });
+    return;
+  }
+  setNoStore(res);
+  res.status(status).type("text/plain; charset=utf-8").send(message);
+}
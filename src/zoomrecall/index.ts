@@ -0,0 +1,144 @@
+export { AccountTokenManager } from "./account.js";
+export type { AccountTokenManagerOptions } from "./account.js";
+export { WaitingRoomAdmitter } from "./admit.js";
+export type { WaitingRoomAdmission, WaitingRoomAdmitterOptions, WaitingRoomParticipant } from "./admit.js";
+export {
+  AuthorizationCodeExpiredError,
+  CodeVerifierMismatchError,
+  HostNotConnectedError,
+  HttpError,
+  InvalidGrantError,
+  IssuanceDeniedError,
+  IssuanceQuotaExceededError,
+  MeetingNotFoundError,
+  OAuthProviderError,
+  RateLimitedError,
+  RecallApiError,
+  TokenExpiredError,
+  TokenNotSetError,
+  UserDeactivatedError,
+  ZOOM_INVALID_TOKEN_CODE,
+  ZOOM_MISSING_SCOPE_CODE,
+  ZOOM_USER_NOT_FOUND_CODE,
+  ZoomApiError,
+  errorFromOAuthResponse,
+  errorFromZoomResponse,
+  statusForError,
+} from "./errors.js";
+export { AwsCredentialProvider, awsCredentialSource, AwsError, AwsJsonClient, signAwsRequest } from "./aws.js";
+export type { AwsCredentials, AwsCredentialSource, AwsJsonClientOptions, AwsRequest } from "./aws.js";
+export { AwsSecretsManagerTokenStore, secretArnRegion } from "./awssecretstore.js";
+export { isSsmParameterPath, SsmParameterClient } from "./ssm.js";
+export type { SsmParameterClientOptions } from "./ssm.js";
+export type { AwsSecretsManagerTokenStoreOptions } from "./awssecretstore.js";
+export { AzureCredentialProvider, azureCredentialSource, AzureError, DEFAULT_AZURE_AUTHORITY_HOST, DEFAULT_AZURE_IMDS_HOST } from "./azure.js";
+export type { AzureAccessToken, AzureCredentialProviderOptions, AzureCredentialSource } from "./azure.js";
+export { AzureKeyVaultTokenStore, DEFAULT_AZURE_KEY_VAULT_SECRET_NAME, isKeyVaultSecretName, keyVaultResource } from "./azurekeyvaultstore.js";
+export type { AzureKeyVaultTokenStoreOptions } from "./azurekeyvaultstore.js";
+export { DEFAULT_DYNAMODB_TTL_MS, DYNAMODB_TTL_ATTRIBUTE, DynamoDbTokenStore, isDynamoDbTable, tableArnRegion } from "./dynamodbstore.js";
+export type { DynamoDbTokenStoreOptions } from "./dynamodbstore.js";
+export {
+  DEFAULT_KUBERNETES_SERVICE_ACCOUNT_DIR,
+  isKubernetesSecretName,
+  kubernetesApiUrl,
+  KubernetesError,
+  KubernetesSecretTokenStore,
+} from "./kubernetessecretstore.js";
+export type { KubernetesSecretTokenStoreOptions } from "./kubernetessecretstore.js";
+export { DEFAULT_GCE_METADATA_HOST, GcpCredentialProvider, GcpError, gcpRequest } from "./gcp.js";
+export type { GcpAccessToken, GcpCredentialProviderOptions } from "./gcp.js";
+export { DEFAULT_GCP_SECRET_MANAGER_ENDPOINT, GcpSecretManagerTokenStore, isGcpSecretName } from "./gcpsecretstore.js";
+export type { GcpSecretManagerTokenStoreOptions } from "./gcpsecretstore.js";
+export { EncryptedTokenStore } from "./encryptedstore.js";
+export type { EncryptedTokenStoreOptions } from "./encryptedstore.js";
+export { DATA_KEY_BYTES, LocalKeyProvider, parseEncryptionKey, parseWrappedRef, wrappedRef, wrappingTag } from "./encryption.js";
+export type { DataKey, EncryptionProvider, LocalKeyProviderOptions } from "./encryption.js";
+export { AwsKmsProvider, DEFAULT_GCP_KMS_ENDPOINT, GcpKmsProvider, isGcpKmsKeyName, kmsKeyArnRegion } from "./kms.js";
+export type { AwsKmsProviderOptions, GcpKmsProviderOptions } from "./kms.js";
+export { AgeProvider, PgpProvider } from "./keytools.js";
+export type { AgeProviderOptions, PgpProviderOptions } from "./keytools.js";
+export { FileTokenStore } from "./filestore.js";
+export { MemoryTokenStore } from "./store.js";
+export type { StoredTokens, TokenStore } from "./store.js";
+export { RedisClient, RedisError } from "./redis.js";
+export type { RedisOptions, RedisReply } from "./redis.js";
+export { DEFAULT_REDIS_KEY_PREFIX, RedisTokenStore } from "./redisstore.js";
+export type { RedisTokenStoreOptions } from "./redisstore.js";
+export {
+  DEFAULT_VAULT_KUBERNETES_AUTH_PATH,
+  DEFAULT_VAULT_KUBERNETES_TOKEN_PATH,
+  DEFAULT_VAULT_KV_MOUNT,
+  DEFAULT_VAULT_PATH_PREFIX,
+  VaultError,
+  VaultTokenStore,
+} from "./vaultstore.js";
+export type { VaultAuth, VaultTokenStoreOptions } from "./vaultstore.js";
+export { openSqlite, setSqliteSchemaVersion, SQLITE_MIGRATIONS, SQLITE_SCHEMA_VERSION, sqliteSchemaVersion, SqliteTokenStore } from "./sqlitestore.js";
+export type { SqliteMigration } from "./sqlitestore.js";
+export {
+  ACCESS_TOKEN_TYPE,
+  createOAuthRecallRouter,
+  createRecallRouter,
+  dryRunToken,
+  meetingJSON,
+  OBF_TOKEN_TYPE,
+  recallCallbackUrl,
+  TOKEN_EXCHANGE_GRANT_TYPE,
+  ZAK_TOKEN_TYPE,
+} from "./handlers.js";
+export type { OAuthRecallRouterOptions, RecallRouterOptions, ServedToken, UserMapper } from "./handlers.js";
+export { TOKEN_RESPONSE_FORMATS } from "./httpx.js";
+export type { TokenResponseFormat } from "./httpx.js";
+export { createCaHttpClient, createHttpClient, withUserAgent } from "./http.js";
+export type { HttpClient } from "./http.js";
+export {
+  DEFAULT_GOOGLE_AUTH_BASE_URL,
+  DEFAULT_GOOGLE_SCOPES,
+  DEFAULT_GOOGLE_TOKEN_BASE_URL,
+  GoogleClient,
+} from "./google.js";
+export type { GoogleClientOptions } from "./google.js";
+export {
+  DEFAULT_MICROSOFT_LOGIN_BASE_URL,
+  DEFAULT_MICROSOFT_SCOPES,
+  DEFAULT_MICROSOFT_TENANT,
+  MicrosoftClient,
+} from "./microsoft.js";
+export type { MicrosoftClientOptions } from "./microsoft.js";
+export { DEFAULT_ISSUANCE_ANOMALY_THRESHOLD, HourlyCounter, ISSUANCE_WINDOW_MS, IssuancePolicy } from "./policy.js";
+export type { IssuanceAnomaly, IssuancePolicyHooks, IssuanceRequest, IssuanceRules, IssuanceUsage } from "./policy.js";
+export { DEFAULT_PROXY_TOKEN_TTL_MS, ProxyTokens } from "./proxy.js";
+export type { ProxyToken, ProxyTokensOptions } from "./proxy.js";
+export { DEFAULT_RECALL_API_BASE_URL, RecallClient } from "./recall.js";
+export { DEFAULT_REFRESH_POLICY, monotonicNow, nextRefreshDelay, retryRefreshDelay } from "./schedule.js";
+export { CLOCK_SKEW_RESOLUTION_MS, ClockSkew, DEFAULT_CLOCK_SKEW_WARNING_MS } from "./clock.js";
+export type { ClockSkewOptions } from "./clock.js";
+export type { RefreshPolicy } from "./schedule.js";
+export type { Bot, BotStatusChange, CreateBotRequest, RecallClientOptions } from "./recall.js";
+export {
+  DEFAULT_OBF_CACHE_TTL_MS,
+  DEFAULT_REAUTHORIZATION_WARNING_MS,
+  DEFAULT_REFRESH_TOKEN_LIFETIME_MS,
+  DEFAULT_STALE_TOKEN_GRACE_MS,
+  DEFAULT_TOKEN_REFRESH_INTERVAL_MS,
+  DEFAULT_TOKEN_REFRESH_MARGIN_MS,
+  DEFAULT_ZAK_CACHE_TTL_MS,
+  OAuthTokenManager,
+  TokenManager,
+} from "./tokens.js";
+export type {
+  HostMapper,
+  OAuthProvider,
+  ObfEntitlement,
+  OAuthTokenManagerOptions,
+  StaleTokenPolicy,
+  TokenCheck,
+  TokenManagerHooks,
+  TokenManagerOptions,
+  TokenStatus,
+  UserSyncResult,
+  UserTokens,
+  ZoomProfile,
+} from "./tokens.js";
+export { DEFAULT_ZOOM_API_BASE_URL, DEFAULT_ZOOM_OAUTH_BASE_URL, meetingIdFromUrl, parseMeetingId, parseMeetingLink, parseScopes, resolveOccurrence, ZoomClient } from "./zoom.js";
+export type { OAuthTokens, ZoomClientOptions, ZoomMeeting, ZoomOccurrence, ZoomUser } from "./zoom.js";
@@ -0,0 +1,109 @@
+import { spawn } from "child_process";
+import { randomBytes } from "crypto";
+import { DATA_KEY_BYTES, parseWrappedRef, wrappedRef, wrappingTag } from "./encryption.js";
+import type { DataKey, EncryptionProvider } from "./encryption.js";
+
+// how long age or gpg may take, e.g. when gpg-agent has to start
+const TOOL_TIMEOUT_MS = 30_000;
+
+// runs command with input on stdin and resolves with what it wrote to stdout
+function runTool(command: string, args: string[], input: Buffer): Promise<Buffer> {
+  return new Promise((resolve, reject) => {
+    const child = spawn(command, args, { stdio: ["pipe", "pipe", "pipe"], timeout: TOOL_TIMEOUT_MS });
+    const stdout: Buffer[] = [];
+    const stderr: Buffer[] = [];
+    child.stdout.on("data", (chunk: Buffer) => stdout.push(chunk));
+    child.stderr.on("data", (chunk: Buffer) => stderr.push(chunk));
+    child.on("error", (error) => reject(new Error(`could not run ${command}: ${error.message}`)));
+    child.on("close", (code, signal) => {
+      if (code === 0) return resolve(Buffer.concat(stdout));
+      const detail = Buffer.concat(stderr).toString("utf8").trim().split("\n").pop();
+      reject(new Error(`${command} ${args[0]} exited with ${signal ?? code}${detail ? `: ${detail}` : ""}`));
+    });
+    child.stdin.end(input);
+  });
+}
+
+export interface AgeProviderOptions {
+  // an age1... public key new data keys are encrypted to
+  recipient: string;
+  // a file with the matching AGE-SECRET-KEY-1... identity
+  identityFile: string;
+  // defaults to age on the PATH
+  command?: string;
+}
+
+/**
+ * Wraps data keys with an age public key using the age tool. The identity
+ * file opens them, so it can live on a mounted secret volume while the
+ * recipient sits in plain configuration.
+ */
+export class AgeProvider implements EncryptionProvider {
+  readonly name = "age";
+  readonly description: string;
+  private readonly options: AgeProviderOptions;
+  private readonly tag: string;
+
+  constructor(options: AgeProviderOptions) {
+    this.options = options;
+    this.tag = wrappingTag(options.recipient);
+    this.description = `age recipient ${options.recipient}`;
+  }
+
+  async dataKey(): Promise<DataKey> {
+    const key = randomBytes(DATA_KEY_BYTES);
+    const wrapped = await runTool(this.options.command ?? "age", ["--encrypt", "--recipient", this.options.recipient], key);
+    return { key, ref: wrappedRef(this.tag, wrapped) };
+  }
+
+  async unwrap(ref: string): Promise<Buffer> {
+    return runTool(this.options.command ?? "age", ["--decrypt", "--identity", this.options.identityFile], parseWrappedRef(ref).wrapped);
+  }
+
+  isCurrent(ref: string): boolean {
+    return parseWrappedRef(ref).tag === this.tag;
+  }
+}
+
+export interface PgpProviderOptions {
+  // a key ID, fingerprint or email in the gpg keyring new data keys are encrypted to
+  recipient: string;
+  // defaults to gpg on the PATH; the keyring is GNUPGHOME's, as for gpg itself
+  command?: string;
+}
+
+/**
+ * Wraps data keys with an OpenPGP public key using gpg. Opening them takes
+ * the secret key in the same keyring, unlocked through gpg-agent, or on a
+ * smartcard.
+ */
+export class PgpProvider implements EncryptionProvider {
+  readonly name = "pgp";
+  readonly description: string;
+  private readonly options: PgpProviderOptions;
+  private readonly tag: string;
+
+  constructor(options: PgpProviderOptions) {
+    this.options = options;
+    this.tag = wrappingTag(options.recipient);
+    this.description = `OpenPGP recipient ${options.recipient}`;
+  }
+
+  async dataKey(): Promise<DataKey> {
+    const key = randomBytes(DATA_KEY_BYTES);
+    const wrapped = await runTool(
+      this.options.command ?? "gpg",
+      ["--encrypt", "--batch", "--yes", "--trust-model", "always", "--recipient", this.options.recipient],
+      key,
+    );
+    return { key, ref: wrappedRef(this.tag, wrapped) };
+  }
+
+  async unwrap(ref: string): Promise<Buffer> {
+    return runTool(this.options.command ?? "gpg", ["--decrypt", "--batch", "--quiet"], parseWrappedRef(ref).wrapped);
+  }
+
+  isCurrent(ref: string): boolean {
+    return parseWrappedRef(ref).tag === this.tag;
+  }
+}
@@ -0,0 +1,130 @@
+import { randomBytes } from "crypto";
+import type { AwsJsonClient } from "./aws.js";
+import { DATA_KEY_BYTES, parseWrappedRef, wrappedRef, wrappingTag } from "./encryption.js";
+import type { DataKey, EncryptionProvider } from "./encryption.js";
+import { gcpRequest } from "./gcp.js";
+import type { GcpCredentialProvider } from "./gcp.js";
+import type { HttpClient } from "./http.js";
+
+export const DEFAULT_GCP_KMS_ENDPOINT = "https://cloudkms.googleapis.com";
+
+// bound to every wrapped key, so a key wrapped for something else doesn't unwrap here
+const KMS_CONTEXT = "zoom-oauth token data key";
+
+/** The region in a KMS key or alias ARN, or null if arn isn't one. */
+export function kmsKeyArnRegion(arn: string): string | null {
+  return /^arn:aws[\w-]*:kms:([a-z0-9-]+):\d{12}:(key|alias)\/.+$/.exec(arn)?.[1] ?? null;
+}
+
+/** Whether name is a Cloud KMS crypto key's resource name. */
+export function isGcpKmsKeyName(name: string): boolean {
+  return /^projects\/[^/]+\/locations\/[^/]+\/keyRings\/[^/]+\/cryptoKeys\/[^/]+$/.test(name);
+}
+
+export interface AwsKmsProviderOptions {
+  // key ID, key ARN, alias name or alias ARN
+  keyId: string;
+  // a client for the "kms" service with target prefix "TrentService"
+  client: AwsJsonClient;
+}
+
+/**
+ * Envelope encryption with AWS KMS: a data key is generated under keyId at
+ * startup and kept in memory, and stored wrapped next to every value it
+ * seals. Wrapped keys are unwrapped with the key KMS finds in them, so
+ * values sealed under a key KMS has rotated or one that was replaced still
+ * open as long as the role may decrypt with it.
+ */
+export class AwsKmsProvider implements EncryptionProvider {
+  readonly name = "aws-kms";
+  readonly description: string;
+  private readonly keyId: string;
+  private readonly client: AwsJsonClient;
+  private readonly tag: string;
+
+  constructor(options: AwsKmsProviderOptions) {
+    this.keyId = options.keyId;
+    this.client = options.client;
+    this.tag = wrappingTag(options.keyId);
+    this.description = `AWS KMS key ${options.keyId}`;
+  }
+
+  async dataKey(): Promise<DataKey> {
+    const generated = await this.client.call<{ Plaintext: string; CiphertextBlob: string }>("GenerateDataKey", {
+      KeyId: this.keyId,
+      KeySpec: "AES_256",
+      EncryptionContext: { purpose: KMS_CONTEXT },
+    });
+    return { key: Buffer.from(generated.Plaintext, "base64"), ref: wrappedRef(this.tag, Buffer.from(generated.CiphertextBlob, "base64")) };
+  }
+
+  async unwrap(ref: string): Promise<Buffer> {
+    const { wrapped } = parseWrappedRef(ref);
+    const decrypted = await this.client.call<{ Plaintext: string }>("Decrypt", {
+      CiphertextBlob: wrapped.toString("base64"),
+      EncryptionContext: { purpose: KMS_CONTEXT },
+    });
+    return Buffer.from(decrypted.Plaintext, "base64");
+  }
+
+  isCurrent(ref: string): boolean {
+    return parseWrappedRef(ref).tag === this.tag;
+  }
+}
+
+export interface GcpKmsProviderOptions {
+  // e.g. projects/my-project/locations/global/keyRings/zoom-oauth/cryptoKeys/tokens
+  keyName: string;
+  credentials: GcpCredentialProvider;
+  httpClient: HttpClient;
+  endpoint?: string;
+}
+
+/**
+ * Envelope encryption with Google Cloud KMS: a data key is made up at
+ * startup, encrypted with keyName and kept in memory, and stored wrapped
+ * next to every value it seals. Cloud KMS picks the key version itself,
+ * so rotating keyName's versions needs nothing here; values sealed under
+ * another crypto key don't open.
+ */
+export class GcpKmsProvider implements EncryptionProvider {
+  readonly name = "gcp-kms";
+  readonly description: string;
+  private readonly options: GcpKmsProviderOptions;
+  private readonly endpoint: string;
+  private readonly tag: string;
+
+  constructor(options: GcpKmsProviderOptions) {
+    this.options = options;
+    this.endpoint = (options.endpoint ?? DEFAULT_GCP_KMS_ENDPOINT).replace(/\/+$/, "");
+    this.tag = wrappingTag(options.keyName);
+    this.description = `Cloud KMS key ${options.keyName}`;
+  }
+
+  async dataKey(): Promise<DataKey> {
+    const key = randomBytes(DATA_KEY_BYTES);
+    const { ciphertext } = await this.request<{ ciphertext: string }>("encrypt", { plaintext: key.toString("base64") });
+    return { key, ref: wrappedRef(this.tag, Buffer.from(ciphertext, "base64")) };
+  }
+
+  async unwrap(ref: string): Promise<Buffer> {
+    const { tag, wrapped } = parseWrappedRef(ref);
+    if (tag !== this.tag) {
+      throw new Error(`the data key was wrapped with another Cloud KMS key than ${this.options.keyName}`);
+    }
+    const { plaintext } = await this.request<{ plaintext: string }>("decrypt", { ciphertext: wrapped.toString("base64") });
+    return Buffer.from(plaintext, "base64");
+  }
+
+  isCurrent(ref: string): boolean {
+    return parseWrappedRef(ref).tag === this.tag;
+  }
+
+  private request<T>(action: "encrypt" | "decrypt", body: Record<string, string>): Promise<T> {
+    const { keyName, credentials, httpClient } = this.options;
+    return gcpRequest<T>(credentials, httpClient, "POST", `${this.endpoint}/v1/${keyName}:${action}`, {
+      ...body,
+      additionalAuthenticatedData: Buffer.from(KMS_CONTEXT).toString("base64"),
+    });
+  }
+}
@@ -0,0 +1,219 @@
+import { readFile } from "fs/promises";
+import { createCaHttpClient } from "./http.js";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+export const DEFAULT_KUBERNETES_SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount";
+
+const SECRET_FORMAT_VERSION = 1;
+// the key of the Secret's data the document is kept under
+const SECRET_DATA_KEY = "tokens.json";
+// a write that keeps meeting someone else's change gives up after this many attempts
+const MAX_WRITE_ATTEMPTS = 3;
+
+// the same layout as the JSON file store's file
+interface SecretContents {
+  version: number;
+  providers: Record<string, StoredTokensJSON[]>;
+}
+
+interface KubernetesSecret {
+  apiVersion: "v1";
+  kind: "Secret";
+  metadata: { name: string; namespace?: string; resourceVersion?: string; labels?: Record<string, string>; [key: string]: unknown };
+  type?: string;
+  data?: Record<string, string>;
+  [key: string]: unknown;
+}
+
+export class KubernetesError extends Error {
+  readonly status: number;
+  // the Status reason, e.g. "NotFound", "Conflict" or "Forbidden"
+  readonly reason: string;
+
+  constructor(status: number, reason: string, message: string) {
+    super(message);
+    this.name = "KubernetesError";
+    this.status = status;
+    this.reason = reason;
+  }
+}
+
+/** The API server a pod reaches through the service Kubernetes puts in its environment, or null outside a cluster. */
+export function kubernetesApiUrl(env: NodeJS.ProcessEnv): string | null {
+  const host = env.KUBERNETES_SERVICE_HOST;
+  if (!host) return null;
+  return `https://${host.includes(":") ? `[${host}]` : host}:${env.KUBERNETES_SERVICE_PORT || "443"}`;
+}
+
+/** Whether name can name a Secret: a DNS subdomain of up to 253 characters. */
+export function isKubernetesSecretName(name: string): boolean {
+  return name.length <= 253 && /^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$/.test(name);
+}
+
+export interface KubernetesSecretTokenStoreOptions {
+  // e.g. https://10.0.0.1:443, see kubernetesApiUrl
+  apiUrl: string;
+  // created on the first write if it doesn't exist
+  name: string;
+  // defaults to the pod's own, read from the service account directory
+  namespace?: string;
+  // holds the service account's token, namespace and the cluster's ca.crt
+  serviceAccountDir?: string;
+  // used when the service account directory has no ca.crt, e.g. through kubectl proxy
+  httpClient: HttpClient;
+}
+
+/**
+ * Keeps token managers' users in one Kubernetes Secret, as the same JSON
+ * document the file store writes, so a pod that is restarted or
+ * rescheduled picks its users back up without a volume. Authenticates with
+ * the pod's service account, reading its token for every request since the
+ * kubelet rotates it. Writes replace the Secret at the version last read,
+ * so a change someone else made in between, e.g. with kubectl, is read
+ * again and kept rather than overwritten. Meant for one instance, like the
+ * file store.
+ */
+export class KubernetesSecretTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly apiUrl: string;
+  private readonly name: string;
+  private readonly serviceAccountDir: string;
+  private readonly httpClient: HttpClient;
+  private namespace: string | undefined;
+  private client: Promise<HttpClient> | null = null;
+  private contents: SecretContents | null = null;
+  // the Secret as last read or written, so a write keeps its other keys, labels and annotations
+  private secret: KubernetesSecret | null = null;
+  // writes go out one at a time, each with every change before it
+  private writing: Promise<void> = Promise.resolve();
+
+  constructor(options: KubernetesSecretTokenStoreOptions) {
+    if (!isKubernetesSecretName(options.name)) {
+      throw new Error(`${options.name} is not a valid Secret name, use lowercase letters, digits, "-" and "."`);
+    }
+    this.apiUrl = options.apiUrl.replace(/\/+$/, "");
+    this.name = options.name;
+    this.namespace = options.namespace || undefined;
+    this.serviceAccountDir = options.serviceAccountDir ?? DEFAULT_KUBERNETES_SERVICE_ACCOUNT_DIR;
+    this.httpClient = options.httpClient;
+    this.path = `secret ${this.namespace ?? "(pod namespace)"}/${this.name}`;
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    this.contents = await this.read();
+    return (this.contents.providers[provider] ?? []).map(storedTokensFromJSON);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const contents = this.contents ?? (this.contents = await this.read());
+    const user = contents.providers[provider]?.find((candidate) => candidate.user_id === userId);
+    return user ? storedTokensFromJSON(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.change(provider, (users) => [...users.filter((candidate) => candidate.user_id !== user.userId), storedTokensJSON(user)]);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.change(provider, (users) => users.filter((candidate) => candidate.user_id !== userId));
+  }
+
+  private change(provider: string, update: (users: StoredTokensJSON[]) => StoredTokensJSON[]): Promise<void> {
+    const write = this.writing.then(async () => {
+      for (let attempt = 1; ; attempt++) {
+        const contents = this.contents ?? (this.contents = await this.read());
+        contents.providers[provider] = update(contents.providers[provider] ?? []);
+        try {
+          await this.write(contents);
+          return;
+        } catch (error) {
+          if (!(error instanceof KubernetesError && (error.reason === "Conflict" || error.reason === "AlreadyExists")) || attempt >= MAX_WRITE_ATTEMPTS) {
+            throw error;
+          }
+          // changed since it was read; read it again and apply this change on top
+          this.contents = null;
+        }
+      }
+    });
+    // a failed write doesn't hold up the next one, which writes its changes too
+    this.writing = write.catch(() => {});
+    return write;
+  }
+
+  private async write(contents: SecretContents): Promise<void> {
+    const data = Buffer.from(JSON.stringify(contents)).toString("base64");
+    const namespace = await this.resolveNamespace();
+    if (this.secret) {
+      this.secret = await this.request<KubernetesSecret>("PUT", `/api/v1/namespaces/${namespace}/secrets/${this.name}`, {
+        ...this.secret,
+        data: { ...this.secret.data, [SECRET_DATA_KEY]: data },
+      });
+      return;
+    }
+    this.secret = await this.request<KubernetesSecret>("POST", `/api/v1/namespaces/${namespace}/secrets`, {
+      apiVersion: "v1",
+      kind: "Secret",
+      metadata: { name: this.name, labels: { "app.kubernetes.io/managed-by": "zoom-oauth" } },
+      type: "Opaque",
+      data: { [SECRET_DATA_KEY]: data },
+    });
+  }
+
+  private async read(): Promise<SecretContents> {
+    const namespace = await this.resolveNamespace();
+    try {
+      this.secret = await this.request<KubernetesSecret>("GET", `/api/v1/namespaces/${namespace}/secrets/${this.name}`);
+    } catch (error) {
+      // the Secret is created by the first write
+      if (error instanceof KubernetesError && error.reason === "NotFound") {
+        this.secret = null;
+        return { version: SECRET_FORMAT_VERSION, providers: {} };
+      }
+      throw error;
+    }
+    const text = Buffer.from(this.secret.data?.[SECRET_DATA_KEY] ?? "", "base64").toString("utf8");
+    if (!text.trim()) {
+      return { version: SECRET_FORMAT_VERSION, providers: {} };
+    }
+    const contents = JSON.parse(text) as SecretContents;
+    if (contents.version !== SECRET_FORMAT_VERSION || typeof contents.providers !== "object" || contents.providers === null) {
+      throw new Error(`${SECRET_DATA_KEY} in ${this.path} does not hold version ${SECRET_FORMAT_VERSION} tokens`);
+    }
+    return contents;
+  }
+
+  private async resolveNamespace(): Promise<string> {
+    this.namespace ??= (await readFile(`${this.serviceAccountDir}/namespace`, "utf8")).trim();
+    return this.namespace;
+  }
+
+  private async request<T>(method: string, path: string, body?: unknown): Promise<T> {
+    this.client ??= readFile(`${this.serviceAccountDir}/ca.crt`).then(
+      (ca) => createCaHttpClient(ca),
+      () => this.httpClient,
+    );
+    const client = await this.client;
+    const token = (await readFile(`${this.serviceAccountDir}/token`, "utf8")).trim();
+    const response = await client(`${this.apiUrl}${path}`, {
+      method,
+      headers: { Authorization: `Bearer ${token}`, Accept: "application/json", ...(body === undefined ? {} : { "Content-Type": "application/json" }) },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await response.text();
+    if (!response.ok) {
+      let reason = "Unknown";
+      let message = text;
+      try {
+        const status = JSON.parse(text) as { reason?: string; message?: string };
+        reason = status.reason ?? reason;
+        message = status.message ?? text;
+      } catch {
+        // not JSON, e.g. from a proxy in between
+      }
+      throw new KubernetesError(response.status, reason, `kubernetes answered ${response.status} ${reason} to ${method} secret ${this.name}: ${message}`);
+    }
+    return JSON.parse(text) as T;
+  }
+}
@@ -0,0 +1,105 @@
+import { errorFromOAuthResponse } from "./errors.js";
+import type { HttpClient } from "./http.js";
+import { parseScopes } from "./zoom.js";
+import type { OAuthTokens } from "./zoom.js";
+
+export const DEFAULT_MICROSOFT_LOGIN_BASE_URL = "https://login.microsoftonline.com";
+export const DEFAULT_MICROSOFT_TENANT = "common";
+// offline_access is what makes the identity platform return a refresh token
+export const DEFAULT_MICROSOFT_SCOPES = ["offline_access", "openid", "profile", "User.Read"];
+
+interface MicrosoftTokenResponse {
+  access_token: string;
+  token_type: string;
+  // only left out when the scopes lack offline_access
+  refresh_token?: string;
+  expires_in: number;
+  scope: string;
+}
+
+export interface MicrosoftClientOptions {
+  clientId: string;
+  clientSecret: string;
+  redirectUri: string;
+  // a tenant ID or domain, or "common"/"organizations" for multi-tenant apps
+  tenant?: string;
+  scopes?: string[];
+  loginBaseUrl?: string;
+  httpClient?: HttpClient;
+}
+
+/** OAuth client for the Microsoft identity platform (v2.0 endpoints), used for Teams bots. */
+export class MicrosoftClient {
+  private readonly clientId: string;
+  private readonly clientSecret: string;
+  private readonly redirectUri: string;
+  private readonly scope: string;
+  private readonly oauthBaseUrl: string;
+  private readonly httpClient: HttpClient;
+
+  constructor(options: MicrosoftClientOptions) {
+    this.clientId = options.clientId;
+    this.clientSecret = options.clientSecret;
+    this.redirectUri = options.redirectUri;
+    this.scope = (options.scopes ?? DEFAULT_MICROSOFT_SCOPES).join(" ");
+    const tenant = encodeURIComponent(options.tenant ?? DEFAULT_MICROSOFT_TENANT);
+    this.oauthBaseUrl = `${options.loginBaseUrl ?? DEFAULT_MICROSOFT_LOGIN_BASE_URL}/${tenant}/oauth2/v2.0`;
+    this.httpClient = options.httpClient ?? fetch;
+  }
+
+  authorizeUrl(state?: string): string {
+    const query = new URLSearchParams({
+      client_id: this.clientId,
+      response_type: "code",
+      redirect_uri: this.redirectUri,
+      response_mode: "query",
+      scope: this.scope,
+    });
+    if (state !== undefined) {
+      query.set("state", state);
+    }
+    return `${this.oauthBaseUrl}/authorize?${query}`;
+  }
+
+  async exchangeCode(authCode: string): Promise<OAuthTokens> {
+    return this.requestToken(
+      new URLSearchParams({
+        grant_type: "authorization_code",
+        code: authCode,
+        redirect_uri: this.redirectUri,
+      }),
+    );
+  }
+
+  async refreshToken(refreshToken: string): Promise<OAuthTokens> {
+    return this.requestToken(
+      new URLSearchParams({
+        grant_type: "refresh_token",
+        refresh_token: refreshToken,
+      }),
+    );
+  }
+
+  private async requestToken(params: URLSearchParams): Promise<OAuthTokens> {
+    params.set("client_id", this.clientId);
+    params.set("client_secret", this.clientSecret);
+    params.set("scope", this.scope);
+    const response = await this.httpClient(`${this.oauthBaseUrl}/token`, {
+      method: "POST",
+      headers: { "Content-Type": "application/x-www-form-urlencoded" },
+      body: params.toString(),
+    });
+    if (!response.ok) {
+      throw await errorFromOAuthResponse(response, "microsoft");
+    }
+
+    const data = (await response.json()) as MicrosoftTokenResponse;
+    return {
+      accessToken: data.access_token,
+      refreshToken: data.refresh_token ?? params.get("refresh_token") ?? "",
+      expiresIn: data.expires_in,
+      scopes: parseScopes(data.scope),
+      tokenType: data.token_type,
+    };
+  }
+}
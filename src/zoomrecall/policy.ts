@@ -0,0 +1,192 @@
+import { IssuanceDeniedError, IssuanceQuotaExceededError } from "./errors.js";
+
+export const ISSUANCE_WINDOW_MS = 60 * 60 * 1000;
+export const DEFAULT_ISSUANCE_ANOMALY_THRESHOLD = 50;
+const MAX_TRACKED_KEYS = 10000;
+
+export interface IssuanceRules {
+  // when non-empty, only these meeting IDs (digits only) may get tokens
+  allowedMeetings?: string[];
+  deniedMeetings?: string[];
+  // when non-empty, tokens are only issued as these users
+  allowedUsers?: string[];
+  deniedUsers?: string[];
+  // most tokens of any kind per meeting, and per user, in an hour; 0 means unlimited
+  meetingQuotaPerHour?: number;
+  userQuotaPerHour?: number;
+  // requests of one kind for one meeting in an hour that trigger onAnomaly; 0 disables it
+  anomalyThreshold?: number;
+}
+
+export interface IssuanceRequest {
+  // "proxy" is a proxy token, which only unlocks OBF and ZAK tokens that are checked again when exchanged
+  kind: "obf" | "zak" | "access" | "proxy";
+  userId: string;
+  meetingId?: string;
+  // who asked, for the audit trail, e.g. a remote address
+  source?: string;
+}
+
+export interface IssuanceAnomaly {
+  request: IssuanceRequest;
+  count: number;
+  windowStartedAt: Date;
+}
+
+export interface IssuanceUsage {
+  // "meeting" counts are keyed by meeting ID, "user" counts by user ID
+  scope: "meeting" | "user";
+  id: string;
+  count: number;
+  windowStartedAt: Date;
+}
+
+export interface IssuancePolicyHooks {
+  onDenied?(request: IssuanceRequest, reason: string): void;
+  onAnomaly?(anomaly: IssuanceAnomaly): void;
+}
+
+interface Window {
+  count: number;
+  startedAt: number;
+}
+
+// counts per key in fixed one-hour windows that start with the first request for the key
+export class HourlyCounter {
+  private readonly windows = new Map<string, Window>();
+
+  peek(key: string, now: number): Window | undefined {
+    const window = this.windows.get(key);
+    return window && now - window.startedAt < ISSUANCE_WINDOW_MS ? window : undefined;
+  }
+
+  increment(key: string, now: number): Window {
+    let window = this.peek(key, now);
+    if (!window) {
+      this.windows.delete(key);
+      window = { count: 0, startedAt: now };
+      this.windows.set(key, window);
+      this.prune(now);
+    }
+    window.count++;
+    return window;
+  }
+
+  entries(now: number): [string, Window][] {
+    return [...this.windows].filter(([, window]) => now - window.startedAt < ISSUANCE_WINDOW_MS);
+  }
+
+  private prune(now: number): void {
+    if (this.windows.size <= MAX_TRACKED_KEYS) return;
+    for (const [key, window] of this.windows) {
+      if (now - window.startedAt >= ISSUANCE_WINDOW_MS) this.windows.delete(key);
+    }
+    // windows are kept in the order they started, so the first one is the oldest
+    while (this.windows.size > MAX_TRACKED_KEYS) {
+      this.windows.delete(this.windows.keys().next().value as string);
+    }
+  }
+}
+
+/**
+ * Decides which meetings and users tokens may be issued for and how many per
+ * hour. Deny rules win over allow rules; with no rules
+ * everything is allowed. Counts are kept in memory.
+ */
+export class IssuancePolicy {
+  private readonly allowedMeetings: Set<string>;
+  private readonly deniedMeetings: Set<string>;
+  private readonly allowedUsers: Set<string>;
+  private readonly deniedUsers: Set<string>;
+  private readonly meetingQuotaPerHour: number;
+  private readonly userQuotaPerHour: number;
+  private readonly anomalyThreshold: number;
+  private readonly hooks: IssuancePolicyHooks;
+  private readonly perMeeting = new HourlyCounter();
+  private readonly perUser = new HourlyCounter();
+  private readonly perKind = new HourlyCounter();
+
+  constructor(rules: IssuanceRules = {}, hooks: IssuancePolicyHooks = {}) {
+    this.allowedMeetings = new Set(rules.allowedMeetings);
+    this.deniedMeetings = new Set(rules.deniedMeetings);
+    this.allowedUsers = new Set(rules.allowedUsers);
+    this.deniedUsers = new Set(rules.deniedUsers);
+    this.meetingQuotaPerHour = rules.meetingQuotaPerHour ?? 0;
+    this.userQuotaPerHour = rules.userQuotaPerHour ?? 0;
+    this.anomalyThreshold = rules.anomalyThreshold ?? DEFAULT_ISSUANCE_ANOMALY_THRESHOLD;
+    this.hooks = hooks;
+  }
+
+  /** Returns why request is denied by the allow and deny rules, or null if it is allowed. */
+  check(request: IssuanceRequest): string | null {
+    const { kind, userId, meetingId } = request;
+    if (this.deniedUsers.has(userId)) return `user ${userId} is denied`;
+    if (this.allowedUsers.size > 0 && !this.allowedUsers.has(userId)) return `user ${userId} is not allowed`;
+    if (kind === "proxy") return null;
+    // an access token can mint OBF and ZAK tokens for any meeting, whatever meeting it was asked for
+    if (kind === "access" && this.allowedMeetings.size > 0) return "access tokens are not issued while a meeting allowlist is configured";
+    if (meetingId !== undefined && this.deniedMeetings.has(meetingId)) return `meeting ${meetingId} is denied`;
+    if (this.allowedMeetings.size > 0) {
+      // an unscoped OBF token, or a ZAK token, would work for any meeting
+      if (meetingId === undefined) return "a meeting_id is required while a meeting allowlist is configured";
+      if (!this.allowedMeetings.has(meetingId)) return `meeting ${meetingId} is not allowed`;
+    }
+    return null;
+  }
+
+  /** Throws IssuanceDeniedError like enforce would, without counting request or reporting it; for dry runs. */
+  verify(request: IssuanceRequest): void {
+    const reason = this.check(request);
+    if (reason !== null) {
+      throw new IssuanceDeniedError(request.kind, reason);
+    }
+  }
+
+  /**
+   * Throws IssuanceDeniedError, or IssuanceQuotaExceededError once a quota
+   * is used up, after calling onDenied. Allowed requests count towards the
+   * quotas and the anomaly threshold.
+   */
+  enforce(request: IssuanceRequest): void {
+    const now = Date.now();
+    const reason = this.check(request);
+    if (reason !== null) {
+      this.hooks.onDenied?.(request, reason);
+      throw new IssuanceDeniedError(request.kind, reason);
+    }
+
+    const { kind, userId, meetingId } = request;
+    const full = (counter: HourlyCounter, key: string, quota: number) => {
+      const window = counter.peek(key, now);
+      return quota > 0 && window !== undefined && window.count >= quota ? window : undefined;
+    };
+    const meetingWindow = meetingId === undefined ? undefined : full(this.perMeeting, meetingId, this.meetingQuotaPerHour);
+    const userWindow = full(this.perUser, userId, this.userQuotaPerHour);
+    const exceeded = meetingWindow
+      ? { window: meetingWindow, reason: `meeting ${meetingId} was issued ${meetingWindow.count} tokens in the last hour` }
+      : userWindow
+        ? { window: userWindow, reason: `user ${userId} was issued ${userWindow.count} tokens in the last hour` }
+        : undefined;
+    if (exceeded) {
+      this.hooks.onDenied?.(request, exceeded.reason);
+      const retryAfterSeconds = Math.ceil((exceeded.window.startedAt + ISSUANCE_WINDOW_MS - now) / 1000);
+      throw new IssuanceQuotaExceededError(exceeded.reason, retryAfterSeconds);
+    }
+
+    if (meetingId !== undefined) this.perMeeting.increment(meetingId, now);
+    this.perUser.increment(userId, now);
+    // requests without a meeting, e.g. most ZAK requests, are watched per user instead
+    const anomaly = this.perKind.increment(`${kind}:${meetingId ?? `user:${userId}`}`, now);
+    if (this.anomalyThreshold > 0 && anomaly.count === this.anomalyThreshold) {
+      this.hooks.onAnomaly?.({ request, count: anomaly.count, windowStartedAt: new Date(anomaly.startedAt) });
+    }
+  }
+
+  /** Returns the requests counted in the current window of every meeting and user, busiest first. */
+  usage(): IssuanceUsage[] {
+    const now = Date.now();
+    const usage = (scope: IssuanceUsage["scope"], counter: HourlyCounter) =>
+      counter.entries(now).map(([id, window]) => ({ scope, id, count: window.count, windowStartedAt: new Date(window.startedAt) }));
+    return [...usage("meeting", this.perMeeting), ...usage("user", this.perUser)].sort((a, b) => b.count - a.count);
+  }
+}
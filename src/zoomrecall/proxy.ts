@@ -0,0 +1,55 @@
+import { createHash, randomBytes } from "crypto";
+import { HttpError } from "./errors.js";
+import { TtlCache } from "./ttlcache.js";
+
+export const DEFAULT_PROXY_TOKEN_TTL_MS = 5 * 60 * 1000;
+const PROXY_TOKEN_PREFIX = "zrp_";
+const MAX_PROXY_TOKENS = 10000;
+
+export interface ProxyToken {
+  token: string;
+  expiresAt: Date;
+}
+
+export interface ProxyTokensOptions {
+  ttlMs?: number;
+}
+
+function hash(token: string): string {
+  return createHash("sha256").update(token).digest("hex");
+}
+
+/**
+ * Hands out opaque, short-lived tokens that stand in for a user's Zoom
+ * access token, so the access token itself stays on this server. Only
+ * hashes of the issued tokens are kept, in memory.
+ */
+export class ProxyTokens {
+  readonly ttlMs: number;
+  private readonly grants: TtlCache<string>;
+
+  constructor(options: ProxyTokensOptions = {}) {
+    this.ttlMs = options.ttlMs ?? DEFAULT_PROXY_TOKEN_TTL_MS;
+    this.grants = new TtlCache({ ttlMs: this.ttlMs, maxEntries: MAX_PROXY_TOKENS });
+  }
+
+  issue(userId: string): ProxyToken {
+    const token = `${PROXY_TOKEN_PREFIX}${randomBytes(24).toString("base64url")}`;
+    this.grants.set(hash(token), userId);
+    return { token, expiresAt: new Date(Date.now() + this.ttlMs) };
+  }
+
+  /** Forgets expired proxy tokens; returns how many. */
+  purgeExpired(): number {
+    return this.grants.purgeExpired();
+  }
+
+  /** Returns the user a proxy token was issued for, throwing a 401 HttpError if it's unknown or expired. Tokens can be redeemed until they expire. */
+  redeem(token: string): string {
+    const userId = token.startsWith(PROXY_TOKEN_PREFIX) ? this.grants.get(hash(token)) : undefined;
+    if (userId === undefined) {
+      throw new HttpError(401, "proxy token is invalid or expired");
+    }
+    return userId;
+  }
+}
@@ -0,0 +1,79 @@
+import { RecallApiError } from "./errors.js";
+import type { HttpClient } from "./http.js";
+
+export const DEFAULT_RECALL_API_BASE_URL = "https://us-east-1.recall.ai/api/v1";
+
+export interface CreateBotRequest {
+  meeting_url: string;
+  bot_name: string;
+  zoom?: {
+    obf_token_url?: string;
+    zak_url?: string;
+  };
+  automatic_leave?: {
+    waiting_room_timeout?: number;
+  };
+  // where Recall sends the bot's real-time events while it is in the meeting
+  recording_config?: {
+    realtime_endpoints?: { type: "webhook"; url: string; events: string[] }[];
+  };
+}
+
+export interface BotStatusChange {
+  code: string;
+  sub_code?: string | null;
+  message?: string | null;
+  created_at: string;
+}
+
+export interface Bot {
+  id: string;
+  status_changes?: BotStatusChange[];
+}
+
+export interface RecallClientOptions {
+  apiKey: string;
+  apiBaseUrl?: string;
+  httpClient?: HttpClient;
+}
+
+export class RecallClient {
+  private readonly apiKey: string;
+  private readonly apiBaseUrl: string;
+  private readonly httpClient: HttpClient;
+
+  constructor(options: RecallClientOptions) {
+    this.apiKey = options.apiKey;
+    this.apiBaseUrl = options.apiBaseUrl ?? DEFAULT_RECALL_API_BASE_URL;
+    this.httpClient = options.httpClient ?? fetch;
+  }
+
+  async getBot(botId: string): Promise<Bot> {
+    const response = await this.httpClient(`${this.apiBaseUrl}/bot/${encodeURIComponent(botId)}`, {
+      headers: { Authorization: `Token ${this.apiKey}` },
+    });
+
+    const data = await response.json();
+    if (!response.ok) {
+      throw new RecallApiError(response.status, data);
+    }
+    return data as Bot;
+  }
+
+  async createBot(request: CreateBotRequest): Promise<Bot> {
+    const response = await this.httpClient(`${this.apiBaseUrl}/bot`, {
+      method: "POST",
+      headers: {
+        Authorization: `Token ${this.apiKey}`,
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(request),
+    });
+
+    const data = await response.json();
+    if (!response.ok) {
+      throw new RecallApiError(response.status, data);
+    }
+    return data as Bot;
+  }
+}
@@ -0,0 +1,229 @@
+import { connect as connectTcp } from "net";
+import type { Socket } from "net";
+import { connect as connectTls } from "tls";
+
+export type RedisReply = string | number | null | RedisReply[];
+
+export class RedisError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = "RedisError";
+  }
+}
+
+export interface RedisOptions {
+  // redis://[[user]:password@]host[:port][/db], or rediss:// for TLS
+  url: string;
+  connectTimeoutMs?: number;
+}
+
+const DEFAULT_CONNECT_TIMEOUT_MS = 5000;
+
+function encode(args: (string | number)[]): Buffer {
+  const parts = [`*${args.length}\r\n`];
+  for (const arg of args) {
+    const value = String(arg);
+    parts.push(`$${Buffer.byteLength(value)}\r\n${value}\r\n`);
+  }
+  return Buffer.from(parts.join(""));
+}
+
+// parses one RESP2 reply from buffer at offset; undefined when it isn't complete yet
+function parse(buffer: Buffer, offset: number): { reply: RedisReply | RedisError; next: number } | undefined {
+  const lineEnd = buffer.indexOf("\r\n", offset);
+  if (lineEnd === -1) return undefined;
+  const type = String.fromCharCode(buffer[offset]);
+  const line = buffer.toString("utf8", offset + 1, lineEnd);
+  const next = lineEnd + 2;
+  switch (type) {
+    case "+":
+      return { reply: line, next };
+    case "-":
+      return { reply: new RedisError(line), next };
+    case ":":
+      return { reply: Number(line), next };
+    case "$": {
+      const length = Number(line);
+      if (length === -1) return { reply: null, next };
+      if (buffer.length < next + length + 2) return undefined;
+      return { reply: buffer.toString("utf8", next, next + length), next: next + length + 2 };
+    }
+    case "*": {
+      const count = Number(line);
+      if (count === -1) return { reply: null, next };
+      const items: RedisReply[] = [];
+      let position = next;
+      for (let i = 0; i < count; i++) {
+        const item = parse(buffer, position);
+        if (!item) return undefined;
+        if (item.reply instanceof RedisError) throw item.reply;
+        items.push(item.reply);
+        position = item.next;
+      }
+      return { reply: items, next: position };
+    }
+    default:
+      throw new RedisError(`unexpected reply type ${JSON.stringify(type)} from redis`);
+  }
+}
+
+interface Pending {
+  resolve(reply: RedisReply): void;
+  reject(error: Error): void;
+}
+
+/**
+ * A minimal Redis client speaking RESP2 over one connection, enough for the
+ * token store. Commands are pipelined in order; the connection is opened on
+ * the first command and again on the next command after it drops. A client
+ * that has subscribed only delivers messages, see subscribe.
+ */
+export class RedisClient {
+  private readonly url: URL;
+  private readonly connectTimeoutMs: number;
+  private socket: Socket | null = null;
+  private connecting: Promise<Socket> | null = null;
+  private buffer = Buffer.alloc(0);
+  private readonly pending: Pending[] = [];
+  private onMessage: ((channel: string, message: string) => void) | null = null;
+  private closed = false;
+
+  constructor(options: RedisOptions) {
+    this.url = new URL(options.url);
+    if (this.url.protocol !== "redis:" && this.url.protocol !== "rediss:") {
+      throw new RedisError(`unsupported redis URL scheme ${this.url.protocol}, use redis:// or rediss://`);
+    }
+    this.connectTimeoutMs = options.connectTimeoutMs ?? DEFAULT_CONNECT_TIMEOUT_MS;
+  }
+
+  /** Where the client connects, without credentials. */
+  get address(): string {
+    return `${this.url.protocol}//${this.url.host}${this.url.pathname === "/" ? "" : this.url.pathname}`;
+  }
+
+  async command(...args: (string | number)[]): Promise<RedisReply> {
+    const socket = await this.connection();
+    return this.send(socket, args);
+  }
+
+  /**
+   * Subscribes to channel, calling onMessage for every message on it. The
+   * client can't run other commands afterwards; if the connection drops it
+   * is re-established and onReconnect is called, since messages sent in
+   * between are lost.
+   */
+  async subscribe(channel: string, onMessage: (message: string) => void, onReconnect: () => void): Promise<void> {
+    this.onMessage = (received, message) => {
+      if (received === channel) onMessage(message);
+    };
+    const socket = await this.connection();
+    await this.send(socket, ["SUBSCRIBE", channel]);
+    socket.once("close", () => this.resubscribe(channel, onMessage, onReconnect));
+  }
+
+  close(): void {
+    this.closed = true;
+    this.socket?.destroy();
+    this.socket = null;
+  }
+
+  private resubscribe(channel: string, onMessage: (message: string) => void, onReconnect: () => void): void {
+    if (this.closed) return;
+    setTimeout(() => {
+      this.subscribe(channel, onMessage, onReconnect).then(onReconnect, (error) => {
+        console.error(`could not resubscribe to ${channel} on ${this.address}`, error);
+        this.resubscribe(channel, onMessage, onReconnect);
+      });
+    }, 1000).unref();
+  }
+
+  private send(socket: Socket, args: (string | number)[]): Promise<RedisReply> {
+    return new Promise((resolve, reject) => {
+      this.pending.push({ resolve, reject });
+      socket.write(encode(args));
+    });
+  }
+
+  private connection(): Promise<Socket> {
+    if (this.closed) return Promise.reject(new RedisError("redis client is closed"));
+    if (this.socket) return Promise.resolve(this.socket);
+    this.connecting ??= this.open().finally(() => {
+      this.connecting = null;
+    });
+    return this.connecting;
+  }
+
+  private async open(): Promise<Socket> {
+    const port = Number(this.url.port || 6379);
+    const host = this.url.hostname.replace(/^\[|\]$/g, "");
+    const socket = await new Promise<Socket>((resolve, reject) => {
+      const tls = this.url.protocol === "rediss:";
+      const opened = tls ? connectTls({ host, port, servername: host }) : connectTcp({ host, port });
+      const timer = setTimeout(() => opened.destroy(new RedisError(`timed out connecting to ${this.address}`)), this.connectTimeoutMs);
+      opened.once(tls ? "secureConnect" : "connect", () => {
+        clearTimeout(timer);
+        resolve(opened);
+      });
+      opened.once("error", (error) => {
+        clearTimeout(timer);
+        reject(error);
+      });
+    });
+    socket.setNoDelay(true);
+    socket.on("data", (chunk) => this.receive(chunk));
+    socket.on("error", () => {
+      // followed by close, which fails whatever was pending
+    });
+    socket.on("close", () => {
+      if (this.socket === socket) this.socket = null;
+      this.buffer = Buffer.alloc(0);
+      for (const waiting of this.pending.splice(0)) {
+        waiting.reject(new RedisError(`connection to ${this.address} was lost`));
+      }
+    });
+
+    const password = decodeURIComponent(this.url.password);
+    const user = decodeURIComponent(this.url.username);
+    const db = this.url.pathname.slice(1);
+    try {
+      if (password) {
+        await this.send(socket, user ? ["AUTH", user, password] : ["AUTH", password]);
+      }
+      if (db) {
+        await this.send(socket, ["SELECT", db]);
+      }
+    } catch (error) {
+      socket.destroy();
+      throw error;
+    }
+    this.socket = socket;
+    return socket;
+  }
+
+  private receive(chunk: Buffer): void {
+    this.buffer = this.buffer.length === 0 ? chunk : Buffer.concat([this.buffer, chunk]);
+    let offset = 0;
+    for (;;) {
+      let parsed: ReturnType<typeof parse>;
+      try {
+        parsed = parse(this.buffer, offset);
+      } catch (error) {
+        // nothing after a reply that can't be parsed can be trusted
+        console.error(`unreadable reply from ${this.address}`, error);
+        this.socket?.destroy();
+        return;
+      }
+      if (!parsed) break;
+      offset = parsed.next;
+      const { reply } = parsed;
+      if (this.onMessage && Array.isArray(reply) && reply[0] === "message") {
+        this.onMessage(String(reply[1]), String(reply[2]));
+        continue;
+      }
+      const waiting = this.pending.shift();
+      if (reply instanceof RedisError) waiting?.reject(reply);
+      else waiting?.resolve(reply);
+    }
+    this.buffer = this.buffer.subarray(offset);
+  }
+}
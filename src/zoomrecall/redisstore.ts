@@ -0,0 +1,123 @@
+import { randomUUID } from "crypto";
+import { RedisClient } from "./redis.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+export const DEFAULT_REDIS_KEY_PREFIX = "zoom-oauth:";
+
+// deletes the lock only if this instance still holds it
+const RELEASE_LOCK_SCRIPT = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`;
+
+interface ChangeMessage {
+  origin: string;
+  provider: string;
+  user_id: string;
+}
+
+export interface RedisTokenStoreOptions {
+  url: string;
+  // prepended to every key and the change channel, to share a Redis between deployments
+  keyPrefix?: string;
+}
+
+/**
+ * Keeps token managers' users in Redis so several instances share them: one
+ * hash per provider, a user's tokens as JSON in a field named by the user
+ * ID. Every change is announced on a channel, so instances pick up users
+ * connected or refreshed elsewhere, and refreshes take a per-user lock, so
+ * two instances never spend the same refresh token.
+ */
+export class RedisTokenStore implements TokenStore {
+  // where the store is, for messages; never includes the password
+  readonly path: string;
+  private readonly url: string;
+  private readonly client: RedisClient;
+  private subscriber: RedisClient | null = null;
+  private readonly keyPrefix: string;
+  // tells this instance's announcements apart from everyone else's
+  private readonly origin = randomUUID();
+  private readonly watchers = new Map<string, (userId: string | null) => void>();
+
+  constructor(options: RedisTokenStoreOptions) {
+    this.url = options.url;
+    this.client = new RedisClient({ url: options.url });
+    this.path = this.client.address;
+    this.keyPrefix = options.keyPrefix ?? DEFAULT_REDIS_KEY_PREFIX;
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    const reply = await this.client.command("HGETALL", this.key(provider));
+    const fields = Array.isArray(reply) ? reply : [];
+    const users: StoredTokens[] = [];
+    for (let i = 1; i < fields.length; i += 2) {
+      users.push(storedTokensFromJSON(JSON.parse(String(fields[i])) as StoredTokensJSON));
+    }
+    return users;
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const reply = await this.client.command("HGET", this.key(provider), userId);
+    return reply === null ? null : storedTokensFromJSON(JSON.parse(String(reply)) as StoredTokensJSON);
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.client.command("HSET", this.key(provider), user.userId, JSON.stringify(storedTokensJSON(user)));
+    await this.announce(provider, user.userId);
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.client.command("HDEL", this.key(provider), userId);
+    await this.announce(provider, userId);
+  }
+
+  async lock(provider: string, userId: string, ttlMs: number): Promise<(() => Promise<void>) | null> {
+    const key = `${this.keyPrefix}lock:${provider}:${userId}`;
+    const token = randomUUID();
+    const reply = await this.client.command("SET", key, token, "NX", "PX", ttlMs);
+    if (reply !== "OK") return null;
+    return async () => {
+      await this.client.command("EVAL", RELEASE_LOCK_SCRIPT, 1, key, token);
+    };
+  }
+
+  watch(provider: string, onChange: (userId: string | null) => void): void {
+    this.watchers.set(provider, onChange);
+    if (this.subscriber) return;
+    this.subscriber = new RedisClient({ url: this.url });
+    const reloadAll = () => {
+      for (const watcher of this.watchers.values()) watcher(null);
+    };
+    this.subscriber.subscribe(this.channel(), (message) => this.changed(message), reloadAll).catch((error) => {
+      console.error(`could not subscribe to token changes on ${this.path}, users changed by other instances are only seen after a restart`, error);
+    });
+  }
+
+  close(): void {
+    this.client.close();
+    this.subscriber?.close();
+  }
+
+  private changed(message: string): void {
+    let change: ChangeMessage;
+    try {
+      change = JSON.parse(message) as ChangeMessage;
+    } catch {
+      return;
+    }
+    if (change.origin === this.origin) return;
+    this.watchers.get(change.provider)?.(change.user_id);
+  }
+
+  private async announce(provider: string, userId: string): Promise<void> {
+    const change: ChangeMessage = { origin: this.origin, provider, user_id: userId };
+    await this.client.command("PUBLISH", this.channel(), JSON.stringify(change));
+  }
+
+  private key(provider: string): string {
+    return `${this.keyPrefix}tokens:${provider}`;
+  }
+
+  private channel(): string {
+    return `${this.keyPrefix}changes`;
+  }
+}
@@ -0,0 +1,42 @@
+export interface RefreshPolicy {
+  // refresh at least this long before the access token expires
+  marginMs: number;
+  // never wait longer than this between refreshes, even for long-lived tokens
+  maxDelayMs: number;
+  // floor on every delay so an already-expiring token doesn't spin
+  minDelayMs: number;
+  // wait this long before retrying after a failed refresh
+  retryDelayMs: number;
+}
+
+export const DEFAULT_REFRESH_POLICY: RefreshPolicy = {
+  marginMs: 10 * 60 * 1000,
+  maxDelayMs: 20 * 60 * 1000,
+  minDelayMs: 1000,
+  retryDelayMs: 30 * 1000,
+};
+
+/** A clock that never jumps with wall-clock adjustments (NTP, DST, manual changes). */
+export function monotonicNow(): number {
+  return performance.now();
+}
+
+/**
+ * Returns how long to wait before refreshing a token expiring at expiresAt,
+ * with now and expiresAt read from the same clock. The result is always
+ * within [minDelayMs, max(minDelayMs, maxDelayMs)], and whenever the margin
+ * is still more than minDelayMs away the refresh lands at or before
+ * expiresAt - marginMs.
+ */
+export function nextRefreshDelay(now: number, expiresAt: number, policy: RefreshPolicy): number {
+  const untilMargin = expiresAt - policy.marginMs - now;
+  if (Number.isNaN(untilMargin)) {
+    return policy.minDelayMs;
+  }
+  return Math.max(policy.minDelayMs, Math.min(untilMargin, policy.maxDelayMs));
+}
+
+/** Returns how long to wait before retrying after a refresh failed. */
+export function retryRefreshDelay(policy: RefreshPolicy): number {
+  return Math.max(policy.minDelayMs, Math.min(policy.retryDelayMs, policy.maxDelayMs));
+}
@@ -0,0 +1,279 @@
+import { chmodSync } from "fs";
+import type { DatabaseSync } from "node:sqlite";
+import type { StoredTokens, TokenStore } from "./store.js";
+
+export interface SqliteMigration {
+  version: number;
+  description: string;
+  up: string;
+  down: string;
+}
+
+/** The token store's schema, in version order; applied by `migrate up`. */
+export const SQLITE_MIGRATIONS: SqliteMigration[] = [
+  {
+    version: 1,
+    description: "create tokens and token_history",
+    up: `
+      CREATE TABLE tokens (
+        provider TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        access_token TEXT NOT NULL,
+        refresh_token TEXT NOT NULL,
+        expires_at TEXT NOT NULL,
+        last_refreshed_at TEXT,
+        needs_reauthorization INTEGER NOT NULL,
+        granted_scopes TEXT,
+        scopes TEXT,
+        deactivated_reason TEXT,
+        updated_at TEXT NOT NULL,
+        PRIMARY KEY (provider, user_id)
+      );
+      CREATE TABLE token_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        at TEXT NOT NULL,
+        provider TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        event TEXT NOT NULL,
+        expires_at TEXT,
+        needs_reauthorization INTEGER,
+        deactivated_reason TEXT
+      );
+      CREATE INDEX token_history_user ON token_history (provider, user_id, id);
+    `,
+    down: "DROP TABLE token_history; DROP TABLE tokens;",
+  },
+  {
+    version: 2,
+    description: "add tokens.metadata and audit_entries",
+    up: `
+      ALTER TABLE tokens ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+      CREATE TABLE audit_entries (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        at TEXT NOT NULL,
+        entry TEXT NOT NULL
+      );
+      CREATE INDEX audit_entries_at ON audit_entries (at);
+    `,
+    down: "DROP TABLE audit_entries; ALTER TABLE tokens DROP COLUMN metadata;",
+  },
+];
+
+export const SQLITE_SCHEMA_VERSION = SQLITE_MIGRATIONS.at(-1)!.version;
+
+interface TokenRow {
+  user_id: string;
+  access_token: string;
+  refresh_token: string;
+  expires_at: string;
+  last_refreshed_at: string | null;
+  needs_reauthorization: number;
+  granted_scopes: string | null;
+  scopes: string | null;
+  deactivated_reason: string | null;
+  metadata: string;
+}
+
+// what token_history records about each change; never the tokens themselves
+type HistoryEvent = "connected" | "refreshed" | "updated" | "removed";
+
+/**
+ * Opens a SQLite database with the built-in node:sqlite module. It is loaded
+ * here rather than imported so that deployments not using SQLite neither
+ * need a Node.js that has it nor see its experimental warning.
+ */
+export function openSqlite(path: string): DatabaseSync {
+  const sqlite = process.getBuiltinModule("node:sqlite") as typeof import("node:sqlite") | undefined;
+  if (!sqlite) {
+    throw new Error("this Node.js has no node:sqlite module, use Node.js 22.13 or later");
+  }
+  const db = new sqlite.DatabaseSync(path);
+  db.exec("PRAGMA busy_timeout = 5000");
+  chmodSync(path, 0o600);
+  return db;
+}
+
+/** The schema version of db, 0 if it has none yet. */
+export function sqliteSchemaVersion(db: DatabaseSync): number {
+  const table = db.prepare("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").get();
+  if (!table) return 0;
+  const row = db.prepare("SELECT version FROM schema_version").get() as { version: number } | undefined;
+  return row?.version ?? 0;
+}
+
+export function setSqliteSchemaVersion(db: DatabaseSync, version: number): void {
+  db.exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)");
+  db.exec("DELETE FROM schema_version");
+  db.prepare("INSERT INTO schema_version (version) VALUES (?)").run(version);
+}
+
+function storedTokensFromRow(row: TokenRow): StoredTokens {
+  return {
+    userId: row.user_id,
+    accessToken: row.access_token,
+    refreshToken: row.refresh_token,
+    expiresAt: new Date(row.expires_at),
+    lastRefreshedAt: row.last_refreshed_at === null ? null : new Date(row.last_refreshed_at),
+    needsReauthorization: Boolean(row.needs_reauthorization),
+    grantedScopes: row.granted_scopes === null ? null : (JSON.parse(row.granted_scopes) as string[]),
+    scopes: row.scopes === null ? null : (JSON.parse(row.scopes) as string[]),
+    deactivatedReason: row.deactivated_reason,
+    metadata: JSON.parse(row.metadata) as Record<string, string>,
+  };
+}
+
+function sameTokens(row: TokenRow, user: StoredTokens): boolean {
+  return row.access_token === user.accessToken && row.refresh_token === user.refreshToken;
+}
+
+function sameMetadata(row: TokenRow, user: StoredTokens): boolean {
+  return (
+    row.expires_at === user.expiresAt.toISOString() &&
+    row.last_refreshed_at === (user.lastRefreshedAt?.toISOString() ?? null) &&
+    Boolean(row.needs_reauthorization) === user.needsReauthorization &&
+    row.granted_scopes === (user.grantedScopes === null ? null : JSON.stringify(user.grantedScopes)) &&
+    row.scopes === (user.scopes === null ? null : JSON.stringify(user.scopes)) &&
+    row.deactivated_reason === user.deactivatedReason &&
+    row.metadata === JSON.stringify(user.metadata)
+  );
+}
+
+/**
+ * Keeps token managers' users in a SQLite database, one row per provider and
+ * user with their metadata. Every change runs in one transaction that also
+ * appends a row to token_history, which records what happened and when but
+ * never the tokens. The same file can hold the audit log, see
+ * appendAuditEntry, so one file is all a durable deployment needs. The
+ * schema has to be brought up to date with `migrate up` first, including
+ * for a new database.
+ */
+export class SqliteTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly db: DatabaseSync;
+
+  constructor(path: string) {
+    this.path = path;
+    this.db = openSqlite(path);
+    const version = sqliteSchemaVersion(this.db);
+    if (version !== SQLITE_SCHEMA_VERSION) {
+      this.db.close();
+      throw new Error(`${path} is at schema version ${version}, this version needs ${SQLITE_SCHEMA_VERSION}; run \`migrate up\``);
+    }
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    const rows = this.db.prepare("SELECT * FROM tokens WHERE provider = ? ORDER BY user_id").all(provider) as unknown as TokenRow[];
+    return rows.map(storedTokensFromRow);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const row = this.row(provider, userId);
+    return row ? storedTokensFromRow(row) : null;
+  }
+
+  /** Adds or replaces one user of provider, recording what changed in token_history. */
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    this.transaction(() => {
+      const row = this.row(provider, user.userId);
+      if (row && sameTokens(row, user) && sameMetadata(row, user)) return;
+      const now = new Date().toISOString();
+      this.db
+        .prepare(`
+          INSERT INTO tokens (provider, user_id, access_token, refresh_token, expires_at, last_refreshed_at,
+            needs_reauthorization, granted_scopes, scopes, deactivated_reason, metadata, updated_at)
+          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+          ON CONFLICT (provider, user_id) DO UPDATE SET
+            access_token = excluded.access_token, refresh_token = excluded.refresh_token,
+            expires_at = excluded.expires_at, last_refreshed_at = excluded.last_refreshed_at,
+            needs_reauthorization = excluded.needs_reauthorization, granted_scopes = excluded.granted_scopes,
+            scopes = excluded.scopes, deactivated_reason = excluded.deactivated_reason, metadata = excluded.metadata,
+            updated_at = excluded.updated_at
+        `)
+        .run(
+          provider,
+          user.userId,
+          user.accessToken,
+          user.refreshToken,
+          user.expiresAt.toISOString(),
+          user.lastRefreshedAt?.toISOString() ?? null,
+          user.needsReauthorization ? 1 : 0,
+          user.grantedScopes === null ? null : JSON.stringify(user.grantedScopes),
+          user.scopes === null ? null : JSON.stringify(user.scopes),
+          user.deactivatedReason,
+          JSON.stringify(user.metadata),
+          now,
+        );
+      const event: HistoryEvent = !row ? "connected" : sameTokens(row, user) ? "updated" : "refreshed";
+      this.history(now, provider, user.userId, event, user);
+    });
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    this.transaction(() => {
+      const { changes } = this.db.prepare("DELETE FROM tokens WHERE provider = ? AND user_id = ?").run(provider, userId);
+      if (changes > 0) {
+        this.history(new Date().toISOString(), provider, userId, "removed", null);
+      }
+    });
+  }
+
+  /** Removes token_history rows recorded before before, of every provider. */
+  async pruneHistory(before: Date): Promise<number> {
+    // at is an ISO 8601 string in UTC, so comparing it as text compares the times
+    const { changes } = this.db.prepare("DELETE FROM token_history WHERE at < ?").run(before.toISOString());
+    return Number(changes);
+  }
+
+  /** Appends an audit entry, as the JSON object it is, to audit_entries. */
+  appendAuditEntry(at: string, entry: object): void {
+    this.db.prepare("INSERT INTO audit_entries (at, entry) VALUES (?, ?)").run(at, JSON.stringify(entry));
+  }
+
+  /** Returns up to limit audit entries, oldest first, from the most recent ones. */
+  recentAuditEntries(limit: number): object[] {
+    const rows = this.db.prepare("SELECT entry FROM audit_entries ORDER BY id DESC LIMIT ?").all(limit) as unknown as { entry: string }[];
+    return rows.reverse().map((row) => JSON.parse(row.entry) as object);
+  }
+
+  /** Removes audit entries recorded before before; returns how many. */
+  pruneAuditEntries(before: Date): number {
+    const { changes } = this.db.prepare("DELETE FROM audit_entries WHERE at < ?").run(before.toISOString());
+    return Number(changes);
+  }
+
+  close(): void {
+    this.db.close();
+  }
+
+  private row(provider: string, userId: string): TokenRow | undefined {
+    return this.db.prepare("SELECT * FROM tokens WHERE provider = ? AND user_id = ?").get(provider, userId) as TokenRow | undefined;
+  }
+
+  private history(at: string, provider: string, userId: string, event: HistoryEvent, user: StoredTokens | null): void {
+    this.db
+      .prepare(`
+        INSERT INTO token_history (at, provider, user_id, event, expires_at, needs_reauthorization, deactivated_reason)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+      `)
+      .run(
+        at,
+        provider,
+        userId,
+        event,
+        user?.expiresAt.toISOString() ?? null,
+        user === null ? null : user.needsReauthorization ? 1 : 0,
+        user?.deactivatedReason ?? null,
+      );
+  }
+
+  private transaction(body: () => void): void {
+    this.db.exec("BEGIN IMMEDIATE");
+    try {
+      body();
+      this.db.exec("COMMIT");
+    } catch (error) {
+      this.db.exec("ROLLBACK");
+      throw error;
+    }
+  }
+}
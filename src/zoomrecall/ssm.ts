@@ -0,0 +1,53 @@
+import { AwsJsonClient } from "./aws.js";
+import type { AwsCredentialProvider } from "./aws.js";
+import type { HttpClient } from "./http.js";
+
+// GetParameters takes at most this many names per call
+const MAX_PARAMETERS_PER_CALL = 10;
+
+export interface SsmParameterClientOptions {
+  region: string;
+  credentials: AwsCredentialProvider;
+  httpClient: HttpClient;
+  // defaults to the regional Systems Manager endpoint
+  endpoint?: string;
+}
+
+/** Whether path can be a Parameter Store hierarchy, e.g. /zoom-oauth/production. */
+export function isSsmParameterPath(path: string): boolean {
+  return /^(\/[\w.-]+)+$/.test(path) && path.length <= 1011;
+}
+
+/** Reads parameters from AWS Systems Manager Parameter Store, decrypting SecureStrings. */
+export class SsmParameterClient {
+  private readonly client: AwsJsonClient;
+
+  constructor(options: SsmParameterClientOptions) {
+    this.client = new AwsJsonClient({
+      service: "ssm",
+      targetPrefix: "AmazonSSM",
+      region: options.region,
+      credentials: options.credentials,
+      httpClient: options.httpClient,
+      endpoint: options.endpoint,
+    });
+  }
+
+  /** The values of the named parameters; throws naming the ones that don't exist. */
+  async getParameters(names: string[]): Promise<Record<string, string>> {
+    const values: Record<string, string> = {};
+    const missing: string[] = [];
+    for (let i = 0; i < names.length; i += MAX_PARAMETERS_PER_CALL) {
+      const page = await this.client.call<{ Parameters?: { Name: string; Value: string }[]; InvalidParameters?: string[] }>("GetParameters", {
+        Names: names.slice(i, i + MAX_PARAMETERS_PER_CALL),
+        WithDecryption: true,
+      });
+      for (const parameter of page.Parameters ?? []) values[parameter.Name] = parameter.Value;
+      missing.push(...(page.InvalidParameters ?? []));
+    }
+    if (missing.length > 0) {
+      throw new Error(`parameter store has no parameter ${missing.join(", ")}`);
+    }
+    return values;
+  }
+}
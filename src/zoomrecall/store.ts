@@ -0,0 +1,131 @@
+/**
+ * Where token managers keep their users: records keyed by provider, e.g.
+ * "zoom", and user ID. A manager reads every user of its provider at
+ * startup and writes one user at a time after that, so a backend only has
+ * to implement these four operations; the optional ones let several
+ * instances share a store safely.
+ */
+export interface TokenStore {
+  // where the store is, for messages; never includes credentials
+  readonly path: string;
+  list(provider: string): Promise<StoredTokens[]>;
+  get(provider: string, userId: string): Promise<StoredTokens | null>;
+  // adds or replaces one user
+  save(provider: string, user: StoredTokens): Promise<void>;
+  delete(provider: string, userId: string): Promise<void>;
+  /**
+   * Takes the refresh lock for userId for up to ttlMs, returning a function
+   * that releases it, or null if another instance holds it. Stores shared
+   * between instances implement it so a refresh token is never spent twice.
+   */
+  lock?(provider: string, userId: string, ttlMs: number): Promise<(() => Promise<void>) | null>;
+  /**
+   * Calls onChange with the ID of every user of provider another instance
+   * changed, or with null when changes may have been missed and every user
+   * should be read again.
+   */
+  watch?(provider: string, onChange: (userId: string | null) => void): void;
+  // stores that keep a history of changes forget what happened before before and return how many entries that removed
+  pruneHistory?(before: Date): Promise<number>;
+  close?(): void;
+}
+
+/** Everything a token manager needs to pick a user back up after a restart. */
+export interface StoredTokens {
+  userId: string;
+  accessToken: string;
+  refreshToken: string;
+  expiresAt: Date;
+  lastRefreshedAt: Date | null;
+  needsReauthorization: boolean;
+  grantedScopes: string[] | null;
+  scopes: string[] | null;
+  deactivatedReason: string | null;
+  // what the manager learned about the user besides their tokens, e.g. their Zoom user ID
+  metadata: Record<string, string>;
+}
+
+export interface StoredTokensJSON {
+  user_id: string;
+  access_token: string;
+  refresh_token: string;
+  expires_at: string;
+  last_refreshed_at: string | null;
+  needs_reauthorization: boolean;
+  granted_scopes: string[] | null;
+  scopes: string[] | null;
+  deactivated_reason: string | null;
+  // missing from records written before users had metadata
+  metadata?: Record<string, string>;
+}
+
+export function storedTokensJSON(user: StoredTokens): StoredTokensJSON {
+  return {
+    user_id: user.userId,
+    access_token: user.accessToken,
+    refresh_token: user.refreshToken,
+    expires_at: user.expiresAt.toISOString(),
+    last_refreshed_at: user.lastRefreshedAt?.toISOString() ?? null,
+    needs_reauthorization: user.needsReauthorization,
+    granted_scopes: user.grantedScopes,
+    scopes: user.scopes,
+    deactivated_reason: user.deactivatedReason,
+    metadata: user.metadata,
+  };
+}
+
+export function storedTokensFromJSON(user: StoredTokensJSON): StoredTokens {
+  return {
+    userId: user.user_id,
+    accessToken: user.access_token,
+    refreshToken: user.refresh_token,
+    expiresAt: new Date(user.expires_at),
+    lastRefreshedAt: user.last_refreshed_at === null ? null : new Date(user.last_refreshed_at),
+    needsReauthorization: user.needs_reauthorization,
+    grantedScopes: user.granted_scopes,
+    scopes: user.scopes,
+    deactivatedReason: user.deactivated_reason,
+    metadata: user.metadata ?? {},
+  };
+}
+
+/**
+ * Keeps users in memory only, so they are lost on restart; what token
+ * managers use without another store.
+ */
+export class MemoryTokenStore implements TokenStore {
+  readonly path = "memory";
+  private readonly providers = new Map<string, Map<string, StoredTokens>>();
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    return [...(this.providers.get(provider)?.values() ?? [])].map(copy);
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const user = this.providers.get(provider)?.get(userId);
+    return user ? copy(user) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    let users = this.providers.get(provider);
+    if (!users) {
+      users = new Map();
+      this.providers.set(provider, users);
+    }
+    users.set(user.userId, copy(user));
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    this.providers.get(provider)?.delete(userId);
+  }
+}
+
+// so callers changing a record they got or saved never change the store's
+function copy(user: StoredTokens): StoredTokens {
+  return {
+    ...user,
+    grantedScopes: user.grantedScopes && [...user.grantedScopes],
+    scopes: user.scopes && [...user.scopes],
+    metadata: { ...user.metadata },
+  };
+}
@@ -0,0 +1,1186 @@
+import { createHash, randomBytes, randomUUID } from "crypto";
+import {
+  AuthorizationCodeExpiredError,
+  CodeVerifierMismatchError,
+  HostNotConnectedError,
+  HttpError,
+  InvalidGrantError,
+  MeetingNotFoundError,
+  TokenExpiredError,
+  TokenNotSetError,
+  UserDeactivatedError,
+  ZOOM_INVALID_TOKEN_CODE,
+  ZOOM_MISSING_SCOPE_CODE,
+  ZOOM_USER_NOT_FOUND_CODE,
+  RateLimitedError,
+  ZoomApiError,
+} from "./errors.js";
+import { CLOCK_SKEW_RESOLUTION_MS } from "./clock.js";
+import { MemoryTokenStore } from "./store.js";
+import type { StoredTokens, TokenStore } from "./store.js";
+import { DEFAULT_REFRESH_POLICY, monotonicNow, nextRefreshDelay, retryRefreshDelay } from "./schedule.js";
+import type { RefreshPolicy } from "./schedule.js";
+import { TtlCache } from "./ttlcache.js";
+import type { TtlCacheHooks } from "./ttlcache.js";
+import { resolveOccurrence } from "./zoom.js";
+import type { OAuthTokens, ZoomClient, ZoomMeeting, ZoomOccurrence, ZoomUser } from "./zoom.js";
+
+export const DEFAULT_TOKEN_REFRESH_INTERVAL_MS = DEFAULT_REFRESH_POLICY.maxDelayMs;
+export const DEFAULT_TOKEN_REFRESH_MARGIN_MS = DEFAULT_REFRESH_POLICY.marginMs;
+export const DEFAULT_ZAK_CACHE_TTL_MS = 5 * 60 * 1000;
+export const DEFAULT_OBF_CACHE_TTL_MS = 60 * 1000;
+export const DEFAULT_STALE_TOKEN_GRACE_MS = 5 * 60 * 1000;
+// Zoom's refresh tokens expire 90 days after they were issued
+export const DEFAULT_REFRESH_TOKEN_LIFETIME_MS = 90 * 24 * 60 * 60 * 1000;
+export const DEFAULT_REAUTHORIZATION_WARNING_MS = 14 * 24 * 60 * 60 * 1000;
+const MAX_CACHED_TOKENS = 1000;
+// long enough for any refresh to finish; a lock left by a crashed instance expires after it
+const REFRESH_LOCK_TTL_MS = 60 * 1000;
+
+// scopes any one of which lets an access token get OBF or ZAK tokens, granular ones first, then classic ones
+const ISSUING_SCOPES = {
+  obf: ["user:read:token", "user:read:token:admin", "user:read", "user:read:admin"],
+  zak: ["user:read:zak", "user:read:zak:admin", "user_zak:read", "user:read", "user:read:admin"],
+};
+
+// the scopes that let a token mint OBF and ZAK tokens for other users of its account than its own
+const ACCOUNT_ISSUING_SCOPES = ["user:read:admin", "user:read:token:admin", "user:read:zak:admin"];
+
+// meeting hosts rarely change, but a meeting can be reassigned, so don't remember them for long
+const MEETING_HOST_CACHE_TTL_MS = 10 * 60 * 1000;
+// the metadata keys the Zoom user behind a user ID, their email, account and profile's time zone are kept under
+const ZOOM_USER_ID_KEY = "zoom_user_id";
+const EMAIL_KEY = "email";
+const ACCOUNT_ID_KEY = "account_id";
+const TIME_ZONE_KEY = "time_zone";
+const NAME_KEY = "name";
+// the Personal Meeting ID and personal link's vanity name; set, if only to "", whenever the profile was learned
+const PMI_KEY = "pmi";
+const VANITY_NAME_KEY = "vanity_name";
+// the user's own Recall callback secret, kept with their tokens since bots launched here for them need it
+const CALLBACK_SECRET_KEY = "callback_secret";
+// when the user last consented and their current refresh token was issued, for any provider
+const CONSENTED_AT_KEY = "consented_at";
+const REFRESH_TOKEN_ISSUED_AT_KEY = "refresh_token_issued_at";
+// what the provider last said of the access token, and how many refreshes in a row have failed since one succeeded
+const TOKEN_TYPE_KEY = "token_type";
+const API_URL_KEY = "api_url";
+const REFRESH_FAILURES_KEY = "refresh_failures";
+
+/** Who a user ID is connected as at Zoom, as far as it has been looked up. */
+export interface ZoomProfile {
+  zoomUserId?: string;
+  email?: string;
+  accountId?: string;
+  timeZone?: string;
+  name?: string;
+}
+
+export interface UserTokens {
+  userId: string;
+  accessToken: string;
+  refreshToken: string;
+}
+
+export interface TokenStatus {
+  userId: string;
+  expiresAt: Date;
+  nextRefreshAt: Date | null;
+  lastRefreshedAt: Date | null;
+  needsReauthorization: boolean;
+  deactivated: boolean;
+  // null when the provider never reported scopes
+  scopes: string[] | null;
+  // scopes of the original grant that the latest refresh no longer included
+  missingScopes: string[];
+  // null for tokens stored before these were tracked, until their next consent or refresh
+  consentedAt: Date | null;
+  refreshTokenIssuedAt: Date | null;
+  // when the user is forecast to have to consent again, the earlier of the refresh token's and the consent's expiry;
+  // null when neither can be told, e.g. for tokens without a refresh token
+  reauthorizationDueAt: Date | null;
+  // as the provider last returned them, null if it didn't
+  tokenType: string | null;
+  apiUrl: string | null;
+  // refreshes failed in a row since the last one that succeeded, 0 after a consent
+  refreshFailures: number;
+}
+
+export interface UserSyncResult {
+  checked: number;
+  // user IDs deactivated by this sync
+  deactivated: string[];
+}
+
+export interface ObfEntitlement {
+  // null when the probe couldn't tell, e.g. because the token lacks a scope
+  entitled: boolean | null;
+  detail: string;
+}
+
+/** Whether Zoom accepted a stored access token, and who it said the token belongs to when it did. */
+export interface TokenCheck {
+  works: boolean;
+  detail: string;
+  zoomUser: ZoomUser | undefined;
+}
+
+/** Picks the connected user to serve as the host of a meeting, named by Zoom user ID and, when Zoom says, email. */
+export type HostMapper = (zoomUserId: string, email: string | undefined) => string | undefined;
+
+// whom a meeting's host resolved to; the host is kept so mappings added since still apply
+interface MeetingHost {
+  hostId: string;
+  hostEmail: string | undefined;
+  // undefined when it was mapped
+  userId: string | undefined;
+}
+
+interface TrackedUser {
+  tokens: UserTokens;
+  // read from the monotonic clock; the wall-clock fields below are only for display
+  expiresAt: number;
+  expiresAtWallClock: number;
+  nextRefreshAtWallClock: number | null;
+  lastRefreshedAtWallClock: number | null;
+  needsReauthorization: boolean;
+  // scopes of the authorization the tokens came from, and of the current access token
+  grantedScopes: string[] | null;
+  scopes: string[] | null;
+  // set once the user is deactivated at the provider; the tokens are kept for status but never served
+  deactivatedReason: string | null;
+  // kept in the store with the tokens; see setMetadata
+  metadata: Record<string, string>;
+  // whether onReauthorizationDue was called since the user consented
+  reauthorizationWarned: boolean;
+  refreshTimer: NodeJS.Timeout | null;
+}
+
+// keeps what the provider said of the access token; fields it left out keep their earlier value
+function describeTokens(metadata: Record<string, string>, tokens: OAuthTokens): void {
+  if (tokens.tokenType) metadata[TOKEN_TYPE_KEY] = tokens.tokenType;
+  if (tokens.apiUrl) metadata[API_URL_KEY] = tokens.apiUrl;
+}
+
+// equal-length digests, so secrets of any length can be compared in constant time
+function sha256(value: string): Buffer {
+  return createHash("sha256").update(value).digest();
+}
+
+function missingScopes(granted: string[] | null, current: string[] | null): string[] {
+  return granted === null || current === null ? [] : granted.filter((scope) => !current.includes(scope));
+}
+
+/** The parts of an OAuth authorization server a token manager needs. */
+export interface OAuthProvider {
+  // codeVerifier is the PKCE verifier of the authorization request the code was issued for, if it had one
+  exchangeCode(authCode: string, codeVerifier?: string): Promise<OAuthTokens>;
+  refreshToken(refreshToken: string): Promise<OAuthTokens>;
+}
+
+/**
+ * What get does with an access token that is past expiry because refreshing
+ * keeps failing: "reject" throws TokenExpiredError, "serve-stale" returns it
+ * anyway, and "grace" returns it until staleTokenGraceMs after expiry.
+ */
+export type StaleTokenPolicy = "reject" | "serve-stale" | "grace";
+
+export interface TokenManagerHooks {
+  onRefresh?(status: TokenStatus): void;
+  // a refresh failed for a reason other than an invalid grant and will be retried
+  onRefreshFailed?(userId: string, error: unknown): void;
+  onReauthorizationRequired?(userId: string, error: InvalidGrantError): void;
+  onDeactivated?(userId: string, reason: string): void;
+  // a refresh returned fewer scopes than were granted, e.g. after the app's scopes were edited
+  onScopesNarrowed?(userId: string, missingScopes: string[], scopes: string[]): void;
+  // the forecast re-authorization is less than reauthorizationWarningMs away; called once per user and consent
+  onReauthorizationDue?(status: TokenStatus): void;
+  // the outcome of each write to the token store, when there is one
+  onStoreSaved?(): void;
+  onStoreFailed?(error: unknown): void;
+}
+
+export interface OAuthTokenManagerOptions {
+  provider: OAuthProvider;
+  // upper bound on the time between refreshes
+  refreshIntervalMs?: number;
+  // how long before expiry a token is refreshed
+  refreshMarginMs?: number;
+  // where users go to (re-)authorize, used in error messages
+  consentPath?: string;
+  // how long a refresh token lasts after it was issued (default: Zoom's 90 days), and a consent however
+  // often it's refreshed (default: as long as its refresh tokens), 0 for no limit; see TokenStatus.reauthorizationDueAt
+  refreshTokenLifetimeMs?: number;
+  consentLifetimeMs?: number;
+  reauthorizationWarningMs?: number;
+  hooks?: TokenManagerHooks;
+  // defaults to "serve-stale"
+  staleTokenPolicy?: StaleTokenPolicy;
+  staleTokenGraceMs?: number;
+  // users are saved here on every change and restored from it at construction (default: in memory)
+  store?: TokenStore;
+  // the store's section for this manager's users (default: "zoom")
+  storeKey?: string;
+  // how far the local clock is off the provider's; times are stored on the provider's clock, so
+  // instances whose clocks are off differently still agree on when a stored token expires
+  clock?: { skewMs(): number };
+}
+
+export interface TokenManagerOptions extends Omit<OAuthTokenManagerOptions, "provider"> {
+  zoom: ZoomClient;
+  // where tokens are got and refreshed (default: zoom's authorization code and refresh token grants)
+  provider?: OAuthProvider;
+  // set a TTL to 0 to disable caching of that token type
+  zakCacheTtlMs?: number;
+  obfCacheTtlMs?: number;
+  cacheHooks?: TtlCacheHooks;
+  // how often every user is checked against Zoom for deactivation; 0 disables the periodic sync
+  userSyncIntervalMs?: number;
+  // a connected admin of an account-level app, by user ID, whose token mints OBF and ZAK tokens for
+  // hosts of the account who never connected, named by email; needs an :admin user scope
+  accountAdmin?: string;
+}
+
+/**
+ * Holds OAuth tokens per user and keeps them fresh by exchanging each user's
+ * refresh token with the provider ahead of the access token's expiry.
+ */
+export class OAuthTokenManager {
+  private readonly provider: OAuthProvider;
+  private readonly refreshPolicy: RefreshPolicy;
+  private readonly consentPath: string;
+  private readonly refreshTokenLifetimeMs: number;
+  private readonly consentLifetimeMs: number;
+  private readonly reauthorizationWarningMs: number;
+  private readonly hooks: TokenManagerHooks;
+  private readonly staleTokenPolicy: StaleTokenPolicy;
+  private readonly staleTokenGraceMs: number;
+  private readonly store: TokenStore;
+  private readonly storeKey: string;
+  private readonly clock: { skewMs(): number };
+  private readonly users = new Map<string, TrackedUser>();
+  // the SHA-256 of each user's own callback secret, hex, to the user, so a callback finds its user without hashing every secret
+  private readonly callbackSecretUsers = new Map<string, string>();
+  private closed = false;
+  /** Settles once the users in the store have been restored; rejects if they couldn't be read. */
+  readonly ready: Promise<void>;
+
+  constructor(options: OAuthTokenManagerOptions) {
+    this.provider = options.provider;
+    this.refreshPolicy = {
+      ...DEFAULT_REFRESH_POLICY,
+      maxDelayMs: options.refreshIntervalMs ?? DEFAULT_REFRESH_POLICY.maxDelayMs,
+      marginMs: options.refreshMarginMs ?? DEFAULT_REFRESH_POLICY.marginMs,
+    };
+    this.consentPath = options.consentPath ?? "/zoom/oauth";
+    this.refreshTokenLifetimeMs = options.refreshTokenLifetimeMs ?? DEFAULT_REFRESH_TOKEN_LIFETIME_MS;
+    this.consentLifetimeMs = options.consentLifetimeMs ?? 0;
+    this.reauthorizationWarningMs = options.reauthorizationWarningMs ?? DEFAULT_REAUTHORIZATION_WARNING_MS;
+    this.hooks = options.hooks ?? {};
+    this.staleTokenPolicy = options.staleTokenPolicy ?? "serve-stale";
+    this.staleTokenGraceMs = options.staleTokenGraceMs ?? DEFAULT_STALE_TOKEN_GRACE_MS;
+    this.store = options.store ?? new MemoryTokenStore();
+    this.storeKey = options.storeKey ?? "zoom";
+    this.clock = options.clock ?? { skewMs: () => 0 };
+    const store = this.store;
+    this.ready = store.list(this.storeKey).then((stored) => this.restore(stored));
+    // callers that never wait for ready still get the error logged instead of an unhandled rejection
+    this.ready.catch((error) => console.error(`could not restore tokens from ${store.path}: ${error instanceof Error ? error.message : String(error)}`));
+    store.watch?.(this.storeKey, (userId) => void this.reload(userId));
+  }
+
+  /** Exchanges an authorization code and starts tracking the resulting tokens under userId. */
+  async authorize(userId: string, authCode: string, codeVerifier?: string): Promise<UserTokens> {
+    return this.set(userId, await this.exchange(authCode, codeVerifier));
+  }
+
+  protected async exchange(authCode: string, codeVerifier?: string): Promise<OAuthTokens> {
+    try {
+      return await this.provider.exchangeCode(authCode, codeVerifier);
+    } catch (error) {
+      if (!(error instanceof InvalidGrantError)) throw error;
+      // Zoom names the verifier when it's the one refused; otherwise the code is the only grant, so it expired or was reused
+      if (codeVerifier !== undefined && /verifier/i.test(error.message)) throw new CodeVerifierMismatchError(this.consentPath);
+      throw new AuthorizationCodeExpiredError(this.consentPath);
+    }
+  }
+
+  /** Stores tokens for userId, replacing any existing tokens and refresh schedule. */
+  set(userId: string, tokens: OAuthTokens): UserTokens {
+    // new tokens for the same user, who is still who they were, from a new consent
+    const issuedAt = new Date().toISOString();
+    const metadata = { ...this.users.get(userId)?.metadata, [CONSENTED_AT_KEY]: issuedAt, [REFRESH_TOKEN_ISSUED_AT_KEY]: issuedAt };
+    delete metadata[REFRESH_FAILURES_KEY];
+    describeTokens(metadata, tokens);
+    // persisted once below, so stores never see the user briefly gone
+    this.forget(userId);
+
+    const user: TrackedUser = {
+      tokens: { userId, accessToken: tokens.accessToken, refreshToken: tokens.refreshToken },
+      expiresAt: monotonicNow() + tokens.expiresIn * 1000,
+      expiresAtWallClock: Date.now() + tokens.expiresIn * 1000,
+      nextRefreshAtWallClock: null,
+      lastRefreshedAtWallClock: null,
+      needsReauthorization: false,
+      grantedScopes: tokens.scopes ?? null,
+      scopes: tokens.scopes ?? null,
+      deactivatedReason: null,
+      metadata,
+      reauthorizationWarned: false,
+      refreshTimer: null,
+    };
+    this.users.set(userId, user);
+    this.indexCallbackSecret(userId, user.metadata, true);
+    this.scheduleRefresh(user, nextRefreshDelay(monotonicNow(), user.expiresAt, this.refreshPolicy));
+    void this.persist(userId);
+    return user.tokens;
+  }
+
+  /**
+   * Returns the tokens for userId, throwing TokenNotSetError if none are
+   * stored and TokenExpiredError if the access token is expired and the
+   * stale-token policy doesn't allow serving it.
+   */
+  get(userId: string): UserTokens {
+    const user = this.users.get(userId);
+    if (!user) {
+      throw new TokenNotSetError(userId, this.consentPath);
+    }
+    if (user.deactivatedReason !== null) {
+      throw new UserDeactivatedError(userId, user.deactivatedReason);
+    }
+    const expiredForMs = monotonicNow() - user.expiresAt;
+    if (
+      expiredForMs >= 0 &&
+      (this.staleTokenPolicy === "reject" || (this.staleTokenPolicy === "grace" && expiredForMs > this.staleTokenGraceMs))
+    ) {
+      throw new TokenExpiredError(userId, expiredForMs);
+    }
+    return user.tokens;
+  }
+
+  /** Reports whether userId's access token is past expiry, i.e. get would serve a stale token. */
+  isStale(userId: string): boolean {
+    const user = this.users.get(userId);
+    return user !== undefined && monotonicNow() >= user.expiresAt;
+  }
+
+  has(userId: string): boolean {
+    return this.users.has(userId);
+  }
+
+  /** Describes the stored tokens for userId without exposing them. */
+  status(userId: string): TokenStatus {
+    const user = this.users.get(userId);
+    if (!user) {
+      throw new TokenNotSetError(userId, this.consentPath);
+    }
+    const date = (ms: number | null) => (ms === null ? null : new Date(ms));
+    const metadataDate = (key: string) => (user.metadata[key] === undefined ? null : new Date(user.metadata[key]));
+    return {
+      userId,
+      expiresAt: new Date(user.expiresAtWallClock),
+      nextRefreshAt: date(user.nextRefreshAtWallClock),
+      lastRefreshedAt: date(user.lastRefreshedAtWallClock),
+      needsReauthorization: user.needsReauthorization,
+      deactivated: user.deactivatedReason !== null,
+      scopes: user.scopes,
+      missingScopes: missingScopes(user.grantedScopes, user.scopes),
+      consentedAt: metadataDate(CONSENTED_AT_KEY),
+      refreshTokenIssuedAt: metadataDate(REFRESH_TOKEN_ISSUED_AT_KEY),
+      reauthorizationDueAt: date(this.reauthorizationDueAt(user)),
+      tokenType: user.metadata[TOKEN_TYPE_KEY] ?? null,
+      apiUrl: user.metadata[API_URL_KEY] ?? null,
+      refreshFailures: Number(user.metadata[REFRESH_FAILURES_KEY] ?? 0),
+    };
+  }
+
+  // a refresh token keeps working until its lifetime after issue and the consent until its own; null if neither is known
+  private reauthorizationDueAt(user: TrackedUser): number | null {
+    if (!user.tokens.refreshToken) return null;
+    const after = (key: string, lifetimeMs: number) =>
+      lifetimeMs > 0 && user.metadata[key] !== undefined ? Date.parse(user.metadata[key]) + lifetimeMs : null;
+    const deadlines = [after(REFRESH_TOKEN_ISSUED_AT_KEY, this.refreshTokenLifetimeMs), after(CONSENTED_AT_KEY, this.consentLifetimeMs)];
+    const known = deadlines.filter((deadline): deadline is number => deadline !== null);
+    return known.length === 0 ? null : Math.min(...known);
+  }
+
+  list(): TokenStatus[] {
+    return [...this.users.keys()].map((userId) => this.status(userId));
+  }
+
+  /** What is known about userId besides their tokens; empty if they are unknown. */
+  metadata(userId: string): Record<string, string> {
+    return { ...this.users.get(userId)?.metadata };
+  }
+
+  /**
+   * Merges changes into userId's metadata, removing the keys set to null,
+   * and saves it with their tokens so it survives a restart. Returns false
+   * if userId is unknown.
+   */
+  protected setMetadata(userId: string, changes: Record<string, string | null>): boolean {
+    const user = this.users.get(userId);
+    if (!user) return false;
+    let changed = false;
+    if (CALLBACK_SECRET_KEY in changes) this.indexCallbackSecret(userId, user.metadata, false);
+    for (const [key, value] of Object.entries(changes)) {
+      if ((user.metadata[key] ?? null) === value) continue;
+      if (value === null) delete user.metadata[key];
+      else user.metadata[key] = value;
+      changed = true;
+    }
+    if (CALLBACK_SECRET_KEY in changes) this.indexCallbackSecret(userId, user.metadata, true);
+    if (changed) void this.persist(userId);
+    return true;
+  }
+
+  private indexCallbackSecret(userId: string, metadata: Record<string, string>, indexed: boolean): void {
+    const secret = metadata[CALLBACK_SECRET_KEY];
+    if (secret === undefined) return;
+    const digest = sha256(secret).toString("hex");
+    if (indexed) this.callbackSecretUsers.set(digest, userId);
+    else if (this.callbackSecretUsers.get(digest) === userId) this.callbackSecretUsers.delete(digest);
+  }
+
+  /**
+   * Stops refreshing userId's tokens and serving them, e.g. after the user
+   * was deactivated at the provider. Returns false if userId is unknown or
+   * already deactivated.
+   */
+  deactivate(userId: string, reason: string): boolean {
+    const user = this.users.get(userId);
+    if (!user || user.deactivatedReason !== null) return false;
+    if (user.refreshTimer) {
+      clearTimeout(user.refreshTimer);
+      user.refreshTimer = null;
+    }
+    user.nextRefreshAtWallClock = null;
+    user.deactivatedReason = reason;
+    void this.persist(userId);
+    console.warn(`deactivated user ${userId}: ${reason}`);
+    this.hooks.onDeactivated?.(userId, reason);
+    return true;
+  }
+
+  /** Stops refreshing and forgets the tokens for userId. */
+  delete(userId: string): void {
+    if (this.forget(userId)) {
+      void this.persist(userId);
+    }
+  }
+
+  /** Stops all refresh schedules, e.g. before shutting down. */
+  close(): void {
+    this.closed = true;
+    for (const user of this.users.values()) {
+      if (user.refreshTimer) {
+        clearTimeout(user.refreshTimer);
+        user.refreshTimer = null;
+      }
+    }
+  }
+
+  private forget(userId: string): boolean {
+    const user = this.users.get(userId);
+    if (!user) return false;
+    if (user.refreshTimer) {
+      clearTimeout(user.refreshTimer);
+    }
+    this.indexCallbackSecret(userId, user.metadata, false);
+    return this.users.delete(userId);
+  }
+
+  private restore(stored: StoredTokens[]): void {
+    for (const saved of stored) {
+      // set while the store was being read, so newer than what it holds
+      if (this.users.has(saved.userId)) continue;
+      this.adopt(saved);
+    }
+    if (stored.length > 0) {
+      console.log(`restored tokens for ${stored.length} ${this.storeKey} user(s) from ${this.store.path}`);
+    }
+  }
+
+  // tracks a user as saved in the store, replacing whatever this instance had for them
+  private adopt(saved: StoredTokens): void {
+    this.forget(saved.userId);
+    // saved on the provider's clock, see persist
+    const skewMs = this.clock.skewMs();
+    const expiresAtWallClock = saved.expiresAt.getTime() + skewMs;
+    const user: TrackedUser = {
+      tokens: { userId: saved.userId, accessToken: saved.accessToken, refreshToken: saved.refreshToken },
+      // the monotonic clock restarted with the process, so carry over the remaining lifetime, erring towards
+      // refreshing early by what the skew estimate can't tell apart
+      expiresAt: monotonicNow() + (expiresAtWallClock - Date.now()) - CLOCK_SKEW_RESOLUTION_MS,
+      expiresAtWallClock,
+      nextRefreshAtWallClock: null,
+      lastRefreshedAtWallClock: saved.lastRefreshedAt === null ? null : saved.lastRefreshedAt.getTime() + skewMs,
+      needsReauthorization: saved.needsReauthorization,
+      grantedScopes: saved.grantedScopes,
+      scopes: saved.scopes,
+      deactivatedReason: saved.deactivatedReason,
+      metadata: { ...saved.metadata },
+      // this instance hasn't said so, whether another did or not
+      reauthorizationWarned: false,
+      refreshTimer: null,
+    };
+    this.users.set(saved.userId, user);
+    this.indexCallbackSecret(saved.userId, user.metadata, true);
+    if (!user.needsReauthorization && user.deactivatedReason === null) {
+      this.scheduleRefresh(user, nextRefreshDelay(monotonicNow(), user.expiresAt, this.refreshPolicy));
+    }
+  }
+
+  // picks up a change another instance made to a shared store; null reloads every user
+  private async reload(userId: string | null): Promise<void> {
+    const store = this.store;
+    if (this.closed) return;
+    try {
+      if (userId === null) {
+        const stored = await store.list(this.storeKey);
+        for (const known of this.users.keys()) {
+          if (!stored.some((saved) => saved.userId === known)) this.forget(known);
+        }
+        stored.forEach((saved) => this.adopt(saved));
+        return;
+      }
+      const saved = await store.get(this.storeKey, userId);
+      if (saved) this.adopt(saved);
+      else this.forget(userId);
+    } catch (error) {
+      console.error(`could not reload tokens changed by another instance from ${store.path}`, error);
+    }
+  }
+
+  /** Saves userId's tokens, or removes them if they're gone; settles once the store has answered. */
+  private async persist(userId: string): Promise<void> {
+    const store = this.store;
+    const user = this.users.get(userId);
+    const skewMs = this.clock.skewMs();
+    try {
+      if (user) {
+        await store.save(this.storeKey, {
+          ...user.tokens,
+          expiresAt: new Date(user.expiresAtWallClock - skewMs),
+          lastRefreshedAt: user.lastRefreshedAtWallClock === null ? null : new Date(user.lastRefreshedAtWallClock - skewMs),
+          needsReauthorization: user.needsReauthorization,
+          grantedScopes: user.grantedScopes,
+          scopes: user.scopes,
+          deactivatedReason: user.deactivatedReason,
+          metadata: { ...user.metadata },
+        });
+      } else {
+        await store.delete(this.storeKey, userId);
+      }
+    } catch (error) {
+      this.storeFailed(error);
+      return;
+    }
+    this.hooks.onStoreSaved?.();
+  }
+
+  private storeFailed(error: unknown): void {
+    // the tokens still work from memory; they'd only be lost on restart
+    console.error(`could not save tokens to ${this.store.path}`, error);
+    this.hooks.onStoreFailed?.(error);
+  }
+
+  private updateScopes(user: TrackedUser, scopes: string[]): void {
+    const previouslyMissing = missingScopes(user.grantedScopes, user.scopes);
+    // tokens stored without scopes, e.g. through the admin API, take the first reported ones as the grant
+    user.grantedScopes ??= scopes;
+    user.scopes = scopes;
+    const missing = missingScopes(user.grantedScopes, scopes);
+    if (missing.length > 0 && missing.some((scope) => !previouslyMissing.includes(scope))) {
+      console.warn(`refreshed token for user ${user.tokens.userId} lost scopes ${missing.join(", ")}, re-authorization via ${this.consentPath} may be required`);
+      this.hooks.onScopesNarrowed?.(user.tokens.userId, missing, scopes);
+    }
+  }
+
+  private scheduleRefresh(user: TrackedUser, delayMs: number): void {
+    if (this.closed) return;
+    user.refreshTimer = setTimeout(() => void this.refresh(user), delayMs);
+    user.nextRefreshAtWallClock = Date.now() + delayMs;
+  }
+
+  private async refresh(user: TrackedUser): Promise<void> {
+    user.refreshTimer = null;
+    user.nextRefreshAtWallClock = null;
+    const store = this.store;
+    if (!store.lock) {
+      await this.refreshTokens(user);
+      return;
+    }
+
+    // a shared store: only one instance may spend the refresh token
+    const userId = user.tokens.userId;
+    const retryLater = () => {
+      if (this.users.get(userId) === user) this.scheduleRefresh(user, retryRefreshDelay(this.refreshPolicy));
+    };
+    let release: (() => Promise<void>) | null;
+    try {
+      release = await store.lock(this.storeKey, userId, REFRESH_LOCK_TTL_MS);
+    } catch (error) {
+      this.storeFailed(error);
+      retryLater();
+      return;
+    }
+    if (!release) {
+      // another instance is refreshing; the change it announces reschedules this one
+      retryLater();
+      return;
+    }
+    try {
+      const saved = await store.get(this.storeKey, userId);
+      if (saved && saved.refreshToken !== user.tokens.refreshToken) {
+        // refreshed elsewhere and not picked up yet
+        if (this.users.get(userId) === user) this.adopt(saved);
+        return;
+      }
+      await this.refreshTokens(user);
+    } catch (error) {
+      this.storeFailed(error);
+      retryLater();
+    } finally {
+      // if this fails, the lock expires on its own
+      await release().catch(() => undefined);
+    }
+  }
+
+  private async refreshTokens(user: TrackedUser): Promise<void> {
+    const userId = user.tokens.userId;
+    try {
+      const newTokens = await this.provider.refreshToken(user.tokens.refreshToken);
+      if (newTokens.refreshToken !== user.tokens.refreshToken) {
+        user.metadata[REFRESH_TOKEN_ISSUED_AT_KEY] = new Date().toISOString();
+      }
+      user.tokens.accessToken = newTokens.accessToken;
+      user.tokens.refreshToken = newTokens.refreshToken;
+      user.expiresAt = monotonicNow() + newTokens.expiresIn * 1000;
+      user.expiresAtWallClock = Date.now() + newTokens.expiresIn * 1000;
+      user.lastRefreshedAtWallClock = Date.now();
+      delete user.metadata[REFRESH_FAILURES_KEY];
+      describeTokens(user.metadata, newTokens);
+      if (newTokens.scopes !== undefined) {
+        this.updateScopes(user, newTokens.scopes);
+      }
+    } catch (error) {
+      console.error("error refreshing oauth token", error);
+      user.metadata[REFRESH_FAILURES_KEY] = String(Number(user.metadata[REFRESH_FAILURES_KEY] ?? 0) + 1);
+      if (error instanceof InvalidGrantError) {
+        console.error(`refresh token for user ${userId} is no longer valid, re-authorization via ${this.consentPath} is required`);
+        user.needsReauthorization = true;
+        await this.persist(userId);
+        this.hooks.onReauthorizationRequired?.(userId, error);
+        return;
+      }
+      if (this.users.get(userId) === user) {
+        this.scheduleRefresh(user, retryRefreshDelay(this.refreshPolicy));
+        void this.persist(userId);
+        this.hooks.onRefreshFailed?.(userId, error);
+      }
+      return;
+    }
+    if (this.users.get(userId) === user) {
+      this.scheduleRefresh(user, nextRefreshDelay(monotonicNow(), user.expiresAt, this.refreshPolicy));
+      await this.persist(userId);
+      this.hooks.onRefresh?.(this.status(userId));
+      this.warnIfReauthorizationDue(user);
+    }
+  }
+
+  private warnIfReauthorizationDue(user: TrackedUser): void {
+    const dueAt = this.reauthorizationDueAt(user);
+    if (user.reauthorizationWarned || dueAt === null || dueAt - Date.now() > this.reauthorizationWarningMs) return;
+    user.reauthorizationWarned = true;
+    console.warn(`user ${user.tokens.userId} will have to re-authorize via ${this.consentPath} by ${new Date(dueAt).toISOString()}`);
+    this.hooks.onReauthorizationDue?.(this.status(user.tokens.userId));
+  }
+}
+
+/**
+ * An OAuthTokenManager for Zoom that also mints OBF and ZAK tokens from the
+ * stored access tokens, caching them briefly per user.
+ */
+export class TokenManager extends OAuthTokenManager {
+  protected readonly zoom: ZoomClient;
+  private readonly zakCache: TtlCache<string>;
+  private readonly obfCache: TtlCache<string>;
+  // meeting ID to the user ID of its connected host
+  private readonly meetingHosts = new TtlCache<MeetingHost>({ ttlMs: MEETING_HOST_CACHE_TTL_MS, maxEntries: MAX_CACHED_TOKENS });
+  private readonly syncTimer: NodeJS.Timeout | null;
+  private readonly accountAdmin: string | undefined;
+
+  constructor(options: TokenManagerOptions) {
+    super({ ...options, provider: options.provider ?? options.zoom });
+    this.zoom = options.zoom;
+    this.accountAdmin = options.accountAdmin || undefined;
+    this.zakCache = new TtlCache({
+      ttlMs: options.zakCacheTtlMs ?? DEFAULT_ZAK_CACHE_TTL_MS,
+      maxEntries: MAX_CACHED_TOKENS,
+      hooks: options.cacheHooks,
+    });
+    this.obfCache = new TtlCache({
+      ttlMs: options.obfCacheTtlMs ?? DEFAULT_OBF_CACHE_TTL_MS,
+      maxEntries: MAX_CACHED_TOKENS,
+      hooks: options.cacheHooks,
+    });
+    const syncIntervalMs = options.userSyncIntervalMs ?? 0;
+    this.syncTimer = syncIntervalMs > 0 ? setInterval(() => void this.syncUsers(), syncIntervalMs) : null;
+  }
+
+  /**
+   * Exchanges an authorization code and stores the tokens under the user ID
+   * of the Zoom user who consented, so a Zoom user consenting again replaces
+   * their tokens, keeping their user ID, instead of being connected twice.
+   * A Zoom user not connected yet, or one Zoom couldn't be asked about, gets
+   * a new random user ID.
+   */
+  async connect(authCode: string, codeVerifier?: string): Promise<{ userId: string; tokens: UserTokens; reconnected: boolean }> {
+    const tokens = await this.exchange(authCode, codeVerifier);
+    let zoomUser: ZoomUser | undefined;
+    try {
+      zoomUser = await this.zoom.getCurrentUser(tokens.accessToken);
+    } catch (error) {
+      // not fatal, the next user sync tries again
+      console.warn("could not look up the zoom user who consented", error);
+    }
+    const existing = zoomUser ? this.usersOfZoomUser(zoomUser.id)[0] : undefined;
+    const userId = existing ?? randomUUID();
+    const stored = this.set(userId, tokens);
+    if (zoomUser) this.learnZoomUser(userId, zoomUser);
+    return { userId, tokens: stored, reconnected: existing !== undefined };
+  }
+
+  override async authorize(userId: string, authCode: string, codeVerifier?: string): Promise<UserTokens> {
+    const tokens = await super.authorize(userId, authCode, codeVerifier);
+    try {
+      this.learnZoomUser(userId, await this.zoom.getCurrentUser(tokens.accessToken));
+    } catch (error) {
+      // not fatal, the next user sync tries again
+      console.warn(`could not look up the zoom user for ${userId}`, error);
+    }
+    return tokens;
+  }
+
+  override close(): void {
+    super.close();
+    if (this.syncTimer) {
+      clearInterval(this.syncTimer);
+    }
+  }
+
+  override delete(userId: string): void {
+    super.delete(userId);
+    this.zakCache.delete(userId);
+    this.obfCache.deleteMatching((key) => key.startsWith(`${userId}:`));
+  }
+
+  /** Drops cached ZAK and OBF tokens and meeting hosts that have expired; returns how many. */
+  purgeExpired(): number {
+    return this.zakCache.purgeExpired() + this.obfCache.purgeExpired() + this.meetingHosts.purgeExpired();
+  }
+
+  /** Revokes userId's authorization at Zoom, then forgets the tokens. */
+  async revoke(userId: string): Promise<void> {
+    await this.zoom.revokeToken(this.get(userId).accessToken);
+    this.delete(userId);
+  }
+
+  /**
+   * Revokes userId's authorization at Zoom where it still stands, then
+   * forgets the tokens either way; returns whether Zoom revoked them. Only
+   * fails, keeping the tokens, when Zoom couldn't be asked.
+   */
+  async disconnect(userId: string): Promise<boolean> {
+    let accessToken: string;
+    try {
+      accessToken = this.get(userId).accessToken;
+    } catch (error) {
+      if (error instanceof TokenNotSetError) throw error;
+      // deactivated or expired, there is no token Zoom would take
+      this.delete(userId);
+      return false;
+    }
+    try {
+      await this.zoom.revokeToken(accessToken);
+    } catch (error) {
+      if (!(error instanceof InvalidGrantError || (error instanceof ZoomApiError && error.status >= 400 && error.status < 500))) throw error;
+      console.log(`zoom no longer accepted the token of user ${userId}, forgetting it: ${error.message}`);
+      this.delete(userId);
+      return false;
+    }
+    this.delete(userId);
+    return true;
+  }
+
+  /** The Zoom user userId authorized as, learned at authorization or sync time. */
+  zoomUserId(userId: string): string | undefined {
+    return this.metadata(userId)[ZOOM_USER_ID_KEY];
+  }
+
+  /** The time zone set in userId's Zoom profile, if known. */
+  timeZone(userId: string): string | undefined {
+    return this.metadata(userId)[TIME_ZONE_KEY];
+  }
+
+  /**
+   * Gives userId a Recall callback secret of their own, replacing any
+   * earlier one, and returns it. It only lets callers fetch userId's
+   * tokens, so leaking it exposes no other user. Throws TokenNotSetError
+   * for unknown users.
+   */
+  issueCallbackSecret(userId: string): string {
+    this.get(userId);
+    const secret = randomBytes(24).toString("base64url");
+    this.setMetadata(userId, { [CALLBACK_SECRET_KEY]: secret });
+    return secret;
+  }
+
+  /** Takes userId's own callback secret away, so the shared one serves them again; false if they had none. */
+  revokeCallbackSecret(userId: string): boolean {
+    if (this.callbackSecret(userId) === undefined) return false;
+    this.setMetadata(userId, { [CALLBACK_SECRET_KEY]: null });
+    return true;
+  }
+
+  /** userId's own callback secret, for the callback URLs of bots launched for them; undefined if they use the shared one. */
+  callbackSecret(userId: string): string | undefined {
+    return this.has(userId) ? this.metadata(userId)[CALLBACK_SECRET_KEY] : undefined;
+  }
+
+  /**
+   * The user whose own callback secret secret is, if any. Secrets are
+   * looked up by digest, so how long the lookup takes depends on the SHA-256
+   * of what was presented, never on how much of a secret it got right.
+   */
+  userForCallbackSecret(secret: string): string | undefined {
+    const userId = this.callbackSecretUsers.get(sha256(secret).toString("hex"));
+    return userId !== undefined && this.metadata(userId)[CALLBACK_SECRET_KEY] === secret ? userId : undefined;
+  }
+
+  /** The Zoom user, email and account userId authorized as, learned at authorization or sync time. */
+  zoomProfile(userId: string): ZoomProfile {
+    const metadata = this.metadata(userId);
+    return {
+      zoomUserId: metadata[ZOOM_USER_ID_KEY],
+      email: metadata[EMAIL_KEY],
+      accountId: metadata[ACCOUNT_ID_KEY],
+      timeZone: metadata[TIME_ZONE_KEY],
+      name: metadata[NAME_KEY],
+    };
+  }
+
+  /**
+   * Asks Zoom about every active user and deactivates those whose Zoom
+   * account was deactivated or removed. Other failures, e.g. an expired
+   * token, are logged and the user is checked again on the next sync.
+   */
+  async syncUsers(): Promise<UserSyncResult> {
+    const result: UserSyncResult = { checked: 0, deactivated: [] };
+    for (const status of this.list()) {
+      if (status.deactivated) continue;
+      result.checked++;
+      let reason: string | null = null;
+      try {
+        const zoomUser = await this.zoom.getCurrentUser(this.get(status.userId).accessToken);
+        this.learnZoomUser(status.userId, zoomUser);
+        if (zoomUser.status === "inactive") reason = "zoom user is deactivated";
+      } catch (error) {
+        if (error instanceof ZoomApiError && error.code === ZOOM_USER_NOT_FOUND_CODE) {
+          reason = "zoom user no longer exists";
+        } else {
+          console.warn(`could not check zoom user status for ${status.userId}`, error);
+        }
+      }
+      if (reason !== null && this.deactivate(status.userId, reason)) {
+        result.deactivated.push(status.userId);
+      }
+    }
+    return result;
+  }
+
+  /** Fetches meetingId's details from Zoom with userId's token. */
+  async getMeeting(userId: string, meetingId: string): Promise<ZoomMeeting> {
+    return this.zoom.getMeeting(this.get(this.minter(userId).tokenUserId).accessToken, meetingId);
+  }
+
+  /** Fetches meetingId with userId's token and picks the occurrence bots are joining, see resolveOccurrence. */
+  async meetingOccurrence(userId: string, meetingId: string, occurrenceId?: string): Promise<ZoomOccurrence | undefined> {
+    return resolveOccurrence(await this.getMeeting(userId, meetingId), occurrenceId);
+  }
+
+  /**
+   * Returns meetingId's passcode if userId hosts it, for bots joining with
+   * their ZAK; null if it has none or someone else hosts it.
+   */
+  async hostedMeetingPasscode(userId: string, meetingId: string): Promise<string | null> {
+    const meeting = await this.getMeeting(userId, meetingId);
+    const { zoomUserId } = this.minter(userId);
+    // the user's own token acts as "me", an admin's or the account's names them by Zoom user ID or email
+    const host = (zoomUserId === "me" ? this.zoomUserId(userId) : zoomUserId)?.toLowerCase();
+    const hosts = host !== undefined && (meeting.hostId.toLowerCase() === host || meeting.hostEmail?.toLowerCase() === host);
+    return hosts ? (meeting.passcode ?? null) : null;
+  }
+
+  /**
+   * Asks Zoom for an OBF token to find out whether userId's account has the
+   * on-behalf-of token feature, which otherwise only shows as errors when a
+   * bot launches. The token is discarded and not cached.
+   */
+  async probeObfEntitlement(userId: string, meetingId?: string): Promise<ObfEntitlement> {
+    const { tokenUserId, zoomUserId } = this.minter(userId);
+    const { accessToken } = this.get(tokenUserId);
+    try {
+      await this.zoom.generateObfToken(accessToken, meetingId, zoomUserId);
+      return { entitled: true, detail: "zoom issued an OBF token" };
+    } catch (error) {
+      if (error instanceof ZoomApiError && error.code === ZOOM_MISSING_SCOPE_CODE) {
+        return { entitled: null, detail: `the access token lacks the scope OBF tokens need, add user:read:token and re-authorize (${error.message})` };
+      }
+      if (error instanceof ZoomApiError && error.code === ZOOM_INVALID_TOKEN_CODE) {
+        return { entitled: null, detail: `zoom rejected the access token (${error.message})` };
+      }
+      if (error instanceof MeetingNotFoundError) {
+        return { entitled: null, detail: `probe meeting ${meetingId} does not exist` };
+      }
+      // what a missing entitlement looks like: a 4xx with a code that means nothing at launch time
+      if (error instanceof ZoomApiError && error.status >= 400 && error.status < 500) {
+        return { entitled: false, detail: `zoom refused to issue an OBF token, the account may not have the on-behalf-of feature enabled (${error.message})` };
+      }
+      throw error;
+    }
+  }
+
+  /**
+   * Asks Zoom who userId's stored access token belongs to, as stored,
+   * without refreshing it first, and keeps the answer as the user's
+   * profile. A token Zoom refuses is reported rather than thrown; Zoom
+   * failing or being unreachable is thrown.
+   */
+  async verifyToken(userId: string): Promise<TokenCheck> {
+    const { accessToken } = this.get(userId);
+    try {
+      const zoomUser = await this.zoom.getCurrentUser(accessToken);
+      this.learnZoomUser(userId, zoomUser);
+      return { works: true, detail: `zoom accepted the access token as ${zoomUser.email || zoomUser.id}`, zoomUser };
+    } catch (error) {
+      if (error instanceof ZoomApiError && error.code === ZOOM_INVALID_TOKEN_CODE) {
+        return { works: false, detail: `zoom rejected the access token (${error.message})`, zoomUser: undefined };
+      }
+      if (error instanceof ZoomApiError && error.status >= 400 && error.status < 500) {
+        return { works: false, detail: `zoom refused to say who the access token belongs to (${error.message})`, zoomUser: undefined };
+      }
+      throw error;
+    }
+  }
+
+  /** Turns meetingId's waiting room on or off with userId's token. */
+  async setWaitingRoom(userId: string, meetingId: string, enabled: boolean): Promise<void> {
+    await this.zoom.setWaitingRoom(this.get(this.minter(userId).tokenUserId).accessToken, meetingId, enabled);
+  }
+
+  /** Admits participantId of meetingId from its waiting room with userId's token. */
+  async admitParticipant(userId: string, meetingId: string, participantId: string): Promise<void> {
+    await this.zoom.admitParticipant(this.get(this.minter(userId).tokenUserId).accessToken, meetingId, participantId);
+  }
+
+  /** Returns the active user authorized as zoomUserId, if any. */
+  async userForZoomUser(zoomUserId: string): Promise<string | undefined> {
+    const candidates = this.list().filter((status) => !status.deactivated).map((status) => status.userId);
+    return this.findZoomUser(zoomUserId, candidates);
+  }
+
+  /**
+   * Finds the user connected with the Zoom account of email, preferring one
+   * whose tokens are still served. Users whose email isn't known yet, e.g.
+   * tokens stored through the admin API, are looked up at Zoom if no known
+   * one matches. Nobody connected with it is the account admin's to mint
+   * for, if there is one; otherwise throws TokenNotSetError naming email.
+   */
+  async userForEmail(email: string): Promise<string> {
+    const wanted = email.toLowerCase();
+    const statuses = [...this.list()].sort((a, b) => Number(a.deactivated) - Number(b.deactivated));
+    const matches = (userId: string) => this.metadata(userId)[EMAIL_KEY]?.toLowerCase() === wanted;
+    const known = statuses.find((status) => matches(status.userId));
+    if (known) return known.userId;
+    for (const { userId, deactivated } of statuses) {
+      if (deactivated || this.metadata(userId)[EMAIL_KEY] !== undefined) continue;
+      try {
+        this.learnZoomUser(userId, await this.zoom.getCurrentUser(this.get(userId).accessToken));
+      } catch (error) {
+        console.warn(`could not look up the zoom user for ${userId}`, error);
+      }
+      if (matches(userId)) return userId;
+    }
+    if (this.mintsForAccount(email)) return email;
+    throw new TokenNotSetError(email);
+  }
+
+  /**
+   * Finds the connected user whose Personal Meeting ID is pmi, or whose
+   * personal link is zoom.us/my/<vanityName>, and the PMI it leads to.
+   * Users whose profile was learned before PMIs were kept are looked up at
+   * Zoom if no known one matches; undefined when nobody matches.
+   */
+  async personalMeeting(personal: { pmi: string } | { vanityName: string }): Promise<{ userId: string; pmi: string } | undefined> {
+    const matches = (userId: string) => {
+      const metadata = this.metadata(userId);
+      const found = "pmi" in personal ? metadata[PMI_KEY] === personal.pmi : metadata[VANITY_NAME_KEY] === personal.vanityName.toLowerCase();
+      return found && !!metadata[PMI_KEY];
+    };
+    const active = this.list().filter((status) => !status.deactivated).map((status) => status.userId);
+    const known = active.find(matches);
+    if (known !== undefined) return { userId: known, pmi: this.metadata(known)[PMI_KEY] };
+    for (const userId of active) {
+      if (this.metadata(userId)[PMI_KEY] !== undefined) continue;
+      try {
+        this.learnZoomUser(userId, await this.zoom.getCurrentUser(this.get(userId).accessToken));
+      } catch (error) {
+        console.warn(`could not look up the zoom user for ${userId}`, error);
+      }
+      if (matches(userId)) return { userId, pmi: this.metadata(userId)[PMI_KEY] };
+    }
+    return undefined;
+  }
+
+  /**
+   * Finds the connected user hosting meetingId, for account-level installs
+   * where callers only know the meeting. Each user's token is tried until one
+   * can read the meeting, which is the host's own or an admin's with
+   * meeting:read:admin. A host who never connected is named by email for
+   * the account admin to mint for, if there is one. userForHost, when
+   * given, picks the user for the host first, e.g. from mappings an admin
+   * registered.
+   */
+  async resolveHost(meetingId: string, userForHost?: HostMapper): Promise<string> {
+    const cached = this.meetingHosts.get(meetingId);
+    if (cached !== undefined) {
+      const mapped = userForHost?.(cached.hostId, cached.hostEmail);
+      if (mapped !== undefined) return mapped;
+      const { userId } = cached;
+      if (userId !== undefined && ((this.has(userId) && !this.status(userId).deactivated) || this.mintsForAccount(userId))) {
+        return userId;
+      }
+    }
+
+    const candidates = this.list().filter((status) => !status.deactivated).map((status) => status.userId);
+    let lastError: unknown = new HostNotConnectedError(meetingId, undefined);
+    for (const userId of candidates) {
+      try {
+        const meeting = await this.zoom.getMeeting(this.get(userId).accessToken, meetingId);
+        const mapped = userForHost?.(meeting.hostId, meeting.hostEmail);
+        if (mapped !== undefined) {
+          this.meetingHosts.set(meetingId, { hostId: meeting.hostId, hostEmail: meeting.hostEmail, userId: undefined });
+          return mapped;
+        }
+        let hostUserId = await this.findZoomUser(meeting.hostId, candidates);
+        if (hostUserId === undefined && meeting.hostEmail && this.mintsForAccount(meeting.hostEmail)) {
+          hostUserId = meeting.hostEmail;
+        }
+        if (hostUserId === undefined) {
+          throw new HostNotConnectedError(meetingId, meeting.hostEmail ?? meeting.hostId);
+        }
+        this.meetingHosts.set(meetingId, { hostId: meeting.hostId, hostEmail: meeting.hostEmail, userId: hostUserId });
+        return hostUserId;
+      } catch (error) {
+        if (error instanceof HostNotConnectedError || error instanceof RateLimitedError) throw error;
+        // most likely this user can't see the meeting; the next one may
+        lastError = error;
+      }
+    }
+    throw lastError;
+  }
+
+  private async findZoomUser(zoomUserId: string, userIds: string[]): Promise<string | undefined> {
+    for (const userId of userIds) {
+      if (this.zoomUserId(userId) === undefined) {
+        // e.g. tokens stored through the admin API, which skips the lookup done at authorization
+        try {
+          this.learnZoomUser(userId, await this.zoom.getCurrentUser(this.get(userId).accessToken));
+        } catch (error) {
+          console.warn(`could not look up the zoom user for ${userId}`, error);
+        }
+      }
+      if (this.zoomUserId(userId) === zoomUserId) return userId;
+    }
+    return undefined;
+  }
+
+  private learnZoomUser(userId: string, zoomUser: ZoomUser): void {
+    this.setMetadata(userId, {
+      [ZOOM_USER_ID_KEY]: zoomUser.id,
+      [EMAIL_KEY]: zoomUser.email || null,
+      [ACCOUNT_ID_KEY]: zoomUser.accountId || null,
+      [TIME_ZONE_KEY]: zoomUser.timezone || null,
+      [NAME_KEY]: zoomUser.name || null,
+      [PMI_KEY]: zoomUser.pmi ?? "",
+      [VANITY_NAME_KEY]: zoomUser.vanityName ?? "",
+    });
+  }
+
+  /** The user IDs known to be authorized as zoomUserId. */
+  usersOfZoomUser(zoomUserId: string): string[] {
+    return this.list()
+      .map(({ userId }) => userId)
+      .filter((userId) => this.zoomUserId(userId) === zoomUserId);
+  }
+
+  /** Deactivates every user authorized as zoomUserId, returning their user IDs. */
+  deactivateZoomUser(zoomUserId: string, reason: string): string[] {
+    return this.usersOfZoomUser(zoomUserId).filter((userId) => this.deactivate(userId, reason));
+  }
+
+  /**
+   * Checks what issuing a kind token for userId depends on without issuing
+   * one, for dry runs: that the user's tokens can be served, that their
+   * scopes allow the token, if Zoom reported them, and that Zoom is reachable
+   * and accepts the access token.
+   */
+  async checkIssuance(userId: string, kind: "access" | "obf" | "zak"): Promise<void> {
+    const { tokenUserId, zoomUserId } = this.minter(userId);
+    const { accessToken } = this.get(kind === "access" ? userId : tokenUserId);
+    const { scopes } = this.status(tokenUserId);
+    if (kind !== "access" && scopes !== null && !ISSUING_SCOPES[kind].some((scope) => scopes.includes(scope))) {
+      throw new HttpError(403, `the access token of user ${tokenUserId} lacks the scope ${kind.toUpperCase()} tokens need, add ${ISSUING_SCOPES[kind][0]} and re-authorize`);
+    }
+    await this.zoom.getUser(accessToken, zoomUserId);
+  }
+
+  async generateObfToken(userId: string, meetingId?: string): Promise<string> {
+    const { tokenUserId, zoomUserId } = this.minter(userId);
+    const { accessToken } = this.get(tokenUserId);
+    return this.obfCache.getOrCompute(`${userId}:${meetingId ?? ""}`, () =>
+      this.zoom.generateObfToken(accessToken, meetingId, zoomUserId),
+    );
+  }
+
+  async generateZakToken(userId: string): Promise<string> {
+    const { tokenUserId, zoomUserId } = this.minter(userId);
+    const { accessToken } = this.get(tokenUserId);
+    return this.zakCache.getOrCompute(userId, () => this.zoom.generateZakToken(accessToken, zoomUserId));
+  }
+
+  /**
+   * Whose stored tokens act for userId at Zoom, and as which Zoom user: their
+   * own, as "me", or for a host who never connected the account admin's, as
+   * the host's email.
+   */
+  protected minter(userId: string): { tokenUserId: string; zoomUserId: string } {
+    if (!this.mintsForAccount(userId)) {
+      return { tokenUserId: userId, zoomUserId: "me" };
+    }
+    const admin = this.accountAdmin!;
+    const { scopes } = this.status(admin);
+    if (scopes !== null && !ACCOUNT_ISSUING_SCOPES.some((scope) => scopes.includes(scope))) {
+      throw new HttpError(403, `the access token of account admin ${admin} can't mint tokens for ${userId}, add ${ACCOUNT_ISSUING_SCOPES.join(" or ")} and re-authorize`);
+    }
+    return { tokenUserId: admin, zoomUserId: userId };
+  }
+
+  // Zoom takes an email wherever it takes a user ID, but user IDs handed out at consent are never emails
+  private mintsForAccount(userId: string): boolean {
+    return this.accountAdmin !== undefined && this.has(this.accountAdmin) && !this.has(userId) && userId.includes("@");
+  }
+}
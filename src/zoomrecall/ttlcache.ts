@@ -0,0 +1,129 @@
+export type EvictionReason = "expired" | "capacity" | "deleted";
+
+export interface TtlCacheHooks {
+  onHit?(key: string): void;
+  onMiss?(key: string): void;
+  onEvict?(key: string, reason: EvictionReason): void;
+}
+
+export interface TtlCacheOptions {
+  ttlMs: number;
+  maxEntries?: number;
+  hooks?: TtlCacheHooks;
+  now?: () => number;
+}
+
+interface Entry<V> {
+  value: V;
+  expiresAt: number;
+}
+
+/**
+ * A small in-memory cache whose entries expire after a fixed TTL. When
+ * maxEntries is reached the least recently used entry is evicted.
+ * getOrCompute shares one in-flight computation between concurrent callers
+ * for the same key.
+ */
+export class TtlCache<V> {
+  private readonly ttlMs: number;
+  private readonly maxEntries: number;
+  private readonly hooks: TtlCacheHooks;
+  private readonly now: () => number;
+  private readonly entries = new Map<string, Entry<V>>();
+  private readonly inflight = new Map<string, Promise<V>>();
+
+  constructor(options: TtlCacheOptions) {
+    this.ttlMs = options.ttlMs;
+    this.maxEntries = options.maxEntries ?? Infinity;
+    this.hooks = options.hooks ?? {};
+    this.now = options.now ?? Date.now;
+  }
+
+  get size(): number {
+    return this.entries.size;
+  }
+
+  get(key: string): V | undefined {
+    const entry = this.entries.get(key);
+    if (!entry) {
+      this.hooks.onMiss?.(key);
+      return undefined;
+    }
+    if (entry.expiresAt <= this.now()) {
+      this.entries.delete(key);
+      this.hooks.onEvict?.(key, "expired");
+      this.hooks.onMiss?.(key);
+      return undefined;
+    }
+
+    // re-insert so the map's iteration order tracks recency of use
+    this.entries.delete(key);
+    this.entries.set(key, entry);
+    this.hooks.onHit?.(key);
+    return entry.value;
+  }
+
+  set(key: string, value: V, ttlMs: number = this.ttlMs): void {
+    if (ttlMs <= 0) return;
+
+    this.entries.delete(key);
+    this.entries.set(key, { value, expiresAt: this.now() + ttlMs });
+    while (this.entries.size > this.maxEntries) {
+      const oldest = this.entries.keys().next().value as string;
+      this.entries.delete(oldest);
+      this.hooks.onEvict?.(oldest, "capacity");
+    }
+  }
+
+  delete(key: string): void {
+    if (this.entries.delete(key)) {
+      this.hooks.onEvict?.(key, "deleted");
+    }
+  }
+
+  deleteMatching(predicate: (key: string) => boolean): void {
+    for (const key of [...this.entries.keys()]) {
+      if (predicate(key)) {
+        this.delete(key);
+      }
+    }
+  }
+
+  clear(): void {
+    for (const key of [...this.entries.keys()]) {
+      this.delete(key);
+    }
+  }
+
+  async getOrCompute(key: string, compute: () => Promise<V>, ttlMs: number = this.ttlMs): Promise<V> {
+    const cached = this.get(key);
+    if (cached !== undefined) return cached;
+
+    const pending = this.inflight.get(key);
+    if (pending) return pending;
+
+    const promise = compute()
+      .then((value) => {
+        this.set(key, value, ttlMs);
+        return value;
+      })
+      .finally(() => {
+        this.inflight.delete(key);
+      });
+    this.inflight.set(key, promise);
+    return promise;
+  }
+
+  purgeExpired(): number {
+    const now = this.now();
+    let purged = 0;
+    for (const [key, entry] of this.entries) {
+      if (entry.expiresAt <= now) {
+        this.entries.delete(key);
+        this.hooks.onEvict?.(key, "expired");
+        purged++;
+      }
+    }
+    return purged;
+  }
+}
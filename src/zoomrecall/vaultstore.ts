@@ -0,0 +1,163 @@
+import { readFile } from "fs/promises";
+import type { HttpClient } from "./http.js";
+import type { StoredTokens, StoredTokensJSON, TokenStore } from "./store.js";
+import { storedTokensFromJSON, storedTokensJSON } from "./store.js";
+
+export const DEFAULT_VAULT_KV_MOUNT = "secret";
+export const DEFAULT_VAULT_PATH_PREFIX = "zoom-oauth";
+export const DEFAULT_VAULT_KUBERNETES_AUTH_PATH = "kubernetes";
+export const DEFAULT_VAULT_KUBERNETES_TOKEN_PATH = "/var/run/secrets/kubernetes.io/serviceaccount/token";
+
+// logs in again this long before a Kubernetes login's token expires
+const VAULT_LOGIN_MARGIN_MS = 30 * 1000;
+
+export class VaultError extends Error {
+  readonly status: number;
+
+  constructor(status: number, message: string) {
+    super(message);
+    this.name = "VaultError";
+    this.status = status;
+  }
+}
+
+// a fixed Vault token, or a login with the pod's service account token against a Vault role
+export type VaultAuth =
+  | { method: "token"; token: string }
+  | { method: "kubernetes"; role: string; authPath?: string; serviceAccountTokenPath?: string };
+
+export interface VaultTokenStoreOptions {
+  // e.g. https://vault.internal:8200
+  address: string;
+  auth: VaultAuth;
+  // the KV version 2 secrets engine users are kept in
+  kvMount?: string;
+  pathPrefix?: string;
+  // Vault Enterprise namespace, sent as X-Vault-Namespace
+  namespace?: string;
+  httpClient: HttpClient;
+}
+
+interface VaultLogin {
+  token: string;
+  // null for tokens that don't expire
+  expiresAt: number | null;
+}
+
+/**
+ * Keeps token managers' users in a HashiCorp Vault KV version 2 secrets
+ * engine, one secret per user at <mount>/<prefix>/<provider>/<user ID>, for
+ * environments where credentials have to live in Vault. Authenticates with
+ * a Vault token or, on Kubernetes, by logging in with the pod's service
+ * account token, logging in again before that login expires. Removing a
+ * user deletes every version of their secret.
+ */
+export class VaultTokenStore implements TokenStore {
+  readonly path: string;
+  private readonly address: string;
+  private readonly auth: VaultAuth;
+  private readonly kvMount: string;
+  private readonly pathPrefix: string;
+  private readonly namespace: string | undefined;
+  private readonly httpClient: HttpClient;
+  private login: Promise<VaultLogin> | null = null;
+
+  constructor(options: VaultTokenStoreOptions) {
+    this.address = options.address.replace(/\/+$/, "");
+    this.auth = options.auth;
+    this.kvMount = (options.kvMount ?? DEFAULT_VAULT_KV_MOUNT).replace(/^\/+|\/+$/g, "");
+    this.pathPrefix = (options.pathPrefix ?? DEFAULT_VAULT_PATH_PREFIX).replace(/^\/+|\/+$/g, "");
+    this.namespace = options.namespace || undefined;
+    this.httpClient = options.httpClient;
+    this.path = `${this.address}/${this.kvMount}/${this.pathPrefix}`;
+  }
+
+  async list(provider: string): Promise<StoredTokens[]> {
+    const listed = await this.request<{ data: { keys: string[] } }>("GET", `metadata/${this.secretPath(provider)}?list=true`);
+    const users: StoredTokens[] = [];
+    // keys ending in a slash are folders, which this store never creates
+    for (const key of listed?.data.keys.filter((candidate) => !candidate.endsWith("/")) ?? []) {
+      const user = await this.get(provider, decodeURIComponent(key));
+      if (user) users.push(user);
+    }
+    return users;
+  }
+
+  async get(provider: string, userId: string): Promise<StoredTokens | null> {
+    const secret = await this.request<{ data: { data: StoredTokensJSON } }>("GET", `data/${this.secretPath(provider, userId)}`);
+    return secret ? storedTokensFromJSON(secret.data.data) : null;
+  }
+
+  async save(provider: string, user: StoredTokens): Promise<void> {
+    await this.request("POST", `data/${this.secretPath(provider, user.userId)}`, { data: storedTokensJSON(user) });
+  }
+
+  async delete(provider: string, userId: string): Promise<void> {
+    await this.request("DELETE", `metadata/${this.secretPath(provider, userId)}`);
+  }
+
+  private secretPath(provider: string, userId?: string): string {
+    const path = `${this.pathPrefix}/${encodeURIComponent(provider)}`;
+    return userId === undefined ? path : `${path}/${encodeURIComponent(userId)}`;
+  }
+
+  // the parsed response, or null when Vault has nothing at path
+  private async request<T>(method: string, path: string, body?: unknown, retried = false): Promise<T | null> {
+    const { token } = await this.token();
+    const response = await this.httpClient(`${this.address}/v1/${this.kvMount}/${path}`, {
+      method,
+      headers: { ...this.headers(), "X-Vault-Token": token, ...(body === undefined ? {} : { "Content-Type": "application/json" }) },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (response.status === 404) return null;
+    // a Kubernetes login can be revoked before it expires; a fixed token can't be renewed by logging in
+    if (response.status === 403 && this.auth.method === "kubernetes" && !retried) {
+      this.login = null;
+      return this.request<T>(method, path, body, true);
+    }
+    if (!response.ok) {
+      throw new VaultError(response.status, `vault answered ${response.status} to ${method} ${path}: ${await vaultErrors(response)}`);
+    }
+    return response.status === 204 ? null : ((await response.json()) as T);
+  }
+
+  private headers(): Record<string, string> {
+    return this.namespace ? { "X-Vault-Namespace": this.namespace } : {};
+  }
+
+  private async token(): Promise<VaultLogin> {
+    if (this.auth.method === "token") return { token: this.auth.token, expiresAt: null };
+    const current = this.login && (await this.login.catch(() => null));
+    if (current && (current.expiresAt === null || current.expiresAt - VAULT_LOGIN_MARGIN_MS > Date.now())) {
+      return current;
+    }
+    this.login = this.logIn(this.auth);
+    return this.login;
+  }
+
+  private async logIn(auth: Extract<VaultAuth, { method: "kubernetes" }>): Promise<VaultLogin> {
+    const tokenPath = auth.serviceAccountTokenPath ?? DEFAULT_VAULT_KUBERNETES_TOKEN_PATH;
+    const jwt = (await readFile(tokenPath, "utf8")).trim();
+    const authPath = (auth.authPath ?? DEFAULT_VAULT_KUBERNETES_AUTH_PATH).replace(/^\/+|\/+$/g, "");
+    const response = await this.httpClient(`${this.address}/v1/auth/${authPath}/login`, {
+      method: "POST",
+      headers: { ...this.headers(), "Content-Type": "application/json" },
+      body: JSON.stringify({ role: auth.role, jwt }),
+    });
+    if (!response.ok) {
+      throw new VaultError(response.status, `vault kubernetes login as role ${auth.role} failed with ${response.status}: ${await vaultErrors(response)}`);
+    }
+    const { auth: login } = (await response.json()) as { auth: { client_token: string; lease_duration: number } };
+    return { token: login.client_token, expiresAt: login.lease_duration > 0 ? Date.now() + login.lease_duration * 1000 : null };
+  }
+}
+
+async function vaultErrors(response: Response): Promise<string> {
+  const text = await response.text();
+  try {
+    const { errors } = JSON.parse(text) as { errors?: string[] };
+    return errors && errors.length > 0 ? errors.join("; ") : text;
+  } catch {
+    return text;
+  }
+}
@@ -0,0 +1,410 @@
+import { errorFromZoomResponse, MeetingNotFoundError } from "./errors.js";
+import type { HttpClient } from "./http.js";
+
+export const DEFAULT_ZOOM_OAUTH_BASE_URL = "https://zoom.us";
+export const DEFAULT_ZOOM_API_BASE_URL = "https://api.zoom.us/v2";
+
+/**
+ * Normalizes a meeting ID typed by a human ("123 4567 8901", "123-4567-8901")
+ * to digits, returning undefined if it can't be a Zoom meeting ID.
+ */
+export function parseMeetingId(input: string): string | undefined {
+  const digits = input.replace(/[\s-]/g, "");
+  return /^\d{9,12}$/.test(digits) ? digits : undefined;
+}
+
+/**
+ * Picks the occurrence of a recurring meeting bots are joining: occurrenceId
+ * if given, otherwise the first that hasn't ended by now. Undefined for
+ * meetings that aren't recurring and for recurring ones without a fixed
+ * time, which can be joined whenever. Throws MeetingNotFoundError when there
+ * is no such occurrence, or none still to come, since a token minted for a
+ * meeting that isn't on fails confusingly at join time.
+ */
+export function resolveOccurrence(meeting: ZoomMeeting, occurrenceId?: string, now: Date = new Date()): ZoomOccurrence | undefined {
+  if (!meeting.recurring || meeting.occurrences.length === 0) {
+    if (occurrenceId !== undefined) {
+      throw new MeetingNotFoundError(`meeting ${meeting.id} has no occurrence ${occurrenceId}`);
+    }
+    return undefined;
+  }
+  const live = meeting.occurrences.filter((occurrence) => occurrence.status !== "deleted");
+  if (occurrenceId !== undefined) {
+    const occurrence = live.find((candidate) => candidate.id === occurrenceId);
+    if (!occurrence) {
+      throw new MeetingNotFoundError(`meeting ${meeting.id} has no occurrence ${occurrenceId}`);
+    }
+    return occurrence;
+  }
+  const upcoming = live.find((occurrence) => occurrence.startTime.getTime() + (occurrence.durationMinutes ?? 0) * 60 * 1000 > now.getTime());
+  if (!upcoming) {
+    throw new MeetingNotFoundError(`recurring meeting ${meeting.id} has no upcoming occurrence`);
+  }
+  return upcoming;
+}
+
+/** Returns the meeting ID in a Zoom join link such as https://zoom.us/j/123456789?pwd=..., if there is one. */
+export function meetingIdFromUrl(meetingUrl: string): string | undefined {
+  let url: URL;
+  try {
+    url = new URL(meetingUrl);
+  } catch {
+    return undefined;
+  }
+  const match = /\/(?:j|w|s|wc(?:\/join)?)\/(\d{9,12})(?:\/|$)/.exec(url.pathname);
+  return match ? match[1] : parseMeetingId(url.searchParams.get("confno") ?? "");
+}
+
+/**
+ * What a Zoom meeting link points at: a meeting ID, or the vanity name of
+ * a personal link such as https://zoom.us/my/jane, which leads to its
+ * owner's Personal Meeting ID.
+ */
+export function parseMeetingLink(meetingUrl: string): { meetingId: string } | { vanityName: string } | undefined {
+  const meetingId = meetingIdFromUrl(meetingUrl);
+  if (meetingId) return { meetingId };
+  let url: URL;
+  try {
+    url = new URL(meetingUrl);
+  } catch {
+    return undefined;
+  }
+  const vanityName = /^\/my\/([\w.-]+)\/?$/.exec(url.pathname)?.[1];
+  return vanityName ? { vanityName: vanityName.toLowerCase() } : undefined;
+}
+
+export interface OAuthTokens {
+  accessToken: string;
+  refreshToken: string;
+  // lifetime of the access token in seconds
+  expiresIn: number;
+  // what the provider says the access token is good for; undefined if it didn't say
+  scopes?: string[];
+  // e.g. "bearer"
+  tokenType?: string;
+  // the API base URL the token is for, which Zoom returns with every token
+  apiUrl?: string;
+}
+
+/** Splits an OAuth `scope` field, which Zoom sometimes comma-separates, into scopes. */
+export function parseScopes(scope: string | undefined): string[] | undefined {
+  return scope === undefined ? undefined : scope.split(/[\s,]+/).filter(Boolean);
+}
+
+interface OAuthTokenResponse {
+  access_token: string;
+  token_type: string;
+  refresh_token: string;
+  expires_in: number;
+  scope: string;
+  api_url: string;
+}
+
+interface TokenResponse {
+  token: string;
+}
+
+export interface ZoomUser {
+  id: string;
+  email: string;
+  // the Zoom account the user belongs to
+  accountId: string | undefined;
+  // "active", "inactive" (deactivated) or "pending"
+  status: string;
+  // IANA time zone from the user's Zoom profile, e.g. "America/New_York"
+  timezone: string | undefined;
+  // the display name, or first and last name
+  name: string | undefined;
+  // the Personal Meeting ID, and the name of the personal link taking its place, e.g. "jane" for zoom.us/my/jane
+  pmi: string | undefined;
+  vanityName: string | undefined;
+}
+
+export interface ZoomOccurrence {
+  id: string;
+  startTime: Date;
+  durationMinutes: number | undefined;
+  // "available" or "deleted"
+  status: string | undefined;
+}
+
+export interface ZoomMeeting {
+  id: string;
+  hostId: string;
+  hostEmail: string | undefined;
+  topic: string;
+  // unset for instant meetings and recurring meetings without a fixed time
+  startTime: Date | undefined;
+  timezone: string | undefined;
+  durationMinutes: number | undefined;
+  // "waiting" or "started"
+  status: string | undefined;
+  registrationRequired: boolean;
+  waitingRoom: boolean;
+  joinBeforeHost: boolean;
+  // Zoom only shows it to the host and admins; unset for meetings without one
+  passcode: string | undefined;
+  recurring: boolean;
+  // of a recurring meeting with a fixed time, in order; recurring meetings without one have none
+  occurrences: ZoomOccurrence[];
+}
+
+interface MeetingResponse {
+  id: number;
+  // 1 instant, 2 scheduled, 3 recurring without a fixed time, 8 recurring with one
+  type?: number;
+  host_id: string;
+  host_email?: string;
+  topic?: string;
+  start_time?: string;
+  timezone?: string;
+  duration?: number;
+  status?: string;
+  registration_url?: string;
+  password?: string;
+  occurrences?: { occurrence_id: string; start_time: string; duration?: number; status?: string }[];
+  settings?: {
+    // 0 and 1 mean attendees register (automatically or manually approved), 2 means no registration
+    approval_type?: number;
+    waiting_room?: boolean;
+    join_before_host?: boolean;
+  };
+}
+
+export interface ZoomClientOptions {
+  clientId: string;
+  clientSecret: string;
+  redirectUri: string;
+  oauthBaseUrl?: string;
+  apiBaseUrl?: string;
+  httpClient?: HttpClient;
+}
+
+export class ZoomClient {
+  private readonly clientId: string;
+  private readonly clientSecret: string;
+  private readonly redirectUri: string;
+  private readonly oauthBaseUrl: string;
+  private readonly apiBaseUrl: string;
+  private readonly httpClient: HttpClient;
+
+  constructor(options: ZoomClientOptions) {
+    this.clientId = options.clientId;
+    this.clientSecret = options.clientSecret;
+    this.redirectUri = options.redirectUri;
+    this.oauthBaseUrl = options.oauthBaseUrl ?? DEFAULT_ZOOM_OAUTH_BASE_URL;
+    this.apiBaseUrl = options.apiBaseUrl ?? DEFAULT_ZOOM_API_BASE_URL;
+    this.httpClient = options.httpClient ?? fetch;
+  }
+
+  // codeChallenge is the S256 PKCE challenge of the verifier the code will be exchanged with
+  authorizeUrl(state?: string, codeChallenge?: string): string {
+    let url = `${this.oauthBaseUrl}/oauth/authorize?response_type=code&client_id=${this.clientId}&redirect_uri=${encodeURIComponent(this.redirectUri)}`;
+    if (state !== undefined) url += `&state=${encodeURIComponent(state)}`;
+    if (codeChallenge !== undefined) url += `&code_challenge=${encodeURIComponent(codeChallenge)}&code_challenge_method=S256`;
+    return url;
+  }
+
+  async exchangeCode(authCode: string, codeVerifier?: string): Promise<OAuthTokens> {
+    const params = new URLSearchParams({
+      grant_type: "authorization_code",
+      code: authCode,
+      redirect_uri: this.redirectUri,
+    });
+    if (codeVerifier !== undefined) params.set("code_verifier", codeVerifier);
+    return this.requestToken(params);
+  }
+
+  async refreshToken(refreshToken: string): Promise<OAuthTokens> {
+    return this.requestToken(
+      new URLSearchParams({
+        grant_type: "refresh_token",
+        refresh_token: refreshToken,
+      }),
+    );
+  }
+
+  /**
+   * Gets a Server-to-Server OAuth app's access token for accountId with the
+   * account_credentials grant. There is no refresh token; a new access token
+   * is got the same way.
+   */
+  async requestAccountToken(accountId: string): Promise<OAuthTokens> {
+    const tokens = await this.requestToken(new URLSearchParams({ grant_type: "account_credentials", account_id: accountId }));
+    return { ...tokens, refreshToken: "" };
+  }
+
+  // zoomUserId is "me" for the token's own user, or, with an admin scope, any user of its account by ID or email
+  async generateObfToken(accessToken: string, meetingId?: string, zoomUserId: string = "me"): Promise<string> {
+    return this.requestUserToken(accessToken, "onbehalf", meetingId, zoomUserId);
+  }
+
+  async generateZakToken(accessToken: string, zoomUserId: string = "me"): Promise<string> {
+    return this.requestUserToken(accessToken, "zak", undefined, zoomUserId);
+  }
+
+  /** Fetches the user an access token belongs to. */
+  async getCurrentUser(accessToken: string): Promise<ZoomUser> {
+    return this.getUser(accessToken, "me");
+  }
+
+  /** Fetches a user by ID or email; other users than "me" need user:read:admin. */
+  async getUser(accessToken: string, zoomUserId: string): Promise<ZoomUser> {
+    const response = await this.httpClient(`${this.apiBaseUrl}/users/${encodeURIComponent(zoomUserId)}`, {
+      headers: { Authorization: `Bearer ${accessToken}` },
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+
+    const data = (await response.json()) as {
+      id: string;
+      email: string;
+      account_id?: string;
+      status: string;
+      timezone?: string;
+      display_name?: string;
+      first_name?: string;
+      last_name?: string;
+      pmi?: number;
+      vanity_url?: string;
+    };
+    const personalLink = data.vanity_url ? parseMeetingLink(data.vanity_url) : undefined;
+    return {
+      id: data.id,
+      email: data.email,
+      accountId: data.account_id || undefined,
+      status: data.status,
+      timezone: data.timezone || undefined,
+      name: data.display_name || [data.first_name, data.last_name].filter(Boolean).join(" ") || undefined,
+      pmi: data.pmi ? String(data.pmi) : undefined,
+      vanityName: personalLink && "vanityName" in personalLink ? personalLink.vanityName : undefined,
+    };
+  }
+
+  /** Fetches a meeting's details; needs a token of its host, or of an admin with meeting:read:admin. */
+  async getMeeting(accessToken: string, meetingId: string): Promise<ZoomMeeting> {
+    const response = await this.httpClient(`${this.apiBaseUrl}/meetings/${encodeURIComponent(meetingId)}`, {
+      headers: { Authorization: `Bearer ${accessToken}` },
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+
+    const data = (await response.json()) as MeetingResponse;
+    const approvalType = data.settings?.approval_type;
+    return {
+      id: String(data.id),
+      hostId: data.host_id,
+      hostEmail: data.host_email,
+      topic: data.topic ?? "",
+      startTime: data.start_time ? new Date(data.start_time) : undefined,
+      timezone: data.timezone,
+      durationMinutes: data.duration,
+      status: data.status,
+      registrationRequired: approvalType === 0 || approvalType === 1 || data.registration_url !== undefined,
+      waitingRoom: data.settings?.waiting_room ?? false,
+      joinBeforeHost: data.settings?.join_before_host ?? false,
+      passcode: data.password || undefined,
+      recurring: data.type === 3 || data.type === 8,
+      occurrences: (data.occurrences ?? []).map((occurrence) => ({
+        id: String(occurrence.occurrence_id),
+        startTime: new Date(occurrence.start_time),
+        durationMinutes: occurrence.duration,
+        status: occurrence.status,
+      })),
+    };
+  }
+
+  /**
+   * Turns a meeting's waiting room on or off; needs meeting:write, or
+   * meeting:write:admin for other users' meetings. Turning it off during the
+   * meeting admits everyone waiting.
+   */
+  async setWaitingRoom(accessToken: string, meetingId: string, enabled: boolean): Promise<void> {
+    const response = await this.httpClient(`${this.apiBaseUrl}/meetings/${encodeURIComponent(meetingId)}`, {
+      method: "PATCH",
+      headers: { "Content-Type": "application/json", Authorization: `Bearer ${accessToken}` },
+      body: JSON.stringify({ settings: { waiting_room: enabled } }),
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+  }
+
+  /**
+   * Admits one participant of a live meeting from its waiting room, leaving
+   * everyone else waiting; participantId is the user_id Zoom's participant
+   * webhooks give. Needs the host's meeting:write, or meeting:write:admin.
+   */
+  async admitParticipant(accessToken: string, meetingId: string, participantId: string): Promise<void> {
+    const response = await this.httpClient(
+      `${this.apiBaseUrl}/live_meetings/${encodeURIComponent(meetingId)}/participants/${encodeURIComponent(participantId)}/status`,
+      {
+        method: "PATCH",
+        headers: { "Content-Type": "application/json", Authorization: `Bearer ${accessToken}` },
+        body: JSON.stringify({ action: "admit" }),
+      },
+    );
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+  }
+
+  /** Revokes an access token (and with it the app's authorization) at Zoom. */
+  async revokeToken(accessToken: string): Promise<void> {
+    const response = await this.httpClient(`${this.oauthBaseUrl}/oauth/revoke`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/x-www-form-urlencoded",
+        Authorization: this.authorizationHeader(),
+      },
+      body: new URLSearchParams({ token: accessToken }).toString(),
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+  }
+
+  private authorizationHeader(): string {
+    const credentials = Buffer.from(`${this.clientId}:${this.clientSecret}`).toString("base64");
+    return `Basic ${credentials}`;
+  }
+
+  private async requestToken(params: URLSearchParams): Promise<OAuthTokens> {
+    const response = await this.httpClient(`${this.oauthBaseUrl}/oauth/token`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/x-www-form-urlencoded",
+        Authorization: this.authorizationHeader(),
+      },
+      body: params.toString(),
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+
+    const data = (await response.json()) as OAuthTokenResponse;
+    return {
+      accessToken: data.access_token,
+      refreshToken: data.refresh_token,
+      expiresIn: data.expires_in,
+      scopes: parseScopes(data.scope),
+      tokenType: data.token_type,
+      apiUrl: data.api_url,
+    };
+  }
+
+  private async requestUserToken(accessToken: string, type: "onbehalf" | "zak", meetingId: string | undefined, zoomUserId: string): Promise<string> {
+    const query = meetingId === undefined ? `type=${type}` : `type=${type}&meeting_id=${encodeURIComponent(meetingId)}`;
+    const response = await this.httpClient(`${this.apiBaseUrl}/users/${encodeURIComponent(zoomUserId)}/token?${query}`, {
+      headers: { Authorization: `Bearer ${accessToken}` },
+    });
+    if (!response.ok) {
+      throw await errorFromZoomResponse(response);
+    }
+
+    const data = (await response.json()) as TokenResponse;
+    return data.token;
+  }
+}
@@ -0,0 +1,129 @@
+import { createHmac, timingSafeEqual } from "crypto";
+import express from "express";
+import type { DeadLetters } from "./deadletters.js";
+import type { RecordingIngest, ZoomRecording } from "./recordings.js";
+import { HttpError } from "./zoomrecall/index.js";
+import type { TokenManager, WaitingRoomAdmitter } from "./zoomrecall/index.js";
+import { writeError, writeJSON } from "./zoomrecall/httpx.js";
+
+const MAX_WEBHOOK_AGE_SECONDS = 5 * 60;
+// events after which a user's tokens should no longer be served
+const DEACTIVATION_EVENTS = new Set(["user.deactivated", "user.deleted", "user.disassociated"]);
+const WAITING_EVENTS = new Set(["meeting.participant_joined_waiting_room", "meeting.participant_put_in_waiting_room"]);
+
+interface WebhookRequest extends express.Request {
+  rawBody?: Buffer;
+}
+
+interface ZoomWebhook {
+  event?: string;
+  payload?: {
+    plainToken?: string;
+    object?: {
+      // a user ID for user events, a meeting ID (sometimes a number) for meeting events
+      id?: string | number;
+      host_id?: string;
+      participant?: { user_name?: string; participant_uuid?: string; user_id?: string; id?: string };
+    } & ZoomRecording;
+  };
+}
+
+async function handleMeetingEvent(admitter: WaitingRoomAdmitter, event: string, object: NonNullable<ZoomWebhook["payload"]>["object"]): Promise<void> {
+  const meetingId = object?.id === undefined ? "" : String(object.id);
+  if (!meetingId) return;
+  const participant = object?.participant ?? {};
+  const participantKey = participant.participant_uuid ?? participant.user_id ?? participant.id ?? participant.user_name ?? "";
+  const name = participant.user_name ?? "";
+
+  if (WAITING_EVENTS.has(event)) {
+    await admitter.participantWaiting({ meetingId, hostZoomUserId: object?.host_id ?? "", participantKey, participantId: participant.user_id ?? "", name });
+  }
+}
+
+/** Does what a verified Zoom webhook asks for; what deadLetters replays. */
+async function processZoomWebhook(
+  tokens: TokenManager,
+  admitter: WaitingRoomAdmitter | undefined,
+  recordings: RecordingIngest | undefined,
+  body: ZoomWebhook,
+): Promise<void> {
+  const { event, payload = {} } = body;
+  const zoomUserId = payload.object?.id === undefined ? "" : String(payload.object.id);
+  if (event && DEACTIVATION_EVENTS.has(event) && zoomUserId) {
+    const deactivated = tokens.deactivateZoomUser(zoomUserId, `zoom sent ${event}`);
+    console.log(`zoom ${event} for ${zoomUserId} deactivated ${deactivated.length} user(s)`);
+  } else if (event === "recording.completed" && recordings && payload.object) {
+    await recordings.completed(payload.object);
+  } else if (event?.startsWith("meeting.") && admitter) {
+    await handleMeetingEvent(admitter, event, payload.object);
+  }
+}
+
+/** Checks the `x-zm-signature` of a Zoom webhook: `v0=` hex HMAC-SHA256 over `v0:${timestamp}:${body}`. */
+export function verifyZoomWebhook(
+  secretToken: string,
+  timestamp: string | undefined,
+  signature: string | undefined,
+  rawBody: Buffer,
+  now: number = Date.now(),
+): boolean {
+  if (!timestamp || !signature || Math.abs(now / 1000 - Number(timestamp)) > MAX_WEBHOOK_AGE_SECONDS) {
+    return false;
+  }
+  const expected = `v0=${createHmac("sha256", secretToken).update(`v0:${timestamp}:`).update(rawBody).digest("hex")}`;
+  return expected.length === signature.length && timingSafeEqual(Buffer.from(expected), Buffer.from(signature));
+}
+
+export interface ZoomWebhookRouterOptions {
+  secretToken: string;
+  tokens: TokenManager;
+  // lets bots through the waiting room when set; needs meeting.participant_joined_waiting_room
+  admitter?: WaitingRoomAdmitter;
+  // takes in connected hosts' cloud recordings when set; needs the recording.completed event
+  recordings?: RecordingIngest;
+  // keeps webhooks whose processing failed for replay
+  deadLetters: DeadLetters;
+}
+
+/**
+ * Receives Zoom event notifications, answering Zoom's endpoint validation
+ * challenge, deactivating users Zoom reports as deactivated or removed and,
+ * with an admitter, passing meeting participant events to it and, with
+ * recordings, completed cloud recordings to that. Events whose
+ * processing fails are kept in deadLetters. Mount ahead of other body
+ * parsers.
+ */
+export function createZoomWebhookRouter(options: ZoomWebhookRouterOptions): express.Router {
+  const { secretToken, tokens, admitter, recordings, deadLetters } = options;
+  const router = express.Router();
+  deadLetters.register("zoom", (body) => processZoomWebhook(tokens, admitter, recordings, body as ZoomWebhook));
+
+  router.post(
+    "/",
+    express.json({
+      verify: (req, _res, buf) => {
+        (req as WebhookRequest).rawBody = buf;
+      },
+    }),
+    (req, res) => {
+      const timestamp = req.headers["x-zm-request-timestamp"] as string | undefined;
+      const signature = req.headers["x-zm-signature"] as string | undefined;
+      if (!verifyZoomWebhook(secretToken, timestamp, signature, (req as WebhookRequest).rawBody ?? Buffer.alloc(0))) {
+        writeError(req, res, new HttpError(401, "invalid zoom webhook signature"));
+        return;
+      }
+
+      const { event, payload = {} } = (req.body ?? {}) as ZoomWebhook;
+      if (event === "endpoint.url_validation") {
+        const plainToken = payload.plainToken ?? "";
+        writeJSON(res, 200, { plainToken, encryptedToken: createHmac("sha256", secretToken).update(plainToken).digest("hex") });
+        return;
+      }
+      // zoom wants an answer within 3 seconds, so zoom API calls finish after responding; failures become dead letters
+      void deadLetters.process("zoom", req.body ?? {});
+      writeJSON(res, 200, { received: true });
+    },
+  );
+
+  return router;
+}